@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"crypto/ecdh"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"flag"
 	"fmt"
 	"net"
@@ -19,14 +21,28 @@ import (
 	logruslogger "github.com/virtual-kubelet/virtual-kubelet/log/logrus"
 	"github.com/virtual-kubelet/virtual-kubelet/trace"
 	"github.com/virtual-kubelet/virtual-kubelet/trace/opentelemetry"
+	"golang.org/x/sync/errgroup"
 
 	"github.com/interlink-hq/interlink/pkg/interlink"
 	"github.com/interlink-hq/interlink/pkg/interlink/api"
+	"github.com/interlink-hq/interlink/pkg/interlink/audit"
+	"github.com/interlink-hq/interlink/pkg/interlink/auth"
+	"github.com/interlink-hq/interlink/pkg/interlink/compression"
+	"github.com/interlink-hq/interlink/pkg/interlink/envelope"
+	"github.com/interlink-hq/interlink/pkg/interlink/jobscript"
+	"github.com/interlink-hq/interlink/pkg/interlink/logarchive"
 	ilpprof "github.com/interlink-hq/interlink/pkg/pprof"
 	"github.com/interlink-hq/interlink/pkg/virtualkubelet"
 	"k8s.io/cri-client/pkg/util"
 )
 
+const (
+	// criEndpoint is where the fake CRI runtime serves, for the kubelet tooling
+	criEndpoint = "unix:///tmp/kubelet_remote_1000.sock"
+	// defaultShutdownTimeout bounds the drain of the requests in flight on shutdown
+	defaultShutdownTimeout = 30 * time.Second
+)
+
 // UnixSocketRoundTripper is a custom RoundTripper for Unix socket connections
 type UnixSocketRoundTripper struct {
 	Transport http.RoundTripper
@@ -85,6 +101,265 @@ func createTLSConfig(ctx context.Context, tlsConfig interlink.TLSConfig) (*tls.C
 	return config, nil
 }
 
+// newSidecarClient returns the endpoint and the HTTP client used to reach a sidecar plugin
+// listening either on a unix socket (unix://) or on a TCP port (http://).
+func newSidecarClient(sidecarURL, sidecarPort string) (string, *http.Client, error) {
+	sidecarEndpoint := ""
+	var socketPath string
+
+	switch {
+	case strings.HasPrefix(sidecarURL, "unix://"):
+		socketPath = strings.ReplaceAll(sidecarURL, "unix://", "")
+		sidecarEndpoint = "http+unix://"
+	case strings.HasPrefix(sidecarURL, "http://"):
+		sidecarEndpoint = sidecarURL + ":" + sidecarPort
+	default:
+		return "", nil, fmt.Errorf("sidecar URL should either start per unix:// or http://: getting %s", sidecarURL)
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   90 * time.Second,
+		KeepAlive: 90 * time.Second,
+	}
+	transport := &http.Transport{
+		MaxConnsPerHost:     10000,
+		MaxIdleConnsPerHost: 1000,
+		IdleConnTimeout:     120 * time.Second,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if strings.HasPrefix(addr, "unix:") {
+				return dialer.DialContext(ctx, "unix", socketPath)
+			}
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+
+	// The response header timeout spares the follow-mode log streams, which plugins may
+	// only answer once the container writes something.
+	clientHTTP := &http.Client{
+		Transport: api.NewHeaderTimeoutTransport(&UnixSocketRoundTripper{
+			Transport: transport,
+		}, 120*time.Second),
+	}
+
+	return sidecarEndpoint, clientHTTP, nil
+}
+
+// newSidecarTransport wraps the transport of a sidecar client with compression (when enabled),
+// metrics, retries and circuit breaking.
+func newSidecarTransport(name string, transport http.RoundTripper, config interlink.Config) http.RoundTripper {
+	if config.Compression.Enabled {
+		transport = compression.NewTransport(transport, config.Compression, nil)
+	}
+	return api.NewSidecarTransport(name, api.InstrumentTransport(name, transport), config.SidecarRetry)
+}
+
+// loadSecretKey returns the public key the Secret data sent to a sidecar is encrypted with:
+// keyFile when set, the common SecretEncryption.PublicKeyFile otherwise. It returns nil when
+// Secret encryption is disabled, and fails when no key is configured for the sidecar.
+func loadSecretKey(config interlink.SecretEncryptionConfig, keyFile string) (*ecdh.PublicKey, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+	if keyFile == "" {
+		keyFile = config.PublicKeyFile
+	}
+	if keyFile == "" {
+		return nil, errors.New("secret encryption is enabled but no public key file is configured")
+	}
+	return envelope.LoadPublicKey(keyFile)
+}
+
+// reloadAdmission applies the Admission section of the config file again on every SIGHUP,
+// until ctx is canceled. The other settings need a restart.
+func reloadAdmission(ctx context.Context, path string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+
+		config, err := interlink.LoadConfigFile(path)
+		if err == nil {
+			err = api.ValidateAdmission(config)
+		}
+		if err != nil {
+			log.G(ctx).Error("Unable to reload the admission configuration from ", path, ", keeping the current one: ", err)
+			continue
+		}
+		api.Admission.Configure(config.Admission)
+		log.G(ctx).Info("Reloaded the admission configuration from ", path)
+	}
+}
+
+// startMetricsServer serves the Prometheus metrics on a separate listener in a background
+// goroutine, until ctx is canceled.
+func startMetricsServer(ctx context.Context, addr string) {
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/metrics", api.MetricsHandler())
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           metricsMux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.G(ctx).Error("metrics server on ", addr, " shutdown error: ", err)
+		}
+	}()
+
+	go func() {
+		log.G(ctx).Infof("Starting metrics server on http://%s/metrics", addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.G(ctx).Error("metrics server on ", addr, " failed: ", err)
+		}
+	}()
+}
+
+// newAPIServer returns the API server for the configured InterlinkAddress, the function
+// serving it (blocking until the server is shut down) and, for unix:// addresses, the
+// socket file to remove on exit.
+func newAPIServer(ctx context.Context, config interlink.Config, handler http.Handler) (*http.Server, func() error, string, error) {
+	switch {
+	case strings.HasPrefix(config.InterlinkAddress, "unix://"):
+		socketPath := strings.ReplaceAll(config.InterlinkAddress, "unix://", "")
+
+		// Create a Unix domain socket and listen for incoming connections.
+		socket, err := net.Listen("unix", socketPath)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		server := &http.Server{
+			Handler: handler,
+		}
+
+		log.G(ctx).Info("Starting server on unix socket: ", socketPath)
+		return server, func() error { return server.Serve(socket) }, socketPath, nil
+	case strings.HasPrefix(config.InterlinkAddress, "http://"):
+		interLinkEndpoint := strings.ReplaceAll(config.InterlinkAddress, "http://", "") + ":" + config.Interlinkport
+
+		server := &http.Server{
+			Addr:              interLinkEndpoint,
+			Handler:           handler,
+			ReadTimeout:       30 * time.Second,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		log.G(ctx).Info("Starting HTTP server on: ", interLinkEndpoint)
+		return server, server.ListenAndServe, "", nil
+	case strings.HasPrefix(config.InterlinkAddress, "https://"):
+		interLinkEndpoint := strings.ReplaceAll(config.InterlinkAddress, "https://", "") + ":" + config.Interlinkport
+
+		// Create TLS configuration
+		tlsConfig, err := createTLSConfig(ctx, config.TLS)
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("failed to create TLS configuration: %w", err)
+		}
+
+		server := &http.Server{
+			Addr:              interLinkEndpoint,
+			Handler:           handler,
+			ReadTimeout:       30 * time.Second,
+			ReadHeaderTimeout: 10 * time.Second,
+			TLSConfig:         tlsConfig,
+		}
+
+		log.G(ctx).Info("Starting HTTPS server on: ", interLinkEndpoint)
+		if tlsConfig != nil && tlsConfig.ClientAuth == tls.RequireAndVerifyClientCert {
+			log.G(ctx).Info("mTLS enabled - requiring client certificates")
+		}
+
+		// Use ListenAndServeTLS with cert files from config
+		listen := func() error {
+			return server.ListenAndServeTLS(config.TLS.CertFile, config.TLS.KeyFile)
+		}
+		return server, listen, "", nil
+	default:
+		return nil, nil, "", fmt.Errorf("interlink URL should start with unix://, http://, or https://. Getting: %s", config.InterlinkAddress)
+	}
+}
+
+// runGroup runs the API server, the CRI endpoint and the pprof server (when not nil) until
+// ctx is canceled (SIGTERM/SIGINT) or the API server or the CRI endpoint fails. The API
+// server then stops accepting connections and drains the requests in flight for at most
+// drainTimeout, after which they are dropped. A pprof server that fails only logs it.
+func runGroup(ctx context.Context, server *http.Server, listen func() error, pprofServer *http.Server, drainTimeout time.Duration) error {
+	group, groupCtx := errgroup.WithContext(ctx)
+
+	if pprofServer != nil {
+		group.Go(func() error {
+			if err := pprofServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.G(ctx).Error("pprof server on ", pprofServer.Addr, " failed: ", err)
+			}
+			return nil
+		})
+		group.Go(func() error {
+			<-groupCtx.Done()
+			log.G(ctx).Info("Shutting down the pprof server on ", pprofServer.Addr)
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := pprofServer.Shutdown(shutdownCtx); err != nil {
+				log.G(ctx).Warn("pprof server on ", pprofServer.Addr, " shutdown error: ", err)
+				return pprofServer.Close()
+			}
+			return nil
+		})
+	}
+
+	group.Go(func() error {
+		if err := listen(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("API server failed: %w", err)
+		}
+		return nil
+	})
+
+	group.Go(func() error {
+		<-groupCtx.Done()
+		log.G(ctx).Info("Shutting down the API server, draining in-flight requests for at most ", drainTimeout)
+		drainCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+		defer cancel()
+		if err := server.Shutdown(drainCtx); err != nil {
+			log.G(ctx).Warn("Dropping the requests still in flight: ", err)
+			return server.Close()
+		}
+		return nil
+	})
+
+	group.Go(func() error {
+		interlinkRuntime := NewFakeRemoteRuntime()
+		if err := interlinkRuntime.Start(criEndpoint); err != nil {
+			return err
+		}
+		<-groupCtx.Done()
+		interlinkRuntime.Stop()
+		// clear endpoint file
+		if addr, _, err := util.GetAddressAndDialer(criEndpoint); err == nil {
+			if _, err := os.Stat(addr); err == nil {
+				os.Remove(addr)
+			}
+		}
+		return nil
+	})
+
+	return group.Wait()
+}
+
+// shutdownTimeout returns how long the requests in flight are drained on shutdown.
+func shutdownTimeout(config interlink.Config) time.Duration {
+	if config.ShutdownTimeoutSeconds > 0 {
+		return time.Duration(config.ShutdownTimeoutSeconds) * time.Second
+	}
+	return defaultShutdownTimeout
+}
+
 func main() {
 	printVersion := flag.Bool("version", false, "show version")
 	flag.Parse()
@@ -93,9 +368,6 @@ func main() {
 		fmt.Println(virtualkubelet.KubeletVersion)
 		return
 	}
-	var cancel context.CancelFunc
-	api.PodStatuses.Statuses = make(map[string]interlink.PodStatus)
-
 	interLinkConfig, err := interlink.NewInterLinkConfig()
 	if err != nil {
 		panic(err)
@@ -112,6 +384,10 @@ func main() {
 	log.L = logruslogger.FromLogrus(logrus.NewEntry(logger))
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	// signalCtx is canceled on SIGTERM/SIGINT and stops the run group. ctx outlives it,
+	// so that the requests being drained can still reach the sidecars.
+	signalCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	pprofAddr := interLinkConfig.Pprof.Address
 	if pprofAddr == "" {
@@ -121,18 +397,14 @@ func main() {
 	if pprofPort == "" {
 		pprofPort = "6061"
 	}
-	ilpprof.Start(ctx, interLinkConfig.Pprof.Enabled, pprofAddr+":"+pprofPort, "127.0.0.1:6061")
+	pprofServer := ilpprof.NewServer(interLinkConfig.Pprof.Enabled, pprofAddr+":"+pprofPort, "127.0.0.1:6061")
 
+	var shutdownTracer func(context.Context) error
 	if os.Getenv("ENABLE_TRACING") == "1" {
-		shutdown, err := interlink.InitTracer(ctx, "InterLink-Plugin-")
+		shutdownTracer, err = interlink.InitTracer(ctx, "InterLink-Plugin-")
 		if err != nil {
 			log.G(ctx).Fatal(err)
 		}
-		defer func() {
-			if err = shutdown(ctx); err != nil {
-				log.G(ctx).Fatal("failed to shutdown TracerProvider: %w", err)
-			}
-		}()
 
 		log.G(ctx).Info("Tracer setup succeeded")
 
@@ -141,145 +413,176 @@ func main() {
 
 	log.G(ctx).Info(interLinkConfig)
 
-	log.G(ctx).Info("interLink version: ", virtualkubelet.KubeletVersion)
+	err = api.InitPodStatuses(ctx, interLinkConfig)
+	if err != nil {
+		log.G(ctx).Fatal("Unable to open the pod status store: ", err)
+	}
 
-	sidecarEndpoint := ""
-	var socketPath string
+	log.G(ctx).Info("interLink version: ", virtualkubelet.KubeletVersion)
 
-	switch {
-	case strings.HasPrefix(interLinkConfig.Sidecarurl, "unix://"):
-		socketPath = strings.ReplaceAll(interLinkConfig.Sidecarurl, "unix://", "")
-		sidecarEndpoint = "http+unix://"
-	case strings.HasPrefix(interLinkConfig.Sidecarurl, "http://"):
-		sidecarEndpoint = interLinkConfig.Sidecarurl + ":" + interLinkConfig.Sidecarport
-	default:
-		log.G(ctx).Fatal("Sidecar URL should either start per unix:// or http://: getting ", interLinkConfig.Sidecarurl)
+	err = api.ValidateRouting(interLinkConfig)
+	if err != nil {
+		log.G(ctx).Fatal("Invalid sidecar routing configuration: ", err)
 	}
-
-	dialer := &net.Dialer{
-		Timeout:   90 * time.Second,
-		KeepAlive: 90 * time.Second,
+	if err := api.ValidateAdmission(interLinkConfig); err != nil {
+		log.G(ctx).Fatal("Invalid admission configuration: ", err)
 	}
-	transport := &http.Transport{
-		MaxConnsPerHost:       10000,
-		MaxIdleConnsPerHost:   1000,
-		IdleConnTimeout:       120 * time.Second,
-		ResponseHeaderTimeout: 120 * time.Second,
-		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-			if strings.HasPrefix(addr, "unix:") {
-				return dialer.DialContext(ctx, "unix", socketPath)
-			}
-			return dialer.DialContext(ctx, network, addr)
-		},
+	api.Admission.Configure(interLinkConfig.Admission)
+	if interLinkConfig.ConfigPath != "" {
+		go reloadAdmission(signalCtx, interLinkConfig.ConfigPath)
 	}
-
-	clientHTTP := &http.Client{
-		Transport: &UnixSocketRoundTripper{
-			Transport: transport,
-		},
+	if err := interLinkConfig.Compression.Validate(); err != nil {
+		log.G(ctx).Fatal("Invalid compression configuration: ", err)
 	}
 
 	interLinkAPIs := api.InterLinkHandler{
-		Config:          interLinkConfig,
-		Ctx:             ctx,
-		SidecarEndpoint: sidecarEndpoint,
-		ClientHTTP:      clientHTTP,
+		Config: interLinkConfig,
+		Ctx:    ctx,
 	}
 
-	mutex := http.NewServeMux()
-	mutex.HandleFunc("/status", interLinkAPIs.StatusHandler)
-	mutex.HandleFunc("/create", interLinkAPIs.CreateHandler)
-	mutex.HandleFunc("/delete", interLinkAPIs.DeleteHandler)
-	mutex.HandleFunc("/pinglink", interLinkAPIs.Ping)
-	mutex.HandleFunc("/getLogs", interLinkAPIs.GetLogsHandler)
-	mutex.HandleFunc("/updateCache", interLinkAPIs.UpdateCacheHandler)
-
-	interLinkEndpoint := ""
-	switch {
-	case strings.HasPrefix(interLinkConfig.InterlinkAddress, "unix://"):
-		interLinkEndpoint = interLinkConfig.InterlinkAddress
+	interLinkAPIs.JobScriptBuilder, err = api.NewJobScriptBuilderClient(interLinkConfig.JobScriptBuilder)
+	if err != nil {
+		log.G(ctx).Fatal("Invalid job script builder configuration: ", err)
+	}
 
-		// Create a Unix domain socket and listen for incoming connections.
-		socket, err := net.Listen("unix", strings.ReplaceAll(interLinkEndpoint, "unix://", ""))
+	if interLinkConfig.JobScriptTemplate != "" || interLinkConfig.JobScriptTemplateDir != "" {
+		interLinkAPIs.JobScripts, err = jobscript.NewEngine(interLinkConfig)
 		if err != nil {
-			panic(err)
-		}
-
-		// Cleanup the sockfile.
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-		go func() {
-			<-c
-			os.Remove(strings.ReplaceAll(interLinkEndpoint, "unix://", ""))
-			os.Exit(1)
-		}()
-		server := http.Server{
-			Handler: mutex,
+			log.G(ctx).Fatal("Invalid job script templates: ", err)
 		}
+		log.G(ctx).Info("Loaded job script templates: ", strings.Join(interLinkAPIs.JobScripts.Names(), ", "))
+		go interLinkAPIs.JobScripts.Watch(signalCtx, jobscript.ReloadInterval)
+	}
 
-		log.G(ctx).Info(socket)
-
-		if err := server.Serve(socket); err != nil {
+	if len(interLinkConfig.Sidecars) == 0 {
+		interLinkAPIs.SidecarEndpoint, interLinkAPIs.ClientHTTP, err = newSidecarClient(interLinkConfig.Sidecarurl, interLinkConfig.Sidecarport)
+		if err != nil {
 			log.G(ctx).Fatal(err)
 		}
-	case strings.HasPrefix(interLinkConfig.InterlinkAddress, "http://"):
-		interLinkEndpoint = strings.ReplaceAll(interLinkConfig.InterlinkAddress, "http://", "") + ":" + interLinkConfig.Interlinkport
-
-		server := http.Server{
-			Addr:              interLinkEndpoint,
-			Handler:           mutex,
-			ReadTimeout:       30 * time.Second,
-			ReadHeaderTimeout: 10 * time.Second,
-		}
-
-		err = server.ListenAndServe()
+		interLinkAPIs.ClientHTTP.Transport = newSidecarTransport("default", interLinkAPIs.ClientHTTP.Transport, interLinkConfig)
+		interLinkAPIs.SecretKey, err = loadSecretKey(interLinkConfig.SecretEncryption, "")
 		if err != nil {
-			log.G(ctx).Fatal(err)
+			log.G(ctx).Fatal("Unable to load the sidecar public key: ", err)
 		}
-	case strings.HasPrefix(interLinkConfig.InterlinkAddress, "https://"):
-		interLinkEndpoint = strings.ReplaceAll(interLinkConfig.InterlinkAddress, "https://", "") + ":" + interLinkConfig.Interlinkport
+	} else {
+		for _, sidecarConfig := range interLinkConfig.Sidecars {
+			endpoint, clientHTTP, err := newSidecarClient(sidecarConfig.URL, sidecarConfig.Port)
+			if err != nil {
+				log.G(ctx).Fatal("Sidecar ", sidecarConfig.Name, ": ", err)
+			}
+			clientHTTP.Transport = newSidecarTransport(sidecarConfig.Name, clientHTTP.Transport, interLinkConfig)
+			secretKey, err := loadSecretKey(interLinkConfig.SecretEncryption, sidecarConfig.SecretPublicKeyFile)
+			if err != nil {
+				log.G(ctx).Fatal("Sidecar ", sidecarConfig.Name, ": unable to load the public key: ", err)
+			}
+			interLinkAPIs.Sidecars = append(interLinkAPIs.Sidecars, &api.Sidecar{
+				Name:       sidecarConfig.Name,
+				Endpoint:   endpoint,
+				ClientHTTP: clientHTTP,
+				SecretKey:  secretKey,
+			})
+			log.G(ctx).Info("Registered sidecar ", sidecarConfig.Name, " at ", endpoint)
+		}
+	}
 
-		// Create TLS configuration
-		tlsConfig, err := createTLSConfig(ctx, interLinkConfig.TLS)
+	go interLinkAPIs.RefreshStatuses(ctx)
+
+	if interLinkConfig.LogArchive.Enabled {
+		interLinkAPIs.LogArchive, err = logarchive.New(interLinkConfig)
 		if err != nil {
-			log.G(ctx).Fatal("Failed to create TLS configuration: ", err)
+			log.G(ctx).Fatal("Unable to open the log archive: ", err)
 		}
+		go interLinkAPIs.ArchiveLogs(ctx)
+		log.G(ctx).Info("Archiving the logs of the completed pods")
+	}
 
-		server := http.Server{
-			Addr:              interLinkEndpoint,
-			Handler:           mutex,
-			ReadTimeout:       30 * time.Second,
-			ReadHeaderTimeout: 10 * time.Second,
-			TLSConfig:         tlsConfig,
-		}
+	mutex := http.NewServeMux()
+	for _, route := range interLinkAPIs.Routes() {
+		api.HandleVersioned(mutex, route)
+	}
+	log.G(ctx).Info("Serving interLink API versions: ", strings.Join(api.APIVersions(), ", "))
 
-		log.G(ctx).Info("Starting HTTPS server on: ", interLinkEndpoint)
-		if tlsConfig != nil && tlsConfig.ClientAuth == tls.RequireAndVerifyClientCert {
-			log.G(ctx).Info("mTLS enabled - requiring client certificates")
+	var apiHandler http.Handler = mutex
+	if interLinkConfig.Audit.Enabled {
+		apiHandler = audit.RecordIdentity(apiHandler)
+	}
+	if interLinkConfig.Auth.Enabled {
+		authenticator, err := auth.NewAuthenticator(ctx, interLinkConfig.Auth)
+		if err != nil {
+			log.G(ctx).Fatal("Unable to set up API authentication: ", err)
 		}
-
-		// Use ListenAndServeTLS with cert files from config
-		err = server.ListenAndServeTLS(interLinkConfig.TLS.CertFile, interLinkConfig.TLS.KeyFile)
+		apiHandler = authenticator.Middleware(apiHandler)
+		log.G(ctx).Info("API authentication enabled")
+	} else {
+		log.G(ctx).Warn("API authentication disabled: every caller reaching the interLink API is trusted")
+	}
+	// The audit middleware wraps authentication, so that rejected calls are audited too.
+	var auditLogger *audit.Logger
+	if interLinkConfig.Audit.Enabled {
+		auditLogger, err = audit.NewLogger(interLinkConfig)
 		if err != nil {
-			log.G(ctx).Fatal(err)
+			log.G(ctx).Fatal("Unable to open the audit log: ", err)
 		}
-	default:
-		log.G(ctx).Fatal("Interlink URL should start with unix://, http://, or https://. Getting: ", interLinkConfig.InterlinkAddress)
+		apiHandler = audit.Middleware(auditLogger, apiHandler)
+		log.G(ctx).Info("API audit log enabled")
+	}
+
+	if interLinkConfig.Metrics.Enabled {
+		if interLinkConfig.Metrics.Port == "" {
+			mutex.Handle("/metrics", api.MetricsHandler())
+			log.G(ctx).Info("Serving Prometheus metrics on the API server at /metrics")
+		} else {
+			metricsAddr := interLinkConfig.Metrics.Address
+			if metricsAddr == "" {
+				metricsAddr = "127.0.0.1"
+			}
+			startMetricsServer(signalCtx, metricsAddr+":"+interLinkConfig.Metrics.Port)
+		}
+		apiHandler = api.MetricsMiddleware(apiHandler)
 	}
 
-	interlinkRuntime := NewFakeRemoteRuntime()
-	err = interlinkRuntime.Start("unix:///tmp/kubelet_remote_1000.sock")
+	// Liveness and readiness probes bypass authentication, so that health checkers need no credentials.
+	probeMux := http.NewServeMux()
+	probeMux.HandleFunc("/healthz", interLinkAPIs.HealthzHandler)
+	probeMux.HandleFunc("/readyz", interLinkAPIs.ReadyzHandler)
+	probeMux.Handle("/", apiHandler)
+	apiHandler = compression.Middleware(interLinkConfig.Compression, probeMux)
+
+	server, listen, socketPath, err := newAPIServer(ctx, interLinkConfig, apiHandler)
 	if err != nil {
-		interlinkRuntime.Stop()
 		log.G(ctx).Fatal(err)
 	}
-	defer func() {
-		interlinkRuntime.Stop()
-		// clear endpoint file
-		if addr, _, err := util.GetAddressAndDialer("unix:///tmp/kubelet_remote_1000.sock"); err == nil {
-			if _, err := os.Stat(addr); err == nil {
-				os.Remove(addr)
-			}
+	// The /watch streams never go idle: end them so that the drain does not wait for them.
+	server.RegisterOnShutdown(api.CloseWatchers)
+
+	runErr := runGroup(signalCtx, server, listen, pprofServer, shutdownTimeout(interLinkConfig))
+
+	// Stop the background status refreshes before flushing traces and closing the store.
+	cancel()
+	if shutdownTracer != nil {
+		flushCtx, flushCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := shutdownTracer(flushCtx); err != nil {
+			log.G(ctx).Error("Failed to shutdown TracerProvider: ", err)
 		}
-	}()
+		flushCancel()
+	}
+	if err := api.ClosePodStatuses(); err != nil {
+		log.G(ctx).Error("Unable to close the pod status store: ", err)
+	}
+	if auditLogger != nil {
+		if err := auditLogger.Close(); err != nil {
+			log.G(ctx).Error("Unable to close the audit log: ", err)
+		}
+	}
+	if socketPath != "" {
+		if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+			log.G(ctx).Error("Unable to remove socket ", socketPath, ": ", err)
+		}
+	}
+
+	if runErr != nil {
+		log.G(ctx).Error(runErr)
+		os.Exit(1)
+	}
+	log.G(ctx).Info("interLink stopped")
 }
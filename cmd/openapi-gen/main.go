@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 
 	"github.com/interlink-hq/interlink/pkg/interlink"
 	"github.com/swaggest/openapi-go"
@@ -13,104 +14,82 @@ import (
 	corev1 "k8s.io/api/core/v1"
 )
 
-func main() {
-	version := flag.String("version", "0.4.0", "generate API spec for this version")
-	flag.Parse()
+// operation is an endpoint of the interLink API and its request and response structures.
+type operation struct {
+	method string
+	path   string
+	req    interface{}
+	resp   interface{}
+}
+
+// v1Operations describes the v1 API, which is also the wire format of the legacy unversioned paths.
+func v1Operations() []operation {
+	return []operation{
+		{method: http.MethodPost, path: "/create", req: new(interlink.PodCreateRequests), resp: new(interlink.RetrievedPodData)},
+		{method: http.MethodPost, path: "/delete", req: new(corev1.Pod), resp: nil},
+		{method: http.MethodPost, path: "/pinglink", req: nil, resp: new(interlink.PingResponse)},
+		{method: http.MethodPost, path: "/status", req: new([]corev1.Pod), resp: new([]interlink.PodStatus)},
+		{method: http.MethodPost, path: "/getLogs", req: new(interlink.LogStruct), resp: new(string)},
+		{method: http.MethodPost, path: "/validate", req: new(corev1.Pod), resp: new(interlink.ValidationResponse)},
+		{method: http.MethodPost, path: "/stats", req: new([]corev1.Pod), resp: new([]interlink.PodStats)},
+	}
+}
+
+// specs lists the generated files: the legacy unversioned paths, then one spec per API
+// version. A version whose wire types differ from v1 gets its own operations function.
+var specs = []struct {
+	file       string
+	prefix     string
+	operations func() []operation
+}{
+	{file: "interlink-openapi.json", prefix: "", operations: v1Operations},
+	{file: "interlink-openapi-" + interlink.APIVersionV1 + ".json", prefix: "/" + interlink.APIVersionV1, operations: v1Operations},
+}
 
+func buildSpec(version, prefix string, operations []operation) ([]byte, error) {
 	reflector := openapi3.Reflector{}
 	reflector.Spec = &openapi3.Spec{Openapi: "3.0.3"}
 	reflector.Spec.Info.
 		WithTitle("interLink server API").
-		WithVersion(*version).
+		WithVersion(version).
 		WithDescription("This is the API spec for the Virtual Kubelet to interLink API server communication")
 
-	createOp, err := reflector.NewOperationContext(http.MethodPost, "/create")
-	if err != nil {
-		panic(err)
-	}
-
-	// CREATE
-	createOp.AddReqStructure(new(interlink.PodCreateRequests))
-	createOp.AddRespStructure(new(interlink.RetrievedPodData), func(cu *openapi.ContentUnit) { cu.HTTPStatus = http.StatusOK })
+	for _, op := range operations {
+		opContext, err := reflector.NewOperationContext(op.method, prefix+op.path)
+		if err != nil {
+			return nil, err
+		}
 
-	err = reflector.AddOperation(createOp)
-	if err != nil {
-		panic(err)
-	}
+		opContext.AddReqStructure(op.req)
+		opContext.AddRespStructure(op.resp, func(cu *openapi.ContentUnit) { cu.HTTPStatus = http.StatusOK })
 
-	// DELETE
-	deleteOp, err := reflector.NewOperationContext(http.MethodPost, "/delete")
-	if err != nil {
-		panic(err)
+		err = reflector.AddOperation(opContext)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	deleteOp.AddReqStructure(new(corev1.Pod))
-	deleteOp.AddRespStructure(nil, func(cu *openapi.ContentUnit) { cu.HTTPStatus = http.StatusOK })
-
-	err = reflector.AddOperation(deleteOp)
-	if err != nil {
-		panic(err)
-	}
-
-	// Ping
-	pingOp, err := reflector.NewOperationContext(http.MethodPost, "/pinglink")
-	if err != nil {
-		panic(err)
-	}
-
-	pingOp.AddReqStructure(nil)
-	pingOp.AddRespStructure(new(interlink.PingResponse), func(cu *openapi.ContentUnit) { cu.HTTPStatus = http.StatusOK })
-
-	err = reflector.AddOperation(pingOp)
-	if err != nil {
-		panic(err)
-	}
-
-	// Status
-	statusOp, err := reflector.NewOperationContext(http.MethodPost, "/status")
-	if err != nil {
-		panic(err)
-	}
-
-	statusOp.AddReqStructure(new([]corev1.Pod))
-	statusOp.AddRespStructure(new([]interlink.PodStatus), func(cu *openapi.ContentUnit) { cu.HTTPStatus = http.StatusOK })
-
-	err = reflector.AddOperation(statusOp)
-	if err != nil {
-		panic(err)
-	}
-
-	// Logs
-	logsOp, err := reflector.NewOperationContext(http.MethodPost, "/getLogs")
-	if err != nil {
-		panic(err)
-	}
-
-	logsOp.AddReqStructure(new(interlink.LogStruct))
-	logsOp.AddRespStructure(new(string), func(cu *openapi.ContentUnit) { cu.HTTPStatus = http.StatusOK })
+	return reflector.Spec.MarshalJSON()
+}
 
-	err = reflector.AddOperation(logsOp)
-	if err != nil {
-		panic(err)
-	}
+func main() {
+	version := flag.String("version", "0.4.0", "generate API spec for this version")
+	outDir := flag.String("out", "./docs/openapi", "directory the specs are written to")
+	flag.Parse()
 
-	schema, err := reflector.Spec.MarshalJSON()
-	if err != nil {
-		log.Fatal(err)
-	}
-	fmt.Println(string(schema))
+	for _, spec := range specs {
+		schema, err := buildSpec(*version, spec.prefix, spec.operations())
+		if err != nil {
+			log.Fatal(err)
+		}
 
-	// Write the JSON data to the file
-	file, err := os.Create("./docs/openapi/interlink-openapi.json")
-	if err != nil {
-		panic(err)
-	}
-	defer file.Close()
+		// Write the JSON data to the file
+		path := filepath.Join(*outDir, spec.file)
+		err = os.WriteFile(path, schema, 0o644) // #nosec G306 -- the specs are public documentation
+		if err != nil {
+			panic(err)
+		}
 
-	_, err = file.Write(schema)
-	if err != nil {
-		panic(err)
+		fmt.Println("Successfully wrote to " + path)
 	}
-
-	fmt.Println("Successfully wrote to ./docs/openapi/interlink-openapi.json")
 }
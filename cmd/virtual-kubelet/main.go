@@ -582,18 +582,27 @@ func main() {
 
 	// start podHandler
 	handlerPodConfig := api.PodHandlerConfig{
-		GetContainerLogs: nodeProvider.GetLogs,
-		GetPods:          nodeProvider.GetPods,
-		GetStatsSummary:  nodeProvider.GetStatsSummary,
+		GetContainerLogs:   nodeProvider.GetLogs,
+		RunInContainer:     nodeProvider.RunInContainer,
+		AttachToContainer:  nodeProvider.AttachToContainer,
+		PortForward:        nodeProvider.PortForward,
+		GetPods:            nodeProvider.GetPods,
+		GetStatsSummary:    nodeProvider.GetStatsSummary,
+		GetMetricsResource: nodeProvider.GetMetricsResource,
 	}
 
 	podRoutes := api.PodHandlerConfig{
-		GetContainerLogs: handlerPodConfig.GetContainerLogs,
-		GetStatsSummary:  handlerPodConfig.GetStatsSummary,
-		GetPods:          handlerPodConfig.GetPods,
+		GetContainerLogs:   handlerPodConfig.GetContainerLogs,
+		RunInContainer:     handlerPodConfig.RunInContainer,
+		AttachToContainer:  handlerPodConfig.AttachToContainer,
+		PortForward:        handlerPodConfig.PortForward,
+		GetStatsSummary:    handlerPodConfig.GetStatsSummary,
+		GetMetricsResource: handlerPodConfig.GetMetricsResource,
+		GetPods:            handlerPodConfig.GetPods,
 	}
 
 	api.AttachPodRoutes(podRoutes, mux, true)
+	mux.HandleFunc("/validate", nodeProvider.ValidateHandler)
 
 	pc, err := node.NewPodController(podControllerConfig) // <-- instatiates the pod controller
 	if err != nil {
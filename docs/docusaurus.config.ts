@@ -65,6 +65,11 @@ const config: Config = {
             spec: 'openapi/interlink-openapi.json',
             route: '/interlink-openapi/',
           },
+          {
+            id: 'interlink-api-v1',
+            spec: 'openapi/interlink-openapi-v1.json',
+            route: '/interlink-openapi-v1/',
+          },
         ],
         // Theme Options for modifying how redoc renders them
         theme: {
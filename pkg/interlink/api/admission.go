@@ -0,0 +1,399 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+)
+
+const (
+	// QueuedReason is the waiting reason of the containers of a pod held in the admission queue
+	QueuedReason = "QueuedInInterLink"
+	// CreateFailedReason terminates the containers of a queued pod whose create failed
+	CreateFailedReason = "InterLinkCreateFailed"
+)
+
+// strideScale is how far the pass of a tenant of weight 1 advances at each admitted create.
+// Heavier tenants advance by a fraction of it, and are picked more often.
+const strideScale = 1 << 20
+
+// admissionTicket is a create waiting for a slot.
+type admissionTicket struct {
+	uid    string
+	tenant string
+	run    func()
+}
+
+// tenantQueue holds the creates of a tenant, in arrival order.
+type tenantQueue struct {
+	waiting  []*admissionTicket
+	inflight int
+	// pass is the virtual time of the tenant: the tenant waiting with the lowest pass gets the
+	// next free slot, and its pass advances by strideScale/weight (stride scheduling).
+	pass uint64
+}
+
+// AdmissionQueue limits the creates forwarded to the sidecars at the same time, in total and
+// per tenant. The creates over the limits are queued, and run in weighted fair order across
+// the tenants as slots free up.
+type AdmissionQueue struct {
+	mu       sync.Mutex
+	config   types.AdmissionConfig
+	tenants  map[string]*tenantQueue
+	inflight int
+	// vtime is the pass of the last admitted create. Tenants starting to wait begin from it,
+	// so that they do not get a burst of slots for the time they were idle.
+	vtime uint64
+	// queued and failed index by pod UID the creates waiting for a slot and the queued
+	// creates that failed, until their pods are deleted.
+	queued map[string]*admissionTicket
+	failed map[string]bool
+	// forwarding indexes by pod UID the queued creates handed to the sidecar. The ones whose
+	// pod is deleted meanwhile are canceled, and undone once they return.
+	forwarding map[string]*forwardingCreate
+}
+
+// forwardingCreate is a queued create handed to the sidecar.
+type forwardingCreate struct {
+	// deleted tells that the pod was deleted while the create was running
+	deleted bool
+	// cancel stops the create, e.g. the build of its job script, when the pod is deleted
+	cancel context.CancelFunc
+}
+
+// Admission is the admission queue of the pod creations.
+var Admission AdmissionQueue
+
+// ValidateAdmission checks the limits and the weights of the admission queue.
+func ValidateAdmission(config types.Config) error {
+	admission := config.Admission
+	if admission.MaxConcurrentCreates < 0 || admission.TenantMaxConcurrentCreates < 0 {
+		return errors.New("admission limits must not be negative")
+	}
+	names := make(map[string]bool, len(admission.Tenants))
+	for _, tenant := range admission.Tenants {
+		if tenant.Name == "" {
+			return errors.New("admission tenant without Name")
+		}
+		if names[tenant.Name] {
+			return fmt.Errorf("admission tenant %q is listed more than once", tenant.Name)
+		}
+		names[tenant.Name] = true
+		if tenant.MaxConcurrentCreates < 0 || tenant.Weight < 0 {
+			return fmt.Errorf("admission tenant %q: limit and weight must not be negative", tenant.Name)
+		}
+	}
+	return nil
+}
+
+// Configure replaces the limits of the queue. Raised limits start the creates they make room for.
+func (a *AdmissionQueue) Configure(config types.AdmissionConfig) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.config = config
+	a.dispatch()
+}
+
+// tenant returns the tenant of a pod: the value of the TenantLabel label, or the namespace.
+func (a *AdmissionQueue) tenant(pod *v1.Pod) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.config.TenantLabel != "" {
+		if tenant, ok := pod.Labels[a.config.TenantLabel]; ok && tenant != "" {
+			return tenant
+		}
+	}
+	return pod.Namespace
+}
+
+// tenantSettings returns the limit (0 for none) and the weight of a tenant.
+func (a *AdmissionQueue) tenantSettings(name string) (int, int) {
+	limit, weight := a.config.TenantMaxConcurrentCreates, 1
+	for _, tenant := range a.config.Tenants {
+		if tenant.Name == name {
+			if tenant.MaxConcurrentCreates > 0 {
+				limit = tenant.MaxConcurrentCreates
+			}
+			if tenant.Weight > 0 {
+				weight = tenant.Weight
+			}
+			break
+		}
+	}
+	return limit, weight
+}
+
+// admit returns the tenant of the pod, and whether its create may go on at once. The caller
+// then calls release when it is done. Otherwise the create is queued, and run is called
+// in its own goroutine once a slot is free, the slot being released when run returns.
+func (a *AdmissionQueue) admit(pod *v1.Pod, run func()) (string, bool) {
+	tenant := a.tenant(pod)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.tenants == nil {
+		a.tenants = make(map[string]*tenantQueue)
+		a.queued = make(map[string]*admissionTicket)
+		a.failed = make(map[string]bool)
+		a.forwarding = make(map[string]*forwardingCreate)
+	}
+	t := a.tenants[tenant]
+	if t == nil {
+		t = &tenantQueue{pass: a.vtime}
+		a.tenants[tenant] = t
+	}
+
+	// Creates of the same tenant keep their order: a tenant with waiting pods queues the new ones.
+	if len(t.waiting) == 0 && a.canStart(tenant, t) {
+		a.start(tenant, t)
+		return tenant, true
+	}
+
+	if len(t.waiting) == 0 && t.pass < a.vtime {
+		t.pass = a.vtime
+	}
+	ticket := &admissionTicket{uid: string(pod.UID), tenant: tenant, run: run}
+	t.waiting = append(t.waiting, ticket)
+	if ticket.uid != "" {
+		a.queued[ticket.uid] = ticket
+	}
+	admissionQueued.WithLabelValues(tenant).Inc()
+	return tenant, false
+}
+
+// release frees the slot of a create of tenant, and starts the queued creates it makes room for.
+func (a *AdmissionQueue) release(tenant string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.inflight--
+	if t := a.tenants[tenant]; t != nil {
+		t.inflight--
+		if t.inflight <= 0 && len(t.waiting) == 0 {
+			delete(a.tenants, tenant)
+		}
+	}
+	a.dispatch()
+}
+
+// canStart tells whether the limits leave room for one more create of tenant. Called with mu held.
+func (a *AdmissionQueue) canStart(name string, t *tenantQueue) bool {
+	if !a.config.Enabled {
+		return true
+	}
+	if a.config.MaxConcurrentCreates > 0 && a.inflight >= a.config.MaxConcurrentCreates {
+		return false
+	}
+	limit, _ := a.tenantSettings(name)
+	return limit == 0 || t.inflight < limit
+}
+
+// start takes a slot for a create of tenant. Called with mu held.
+func (a *AdmissionQueue) start(name string, t *tenantQueue) {
+	_, weight := a.tenantSettings(name)
+	if t.pass < a.vtime {
+		t.pass = a.vtime
+	}
+	a.vtime = t.pass
+	t.pass += strideScale / uint64(weight) // #nosec G115 -- weight is positive
+	t.inflight++
+	a.inflight++
+}
+
+// dispatch starts queued creates while slots are free, picking every time the waiting tenant
+// with the lowest pass among the ones below their limit. Called with mu held.
+func (a *AdmissionQueue) dispatch() {
+	for {
+		var next string
+		var nextQueue *tenantQueue
+		for name, t := range a.tenants {
+			if len(t.waiting) == 0 || !a.canStart(name, t) {
+				continue
+			}
+			if nextQueue == nil || t.pass < nextQueue.pass || (t.pass == nextQueue.pass && name < next) {
+				next, nextQueue = name, t
+			}
+		}
+		if nextQueue == nil {
+			return
+		}
+
+		ticket := nextQueue.waiting[0]
+		nextQueue.waiting = nextQueue.waiting[1:]
+		delete(a.queued, ticket.uid)
+		if ticket.uid != "" {
+			a.forwarding[ticket.uid] = &forwardingCreate{}
+		}
+		admissionQueued.WithLabelValues(next).Dec()
+		a.start(next, nextQueue)
+		go func() {
+			defer a.release(ticket.tenant)
+			ticket.run()
+		}()
+	}
+}
+
+// cancel drops the queued or failed create of a pod being deleted. A queued create being
+// forwarded to the sidecar is canceled and marked deleted, for createQueued to undo it once
+// it returns. It returns false when the create is not held by the queue, i.e. the sidecar
+// owns the pod.
+func (a *AdmissionQueue) cancel(uid string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if f, ok := a.forwarding[uid]; ok {
+		f.deleted = true
+		if f.cancel != nil {
+			f.cancel()
+		}
+		return true
+	}
+	if a.failed[uid] {
+		delete(a.failed, uid)
+		return true
+	}
+	ticket, ok := a.queued[uid]
+	if !ok {
+		return false
+	}
+	delete(a.queued, uid)
+	if t := a.tenants[ticket.tenant]; t != nil {
+		for i, waiting := range t.waiting {
+			if waiting == ticket {
+				t.waiting = append(t.waiting[:i], t.waiting[i+1:]...)
+				break
+			}
+		}
+		if t.inflight <= 0 && len(t.waiting) == 0 {
+			delete(a.tenants, ticket.tenant)
+		}
+	}
+	admissionQueued.WithLabelValues(ticket.tenant).Dec()
+	return true
+}
+
+// forwardContext returns the context of the queued create of a pod handed to the sidecar,
+// derived from parent and canceled when the pod is deleted.
+func (a *AdmissionQueue) forwardContext(parent context.Context, uid string) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if f, ok := a.forwarding[uid]; ok {
+		f.cancel = cancel
+		if f.deleted {
+			cancel()
+		}
+	}
+	return ctx, cancel
+}
+
+// forwarded ends the forwarding of a queued create to the sidecar, and tells whether its pod
+// was deleted meanwhile.
+func (a *AdmissionQueue) forwarded(uid string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	f, ok := a.forwarding[uid]
+	delete(a.forwarding, uid)
+	return ok && f.deleted
+}
+
+// fail records that the queued create of a pod failed, until the pod is deleted.
+func (a *AdmissionQueue) fail(uid string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if uid != "" && a.failed != nil {
+		a.failed[uid] = true
+	}
+}
+
+// holds tells whether the create of a pod is queued or failed in the queue: the sidecars do
+// not know such a pod, and its status comes from interLink.
+func (a *AdmissionQueue) holds(uid string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, queued := a.queued[uid]
+	return queued || a.failed[uid]
+}
+
+// admissionStatus is the status reported for a pod held in the admission queue: its containers
+// wait with QueuedReason, or are terminated with CreateFailedReason when createErr is set.
+func admissionStatus(pod *v1.Pod, tenant string, createErr error) types.PodStatus {
+	state := v1.ContainerState{Waiting: &v1.ContainerStateWaiting{
+		Reason:  QueuedReason,
+		Message: "waiting in the interLink admission queue of tenant " + tenant,
+	}}
+	if createErr != nil {
+		state = v1.ContainerState{Terminated: &v1.ContainerStateTerminated{
+			ExitCode: 1,
+			Reason:   CreateFailedReason,
+			Message:  createErr.Error(),
+		}}
+	}
+
+	statuses := func(containers []v1.Container) []v1.ContainerStatus {
+		out := make([]v1.ContainerStatus, 0, len(containers))
+		for _, container := range containers {
+			out = append(out, v1.ContainerStatus{Name: container.Name, Image: container.Image, State: state})
+		}
+		return out
+	}
+	return types.PodStatus{
+		PodName:        pod.Name,
+		PodUID:         string(pod.UID),
+		PodNamespace:   pod.Namespace,
+		Containers:     statuses(pod.Spec.Containers),
+		InitContainers: statuses(pod.Spec.InitContainers),
+	}
+}
+
+// failQueuedStatuses fails the statuses of the pods that were waiting in the admission queue
+// when interLink stopped: the queue is not persisted, so their creates will never run. The
+// pods are held as failed in the queue, until they are deleted. It returns the statuses it
+// changed.
+func (a *AdmissionQueue) failQueuedStatuses(statuses map[string]types.PodStatus) []types.PodStatus {
+	var failed []types.PodStatus
+	for uid, status := range statuses {
+		if !isQueuedStatus(status) {
+			continue
+		}
+		terminate := func(containers []v1.ContainerStatus) {
+			for i := range containers {
+				containers[i].State = v1.ContainerState{Terminated: &v1.ContainerStateTerminated{
+					ExitCode: 1,
+					Reason:   CreateFailedReason,
+					Message:  "interLink restarted while the pod was waiting in the admission queue",
+				}}
+			}
+		}
+		status.Containers = slices.Clone(status.Containers)
+		status.InitContainers = slices.Clone(status.InitContainers)
+		terminate(status.Containers)
+		terminate(status.InitContainers)
+		statuses[uid] = status
+		failed = append(failed, status)
+
+		a.mu.Lock()
+		if a.failed == nil {
+			a.failed = make(map[string]bool)
+		}
+		a.failed[uid] = true
+		a.mu.Unlock()
+	}
+	return failed
+}
+
+// isQueuedStatus tells whether a status is the one of a pod waiting in the admission queue.
+func isQueuedStatus(status types.PodStatus) bool {
+	for _, containers := range [][]v1.ContainerStatus{status.Containers, status.InitContainers} {
+		for _, container := range containers {
+			if container.State.Waiting != nil && container.State.Waiting.Reason == QueuedReason {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,335 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+)
+
+// admitAll queues the pods behind a blocker holding the only slot, then frees the slot and
+// returns the order in which the queued creates ran.
+func admitAll(t *testing.T, a *AdmissionQueue, pods []*v1.Pod) []string {
+	t.Helper()
+	blocker, admitted := a.admit(testPod("blocker", "blocker", nil, nil), nil)
+	require.True(t, admitted)
+
+	order := make(chan string, len(pods))
+	for _, pod := range pods {
+		name := pod.Name
+		_, admitted := a.admit(pod, func() { order <- name })
+		require.False(t, admitted, name)
+	}
+	a.release(blocker)
+
+	var got []string
+	for range pods {
+		select {
+		case name := <-order:
+			got = append(got, name)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("queued creates did not run, got %v", got)
+		}
+	}
+	return got
+}
+
+func TestAdmissionQueue_FairShare(t *testing.T) {
+	a := &AdmissionQueue{}
+	a.Configure(types.AdmissionConfig{Enabled: true, MaxConcurrentCreates: 1})
+
+	var pods []*v1.Pod
+	for _, uid := range []string{"a1", "a2", "a3", "a4"} {
+		pods = append(pods, testPod(uid, "burst", nil, nil))
+	}
+	pods = append(pods, testPod("b1", "small", nil, nil), testPod("b2", "small", nil, nil))
+
+	// The small tenant is not starved by the burst queued before it.
+	assert.Equal(t, []string{"pod-a1", "pod-b1", "pod-a2", "pod-b2", "pod-a3", "pod-a4"}, admitAll(t, a, pods))
+}
+
+func TestAdmissionQueue_Weights(t *testing.T) {
+	a := &AdmissionQueue{}
+	a.Configure(types.AdmissionConfig{
+		Enabled:              true,
+		MaxConcurrentCreates: 1,
+		TenantLabel:          "team",
+		Tenants:              []types.TenantConfig{{Name: "gold", Weight: 3}},
+	})
+
+	var pods []*v1.Pod
+	for _, uid := range []string{"g1", "g2", "g3", "g4"} {
+		pods = append(pods, testPod(uid, "ns1", map[string]string{"team": "gold"}, nil))
+	}
+	for _, uid := range []string{"s1", "s2"} {
+		pods = append(pods, testPod(uid, "ns2", map[string]string{"team": "silver"}, nil))
+	}
+
+	assert.Equal(t, []string{"pod-g1", "pod-s1", "pod-g2", "pod-g3", "pod-g4", "pod-s2"}, admitAll(t, a, pods))
+}
+
+func TestAdmissionQueue_TenantLimit(t *testing.T) {
+	a := &AdmissionQueue{}
+	a.Configure(types.AdmissionConfig{Enabled: true, TenantMaxConcurrentCreates: 1})
+
+	first, admitted := a.admit(testPod("a1", "ns1", nil, nil), nil)
+	require.True(t, admitted)
+	_, admitted = a.admit(testPod("b1", "ns2", nil, nil), nil)
+	assert.True(t, admitted, "other tenants are not limited by ns1")
+
+	ran := make(chan struct{})
+	_, admitted = a.admit(testPod("a2", "ns1", nil, nil), func() { close(ran) })
+	require.False(t, admitted)
+	assert.True(t, a.holds("a2"))
+
+	// Raising the limit starts the queued create without waiting for a release.
+	a.Configure(types.AdmissionConfig{Enabled: true, TenantMaxConcurrentCreates: 2})
+	select {
+	case <-ran:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the queued create did not run after the limit was raised")
+	}
+	assert.False(t, a.holds("a2"))
+	a.release(first)
+}
+
+func TestAdmissionQueue_Cancel(t *testing.T) {
+	a := &AdmissionQueue{}
+	a.Configure(types.AdmissionConfig{Enabled: true, MaxConcurrentCreates: 1})
+
+	blocker, _ := a.admit(testPod("blocker", "ns", nil, nil), nil)
+	_, admitted := a.admit(testPod("queued", "ns", nil, nil), func() { t.Error("a canceled create must not run") })
+	require.False(t, admitted)
+
+	assert.True(t, a.cancel("queued"))
+	assert.False(t, a.cancel("queued"))
+	assert.False(t, a.holds("queued"))
+	a.release(blocker)
+
+	a.fail("failed")
+	assert.True(t, a.holds("failed"))
+	assert.True(t, a.cancel("failed"))
+	assert.False(t, a.holds("failed"))
+}
+
+func TestValidateAdmission(t *testing.T) {
+	require.NoError(t, ValidateAdmission(types.Config{Admission: types.AdmissionConfig{
+		Enabled: true, MaxConcurrentCreates: 10, Tenants: []types.TenantConfig{{Name: "a", Weight: 2}},
+	}}))
+	require.Error(t, ValidateAdmission(types.Config{Admission: types.AdmissionConfig{MaxConcurrentCreates: -1}}))
+	require.Error(t, ValidateAdmission(types.Config{Admission: types.AdmissionConfig{Tenants: []types.TenantConfig{{Name: "a"}, {Name: "a"}}}}))
+	require.Error(t, ValidateAdmission(types.Config{Admission: types.AdmissionConfig{Tenants: []types.TenantConfig{{}}}}))
+}
+
+func TestCreateHandler_QueuedCreate(t *testing.T) {
+	h, creates := newCreateSidecar(t, nil)
+	Admission.Configure(types.AdmissionConfig{Enabled: true, MaxConcurrentCreates: 1})
+	t.Cleanup(func() {
+		Admission = AdmissionQueue{}
+		resetPodStatuses()
+	})
+	resetPodStatuses()
+
+	blocker, admitted := Admission.admit(testPod("blocker", "default", nil, nil), nil)
+	require.True(t, admitted)
+
+	queued := createResult(t, createCall(t, h, "uid-q", "q", ""))
+	assert.Equal(t, types.CreateStruct{PodUID: "uid-q"}, queued)
+	assert.Equal(t, int32(0), creates.Load())
+	assert.True(t, Admission.holds("uid-q"))
+
+	PodStatuses.mu.Lock()
+	_, cached := PodStatuses.Statuses["uid-q"]
+	PodStatuses.mu.Unlock()
+	assert.True(t, cached, "a queued pod has a status")
+
+	// the status of a queued pod comes from interLink: the sidecar is not asked
+	body, err := json.Marshal([]*v1.Pod{testPod("uid-q", "default", nil, nil)})
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	h.StatusHandler(rec, httptest.NewRequest(http.MethodGet, "/status", strings.NewReader(string(body))))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var statuses []types.PodStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &statuses))
+	require.Len(t, statuses, 1)
+	assert.Equal(t, "uid-q", statuses[0].PodUID)
+
+	// a repeated create gets the queued answer back
+	assert.Equal(t, queued, createResult(t, createCall(t, h, "uid-q", "q", "")))
+
+	Admission.release(blocker)
+	require.Eventually(t, func() bool { return creates.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		return createResult(t, createCall(t, h, "uid-q", "q", "")).PodJID == "1"
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.False(t, Admission.holds("uid-q"))
+
+	PodOwners.forget("uid-q")
+	KnownPods.forget("uid-q")
+}
+
+func TestDeleteHandler_QueuedPod(t *testing.T) {
+	h, creates := newCreateSidecar(t, nil)
+	Admission.Configure(types.AdmissionConfig{Enabled: true, MaxConcurrentCreates: 1})
+	t.Cleanup(func() {
+		Admission = AdmissionQueue{}
+		resetPodStatuses()
+	})
+	resetPodStatuses()
+
+	blocker, _ := Admission.admit(testPod("blocker", "default", nil, nil), nil)
+	createResult(t, createCall(t, h, "uid-d", "d", ""))
+
+	body, err := json.Marshal(testPod("uid-d", "default", nil, nil))
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	h.DeleteHandler(rec, httptest.NewRequest(http.MethodDelete, "/delete", strings.NewReader(string(body))))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.False(t, Admission.holds("uid-d"))
+
+	Admission.release(blocker)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(0), creates.Load(), "a deleted queued pod is never created")
+}
+
+func TestDeleteHandler_QueuedPodBeingCreated(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	entered := make(chan struct{})
+	unblock := make(chan struct{})
+	server, endpoint, client := newUnixTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/create"):
+			close(entered)
+			<-unblock
+			_ = json.NewEncoder(w).Encode(types.CreateStruct{PodUID: "uid-f", PodJID: "1"})
+		case strings.HasSuffix(r.URL.Path, "/delete"):
+		default:
+			return
+		}
+		mu.Lock()
+		calls = append(calls, r.URL.Path[strings.LastIndex(r.URL.Path, "/"):])
+		mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+	h := &InterLinkHandler{Ctx: context.Background(), SidecarEndpoint: endpoint, ClientHTTP: client}
+	Admission.Configure(types.AdmissionConfig{Enabled: true, MaxConcurrentCreates: 1})
+	t.Cleanup(func() {
+		Admission = AdmissionQueue{}
+		PodCreates = MutexCreates{}
+		resetPodStatuses()
+	})
+	resetPodStatuses()
+
+	blocker, _ := Admission.admit(testPod("blocker", "default", nil, nil), nil)
+	createResult(t, createCall(t, h, "uid-f", "f", ""))
+	Admission.release(blocker)
+	<-entered
+
+	// the create is in flight: the delete is left to it
+	body, err := json.Marshal(testPod("uid-f", "default", nil, nil))
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	h.DeleteHandler(rec, httptest.NewRequest(http.MethodDelete, "/delete", strings.NewReader(string(body))))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	close(unblock)
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(calls) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		Admission.mu.Lock()
+		defer Admission.mu.Unlock()
+		return Admission.inflight == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"/create", "/delete"}, calls, "the job created after the delete is deleted")
+	_, owned := PodOwners.get("uid-f")
+	assert.False(t, owned)
+	for _, pod := range KnownPods.list() {
+		assert.NotEqual(t, "uid-f", string(pod.UID))
+	}
+}
+
+func TestDeleteHandler_CancelsQueuedJobScriptBuild(t *testing.T) {
+	building := make(chan struct{})
+	canceled := make(chan struct{})
+	builder := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		// the server notices the client going away once the body is read
+		_, _ = io.Copy(io.Discard, r.Body)
+		close(building)
+		<-r.Context().Done()
+		close(canceled)
+	}))
+	defer builder.Close()
+
+	h, creates := newCreateSidecar(t, nil)
+	h.Config.JobScriptBuildConfig = &types.ScriptBuildConfig{}
+	h.JobScriptBuilder = newBuilder(t, types.JobScriptBuilderConfig{})
+	Admission.Configure(types.AdmissionConfig{Enabled: true, MaxConcurrentCreates: 1})
+	t.Cleanup(func() {
+		Admission = AdmissionQueue{}
+		resetPodStatuses()
+	})
+	resetPodStatuses()
+
+	blocker, _ := Admission.admit(testPod("blocker", "default", nil, nil), nil)
+	body, err := json.Marshal(types.PodCreateRequests{Pod: *testPod("uid-b", "default", nil, nil), JobScriptBuilderURL: builder.URL})
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	h.CreateHandler(rec, httptest.NewRequest(http.MethodPost, "/create", strings.NewReader(string(body))))
+	require.Equal(t, http.StatusOK, rec.Code)
+	Admission.release(blocker)
+	<-building
+
+	body, err = json.Marshal(testPod("uid-b", "default", nil, nil))
+	require.NoError(t, err)
+	rec = httptest.NewRecorder()
+	h.DeleteHandler(rec, httptest.NewRequest(http.MethodDelete, "/delete", strings.NewReader(string(body))))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the job script build was not canceled with the pod deletion")
+	}
+	require.Eventually(t, func() bool {
+		Admission.mu.Lock()
+		defer Admission.mu.Unlock()
+		return Admission.inflight == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Zero(t, creates.Load(), "the sidecar is not called for a deleted pod")
+	PodStatuses.mu.Lock()
+	_, cached := PodStatuses.Statuses["uid-b"]
+	PodStatuses.mu.Unlock()
+	assert.False(t, cached, "the canceled create does not report a failure")
+}
+
+func TestAdmissionStatus(t *testing.T) {
+	pod := testPod("uid-s", "ns", nil, nil)
+	pod.Spec.InitContainers = []v1.Container{{Name: "init"}}
+	pod.Spec.Containers = []v1.Container{{Name: "main"}}
+
+	status := admissionStatus(pod, "ns", nil)
+	require.Len(t, status.Containers, 1)
+	require.NotNil(t, status.Containers[0].State.Waiting)
+	assert.Equal(t, QueuedReason, status.Containers[0].State.Waiting.Reason)
+	assert.Equal(t, QueuedReason, status.InitContainers[0].State.Waiting.Reason)
+
+	failed := admissionStatus(pod, "ns", assert.AnError)
+	require.NotNil(t, failed.Containers[0].State.Terminated)
+	assert.Equal(t, CreateFailedReason, failed.Containers[0].State.Terminated.Reason)
+	assert.True(t, isTerminal(failed))
+}
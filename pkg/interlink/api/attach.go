@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/containerd/containerd/log"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+	"github.com/interlink-hq/interlink/pkg/interlink/audit"
+	"github.com/interlink-hq/interlink/pkg/interlink/channelstream"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	trace "go.opentelemetry.io/otel/trace"
+)
+
+// validateAttachRequest checks the pod and container of an attach request, as validateLogRequest does.
+func validateAttachRequest(req types.AttachRequest) error {
+	if err := validateLogRequest(types.LogStruct{Namespace: req.Namespace, PodUID: req.PodUID, ContainerName: req.ContainerName}); err != nil {
+		return err
+	}
+	if req.ContainerName == "" {
+		return errors.New("missing container name")
+	}
+	if !req.Stdin && !req.Stdout && !req.Stderr {
+		return errors.New("at least one of stdin, stdout and stderr is required")
+	}
+	return nil
+}
+
+// AttachHandler handles HTTP POST requests attaching to the main process of a container, for
+// kubectl attach. The bodies are channel streams, as for ExecHandler: the request starts with
+// a JSON-encoded AttachRequest, and carries stdin and the terminal resizes; the response
+// carries stdout and stderr. The session ends with a status frame when the process exits;
+// when the client goes away first, the plugin detaches and the process keeps running.
+//
+// Each session is tagged with the InterLink-Http-Session header of the request, which is
+// forwarded to the plugin and recorded in the span and the logs.
+//
+// HTTP Status Codes:
+//   - 200: Session opened, the outcome is in the status frame
+//   - 400: Bad request (the stream does not start with a valid AttachRequest)
+//   - 501: The plugin does not support attach
+//   - 502: The plugin failed to open the session
+func (h *InterLinkHandler) AttachHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now().UnixMicro()
+	tracer := otel.Tracer("interlink-API")
+	_, span := tracer.Start(h.Ctx, "AttachAPI", trace.WithAttributes(
+		attribute.Int64("start.timestamp", start),
+	))
+	defer span.End()
+	defer types.SetDurationSpan(start, span)
+	defer types.SetInfoFromHeaders(span, &r.Header)
+
+	sessionContext := GetSessionContext(r)
+	sessionContextMessage := GetSessionContextMessage(sessionContext)
+	span.SetAttributes(attribute.String("session.id", sessionContext))
+	log.G(h.Ctx).Info(sessionContextMessage, "InterLink: received Attach call")
+
+	enableFullDuplex(w)
+
+	body := channelstream.NewReader(r.Body)
+	channel, payload, err := body.Next()
+	if err != nil || channel != channelstream.ChannelRequest {
+		http.Error(w, "the stream must start with the attach request", http.StatusBadRequest)
+		return
+	}
+	var attachRequest types.AttachRequest
+	if err := json.Unmarshal(payload, &attachRequest); err != nil {
+		http.Error(w, "invalid attach request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateAttachRequest(attachRequest); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	span.SetAttributes(
+		attribute.String("pod.name", attachRequest.PodName),
+		attribute.String("pod.namespace", attachRequest.Namespace),
+		attribute.String("pod.uid", attachRequest.PodUID),
+		attribute.String("container.name", attachRequest.ContainerName),
+		attribute.Bool("attach.stdin", attachRequest.Stdin),
+		attribute.Bool("attach.tty", attachRequest.TTY),
+	)
+	audit.AddPod(r.Context(), audit.Pod{Namespace: attachRequest.Namespace, Name: attachRequest.PodName, UID: attachRequest.PodUID})
+	log.G(h.Ctx).Info(sessionContextMessage, "Attach to container ", attachRequest.ContainerName, " of pod ",
+		attachRequest.Namespace, "/", attachRequest.PodName)
+
+	sidecar := h.routeUID(attachRequest.PodUID, attachRequest.Namespace)
+	span.SetAttributes(attribute.String("sidecar.name", sidecar.Name))
+	h.relaySession(w, r, sidecar, "/attach", payload, body, sessionContext)
+	log.G(h.Ctx).Info(sessionContextMessage, "Attach session to container ", attachRequest.ContainerName, " of pod ",
+		attachRequest.Namespace, "/", attachRequest.PodName, " ended")
+}
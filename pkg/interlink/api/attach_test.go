@@ -0,0 +1,97 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+	"github.com/interlink-hq/interlink/pkg/interlink/channelstream"
+)
+
+func TestAttachHandler(t *testing.T) {
+	sidecar, endpoint, client := newUnixTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasSuffix(r.URL.Path, "/attach"))
+		assert.Equal(t, "Attach#42", r.Header.Get("InterLink-Http-Session"))
+		rc := http.NewResponseController(w)
+		assert.NoError(t, rc.EnableFullDuplex())
+		in := channelstream.NewReader(r.Body)
+		channel, payload, err := in.Next()
+		if !assert.NoError(t, err) || !assert.Equal(t, channelstream.ChannelRequest, channel) {
+			return
+		}
+		var req types.AttachRequest
+		assert.NoError(t, json.Unmarshal(payload, &req))
+		assert.True(t, req.TTY)
+
+		w.Header().Set("Content-Type", channelstream.ContentType)
+		w.WriteHeader(http.StatusOK)
+		assert.NoError(t, rc.Flush())
+		out := channelstream.NewWriter(w)
+		// the resizes are relayed as they come
+		channel, payload, err = in.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, channelstream.ChannelResize, channel)
+		assert.NoError(t, out.WriteFrame(channelstream.ChannelStdout, payload))
+		assert.NoError(t, out.WriteJSON(channelstream.ChannelStatus, channelstream.Status{}))
+	}))
+	defer sidecar.Close()
+	h := &InterLinkHandler{Ctx: context.Background(), SidecarEndpoint: endpoint, ClientHTTP: client}
+	server := httptest.NewServer(http.HandlerFunc(h.AttachHandler))
+	defer server.Close()
+
+	body, pipe := io.Pipe()
+	defer pipe.Close()
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, server.URL+"/attach", body)
+	require.NoError(t, err)
+	req.Header.Set("InterLink-Http-Session", "Attach#42")
+	in := channelstream.NewWriter(pipe)
+	go func() {
+		_ = in.WriteJSON(channelstream.ChannelRequest, types.AttachRequest{
+			Namespace: "default", PodUID: execPodUID, PodName: "pod", ContainerName: "main", Stdout: true, TTY: true,
+		})
+	}()
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	require.NoError(t, in.WriteJSON(channelstream.ChannelResize, channelstream.TermSize{Width: 80, Height: 24}))
+	out := channelstream.NewReader(resp.Body)
+	channel, payload, err := out.Next()
+	require.NoError(t, err)
+	assert.Equal(t, channelstream.ChannelStdout, channel)
+	assert.JSONEq(t, `{"width":80,"height":24}`, string(payload))
+	channel, _, err = out.Next()
+	require.NoError(t, err)
+	assert.Equal(t, channelstream.ChannelStatus, channel)
+}
+
+func TestAttachHandler_InvalidRequest(t *testing.T) {
+	h := &InterLinkHandler{Ctx: context.Background()}
+	tests := []struct {
+		name    string
+		request types.AttachRequest
+	}{
+		{"no container", types.AttachRequest{Namespace: "default", PodUID: execPodUID, Stdout: true}},
+		{"no stream", types.AttachRequest{Namespace: "default", PodUID: execPodUID, ContainerName: "main"}},
+		{"invalid namespace", types.AttachRequest{Namespace: "../x", PodUID: execPodUID, ContainerName: "main", Stdout: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body bytes.Buffer
+			require.NoError(t, channelstream.NewWriter(&body).WriteJSON(channelstream.ChannelRequest, tt.request))
+			rec := httptest.NewRecorder()
+			h.AttachHandler(rec, httptest.NewRequest(http.MethodPost, "/attach", &body))
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		})
+	}
+}
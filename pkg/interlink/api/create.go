@@ -2,16 +2,21 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
 	"io"
 	"net/http"
-	"text/template"
 	"time"
 
 	"github.com/containerd/containerd/log"
 
 	types "github.com/interlink-hq/interlink/pkg/interlink"
+	"github.com/interlink-hq/interlink/pkg/interlink/audit"
+	"github.com/interlink-hq/interlink/pkg/interlink/envelope"
+	"github.com/interlink-hq/interlink/pkg/interlink/jobscript"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -21,18 +26,29 @@ import (
 // CreateHandler handles HTTP POST requests to create pods on remote systems.
 // This endpoint receives pod creation requests from the Virtual Kubelet, processes them
 // by gathering all necessary resources (ConfigMaps, Secrets, projected volumes), and
-// forwards the complete pod specification to the configured sidecar plugin.
+// forwards the complete pod specification to the sidecar plugin selected by the routing rules.
 //
 // The handler supports optional job script generation through either:
 //   - JobScriptBuilderURL: An external service that generates job scripts
-//   - JobScriptTemplate: A local template file for job script generation
+//   - JobScriptTemplate and JobScriptTemplateDir: local templates, selected per pod with the
+//     interlink.eu/job-script-template annotation
 //
 // Request body: JSON-encoded PodCreateRequests
 // Response: JSON-encoded CreateStruct array with pod UID to job ID mappings
 //
+// Creates are idempotent: a pod (identified by its UID, or by the Idempotency-Key header
+// when it has none) that was already created gets the recorded job ID back, and the
+// sidecar is not called again until the pod is deleted. The creates recorded by
+// Idempotency-Key alone are remembered for 24 hours.
+//
 // HTTP Status Codes:
-//   - 200: Pod creation request processed successfully
+//   - 200: Pod creation request processed successfully, or pod already created
+//   - 400: The pod requests an unknown plugin through the interlink.eu/plugin annotation,
+//     or an unknown job script template through the interlink.eu/job-script-template annotation
+//   - 409: A create call for the same pod is still in progress
+//   - 422: The Idempotency-Key was already used for another pod
 //   - 500: Internal server error (configuration issues, sidecar communication failures)
+//   - 502, 504: The job script builder failed, or did not answer in time
 func (h *InterLinkHandler) CreateHandler(w http.ResponseWriter, r *http.Request) {
 	start := time.Now().UnixMicro()
 	tracer := otel.Tracer("interlink-API")
@@ -55,7 +71,6 @@ func (h *InterLinkHandler) CreateHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	var req *http.Request           // request to forward to sidecar
 	var pod types.PodCreateRequests // request for interlink
 	err = json.Unmarshal(bodyBytes, &pod)
 	if err != nil {
@@ -71,12 +86,83 @@ func (h *InterLinkHandler) CreateHandler(w http.ResponseWriter, r *http.Request)
 		attribute.String("pod.uid", string(pod.Pod.UID)),
 	)
 
+	// A create repeated after a timeout must not submit a second job for the same pod.
+	uid := string(pod.Pod.UID)
+	audit.AddPod(r.Context(), audit.Pod{Namespace: pod.Pod.Namespace, Name: pod.Pod.Name, UID: uid})
+	idempotencyKey := r.Header.Get(IdempotencyKeyHeader)
+	existing, err := PodCreates.begin(uid, idempotencyKey)
+	if err != nil {
+		statusCode = http.StatusUnprocessableEntity
+		log.G(h.Ctx).Error(err)
+		w.WriteHeader(statusCode)
+		return
+	}
+	if existing != nil {
+		audit.SetJobID(r.Context(), uid, existing.result.PodJID)
+		h.replayCreate(w, pod, existing, span)
+		return
+	}
+	created := false
+	defer func() {
+		if !created {
+			PodCreates.abort(uid, idempotencyKey)
+		}
+	}()
+
+	sidecar, err := h.routePod(&pod.Pod)
+	if err != nil {
+		statusCode = http.StatusBadRequest
+		log.G(h.Ctx).Error(err)
+		w.WriteHeader(statusCode)
+		return
+	}
+	span.SetAttributes(attribute.String("sidecar.name", sidecar.Name))
+
+	// Creates over the admission limits are answered at once, and forwarded when their turn comes.
+	sessionContext := GetSessionContext(r)
+	ready := make(chan struct{})
+	defer close(ready)
+	var tenant string
+	var admitted bool
+	tenant, admitted = Admission.admit(&pod.Pod, func() {
+		<-ready
+		h.createQueued(pod, sidecar, tenant, idempotencyKey, sessionContext)
+	})
+	span.SetAttributes(attribute.String("admission.tenant", tenant), attribute.Bool("admission.queued", !admitted))
+	if !admitted {
+		created = true
+		h.queueCreate(w, pod, tenant, idempotencyKey)
+		return
+	}
+	defer Admission.release(tenant)
+
+	// the build of the job script stops when the Virtual Kubelet gives up
+	result, err := h.forwardCreate(r.Context(), w, pod, sidecar, sessionContext, start, span)
+	if err != nil {
+		return
+	}
+	created = true
+	audit.SetJobID(r.Context(), uid, result.PodJID)
+	PodCreates.complete(uid, idempotencyKey, result)
+	PodOwners.set(uid, sidecar.Name)
+	KnownPods.remember(&pod.Pod)
+}
+
+// forwardCreate gathers the data of a pod, builds its job script when configured, and sends it
+// to the sidecar. Errors are written to w, and returned. Once ctx is done the job script is no
+// longer built and the sidecar is not called; a create already sent to the sidecar is left
+// to complete, so that the job it submits is not lost.
+func (h *InterLinkHandler) forwardCreate(ctx context.Context, w http.ResponseWriter, pod types.PodCreateRequests, sidecar *Sidecar, sessionContext string, start int64, span trace.Span) (types.CreateStruct, error) {
+	var statusCode int
+	var req *http.Request
+	var bodyBytes []byte
+
 	data, err := getData(h.Ctx, h.Config, pod, span)
 	if err != nil {
 		statusCode = http.StatusInternalServerError
 		log.G(h.Ctx).Error(err)
 		w.WriteHeader(statusCode)
-		return
+		return types.CreateStruct{}, err
 	}
 
 	if log.G(h.Ctx).Logger.IsLevelEnabled(log.DebugLevel) {
@@ -95,8 +181,11 @@ func (h *InterLinkHandler) CreateHandler(w http.ResponseWriter, r *http.Request)
 	case pod.JobScriptBuilderURL != "":
 		log.G(h.Ctx).Info("JobScriptBuilderURL: ", pod.JobScriptBuilderURL)
 		if h.Config.JobScriptBuildConfig == nil {
-			log.L.Error(fmt.Errorf("JobScript URL requested, but interlink does not have any Script build config set"))
-			return
+			err = errors.New("JobScript URL requested, but interlink does not have any Script build config set")
+			log.G(h.Ctx).Error(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(err.Error()))
+			return types.CreateStruct{}, err
 		}
 		log.G(h.Ctx).Info("InterLink: asking JobScriptURL for job.sh")
 
@@ -104,56 +193,43 @@ func (h *InterLinkHandler) CreateHandler(w http.ResponseWriter, r *http.Request)
 
 		bodyBytes, err = json.Marshal(data)
 		if err != nil {
-			log.G(h.Ctx).Errorf("Failed to marshal job data: %v | data: %+v", err, data)
+			log.G(h.Ctx).Errorf("Failed to marshal job data: %v | data: %s", err, redactedPodData(data))
 			w.WriteHeader(http.StatusInternalServerError)
-			return
+			return types.CreateStruct{}, err
 		}
-		log.G(h.Ctx).Debugf("Marshalled job data: %s", string(bodyBytes))
-		log.G(h.Ctx).Infof("POST payload to JobScriptBuilder: %s", string(bodyBytes))
-
-		reader := bytes.NewReader(bodyBytes)
-		req, err = http.NewRequest(http.MethodPost, pod.JobScriptBuilderURL, reader)
-		if err != nil {
-			log.G(h.Ctx).Errorf("Failed to create POST request to JobScriptBuilder: %v | URL: %s", err, pod.JobScriptBuilderURL)
-			return
-		}
-
-		sessionContext := GetSessionContext(r)
-		req.Header.Set("Content-Type", "application/json")
-
+		log.G(h.Ctx).Debugf("POST payload to JobScriptBuilder: %s", redactedPodData(data))
 		log.G(h.Ctx).Infof("Sending POST to JobScriptBuilder at %s with session: %+v", pod.JobScriptBuilderURL, sessionContext)
 
-		bodyBytesResp, err := ReqWithError(h.Ctx, req, w, start, span, false, true, sessionContext, http.DefaultClient)
+		data.JobScript, err = h.jobScriptBuilder().Build(ctx, pod.JobScriptBuilderURL, bodyBytes, sessionContext)
 		if err != nil {
-			log.G(h.Ctx).Errorf("JobScriptBuilder request failed: %v", err)
-			return
-		}
-
-		log.G(h.Ctx).Debugf("Received response from JobScriptBuilder: %s", string(bodyBytesResp))
-
-		data.JobScript = string(bodyBytesResp)
-		log.G(h.Ctx).Infof("Updated JobScript successfully (len=%d)", len(data.JobScript))
-
-	case h.Config.JobScriptTemplate != "":
-
-		tmp, err := template.ParseFiles(h.Config.JobScriptTemplate)
-		if err != nil {
-			statusCode = http.StatusInternalServerError
+			// The Virtual Kubelet shows the body of a failed create on the pod.
+			statusCode = http.StatusBadGateway
+			var builderErr *JobScriptBuilderError
+			if errors.As(err, &builderErr) {
+				span.SetAttributes(attribute.Int("jobscript.builder.attempts", builderErr.Attempts))
+				if builderErr.Timeout() {
+					statusCode = http.StatusGatewayTimeout
+				}
+			}
+			err = fmt.Errorf("unable to build the job script of pod %s/%s: %w", pod.Pod.Namespace, pod.Pod.Name, err)
 			log.G(h.Ctx).Error(err)
 			w.WriteHeader(statusCode)
-			return
+			_, _ = w.Write([]byte(html.EscapeString(err.Error())))
+			return types.CreateStruct{}, err
 		}
+		log.G(h.Ctx).Infof("Updated JobScript successfully (len=%d)", len(data.JobScript))
 
-		var tpl bytes.Buffer
-		err = tmp.Execute(&tpl, data)
+	case h.JobScripts != nil:
+		data.JobScript, err = h.JobScripts.Render(&data.Pod, data)
 		if err != nil {
 			statusCode = http.StatusInternalServerError
+			if errors.Is(err, jobscript.ErrUnknownTemplate) {
+				statusCode = http.StatusBadRequest
+			}
 			log.G(h.Ctx).Error(err)
 			w.WriteHeader(statusCode)
-			return
+			return types.CreateStruct{}, err
 		}
-
-		data.JobScript = tpl.String()
 	}
 
 	// updated to handle single data
@@ -163,30 +239,162 @@ func (h *InterLinkHandler) CreateHandler(w http.ResponseWriter, r *http.Request)
 	if ok {
 		retrievedData.Pod.DeepCopy().Status.PodIP = podIP
 	}
+	// The job script is built from the plain data: only the plugin can read the Secrets it gets.
+	if sidecar.SecretKey != nil {
+		if err = envelope.SealPodData(sidecar.SecretKey, &retrievedData); err != nil {
+			statusCode = http.StatusInternalServerError
+			log.G(h.Ctx).Error("Unable to encrypt the Secrets sent to sidecar ", sidecar.Name, ": ", err)
+			w.WriteHeader(statusCode)
+			return types.CreateStruct{}, err
+		}
+		span.SetAttributes(attribute.String("secrets.key_id", envelope.KeyID(sidecar.SecretKey)))
+	}
+
 	bodyBytes, err = json.Marshal(retrievedData)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		log.G(h.Ctx).Error(err)
-		return
+		return types.CreateStruct{}, err
+	}
+	if log.G(h.Ctx).Logger.IsLevelEnabled(log.DebugLevel) {
+		log.G(h.Ctx).Debug(redactedPodData(retrievedData))
 	}
-	log.G(h.Ctx).Debug(string(bodyBytes))
 	reader := bytes.NewReader(bodyBytes)
 
 	log.G(h.Ctx).Info(req)
-	req, err = http.NewRequest(http.MethodPost, h.SidecarEndpoint+"/create", reader)
+	req, err = http.NewRequest(http.MethodPost, sidecar.Endpoint+"/create", reader)
 	if err != nil {
 		statusCode = http.StatusInternalServerError
 		w.WriteHeader(statusCode)
 		log.G(h.Ctx).Error(err)
-		return
+		return types.CreateStruct{}, err
 	}
 
-	log.G(h.Ctx).Info("InterLink: forwarding Create call to sidecar")
+	if err = ctx.Err(); err != nil {
+		log.G(h.Ctx).Warning("Create of pod ", pod.Pod.Namespace, "/", pod.Pod.Name, " abandoned before reaching sidecar ", sidecar.Name, ": ", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return types.CreateStruct{}, err
+	}
+	log.G(h.Ctx).Info("InterLink: forwarding Create call to sidecar ", sidecar.Name)
 
-	sessionContext := GetSessionContext(r)
-	_, err = ReqWithError(h.Ctx, req, w, start, span, true, false, sessionContext, h.ClientHTTP)
+	bodyBytes, err = ReqWithError(h.Ctx, req, w, start, span, true, true, sessionContext, sidecar.ClientHTTP)
 	if err != nil {
 		log.L.Error(err)
+		return types.CreateStruct{}, err
+	}
+
+	var result types.CreateStruct
+	if err = json.Unmarshal(bodyBytes, &result); err != nil {
+		log.G(h.Ctx).Warning("Unable to read the job ID returned by sidecar ", sidecar.Name, ": ", err)
+		result.PodUID = string(pod.Pod.UID)
+	}
+	return result, nil
+}
+
+// queueCreate answers the create of a pod queued for admission. The pod gets no job ID
+// yet, and reports QueuedReason in its status until the sidecar takes it.
+func (h *InterLinkHandler) queueCreate(w http.ResponseWriter, pod types.PodCreateRequests, tenant, idempotencyKey string) {
+	log.G(h.Ctx).Info("Pod ", pod.Pod.Namespace, "/", pod.Pod.Name, " queued for admission (tenant ", tenant, ")")
+	result := types.CreateStruct{PodUID: string(pod.Pod.UID)}
+	PodCreates.complete(string(pod.Pod.UID), idempotencyKey, result)
+	if result.PodUID != "" {
+		updateStatuses([]types.PodStatus{admissionStatus(&pod.Pod, tenant, nil)})
+	}
+
+	bodyBytes, err := json.Marshal(result)
+	if err != nil {
+		log.G(h.Ctx).Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	if _, err = w.Write(bodyBytes); err != nil {
+		log.G(h.Ctx).Error(errors.New("failed to write to http buffer"))
+	}
+}
+
+// createQueued forwards the create of a pod once the admission queue gives it a slot. The
+// Virtual Kubelet was already answered: a failure is reported in the status of the pod.
+func (h *InterLinkHandler) createQueued(pod types.PodCreateRequests, sidecar *Sidecar, tenant, idempotencyKey, sessionContext string) {
+	start := time.Now().UnixMicro()
+	tracer := otel.Tracer("interlink-API")
+	_, span := tracer.Start(h.Ctx, "CreateQueuedAPI", trace.WithAttributes(
+		attribute.Int64("start.timestamp", start),
+		attribute.String("pod.name", pod.Pod.Name),
+		attribute.String("pod.namespace", pod.Pod.Namespace),
+		attribute.String("pod.uid", string(pod.Pod.UID)),
+		attribute.String("sidecar.name", sidecar.Name),
+		attribute.String("admission.tenant", tenant),
+	))
+	defer span.End()
+	defer types.SetDurationSpan(start, span)
+
+	log.G(h.Ctx).Info("Pod ", pod.Pod.Namespace, "/", pod.Pod.Name, " admitted from the queue (tenant ", tenant, ")")
+	uid := string(pod.Pod.UID)
+	response := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+	ctx, cancel := Admission.forwardContext(h.Ctx, uid)
+	defer cancel()
+	result, err := h.forwardCreate(ctx, response, pod, sidecar, sessionContext, start, span)
+	if Admission.forwarded(uid) {
+		// the pod was deleted while its create was in flight: the delete left it to us
+		span.SetAttributes(attribute.Bool("pod.deleted", true))
+		PodCreates.forget(recordID(uid, idempotencyKey))
+		if err == nil {
+			h.undoCreate(pod, sidecar, sessionContext)
+		}
+		return
+	}
+	if err != nil {
+		log.G(h.Ctx).Error("Queued create of pod ", pod.Pod.Namespace, "/", pod.Pod.Name, " failed: ", err)
+		PodCreates.forget(recordID(uid, idempotencyKey))
+		if uid != "" {
+			Admission.fail(uid)
+			updateStatuses([]types.PodStatus{admissionStatus(&pod.Pod, tenant, err)})
+		}
 		return
 	}
+	PodCreates.complete(uid, idempotencyKey, result)
+	PodOwners.set(uid, sidecar.Name)
+	KnownPods.remember(&pod.Pod)
+}
+
+// undoCreate deletes on the sidecar a queued pod deleted while its create was in flight.
+func (h *InterLinkHandler) undoCreate(pod types.PodCreateRequests, sidecar *Sidecar, sessionContext string) {
+	log.G(h.Ctx).Info("Pod ", pod.Pod.Namespace, "/", pod.Pod.Name, " was deleted while being created, deleting it from sidecar ", sidecar.Name)
+	body, err := json.Marshal(pod.Pod)
+	if err != nil {
+		log.G(h.Ctx).Error(err)
+		return
+	}
+	code, respBody, err := sidecar.do(h.Ctx, http.MethodPost, "/delete", body, sessionContext)
+	if err == nil && code != http.StatusOK {
+		err = fmt.Errorf("sidecar %s returned HTTP %d: %s", sidecar.Name, code, bytes.TrimSpace(respBody))
+	}
+	if err != nil {
+		log.G(h.Ctx).Error("Unable to delete pod ", pod.Pod.Namespace, "/", pod.Pod.Name, " created after its deletion: ", err)
+	}
+}
+
+// replayCreate answers a create call for a pod that was already created, or is being created,
+// without calling the sidecar again.
+func (h *InterLinkHandler) replayCreate(w http.ResponseWriter, pod types.PodCreateRequests, record *createRecord, span trace.Span) {
+	if record.pending {
+		log.G(h.Ctx).Warning("Rejecting create of pod ", pod.Pod.Namespace, "/", pod.Pod.Name, ": a create call is already in progress")
+		span.SetAttributes(attribute.Bool("create.duplicate", true))
+		http.Error(w, "a create call for this pod is already in progress", http.StatusConflict)
+		return
+	}
+
+	log.G(h.Ctx).Info("Pod ", pod.Pod.Namespace, "/", pod.Pod.Name, " already created with job ID ", record.result.PodJID, ", not calling the sidecar again")
+	span.SetAttributes(attribute.Bool("create.replayed", true))
+	bodyBytes, err := json.Marshal(record.result)
+	if err != nil {
+		log.G(h.Ctx).Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	if _, err = w.Write(bodyBytes); err != nil {
+		log.G(h.Ctx).Error(errors.New("failed to write to http buffer"))
+	}
 }
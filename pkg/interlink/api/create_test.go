@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+	"github.com/interlink-hq/interlink/pkg/interlink/audit"
+	"github.com/interlink-hq/interlink/pkg/interlink/envelope"
+	"github.com/interlink-hq/interlink/pkg/interlink/jobscript"
+)
+
+func TestCreateHandler_EncryptsSecrets(t *testing.T) {
+	key, err := envelope.GenerateKey()
+	require.NoError(t, err)
+
+	var received types.RetrievedPodData
+	server, endpoint, client := newUnixTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		_ = json.NewEncoder(w).Encode(types.CreateStruct{PodUID: string(received.Pod.UID), PodJID: "1"})
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { PodCreates = MutexCreates{} })
+	h := &InterLinkHandler{Ctx: context.Background(), SidecarEndpoint: endpoint, ClientHTTP: client, SecretKey: key.PublicKey()}
+
+	pod := testPod("uid-secret", "default", nil, nil)
+	pod.Spec.Volumes = []v1.Volume{{Name: "creds", VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: "creds"}}}}
+	pod.Spec.Containers = []v1.Container{{Name: "main", VolumeMounts: []v1.VolumeMount{{Name: "creds", MountPath: "/creds"}}}}
+	body, err := json.Marshal(types.PodCreateRequests{
+		Pod: *pod,
+		Secrets: []v1.Secret{{
+			ObjectMeta: metav1.ObjectMeta{Name: "creds", Namespace: "default"},
+			Data:       map[string][]byte{"password": []byte("s3cr3t")},
+		}},
+	})
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	h.CreateHandler(rec, httptest.NewRequest(http.MethodPost, "/create", strings.NewReader(string(body))))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	t.Cleanup(func() {
+		PodOwners.forget("uid-secret")
+		KnownPods.forget("uid-secret")
+	})
+
+	require.Len(t, received.Containers, 1)
+	require.Len(t, received.Containers[0].Secrets, 1)
+	secret := received.Containers[0].Secrets[0]
+	assert.True(t, envelope.IsSealed(&secret))
+	assert.NotEqual(t, []byte("s3cr3t"), secret.Data["password"])
+
+	require.NoError(t, envelope.OpenPodData(key, &received))
+	assert.Equal(t, []byte("s3cr3t"), received.Containers[0].Secrets[0].Data["password"])
+}
+
+func TestRedactedPodData(t *testing.T) {
+	data := types.RetrievedPodData{Containers: []types.RetrievedContainer{{
+		Name: "main",
+		Secrets: []v1.Secret{{
+			Data:       map[string][]byte{"password": []byte("s3cr3t")},
+			StringData: map[string]string{"token": "abc"},
+		}},
+	}}}
+
+	redacted := redactedPodData(data)
+	assert.NotContains(t, redacted, "abc")
+	assert.NotContains(t, redacted, "czNjcjN0")
+	assert.Contains(t, redacted, "REDACTED")
+	assert.Equal(t, []byte("s3cr3t"), data.Containers[0].Secrets[0].Data["password"], "the data itself is not modified")
+}
+
+func TestCreateHandler_Audit(t *testing.T) {
+	h, _ := newCreateSidecar(t, nil)
+	path := filepath.Join(t.TempDir(), "audit.log")
+	logger, err := audit.OpenLogger(path, 1<<20, 1)
+	require.NoError(t, err)
+
+	body, err := json.Marshal(types.PodCreateRequests{Pod: *testPod("uid-audit", "default", nil, nil)})
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	audit.Middleware(logger, http.HandlerFunc(h.CreateHandler)).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/create", strings.NewReader(string(body))))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, logger.Close())
+	t.Cleanup(func() {
+		PodOwners.forget("uid-audit")
+		KnownPods.forget("uid-audit")
+	})
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var record audit.Record
+	require.NoError(t, json.Unmarshal(data, &record))
+	assert.Equal(t, "/create", record.Endpoint)
+	assert.Equal(t, []audit.Pod{{Namespace: "default", Name: "pod-uid-audit", UID: "uid-audit", JobID: "1"}}, record.Pods)
+	assert.Equal(t, http.StatusOK, record.StatusCode)
+}
+
+func TestCreateHandler_JobScriptTemplate(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "default.tmpl"), []byte(`default {{ .Pod.Name }}`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "gpu.tmpl"), []byte(`gpu {{ .Pod.Name }}`), 0o600))
+	engine, err := jobscript.NewEngine(types.Config{JobScriptTemplateDir: dir})
+	require.NoError(t, err)
+
+	var received types.RetrievedPodData
+	server, endpoint, client := newUnixTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		_ = json.NewEncoder(w).Encode(types.CreateStruct{PodUID: string(received.Pod.UID), PodJID: "1"})
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { PodCreates = MutexCreates{} })
+	h := &InterLinkHandler{Ctx: context.Background(), SidecarEndpoint: endpoint, ClientHTTP: client, JobScripts: engine}
+
+	create := func(uid, template string) *httptest.ResponseRecorder {
+		var annotations map[string]string
+		if template != "" {
+			annotations = map[string]string{jobscript.TemplateAnnotation: template}
+		}
+		body, err := json.Marshal(types.PodCreateRequests{Pod: *testPod(uid, "default", nil, annotations)})
+		require.NoError(t, err)
+		rec := httptest.NewRecorder()
+		h.CreateHandler(rec, httptest.NewRequest(http.MethodPost, "/create", strings.NewReader(string(body))))
+		t.Cleanup(func() {
+			PodOwners.forget(uid)
+			KnownPods.forget(uid)
+		})
+		return rec
+	}
+
+	require.Equal(t, http.StatusOK, create("uid-default", "").Code)
+	assert.Equal(t, "default pod-uid-default", received.JobScript)
+
+	require.Equal(t, http.StatusOK, create("uid-gpu", "gpu").Code)
+	assert.Equal(t, "gpu pod-uid-gpu", received.JobScript)
+
+	assert.Equal(t, http.StatusBadRequest, create("uid-unknown", "missing").Code)
+}
@@ -11,6 +11,7 @@ import (
 	v1 "k8s.io/api/core/v1"
 
 	types "github.com/interlink-hq/interlink/pkg/interlink"
+	"github.com/interlink-hq/interlink/pkg/interlink/audit"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -20,7 +21,11 @@ import (
 // DeleteHandler handles HTTP DELETE requests to remove pods from remote systems.
 // This endpoint processes pod deletion requests from the Virtual Kubelet by:
 //  1. Removing the pod from the local status cache
-//  2. Forwarding the deletion request to the sidecar plugin
+//  2. Removing the pod from the admission queue, when it was still waiting there
+//     (the sidecar is not called in that case; a queued create already forwarded is
+//     deleted from the sidecar once it returns)
+//  3. Forwarding the deletion request to the sidecar plugin owning the pod
+//  4. Clearing the create record of the pod, so that it can be created again
 //
 // The handler ensures cleanup of both local state and remote resources.
 //
@@ -67,8 +72,33 @@ func (h *InterLinkHandler) DeleteHandler(w http.ResponseWriter, r *http.Request)
 		attribute.String("pod.uid", string(pod.UID)),
 	)
 
+	audit.AddPod(r.Context(), audit.Pod{Namespace: pod.Namespace, Name: pod.Name, UID: string(pod.UID), JobID: pod.Annotations["JobID"]})
+
+	sidecar, err := h.routePod(pod)
+	if err != nil {
+		statusCode = http.StatusBadRequest
+		w.WriteHeader(statusCode)
+		log.G(h.Ctx).Error(err)
+		return
+	}
+	span.SetAttributes(attribute.String("sidecar.name", sidecar.Name))
+
 	deleteCachedStatus(string(pod.UID))
-	req, err = http.NewRequest(http.MethodPost, h.SidecarEndpoint+"/delete", reader)
+	KnownPods.forget(string(pod.UID))
+	if h.LogArchive != nil {
+		if err := h.LogArchive.Remove(pod.Namespace, string(pod.UID)); err != nil {
+			log.G(h.Ctx).Error("Unable to remove the archived logs of pod ", pod.Namespace, "/", pod.Name, ": ", err)
+		}
+	}
+	if Admission.cancel(string(pod.UID)) {
+		// the pod never reached the sidecar, or its create in flight is undone when it returns
+		log.G(h.Ctx).Info("Pod ", pod.Namespace, "/", pod.Name, " removed from the admission queue")
+		PodOwners.forget(string(pod.UID))
+		PodCreates.forget(string(pod.UID))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	req, err = http.NewRequest(http.MethodPost, sidecar.Endpoint+"/delete", reader)
 	if err != nil {
 		statusCode = http.StatusInternalServerError
 		w.WriteHeader(statusCode)
@@ -77,11 +107,13 @@ func (h *InterLinkHandler) DeleteHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	log.G(h.Ctx).Info("InterLink: forwarding Delete call to sidecar")
+	log.G(h.Ctx).Info("InterLink: forwarding Delete call to sidecar ", sidecar.Name)
 	sessionContext := GetSessionContext(r)
-	_, err = ReqWithError(h.Ctx, req, w, start, span, true, false, sessionContext, h.ClientHTTP)
+	_, err = ReqWithError(h.Ctx, req, w, start, span, true, false, sessionContext, sidecar.ClientHTTP)
 	if err != nil {
 		log.L.Error(err)
 		return
 	}
+	PodOwners.forget(string(pod.UID))
+	PodCreates.forget(string(pod.UID))
 }
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/log"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+	"github.com/interlink-hq/interlink/pkg/interlink/audit"
+	"github.com/interlink-hq/interlink/pkg/interlink/channelstream"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	trace "go.opentelemetry.io/otel/trace"
+)
+
+// validateExecRequest checks the pod and container of an exec request, as validateLogRequest does.
+func validateExecRequest(req types.ExecRequest) error {
+	if err := validateLogRequest(types.LogStruct{Namespace: req.Namespace, PodUID: req.PodUID, ContainerName: req.ContainerName}); err != nil {
+		return err
+	}
+	if len(req.Command) == 0 {
+		return errors.New("missing command")
+	}
+	if !req.Stdin && !req.Stdout && !req.Stderr {
+		return errors.New("at least one of stdin, stdout and stderr is required")
+	}
+	return nil
+}
+
+// ExecHandler handles HTTP POST requests running a command in a container, for kubectl exec.
+// The request and the response bodies are channel streams (see the channelstream package):
+// the request starts with a JSON-encoded ExecRequest, and carries stdin and the terminal
+// resizes; the response carries stdout and stderr, and ends with the status of the command.
+// interLink relays both streams to and from the /exec endpoint of the plugin of the pod, and
+// holds no state about the session.
+//
+// HTTP Status Codes:
+//   - 200: Session opened, the outcome of the command is in the status frame
+//   - 400: Bad request (the stream does not start with a valid ExecRequest)
+//   - 501: The plugin does not support exec
+//   - 502: The plugin failed to open the session
+func (h *InterLinkHandler) ExecHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now().UnixMicro()
+	tracer := otel.Tracer("interlink-API")
+	_, span := tracer.Start(h.Ctx, "ExecAPI", trace.WithAttributes(
+		attribute.Int64("start.timestamp", start),
+	))
+	defer span.End()
+	defer types.SetDurationSpan(start, span)
+	defer types.SetInfoFromHeaders(span, &r.Header)
+
+	sessionContext := GetSessionContext(r)
+	sessionContextMessage := GetSessionContextMessage(sessionContext)
+	span.SetAttributes(attribute.String("session.id", sessionContext))
+	log.G(h.Ctx).Info(sessionContextMessage, "InterLink: received Exec call")
+
+	// the session reads stdin while it writes the output, and the errors must not wait for the
+	// rest of the request
+	enableFullDuplex(w)
+
+	body := channelstream.NewReader(r.Body)
+	channel, payload, err := body.Next()
+	if err != nil || channel != channelstream.ChannelRequest {
+		http.Error(w, "the stream must start with the exec request", http.StatusBadRequest)
+		return
+	}
+	var execRequest types.ExecRequest
+	if err := json.Unmarshal(payload, &execRequest); err != nil {
+		http.Error(w, "invalid exec request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateExecRequest(execRequest); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	span.SetAttributes(
+		attribute.String("pod.name", execRequest.PodName),
+		attribute.String("pod.namespace", execRequest.Namespace),
+		attribute.String("pod.uid", execRequest.PodUID),
+		attribute.String("container.name", execRequest.ContainerName),
+		attribute.Bool("exec.tty", execRequest.TTY),
+	)
+	audit.AddPod(r.Context(), audit.Pod{Namespace: execRequest.Namespace, Name: execRequest.PodName, UID: execRequest.PodUID})
+	log.G(h.Ctx).Info(sessionContextMessage, "Exec in container ", execRequest.ContainerName, " of pod ",
+		execRequest.Namespace, "/", execRequest.PodName, ": ", strings.Join(execRequest.Command, " "))
+
+	sidecar := h.routeUID(execRequest.PodUID, execRequest.Namespace)
+	span.SetAttributes(attribute.String("sidecar.name", sidecar.Name))
+	h.relaySession(w, r, sidecar, "/exec", payload, body, sessionContext)
+}
+
+// enableFullDuplex lets an HTTP/1 handler write its response before it has read the whole
+// request body. HTTP/2 handlers always can.
+func enableFullDuplex(w http.ResponseWriter) {
+	_ = http.NewResponseController(w).EnableFullDuplex()
+}
+
+// relaySession opens an interactive session on a sidecar endpoint, sending it the request
+// frame already read from the client, then relays the frames in both directions until the
+// sidecar ends the session or the client goes away.
+func (h *InterLinkHandler) relaySession(w http.ResponseWriter, r *http.Request, sidecar *Sidecar, path string, request []byte, body *channelstream.Reader, sessionContext string) {
+	sessionContextMessage := GetSessionContextMessage(sessionContext)
+	rc := http.NewResponseController(w)
+	// sessions are interactive: they outlive the timeouts of the server
+	if err := rc.SetReadDeadline(time.Time{}); err != nil {
+		log.G(h.Ctx).Debug(sessionContextMessage, "unable to clear the read deadline: ", err)
+	}
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.G(h.Ctx).Debug(sessionContextMessage, "unable to clear the write deadline: ", err)
+	}
+
+	ctx, cancel := context.WithCancel(withoutHeaderTimeout(r.Context()))
+	defer cancel()
+	upstreamBody, upstreamPipe := io.Pipe()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sidecar.Endpoint+path, upstreamBody)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	req.Header.Set("Content-Type", channelstream.ContentType)
+	// a plugin answering without reading the stream, e.g. with a 404, must not wait for its end
+	req.Header.Set("Expect", "100-continue")
+	AddSessionContext(req, sessionContext)
+	if !isSafeURL(req.URL.String()) {
+		log.G(h.Ctx).Error(sessionContextMessage, "potential SSRF detected: ", req.URL.String())
+		http.Error(w, "invalid sidecar URL", http.StatusInternalServerError)
+		return
+	}
+
+	// client to sidecar: the request frame, then stdin and the resizes
+	clientDone := make(chan struct{})
+	go func() {
+		defer close(clientDone)
+		upstream := channelstream.NewWriter(upstreamPipe)
+		err := upstream.WriteFrame(channelstream.ChannelRequest, request)
+		if err == nil {
+			err = channelstream.Relay(upstream, body)
+		}
+		if err != nil && ctx.Err() == nil {
+			log.G(h.Ctx).Debug(sessionContextMessage, "client stream ended: ", err)
+			cancel()
+		}
+		upstreamPipe.CloseWithError(err)
+	}()
+	defer func() {
+		// unblock the relay of the client stream, which must not outlive the handler
+		cancel()
+		upstreamBody.Close()
+		_ = rc.SetReadDeadline(time.Now())
+		<-clientDone
+	}()
+
+	resp, err := sidecar.ClientHTTP.Do(req) // #nosec G704
+	if err != nil {
+		log.G(h.Ctx).Error(sessionContextMessage, err)
+		http.Error(w, fmt.Sprintf("unable to reach sidecar %s: %v", sidecar.Name, err), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented:
+		http.Error(w, fmt.Sprintf("plugin %s does not support %s", sidecar.Name, strings.TrimPrefix(path, "/")), http.StatusNotImplemented)
+		return
+	case resp.StatusCode != http.StatusOK:
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		log.G(h.Ctx).Error(sessionContextMessage, "sidecar ", sidecar.Name, " returned HTTP ", resp.StatusCode, ": ", string(message))
+		http.Error(w, fmt.Sprintf("sidecar %s returned HTTP %d: %s", sidecar.Name, resp.StatusCode, strings.TrimSpace(string(message))), http.StatusBadGateway)
+		return
+	}
+
+	// sidecar to client: stdout, stderr and the status
+	w.Header().Set("Content-Type", channelstream.ContentType)
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		log.G(h.Ctx).Debug(sessionContextMessage, "unable to flush: ", err)
+	}
+	if err := channelstream.Relay(channelstream.NewWriter(w), channelstream.NewReader(resp.Body)); err != nil && ctx.Err() == nil {
+		log.G(h.Ctx).Warning(sessionContextMessage, "session with sidecar ", sidecar.Name, " interrupted: ", err)
+	}
+}
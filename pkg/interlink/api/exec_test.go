@@ -0,0 +1,185 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+	"github.com/interlink-hq/interlink/pkg/interlink/channelstream"
+	"github.com/interlink-hq/interlink/pkg/interlink/compression"
+)
+
+const execPodUID = "12345678-1234-1234-1234-123456789012"
+
+// echoExecSidecar answers the exec sessions by echoing stdin to stdout in upper case until
+// stdin is closed, then exits with code 3.
+func echoExecSidecar(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		assert.NoError(t, rc.EnableFullDuplex())
+		in := channelstream.NewReader(r.Body)
+		channel, payload, err := in.Next()
+		if !assert.NoError(t, err) || !assert.Equal(t, channelstream.ChannelRequest, channel) {
+			return
+		}
+		var req types.ExecRequest
+		assert.NoError(t, json.Unmarshal(payload, &req))
+		assert.Equal(t, []string{"cat"}, req.Command)
+
+		w.Header().Set("Content-Type", channelstream.ContentType)
+		w.WriteHeader(http.StatusOK)
+		assert.NoError(t, rc.Flush())
+		out := channelstream.NewWriter(w)
+		for {
+			channel, payload, err := in.Next()
+			if !assert.NoError(t, err) {
+				return
+			}
+			if channel == channelstream.ChannelClose {
+				break
+			}
+			if channel == channelstream.ChannelStdin {
+				assert.NoError(t, out.WriteFrame(channelstream.ChannelStdout, bytes.ToUpper(payload)))
+			}
+		}
+		assert.NoError(t, out.WriteJSON(channelstream.ChannelStatus, channelstream.Status{ExitCode: 3}))
+	}
+}
+
+// openExec opens an exec session on an interLink server, and returns the writer of the
+// request stream and the response.
+func openExec(t *testing.T, url string, request types.ExecRequest) (*channelstream.Writer, *io.PipeWriter, *http.Response) {
+	t.Helper()
+	body, pipe := io.Pipe()
+	t.Cleanup(func() { pipe.Close() })
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url+"/exec", body)
+	require.NoError(t, err)
+
+	in := channelstream.NewWriter(pipe)
+	go func() {
+		_ = in.WriteJSON(channelstream.ChannelRequest, request)
+	}()
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return in, pipe, resp
+}
+
+func TestExecHandler(t *testing.T) {
+	sidecar, endpoint, client := newUnixTestServer(t, echoExecSidecar(t))
+	defer sidecar.Close()
+	testExecSession(t, &InterLinkHandler{Ctx: context.Background(), SidecarEndpoint: endpoint, ClientHTTP: client})
+}
+
+// TestExecHandler_Compression checks that the sessions are not held back by the compression
+// of the request bodies, which would wait for the end of the stream.
+func TestExecHandler_Compression(t *testing.T) {
+	exec := echoExecSidecar(t)
+	plugin := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/exec") {
+			exec(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("[]"))
+	})
+	sidecar, endpoint, client := newUnixTestServer(t, compression.Middleware(compression.Config{Enabled: true}, plugin))
+	defer sidecar.Close()
+	client = &http.Client{Transport: compression.NewTransport(client.Transport, compression.Config{Enabled: true}, nil)}
+
+	// the plugin advertises the encodings it accepts
+	resp, err := client.Post(endpoint+"/status", "application/json", strings.NewReader("[]"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.NotEmpty(t, resp.Header.Get("Accept-Encoding"))
+
+	testExecSession(t, &InterLinkHandler{Ctx: context.Background(), SidecarEndpoint: endpoint, ClientHTTP: client})
+}
+
+// testExecSession runs a session against echoExecSidecar through h.
+func testExecSession(t *testing.T, h *InterLinkHandler) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(h.ExecHandler))
+	defer server.Close()
+
+	in, _, resp := openExec(t, server.URL, types.ExecRequest{
+		Namespace: "default", PodUID: execPodUID, PodName: "pod", ContainerName: "main",
+		Command: []string{"cat"}, Stdin: true, Stdout: true,
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	out := channelstream.NewReader(resp.Body)
+
+	// the output comes back while the session is open
+	require.NoError(t, in.WriteFrame(channelstream.ChannelStdin, []byte("hello\n")))
+	channel, payload, err := out.Next()
+	require.NoError(t, err)
+	assert.Equal(t, channelstream.ChannelStdout, channel)
+	assert.Equal(t, "HELLO\n", string(payload))
+
+	require.NoError(t, in.CloseChannel(channelstream.ChannelStdin))
+	channel, payload, err = out.Next()
+	require.NoError(t, err)
+	require.Equal(t, channelstream.ChannelStatus, channel)
+	var status channelstream.Status
+	require.NoError(t, json.Unmarshal(payload, &status))
+	assert.Equal(t, 3, status.ExitCode)
+}
+
+func TestExecHandler_NotSupported(t *testing.T) {
+	sidecar, endpoint, client := newUnixTestServer(t, http.NotFoundHandler())
+	defer sidecar.Close()
+	h := &InterLinkHandler{Ctx: context.Background(), SidecarEndpoint: endpoint, ClientHTTP: client}
+	server := httptest.NewServer(http.HandlerFunc(h.ExecHandler))
+	defer server.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, pipe, resp := openExec(t, server.URL, types.ExecRequest{
+			Namespace: "default", PodUID: execPodUID, ContainerName: "main", Command: []string{"sh"}, Stdout: true,
+		})
+		assert.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+		message, _ := io.ReadAll(resp.Body)
+		assert.Contains(t, string(message), "does not support exec")
+		pipe.Close()
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the exec call did not end")
+	}
+}
+
+func TestExecHandler_InvalidRequest(t *testing.T) {
+	h := &InterLinkHandler{Ctx: context.Background()}
+	tests := []struct {
+		name string
+		body func(w *channelstream.Writer)
+	}{
+		{"no request frame", func(w *channelstream.Writer) { _ = w.WriteFrame(channelstream.ChannelStdin, []byte("x")) }},
+		{"no command", func(w *channelstream.Writer) {
+			_ = w.WriteJSON(channelstream.ChannelRequest, types.ExecRequest{Namespace: "default", PodUID: execPodUID, Stdout: true})
+		}},
+		{"invalid pod UID", func(w *channelstream.Writer) {
+			_ = w.WriteJSON(channelstream.ChannelRequest, types.ExecRequest{Namespace: "default", PodUID: "../x", Command: []string{"sh"}, Stdout: true})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body bytes.Buffer
+			tt.body(channelstream.NewWriter(&body))
+			rec := httptest.NewRecorder()
+			h.ExecHandler(rec, httptest.NewRequest(http.MethodPost, "/exec", strings.NewReader(body.String())))
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		})
+	}
+}
@@ -2,6 +2,8 @@ package api
 
 import (
 	"context"
+	"encoding/json"
+	"reflect"
 	"strings"
 	"sync"
 	"time"
@@ -17,10 +19,75 @@ import (
 type MutexStatuses struct {
 	mu       sync.Mutex
 	Statuses map[string]types.PodStatus
+	// store makes the changes to Statuses durable. Nil means in-memory only.
+	store StatusStore
 }
 
 var PodStatuses MutexStatuses
 
+// InitPodStatuses opens the status store selected in the config and fills the PodStatuses
+// cache with the statuses it holds, so that a restarted interLink does not have to query
+// the sidecar again for pods it already knows about. The sidecars owning the pods are
+// restored in PodOwners, so that the pods keep reaching them whatever the routing rules.
+// The pods that were waiting in the admission queue, which is not persisted, are reported
+// as failed.
+func InitPodStatuses(ctx context.Context, config types.Config) error {
+	store, err := NewStatusStore(config)
+	if err != nil {
+		return err
+	}
+
+	stored, err := store.Load()
+	if err != nil {
+		store.Close()
+		return err
+	}
+	statuses := make(map[string]types.PodStatus, len(stored))
+	for uid, status := range stored {
+		statuses[uid] = status.PodStatus
+		if status.Sidecar != "" {
+			PodOwners.set(uid, status.Sidecar)
+		}
+	}
+
+	// the admission queue is in memory only: the pods it held are lost
+	if failed := Admission.failQueuedStatuses(statuses); len(failed) > 0 {
+		log.G(ctx).Warningf("Failing %d pods that were waiting in the admission queue", len(failed))
+		if err := store.Put(withOwners(failed)); err != nil {
+			store.Close()
+			return err
+		}
+	}
+
+	PodStatuses.mu.Lock()
+	PodStatuses.Statuses = statuses
+	PodStatuses.store = store
+	PodStatuses.mu.Unlock()
+
+	log.G(ctx).Infof("Loaded %d cached pod statuses from the %s status store", len(statuses), storeBackendName(config))
+	return nil
+}
+
+// ClosePodStatuses closes the status store backing the PodStatuses cache.
+func ClosePodStatuses() error {
+	PodStatuses.mu.Lock()
+	defer PodStatuses.mu.Unlock()
+
+	if PodStatuses.store == nil {
+		return nil
+	}
+	err := PodStatuses.store.Close()
+	PodStatuses.store = nil
+	return err
+}
+
+func storeBackendName(config types.Config) string {
+	if config.StatusStore.Backend == "" {
+		return StatusStoreMemory
+	}
+	return config.StatusStore.Backend
+}
+
 // getData retrieves ConfigMaps, Secrets and EmptyDirs from the provided pod by calling the retrieveData function.
 // The config is needed by the retrieveData function.
 // The function aggregates the return values of retrieveData function in a commonIL.RetrievedPodData variable and returns it, along with the first encountered error.
@@ -70,6 +137,33 @@ func getData(ctx context.Context, config types.Config, pod types.PodCreateReques
 	return retrievedData, nil
 }
 
+// redactedPodData returns the JSON form of data for the logs, with the Secret values replaced,
+// whether they are encrypted or not.
+func redactedPodData(data types.RetrievedPodData) string {
+	containers := make([]types.RetrievedContainer, len(data.Containers))
+	for i, container := range data.Containers {
+		secrets := make([]v1.Secret, len(container.Secrets))
+		for j, secret := range container.Secrets {
+			secrets[j] = *secret.DeepCopy()
+			for k := range secrets[j].Data {
+				secrets[j].Data[k] = []byte("REDACTED")
+			}
+			for k := range secrets[j].StringData {
+				secrets[j].StringData[k] = "REDACTED"
+			}
+		}
+		container.Secrets = secrets
+		containers[i] = container
+	}
+	data.Containers = containers
+
+	bodyBytes, err := json.Marshal(data)
+	if err != nil {
+		return err.Error()
+	}
+	return string(bodyBytes)
+}
+
 // retrieveData retrieves ConfigMaps, Secrets and EmptyDirs.
 // The config is needed to specify the EmptyDirs mounting point.
 // It returns the retrieved data in a variable of type commonIL.RetrievedContainer and the first encountered error.
@@ -153,7 +247,15 @@ func retrieveData(ctx context.Context, _ types.Config, pod types.PodCreateReques
 // deleteCachedStatus locks the map PodStatuses and delete the uid key from that map
 func deleteCachedStatus(uid string) {
 	PodStatuses.mu.Lock()
+	if old, ok := PodStatuses.Statuses[uid]; ok {
+		statusWatchers.publish(types.PodStatusEvent{Type: types.PodStatusEventDeleted, Status: old})
+	}
 	delete(PodStatuses.Statuses, uid)
+	if PodStatuses.store != nil {
+		if err := PodStatuses.store.Delete(uid); err != nil {
+			log.L.Error("unable to persist deletion of cached status for pod ", uid, ": ", err)
+		}
+	}
 	PodStatuses.mu.Unlock()
 }
 
@@ -164,14 +266,50 @@ func checkIfCached(uid string) bool {
 	return ok
 }
 
+// withOwners pairs the statuses with the sidecars owning their pods, for the status store.
+func withOwners(statuses []types.PodStatus) []StoredStatus {
+	stored := make([]StoredStatus, 0, len(statuses))
+	for _, status := range statuses {
+		owner, _ := PodOwners.get(status.PodUID)
+		stored = append(stored, StoredStatus{PodStatus: status, Sidecar: owner})
+	}
+	return stored
+}
+
 // updateStatuses locks and updates the PodStatuses map with the statuses contained in the returnedStatuses slice
 func updateStatuses(returnedStatuses []types.PodStatus) {
 	PodStatuses.mu.Lock()
 
+	var changed []types.PodStatus
 	for _, new := range returnedStatuses {
 		// log.G(ctx).Debug(PodStatuses.Statuses, new)
+		old, ok := PodStatuses.Statuses[new.PodUID]
+		if !ok || !reflect.DeepEqual(old, new) {
+			changed = append(changed, new)
+		}
+		// the logs of the pods that just completed are archived before the sidecars clean them up
+		if isTerminal(new) && (!ok || !isTerminal(old)) {
+			podCompletions.push(new)
+		}
 		PodStatuses.Statuses[new.PodUID] = new
 	}
 
+	// Only the statuses that actually changed are written, so that the periodic
+	// status polling of long-running pods does not grow the store log.
+	if PodStatuses.store != nil && len(changed) > 0 {
+		if err := PodStatuses.store.Put(withOwners(changed)); err != nil {
+			log.L.Error("unable to persist cached statuses: ", err)
+		}
+	}
+
+	// The same changes are pushed to the /watch clients.
+	if len(changed) > 0 {
+		events := make([]types.PodStatusEvent, 0, len(changed))
+		for _, status := range changed {
+			events = append(events, types.PodStatusEvent{Type: types.PodStatusEventModified, Status: status})
+		}
+		statusWatchers.publish(events...)
+	}
+
 	PodStatuses.mu.Unlock()
 }
@@ -6,6 +6,8 @@ package api
 import (
 	"bufio"
 	"context"
+	"crypto/ecdh"
+	"errors"
 	"fmt"
 	"html"
 	"io"
@@ -18,6 +20,8 @@ import (
 	trace "go.opentelemetry.io/otel/trace"
 
 	"github.com/interlink-hq/interlink/pkg/interlink"
+	"github.com/interlink-hq/interlink/pkg/interlink/jobscript"
+	"github.com/interlink-hq/interlink/pkg/interlink/logarchive"
 )
 
 // isSafeURL validates that a URL uses only http, https, or http+unix schemes.
@@ -53,6 +57,17 @@ type InterLinkHandler struct {
 	SidecarEndpoint string
 	// ClientHTTP is the HTTP client for communicating with the sidecar
 	ClientHTTP *http.Client
+	// SecretKey is the public key the Secret data sent to the sidecar is encrypted with (optional)
+	SecretKey *ecdh.PublicKey
+	// JobScripts renders the job scripts of the pods when job script templates are configured (optional)
+	JobScripts *jobscript.Engine
+	// JobScriptBuilder calls the external job script builder (default: a client with the default settings)
+	JobScriptBuilder *JobScriptBuilderClient
+	// LogArchive keeps the logs of the completed pods when the log archive is enabled (optional)
+	LogArchive *logarchive.Archive
+	// Sidecars lists the plugins pods can be routed to. When empty, SidecarEndpoint
+	// and ClientHTTP describe the only plugin.
+	Sidecars []*Sidecar
 }
 
 // AddSessionContext adds a session identifier to the HTTP request headers.
@@ -96,6 +111,9 @@ func GetSessionContextMessage(sessionContext string) string {
 //   - sessionContext: Session identifier for request tracing
 //   - clientHTTP: HTTP client to use for the request
 //
+// When the circuit breaker of the sidecar is open the call fails fast with a 503 and a message
+// naming the unavailable sidecar.
+//
 // Returns:
 //   - []byte: Response body (only if respondWithReturn is true)
 //   - error: Any error encountered during request processing
@@ -128,6 +146,13 @@ func ReqWithError(
 	if err != nil {
 		statusCode := http.StatusInternalServerError
 		log.G(ctx).Errorf("%s HTTP client.Do() failed: %v", sessionContextMessage, err)
+		if errors.Is(err, ErrCircuitOpen) {
+			// fail fast and tell the caller why, instead of a bare 500
+			statusCode = http.StatusServiceUnavailable
+			w.WriteHeader(statusCode)
+			_, _ = w.Write([]byte(html.EscapeString(errors.Unwrap(err).Error())))
+			return nil, fmt.Errorf(sessionContextMessage+"%w", err)
+		}
 		w.WriteHeader(statusCode)
 		errWithContext := fmt.Errorf(sessionContextMessage+
 			"error doing DoReq() of ReqWithErrorWithSessionNumber error %w", err)
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/log"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+)
+
+// readinessTimeout bounds the time /readyz waits for each sidecar.
+const readinessTimeout = 5 * time.Second
+
+// HealthzHandler reports that the interLink process is up and serving requests.
+// It checks no dependency: use ReadyzHandler for that.
+func (h *InterLinkHandler) HealthzHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte("ok")); err != nil {
+		log.G(h.Ctx).Error(errors.New("failed to write to http buffer"))
+	}
+}
+
+// ReadyzHandler reports whether interLink can serve pods: every sidecar answers its status
+// endpoint, the TLS material (when TLS is used) can be loaded and the status store is open.
+// The outcome of each check is returned as a ReadinessResponse, with 503 when any fails.
+// Unlike Ping, the sidecar answers are not passed through to the caller.
+func (h *InterLinkHandler) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	response := types.ReadinessResponse{Status: types.ReadinessOK}
+	check := func(name string, err error) {
+		result := types.ReadinessCheck{Name: name, Status: types.ReadinessOK}
+		if err != nil {
+			result.Status = types.ReadinessUnavailable
+			result.Error = err.Error()
+			response.Status = types.ReadinessUnavailable
+			log.G(h.Ctx).Warningf("Readiness check %s failed: %v", name, err)
+		}
+		response.Checks = append(response.Checks, result)
+	}
+
+	for _, sidecar := range h.sidecars() {
+		check("sidecar/"+sidecar.Name, checkSidecar(r.Context(), sidecar))
+	}
+	if h.Config.TLS.Enabled || strings.HasPrefix(h.Config.InterlinkAddress, "https://") {
+		check("tls", checkTLSMaterial(h.Config.TLS))
+	}
+	check("statusStore", checkStatusStore())
+
+	statusCode := http.StatusOK
+	if response.Status != types.ReadinessOK {
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	bodyBytes, err := json.Marshal(response)
+	if err != nil {
+		log.G(h.Ctx).Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if _, err = w.Write(bodyBytes); err != nil {
+		log.G(h.Ctx).Error(errors.New("failed to write to http buffer"))
+	}
+}
+
+// checkSidecar sends an empty status request to a sidecar and expects a 200 answer.
+func checkSidecar(ctx context.Context, sidecar *Sidecar) error {
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	code, body, err := pingSidecar(ctx, sidecar, "readyz")
+	if err != nil {
+		return err
+	}
+	if code != http.StatusOK {
+		return fmt.Errorf("sidecar answered %d: %s", code, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// checkTLSMaterial loads the server certificate pair and the client CA, as the HTTPS server
+// does, and fails when they are missing, invalid or expired.
+func checkTLSMaterial(config types.TLSConfig) error {
+	if config.CertFile == "" || config.KeyFile == "" {
+		return errors.New("TLS enabled but CertFile or KeyFile not provided")
+	}
+	cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load server certificate pair: %w", err)
+	}
+	if cert.Leaf != nil && time.Now().After(cert.Leaf.NotAfter) {
+		return fmt.Errorf("server certificate expired on %s", cert.Leaf.NotAfter.Format(time.RFC3339))
+	}
+
+	if config.CACertFile != "" {
+		caCert, err := os.ReadFile(config.CACertFile)
+		if err != nil {
+			return fmt.Errorf("failed to read CA certificate file: %w", err)
+		}
+		if !x509.NewCertPool().AppendCertsFromPEM(caCert) {
+			return fmt.Errorf("failed to parse CA certificate from %s", config.CACertFile)
+		}
+	}
+	return nil
+}
+
+// checkStatusStore fails when the status store backing the PodStatuses cache is not open.
+func checkStatusStore() error {
+	PodStatuses.mu.Lock()
+	defer PodStatuses.mu.Unlock()
+
+	if PodStatuses.store == nil {
+		return errors.New("status store is not open")
+	}
+	if checker, ok := PodStatuses.store.(interface{ ready() error }); ok {
+		return checker.ready()
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+)
+
+// readyzCall opens the status store selected by config and calls /readyz with a single
+// sidecar answering code to its status calls.
+func readyzCall(t *testing.T, config types.Config, code int) (int, types.ReadinessResponse) {
+	t.Helper()
+	server, endpoint, client := newUnixTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(code)
+	}))
+	defer server.Close()
+
+	require.NoError(t, InitPodStatuses(context.Background(), config))
+	t.Cleanup(func() {
+		_ = ClosePodStatuses()
+		resetPodStatuses()
+	})
+
+	h := &InterLinkHandler{Ctx: context.Background(), Config: config, SidecarEndpoint: endpoint, ClientHTTP: client}
+	rec := httptest.NewRecorder()
+	h.ReadyzHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var resp types.ReadinessResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	return rec.Code, resp
+}
+
+func readinessCheck(t *testing.T, resp types.ReadinessResponse, name string) types.ReadinessCheck {
+	t.Helper()
+	for _, check := range resp.Checks {
+		if check.Name == name {
+			return check
+		}
+	}
+	require.Failf(t, "missing readiness check", "no %s check in %+v", name, resp.Checks)
+	return types.ReadinessCheck{}
+}
+
+func TestHealthzHandler(t *testing.T) {
+	h := &InterLinkHandler{Ctx: context.Background()}
+	rec := httptest.NewRecorder()
+	h.HealthzHandler(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "ok", rec.Body.String())
+}
+
+func TestReadyzHandler_Ready(t *testing.T) {
+	code, resp := readyzCall(t, types.Config{}, http.StatusOK)
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, types.ReadinessOK, resp.Status)
+	require.Len(t, resp.Checks, 2, "no TLS check without TLS")
+	assert.Equal(t, types.ReadinessOK, readinessCheck(t, resp, "sidecar/default").Status)
+	assert.Equal(t, types.ReadinessOK, readinessCheck(t, resp, "statusStore").Status)
+}
+
+func TestReadyzHandler_SidecarUnavailable(t *testing.T) {
+	code, resp := readyzCall(t, types.Config{}, http.StatusInternalServerError)
+
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, types.ReadinessUnavailable, resp.Status)
+	sidecar := readinessCheck(t, resp, "sidecar/default")
+	assert.Equal(t, types.ReadinessUnavailable, sidecar.Status)
+	assert.Contains(t, sidecar.Error, "500")
+	assert.Equal(t, types.ReadinessOK, readinessCheck(t, resp, "statusStore").Status)
+}
+
+func TestReadyzHandler_MissingTLSMaterial(t *testing.T) {
+	dir := t.TempDir()
+	config := types.Config{TLS: types.TLSConfig{
+		Enabled:  true,
+		CertFile: filepath.Join(dir, "tls.crt"),
+		KeyFile:  filepath.Join(dir, "tls.key"),
+	}}
+	code, resp := readyzCall(t, config, http.StatusOK)
+
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	tlsCheck := readinessCheck(t, resp, "tls")
+	assert.Equal(t, types.ReadinessUnavailable, tlsCheck.Status)
+	assert.Contains(t, tlsCheck.Error, "failed to load server certificate pair")
+}
+
+func TestCheckStatusStore(t *testing.T) {
+	config := types.Config{StatusStore: types.StatusStoreConfig{Backend: StatusStoreFile, Path: t.TempDir()}}
+	require.NoError(t, InitPodStatuses(context.Background(), config))
+	t.Cleanup(func() { resetPodStatuses() })
+	require.NoError(t, checkStatusStore())
+
+	PodStatuses.mu.Lock()
+	require.NoError(t, PodStatuses.store.Close())
+	PodStatuses.mu.Unlock()
+	assert.ErrorContains(t, checkStatusStore(), "status store is closed")
+
+	require.NoError(t, ClosePodStatuses())
+	assert.ErrorContains(t, checkStatusStore(), "status store is not open")
+}
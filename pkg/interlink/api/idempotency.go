@@ -0,0 +1,135 @@
+package api
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+)
+
+// IdempotencyKeyHeader lets clients that do not set a pod UID make their create calls idempotent.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// idempotencyKeyTTL is how long the completed creates recorded under an idempotency key alone
+// are remembered. Unlike the creates recorded by pod UID, no delete call ever clears them.
+const idempotencyKeyTTL = 24 * time.Hour
+
+var errIdempotencyKeyReused = errors.New("idempotency key already used for another pod")
+
+// createRecord is a create call accepted by interLink. It is pending until the sidecar answers.
+type createRecord struct {
+	key       string
+	pending   bool
+	result    types.CreateStruct
+	completed time.Time
+}
+
+// MutexCreates records the creates forwarded to the sidecars, so that a create repeated after
+// a timeout returns the job of the first one instead of submitting a second job.
+type MutexCreates struct {
+	mu      sync.Mutex
+	records map[string]*createRecord
+	keys    map[string]string
+	// swept is when the expired idempotency key records were last dropped
+	swept time.Time
+}
+
+// PodCreates maps pod UIDs (or idempotency keys, for pods without UID) to their create result.
+var PodCreates MutexCreates
+
+// begin registers a create call. It returns a copy of the existing record when the same pod
+// (or idempotency key) was already created or is being created, and nil when the caller
+// must go on with the creation. Calls with neither UID nor key are never recorded.
+func (c *MutexCreates) begin(uid, key string) (*createRecord, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.records == nil {
+		c.records = make(map[string]*createRecord)
+		c.keys = make(map[string]string)
+	}
+	c.expire(time.Now())
+
+	if key != "" {
+		if id, ok := c.keys[key]; ok && id != recordID(uid, key) {
+			return nil, errIdempotencyKeyReused
+		}
+	}
+	id := recordID(uid, key)
+	if id == "" {
+		return nil, nil
+	}
+	if existing, ok := c.records[id]; ok {
+		record := *existing
+		return &record, nil
+	}
+
+	c.records[id] = &createRecord{key: key, pending: true}
+	if key != "" {
+		c.keys[key] = id
+	}
+	return nil, nil
+}
+
+// complete stores the result of a successful create.
+func (c *MutexCreates) complete(uid, key string, result types.CreateStruct) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if record, ok := c.records[recordID(uid, key)]; ok {
+		record.pending = false
+		record.result = result
+		record.completed = time.Now()
+	}
+}
+
+// abort drops a pending create that failed, so that it can be retried.
+func (c *MutexCreates) abort(uid, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := recordID(uid, key)
+	if record, ok := c.records[id]; ok && record.pending {
+		c.remove(id)
+	}
+}
+
+// forget drops the record of a pod, once it is deleted.
+func (c *MutexCreates) forget(uid string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove(uid)
+}
+
+func (c *MutexCreates) remove(id string) {
+	if record, ok := c.records[id]; ok {
+		delete(c.keys, record.key)
+		delete(c.records, id)
+	}
+}
+
+// expire drops the completed records of the creates made with an idempotency key and no pod
+// UID, once older than idempotencyKeyTTL. The records are swept at most once per minute.
+// Called with mu held.
+func (c *MutexCreates) expire(now time.Time) {
+	if now.Sub(c.swept) < time.Minute {
+		return
+	}
+	c.swept = now
+	for _, id := range c.keys {
+		record := c.records[id]
+		if strings.HasPrefix(id, "key/") && record != nil && !record.pending && now.Sub(record.completed) > idempotencyKeyTTL {
+			c.remove(id)
+		}
+	}
+}
+
+func recordID(uid, key string) string {
+	if uid != "" {
+		return uid
+	}
+	if key != "" {
+		return "key/" + key
+	}
+	return ""
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+)
+
+// newCreateSidecar starts a sidecar counting its /create calls. It answers with job IDs 1, 2, ...
+// or with fail, when not zero.
+func newCreateSidecar(t *testing.T, fail *atomic.Int32) (*InterLinkHandler, *atomic.Int32) {
+	t.Helper()
+	var creates atomic.Int32
+	server, endpoint, client := newUnixTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/create") {
+			return
+		}
+		if fail != nil && fail.Load() != 0 {
+			w.WriteHeader(int(fail.Load()))
+			return
+		}
+		var data types.RetrievedPodData
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&data))
+		n := creates.Add(1)
+		_ = json.NewEncoder(w).Encode(types.CreateStruct{PodUID: string(data.Pod.UID), PodJID: string(rune('0' + n))})
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { PodCreates = MutexCreates{} })
+
+	return &InterLinkHandler{Ctx: context.Background(), SidecarEndpoint: endpoint, ClientHTTP: client}, &creates
+}
+
+func createCall(t *testing.T, h *InterLinkHandler, uid, name, key string) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(types.PodCreateRequests{Pod: v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: k8stypes.UID(uid)},
+	}})
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/create", strings.NewReader(string(body)))
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	rec := httptest.NewRecorder()
+	h.CreateHandler(rec, req)
+	return rec
+}
+
+func createResult(t *testing.T, rec *httptest.ResponseRecorder) types.CreateStruct {
+	t.Helper()
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var result types.CreateStruct
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	return result
+}
+
+func TestCreateHandler_RepeatedCreateReturnsExistingJob(t *testing.T) {
+	h, creates := newCreateSidecar(t, nil)
+
+	first := createResult(t, createCall(t, h, "uid-a", "a", ""))
+	second := createResult(t, createCall(t, h, "uid-a", "a", ""))
+
+	assert.Equal(t, int32(1), creates.Load())
+	assert.Equal(t, "1", first.PodJID)
+	assert.Equal(t, first, second)
+
+	PodOwners.forget("uid-a")
+	KnownPods.forget("uid-a")
+}
+
+func TestCreateHandler_DeleteClearsRecord(t *testing.T) {
+	h, creates := newCreateSidecar(t, nil)
+	createResult(t, createCall(t, h, "uid-a", "a", ""))
+
+	body, err := json.Marshal(testPod("uid-a", "default", nil, nil))
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	h.DeleteHandler(rec, httptest.NewRequest(http.MethodPost, "/delete", strings.NewReader(string(body))))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	result := createResult(t, createCall(t, h, "uid-a", "a", ""))
+	assert.Equal(t, int32(2), creates.Load())
+	assert.Equal(t, "2", result.PodJID)
+
+	PodOwners.forget("uid-a")
+	KnownPods.forget("uid-a")
+}
+
+func TestCreateHandler_FailedCreateCanBeRetried(t *testing.T) {
+	var fail atomic.Int32
+	fail.Store(http.StatusInternalServerError)
+	h, creates := newCreateSidecar(t, &fail)
+
+	rec := createCall(t, h, "uid-a", "a", "")
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	fail.Store(0)
+	createResult(t, createCall(t, h, "uid-a", "a", ""))
+	assert.Equal(t, int32(1), creates.Load())
+
+	PodOwners.forget("uid-a")
+	KnownPods.forget("uid-a")
+}
+
+func TestCreateHandler_ConcurrentCreateConflicts(t *testing.T) {
+	h, creates := newCreateSidecar(t, nil)
+	existing, err := PodCreates.begin("uid-a", "")
+	require.NoError(t, err)
+	require.Nil(t, existing)
+
+	rec := createCall(t, h, "uid-a", "a", "")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Equal(t, int32(0), creates.Load())
+}
+
+func TestCreateHandler_IdempotencyKey(t *testing.T) {
+	h, creates := newCreateSidecar(t, nil)
+
+	first := createResult(t, createCall(t, h, "", "a", "key-1"))
+	second := createResult(t, createCall(t, h, "", "a", "key-1"))
+	assert.Equal(t, first, second)
+	assert.Equal(t, int32(1), creates.Load())
+
+	rec := createCall(t, h, "uid-b", "b", "key-1")
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, int32(1), creates.Load())
+
+	PodOwners.forget("")
+	KnownPods.forget("")
+}
+
+func TestMutexCreates_ExpiresKeyRecords(t *testing.T) {
+	var creates MutexCreates
+	_, err := creates.begin("", "key-1")
+	require.NoError(t, err)
+	creates.complete("", "key-1", types.CreateStruct{PodJID: "1"})
+	_, err = creates.begin("uid-a", "key-2")
+	require.NoError(t, err)
+	creates.complete("uid-a", "key-2", types.CreateStruct{PodUID: "uid-a", PodJID: "2"})
+
+	creates.expire(time.Now().Add(idempotencyKeyTTL + time.Minute))
+	assert.NotContains(t, creates.records, "key/key-1")
+	assert.NotContains(t, creates.keys, "key-1")
+	// the records of pods with a UID are dropped by their delete call
+	assert.Contains(t, creates.records, "uid-a")
+
+	// a key used again after its expiry creates a new job
+	existing, err := creates.begin("", "key-1")
+	require.NoError(t, err)
+	assert.Nil(t, existing)
+}
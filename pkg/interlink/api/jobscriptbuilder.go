@@ -0,0 +1,234 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/log"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+)
+
+const (
+	defaultJobScriptBuilderTimeout = 30 * time.Second
+	// maxJobScriptSize bounds the job scripts read from the builder
+	maxJobScriptSize = 16 << 20
+	// maxBuilderErrorSize bounds the part of an error response quoted in the create error
+	maxBuilderErrorSize = 1 << 10
+)
+
+// JobScriptBuilderError is returned when the external job script builder could not build
+// the job script of a pod. It is reported to the Virtual Kubelet, which shows it on the pod.
+type JobScriptBuilderError struct {
+	// URL of the builder
+	URL string
+	// Attempts is the number of calls made to the builder
+	Attempts int
+	// StatusCode is the HTTP status of the last response, 0 when the builder was unreachable
+	StatusCode int
+	// Body is the beginning of the last error response
+	Body string
+	// Err is the error of the last call, when it got no response
+	Err error
+}
+
+func (e *JobScriptBuilderError) Error() string {
+	msg := fmt.Sprintf("job script builder %s failed after %d attempt(s)", e.URL, e.Attempts)
+	if e.StatusCode != 0 {
+		msg += fmt.Sprintf(": HTTP %d", e.StatusCode)
+		if e.Body != "" {
+			msg += ": " + e.Body
+		}
+		return msg
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *JobScriptBuilderError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout tells whether the builder did not answer in time.
+func (e *JobScriptBuilderError) Timeout() bool {
+	var timeout interface{ Timeout() bool }
+	return e.StatusCode == http.StatusGatewayTimeout ||
+		errors.Is(e.Err, context.DeadlineExceeded) ||
+		(errors.As(e.Err, &timeout) && timeout.Timeout())
+}
+
+// JobScriptBuilderClient calls the external job script builder: it posts the data of a pod,
+// and gets its job script back.
+type JobScriptBuilderClient struct {
+	client         *http.Client
+	tokenFile      string
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+// NewJobScriptBuilderClient returns the builder client set up by config. Unset fields take
+// their default value.
+func NewJobScriptBuilderClient(config types.JobScriptBuilderConfig) (*JobScriptBuilderClient, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if config.CACertFile != "" {
+		caCert, err := os.ReadFile(config.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read job script builder CA certificate %s: %w", config.CACertFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("failed to parse job script builder CA certificate from %s", config.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return nil, errors.New("job script builder CertFile and KeyFile must be set together")
+	}
+	if config.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load job script builder client certificate (%s, %s): %w", config.CertFile, config.KeyFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if config.BearerTokenFile != "" {
+		if _, err := readBearerToken(config.BearerTokenFile); err != nil {
+			return nil, err
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	timeout := defaultJobScriptBuilderTimeout
+	if config.TimeoutSeconds > 0 {
+		timeout = time.Duration(config.TimeoutSeconds) * time.Second
+	}
+
+	c := &JobScriptBuilderClient{
+		client:         &http.Client{Transport: transport, Timeout: timeout},
+		tokenFile:      config.BearerTokenFile,
+		maxAttempts:    defaultRetryMaxAttempts,
+		initialBackoff: defaultRetryInitialBackoff,
+		maxBackoff:     defaultRetryMaxBackoff,
+	}
+	if config.MaxAttempts > 0 {
+		c.maxAttempts = config.MaxAttempts
+	}
+	if config.InitialBackoffMilliseconds > 0 {
+		c.initialBackoff = time.Duration(config.InitialBackoffMilliseconds) * time.Millisecond
+	}
+	if config.MaxBackoffMilliseconds > 0 {
+		c.maxBackoff = time.Duration(config.MaxBackoffMilliseconds) * time.Millisecond
+	}
+	return c, nil
+}
+
+func readBearerToken(path string) (string, error) {
+	token, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read job script builder token: %w", err)
+	}
+	trimmed := strings.TrimSpace(string(token))
+	if trimmed == "" {
+		return "", fmt.Errorf("job script builder token file %s is empty", path)
+	}
+	return trimmed, nil
+}
+
+// defaultJobScriptBuilder is used by the handlers built without a JobScriptBuilder client.
+var defaultJobScriptBuilder = sync.OnceValue(func() *JobScriptBuilderClient {
+	c, _ := NewJobScriptBuilderClient(types.JobScriptBuilderConfig{})
+	return c
+})
+
+// jobScriptBuilder returns the builder client of the handler.
+func (h *InterLinkHandler) jobScriptBuilder() *JobScriptBuilderClient {
+	if h.JobScriptBuilder != nil {
+		return h.JobScriptBuilder
+	}
+	return defaultJobScriptBuilder()
+}
+
+// Build posts body, the JSON data of a pod, to the builder at url and returns the job script
+// it answers. Unreachable builders, 429 and 5xx answers are retried; the other errors are not.
+// Failures are returned as a *JobScriptBuilderError.
+func (c *JobScriptBuilderClient) Build(ctx context.Context, url string, body []byte, sessionContext string) (string, error) {
+	if !isSafeURL(url) {
+		return "", fmt.Errorf("potential SSRF detected: %s", url)
+	}
+
+	backoff := c.initialBackoff
+	for attempt := 1; ; attempt++ {
+		script, buildErr, retry := c.try(ctx, url, body, sessionContext)
+		if buildErr == nil {
+			return script, nil
+		}
+		buildErr.URL, buildErr.Attempts = url, attempt
+		if !retry || attempt >= c.maxAttempts {
+			return "", buildErr
+		}
+		log.G(ctx).Warningf("Job script builder call failed (attempt %d/%d): %v", attempt, c.maxAttempts, buildErr)
+
+		select {
+		case <-ctx.Done():
+			buildErr.Err = ctx.Err()
+			return "", buildErr
+		case <-time.After(jitter(backoff)):
+		}
+		backoff = min(2*backoff, c.maxBackoff)
+	}
+}
+
+// try makes a single call to the builder. It returns the job script, or the error and whether
+// the call may be retried.
+func (c *JobScriptBuilderClient) try(ctx context.Context, url string, body []byte, sessionContext string) (string, *JobScriptBuilderError, bool) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return "", &JobScriptBuilderError{Err: err}, false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	AddSessionContext(req, sessionContext)
+	if c.tokenFile != "" {
+		token, err := readBearerToken(c.tokenFile)
+		if err != nil {
+			return "", &JobScriptBuilderError{Err: err}, false
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.client.Do(req) // #nosec G704 -- checked by isSafeURL
+	if err != nil {
+		// a certificate the client does not trust will not be trusted on the next attempt
+		var certErr *tls.CertificateVerificationError
+		return "", &JobScriptBuilderError{Err: err}, ctx.Err() == nil && !errors.As(err, &certErr)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxBuilderErrorSize))
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+		return "", &JobScriptBuilderError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(snippet))}, retry
+	}
+
+	script, err := io.ReadAll(io.LimitReader(resp.Body, maxJobScriptSize+1))
+	if err != nil {
+		return "", &JobScriptBuilderError{Err: err}, true
+	}
+	if len(script) > maxJobScriptSize {
+		return "", &JobScriptBuilderError{Err: fmt.Errorf("job script larger than %d bytes", maxJobScriptSize)}, false
+	}
+	return string(script), nil, false
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+)
+
+// newBuilder returns a builder client with fast retries.
+func newBuilder(t *testing.T, config types.JobScriptBuilderConfig) *JobScriptBuilderClient {
+	t.Helper()
+	config.InitialBackoffMilliseconds, config.MaxBackoffMilliseconds = 1, 2
+	c, err := NewJobScriptBuilderClient(config)
+	require.NoError(t, err)
+	return c
+}
+
+func TestJobScriptBuilderClient_RetriesAndAuth(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer s3cr3t", r.Header.Get("Authorization"))
+		assert.Equal(t, "session", r.Header.Get("InterLink-Http-Session"))
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("#!/bin/bash\n"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600))
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("s3cr3t\n"), 0o600))
+
+	builder := newBuilder(t, types.JobScriptBuilderConfig{CACertFile: caFile, BearerTokenFile: tokenFile})
+	script, err := builder.Build(context.Background(), server.URL, []byte("{}"), "session")
+	require.NoError(t, err)
+	assert.Equal(t, "#!/bin/bash\n", script)
+	assert.Equal(t, int32(3), calls.Load())
+
+	_, err = newBuilder(t, types.JobScriptBuilderConfig{}).Build(context.Background(), server.URL, []byte("{}"), "session")
+	var builderErr *JobScriptBuilderError
+	require.ErrorAs(t, err, &builderErr, "the server certificate is not trusted without the CA")
+	assert.Equal(t, 1, builderErr.Attempts, "certificate errors are not retried")
+}
+
+func TestJobScriptBuilderClient_Errors(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		switch r.URL.Path {
+		case "/invalid":
+			http.Error(w, "unsupported runtime", http.StatusBadRequest)
+		case "/slow":
+			time.Sleep(1500 * time.Millisecond)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	builder := newBuilder(t, types.JobScriptBuilderConfig{TimeoutSeconds: 1, MaxAttempts: 2})
+
+	_, err := builder.Build(context.Background(), server.URL+"/invalid", nil, "")
+	var builderErr *JobScriptBuilderError
+	require.ErrorAs(t, err, &builderErr)
+	assert.Equal(t, http.StatusBadRequest, builderErr.StatusCode)
+	assert.Equal(t, 1, builderErr.Attempts, "client errors are not retried")
+	assert.Contains(t, err.Error(), "unsupported runtime")
+
+	_, err = builder.Build(context.Background(), server.URL+"/broken", nil, "")
+	require.ErrorAs(t, err, &builderErr)
+	assert.Equal(t, 2, builderErr.Attempts)
+	assert.False(t, builderErr.Timeout())
+
+	builder = newBuilder(t, types.JobScriptBuilderConfig{TimeoutSeconds: 1, MaxAttempts: 1})
+	_, err = builder.Build(context.Background(), server.URL+"/slow", nil, "")
+	require.ErrorAs(t, err, &builderErr)
+	assert.True(t, builderErr.Timeout())
+
+	_, err = NewJobScriptBuilderClient(types.JobScriptBuilderConfig{CertFile: "cert.pem"})
+	require.Error(t, err)
+	_, err = NewJobScriptBuilderClient(types.JobScriptBuilderConfig{BearerTokenFile: filepath.Join(t.TempDir(), "missing")})
+	require.Error(t, err)
+}
+
+func TestCreateHandler_JobScriptBuilderFailure(t *testing.T) {
+	builder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "no such image", http.StatusUnprocessableEntity)
+	}))
+	defer builder.Close()
+
+	h, creates := newCreateSidecar(t, nil)
+	h.Config.JobScriptBuildConfig = &types.ScriptBuildConfig{}
+	h.JobScriptBuilder = newBuilder(t, types.JobScriptBuilderConfig{})
+
+	body, err := json.Marshal(types.PodCreateRequests{Pod: *testPod("uid-builder", "default", nil, nil), JobScriptBuilderURL: builder.URL})
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	h.CreateHandler(rec, httptest.NewRequest(http.MethodPost, "/create", strings.NewReader(string(body))))
+
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Contains(t, rec.Body.String(), "unable to build the job script of pod default/pod-uid-builder")
+	assert.Contains(t, rec.Body.String(), "no such image")
+	assert.Zero(t, creates.Load(), "the sidecar is not called without a job script")
+}
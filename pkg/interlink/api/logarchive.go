@@ -0,0 +1,206 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/log"
+	"github.com/google/uuid"
+	v1 "k8s.io/api/core/v1"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+)
+
+const (
+	// completionQueueSize is the number of completed pods that may wait for the log archiver
+	completionQueueSize = 1024
+	// logArchivePruneInterval is how often the expired pods are removed from the log archive
+	logArchivePruneInterval = time.Hour
+	// archiveLogsTimeout bounds the retrieval of the logs of a container from the sidecar
+	archiveLogsTimeout = 5 * time.Minute
+)
+
+// completionQueue hands the pods that reached a terminal state in updateStatuses over to the
+// log archiver. push never blocks: when the archiver lags behind, the completions are dropped.
+type completionQueue struct {
+	mu sync.Mutex
+	ch chan types.PodStatus
+}
+
+var podCompletions completionQueue
+
+// open starts queueing the completions, and returns the queue.
+func (q *completionQueue) open() <-chan types.PodStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.ch = make(chan types.PodStatus, completionQueueSize)
+	return q.ch
+}
+
+// close stops queueing the completions.
+func (q *completionQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.ch = nil
+}
+
+// push is called with PodStatuses.mu held.
+func (q *completionQueue) push(status types.PodStatus) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.ch == nil {
+		return
+	}
+	select {
+	case q.ch <- status:
+	default:
+		log.L.Warning("Log archiver lagging behind, the logs of pod ", status.PodNamespace, "/", status.PodName, " are not archived")
+	}
+}
+
+// ArchiveLogs archives the logs of the pods reaching a terminal state into h.LogArchive, and
+// prunes the archive every hour. It returns when ctx is done.
+func (h *InterLinkHandler) ArchiveLogs(ctx context.Context) {
+	completions := podCompletions.open()
+	defer podCompletions.close()
+	ticker := time.NewTicker(logArchivePruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case status := <-completions:
+			h.archivePodLogs(ctx, status)
+		case <-ticker.C:
+		}
+		if removed, err := h.LogArchive.Prune(time.Now()); err != nil {
+			log.G(ctx).Error(err)
+		} else if removed > 0 {
+			log.G(ctx).Info("Removed the archived logs of ", removed, " pod(s)")
+		}
+	}
+}
+
+// archivePodLogs stores the logs of every container of a completed pod in the log archive.
+func (h *InterLinkHandler) archivePodLogs(ctx context.Context, status types.PodStatus) {
+	sidecar := h.routeUID(status.PodUID, status.PodNamespace)
+	sessionContext := "Archive-" + uuid.New().String()
+	containers := append(append([]string{}, containerNames(status.InitContainers)...), containerNames(status.Containers)...)
+	for _, container := range containers {
+		if err := h.archiveContainerLogs(ctx, sidecar, status, container, sessionContext); err != nil {
+			log.G(ctx).Warning("Unable to archive the logs of container ", container, " of pod ", status.PodNamespace, "/", status.PodName, ": ", err)
+		}
+	}
+
+	// the pod may have been deleted while its logs were retrieved
+	PodStatuses.mu.Lock()
+	_, cached := PodStatuses.Statuses[status.PodUID]
+	PodStatuses.mu.Unlock()
+	if !cached {
+		if err := h.LogArchive.Remove(status.PodNamespace, status.PodUID); err != nil {
+			log.G(ctx).Error(err)
+		}
+		return
+	}
+	log.G(ctx).Info("Archived the logs of pod ", status.PodNamespace, "/", status.PodName)
+}
+
+func containerNames(statuses []v1.ContainerStatus) []string {
+	names := make([]string, 0, len(statuses))
+	for _, status := range statuses {
+		names = append(names, status.Name)
+	}
+	return names
+}
+
+// archiveContainerLogs retrieves the logs of a container with their timestamps, which the
+// archive needs to filter them later, and stores them.
+func (h *InterLinkHandler) archiveContainerLogs(ctx context.Context, sidecar *Sidecar, status types.PodStatus, container, sessionContext string) error {
+	bodyBytes, err := json.Marshal(types.LogStruct{
+		Namespace:     status.PodNamespace,
+		PodUID:        status.PodUID,
+		PodName:       status.PodName,
+		ContainerName: container,
+		Opts:          types.ContainerLogOpts{Timestamps: true},
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, archiveLogsTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sidecar.Endpoint+"/getLogs", bytes.NewReader(bodyBytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	AddSessionContext(req, sessionContext)
+	if !isSafeURL(req.URL.String()) {
+		return fmt.Errorf("potential SSRF detected: %s", req.URL.String())
+	}
+	resp, err := sidecar.ClientHTTP.Do(req) // #nosec G704
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("sidecar %s returned HTTP %d", sidecar.Name, resp.StatusCode)
+	}
+	return h.LogArchive.Store(status.PodNamespace, status.PodUID, container, resp.Body)
+}
+
+// logsWithArchiveFallback forwards a log request to the sidecar, and serves the archived logs
+// of the container instead when the sidecar fails or has no logs left, e.g. because it
+// cleaned up the job of the completed pod.
+func (h *InterLinkHandler) logsWithArchiveFallback(w http.ResponseWriter, req *http.Request, logsRequest types.LogStruct, sidecar *Sidecar, sessionContext string) {
+	sessionContextMessage := GetSessionContextMessage(sessionContext)
+
+	AddSessionContext(req, sessionContext)
+	if !isSafeURL(req.URL.String()) {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.G(h.Ctx).Error(sessionContextMessage, "potential SSRF detected: ", req.URL.String())
+		return
+	}
+	resp, err := sidecar.ClientHTTP.Do(req) // #nosec G704
+	if err == nil {
+		defer resp.Body.Close()
+		body := bufio.NewReader(resp.Body)
+		if _, peekErr := body.Peek(1); resp.StatusCode == http.StatusOK && peekErr == nil {
+			w.WriteHeader(http.StatusOK)
+			if _, err := io.Copy(flushWriter{w}, body); err != nil {
+				log.G(h.Ctx).Error(sessionContextMessage, err)
+			}
+			return
+		}
+		err = fmt.Errorf("sidecar %s returned HTTP %d and no logs", sidecar.Name, resp.StatusCode)
+	}
+
+	log.G(h.Ctx).Info(sessionContextMessage, "Serving archived logs of container ", logsRequest.ContainerName, " of pod ",
+		logsRequest.Namespace, "/", logsRequest.PodName, ": ", err)
+	w.WriteHeader(http.StatusOK)
+	err = h.LogArchive.WriteLogs(w, logsRequest.Namespace, logsRequest.PodUID, logsRequest.ContainerName, logsRequest.Opts, time.Now())
+	if err != nil {
+		log.G(h.Ctx).Error(sessionContextMessage, err)
+	}
+}
+
+// flushWriter flushes every write, so that followed logs reach the client as they come.
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if flusher, ok := f.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+	"github.com/interlink-hq/interlink/pkg/interlink/logarchive"
+)
+
+const archivedPodUID = "12345678-1234-1234-1234-123456789012"
+
+func completedPodStatus(uid string) types.PodStatus {
+	status := testPodStatus(uid, "1")
+	status.Containers = []v1.ContainerStatus{
+		{Name: "main", State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 0}}},
+	}
+	return status
+}
+
+func TestUpdateStatuses_QueuesCompletedPods(t *testing.T) {
+	resetPodStatuses()
+	defer resetPodStatuses()
+	completions := podCompletions.open()
+	defer podCompletions.close()
+
+	updateStatuses([]types.PodStatus{testPodStatus("a", "1")})
+	assert.Empty(t, completions, "running pods are not archived")
+
+	updateStatuses([]types.PodStatus{completedPodStatus("a"), completedPodStatus("b")})
+	require.Len(t, completions, 2)
+	assert.Equal(t, "a", (<-completions).PodUID)
+	assert.Equal(t, "b", (<-completions).PodUID)
+
+	updateStatuses([]types.PodStatus{completedPodStatus("a")})
+	assert.Empty(t, completions, "pods are archived once, when they complete")
+}
+
+func TestGetLogsHandler_ServesArchivedLogs(t *testing.T) {
+	status := completedPodStatus(archivedPodUID)
+	resetPodStatuses(status)
+	defer resetPodStatuses()
+
+	// the sidecar has the logs until it cleans up the job
+	var cleaned atomic.Bool
+	server, endpoint, client := newUnixTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req types.LogStruct
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		switch {
+		case cleaned.Load():
+			http.Error(w, "job not found", http.StatusNotFound)
+		case req.Opts.Timestamps:
+			_, _ = w.Write([]byte("2026-01-02T10:00:00Z first\n2026-01-02T10:00:10Z second\n"))
+		default:
+			_, _ = w.Write([]byte("live logs\n"))
+		}
+	}))
+	defer server.Close()
+
+	archive, err := logarchive.Open(t.TempDir(), time.Hour, 1<<20)
+	require.NoError(t, err)
+	h := &InterLinkHandler{
+		Ctx:        context.Background(),
+		Sidecars:   []*Sidecar{{Name: "default", Endpoint: endpoint, ClientHTTP: client}},
+		LogArchive: archive,
+	}
+	h.archivePodLogs(context.Background(), status)
+	require.True(t, archive.Has("default", archivedPodUID, "main"))
+
+	getLogs := func(opts types.ContainerLogOpts) string {
+		body, err := json.Marshal(types.LogStruct{Namespace: "default", PodUID: archivedPodUID, ContainerName: "main", Opts: opts})
+		require.NoError(t, err)
+		rec := httptest.NewRecorder()
+		h.GetLogsHandler(rec, httptest.NewRequest(http.MethodGet, "/getLogs", bytes.NewReader(body)))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		return rec.Body.String()
+	}
+
+	assert.Equal(t, "live logs\n", getLogs(types.ContainerLogOpts{}), "the sidecar answers while it has the logs")
+
+	cleaned.Store(true)
+	assert.Equal(t, "first\nsecond\n", getLogs(types.ContainerLogOpts{}))
+	assert.Equal(t, "2026-01-02T10:00:10Z second\n", getLogs(types.ContainerLogOpts{Tail: 1, Timestamps: true}))
+	assert.Equal(t, "fir", getLogs(types.ContainerLogOpts{LimitBytes: 3}))
+}
+
+func TestArchivePodLogs_DeletedPod(t *testing.T) {
+	resetPodStatuses()
+	defer resetPodStatuses()
+	server, endpoint, client := newUnixTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("2026-01-02T10:00:00Z first\n"))
+	}))
+	defer server.Close()
+
+	archive, err := logarchive.Open(t.TempDir(), time.Hour, 1<<20)
+	require.NoError(t, err)
+	h := &InterLinkHandler{
+		Ctx:        context.Background(),
+		Sidecars:   []*Sidecar{{Name: "default", Endpoint: endpoint, ClientHTTP: client}},
+		LogArchive: archive,
+	}
+	h.archivePodLogs(context.Background(), completedPodStatus(archivedPodUID))
+	assert.False(t, archive.Has("default", archivedPodUID, "main"), "the logs of a pod deleted meanwhile are dropped")
+}
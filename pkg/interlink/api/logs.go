@@ -2,22 +2,33 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"regexp"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/containerd/containerd/log"
 
 	types "github.com/interlink-hq/interlink/pkg/interlink"
+	"github.com/interlink-hq/interlink/pkg/interlink/audit"
+	"github.com/interlink-hq/interlink/pkg/interlink/logstream"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	trace "go.opentelemetry.io/otel/trace"
 )
 
+const (
+	defaultFollowHeartbeatInterval = 15 * time.Second
+	defaultMaxFollowDuration       = 24 * time.Hour
+)
+
 // containerNameRegexp validates that a container name contains only safe characters.
 // Kubernetes container names are DNS labels (RFC 1123 label): lowercase alphanumeric
 // characters or '-', and must start and end with an alphanumeric character.
@@ -54,7 +65,14 @@ func validateLogRequest(req types.LogStruct) error {
 //   - SinceSeconds and SinceTime cannot both be set
 //
 // Request body: JSON-encoded LogStruct with container identification and log options
-// Response: Streamed plain text log data
+// Response: Streamed plain text log data. Follow requests accepting logstream.ContentType get
+// a framed stream instead, with heartbeats on idle streams (see the logstream package).
+//
+// The sidecar call is canceled when the client disconnects. Follow streams are not subject to
+// the sidecar response header timeout, and end after Logs.MaxFollowSeconds.
+//
+// The logs of the completed pods are served from the log archive, when enabled, once the
+// sidecar fails or returns no logs for them.
 //
 // HTTP Status Codes:
 //   - 200: Log retrieval successful (may be empty if no logs available)
@@ -91,6 +109,8 @@ func (h *InterLinkHandler) GetLogsHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	audit.AddPod(r.Context(), audit.Pod{Namespace: req2.Namespace, Name: req2.PodName, UID: req2.PodUID})
+
 	span.SetAttributes(
 		attribute.String("pod.name", req2.PodName),
 		attribute.String("pod.namespace", req2.Namespace),
@@ -138,8 +158,21 @@ func (h *InterLinkHandler) GetLogsHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 	reader := bytes.NewReader(bodyBytes)
-	log.G(h.Ctx).Info("Sending log request to: ", h.SidecarEndpoint)
-	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, h.SidecarEndpoint+"/getLogs", reader)
+	sidecar := h.routeUID(req2.PodUID, req2.Namespace)
+	log.G(h.Ctx).Info("Sending log request to: ", sidecar.Name, " at ", sidecar.Endpoint)
+
+	// The sidecar call is canceled as soon as the client goes away. Follow streams may stay
+	// silent for long, and end after the maximum follow duration.
+	ctx := r.Context()
+	if req2.Opts.Follow {
+		ctx = withoutHeaderTimeout(ctx)
+		if maxFollow := h.maxFollowDuration(); maxFollow > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, maxFollow)
+			defer cancel()
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sidecar.Endpoint+"/getLogs", reader)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		log.G(h.Ctx).Error(sessionContextMessage, err)
@@ -148,10 +181,131 @@ func (h *InterLinkHandler) GetLogsHandler(w http.ResponseWriter, r *http.Request
 
 	req.Header.Set("Content-Type", "application/json")
 
+	if h.LogArchive != nil && !req2.Opts.Previous && h.LogArchive.Has(req2.Namespace, req2.PodUID, req2.ContainerName) {
+		h.logsWithArchiveFallback(w, req, req2, sidecar, sessionContext)
+		return
+	}
+
+	if req2.Opts.Follow && acceptsFramedLogs(r) {
+		log.G(h.Ctx).Info(sessionContextMessage, "InterLink: following logs from sidecar")
+		h.followLogs(w, r, req, sidecar, sessionContext)
+		return
+	}
+
 	log.G(h.Ctx).Info(sessionContextMessage, "InterLink: forwarding GetLogs call to sidecar")
-	_, err = ReqWithError(h.Ctx, req, w, start, span, true, false, sessionContext, h.ClientHTTP)
+	_, err = ReqWithError(h.Ctx, req, w, start, span, true, false, sessionContext, sidecar.ClientHTTP)
 	if err != nil {
 		log.L.Error(sessionContextMessage, err)
 		return
 	}
 }
+
+// acceptsFramedLogs tells whether the client asked for a framed log stream.
+func acceptsFramedLogs(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaType := range strings.Split(accept, ",") {
+			mediaType, _, _ = strings.Cut(mediaType, ";")
+			if strings.TrimSpace(mediaType) == logstream.ContentType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (h *InterLinkHandler) followHeartbeatInterval() time.Duration {
+	if h.Config.Logs.FollowHeartbeatSeconds > 0 {
+		return time.Duration(h.Config.Logs.FollowHeartbeatSeconds) * time.Second
+	}
+	return defaultFollowHeartbeatInterval
+}
+
+// maxFollowDuration returns the maximum duration of a follow stream, 0 for none.
+func (h *InterLinkHandler) maxFollowDuration() time.Duration {
+	switch {
+	case h.Config.Logs.MaxFollowSeconds < 0:
+		return 0
+	case h.Config.Logs.MaxFollowSeconds > 0:
+		return time.Duration(h.Config.Logs.MaxFollowSeconds) * time.Second
+	default:
+		return defaultMaxFollowDuration
+	}
+}
+
+// followLogs streams the logs returned by the sidecar for req as a framed log stream. The
+// response is started at once, and heartbeat frames are sent while the sidecar is silent.
+// The stream ends with an error frame when the sidecar fails, and with an end frame when the
+// sidecar closes it or the maximum follow duration is reached.
+func (h *InterLinkHandler) followLogs(w http.ResponseWriter, r *http.Request, req *http.Request, sidecar *Sidecar, sessionContext string) {
+	sessionContextMessage := GetSessionContextMessage(sessionContext)
+
+	w.Header().Set("Content-Type", logstream.ContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	stream := logstream.NewWriter(w)
+	if err := stream.Heartbeat(); err != nil {
+		log.G(h.Ctx).Error(sessionContextMessage, err)
+		return
+	}
+
+	// The heartbeats must stop before the handler returns and w becomes unusable.
+	done := make(chan struct{})
+	var heartbeats sync.WaitGroup
+	heartbeats.Add(1)
+	go func() {
+		defer heartbeats.Done()
+		ticker := time.NewTicker(h.followHeartbeatInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := stream.Heartbeat(); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	defer func() {
+		close(done)
+		heartbeats.Wait()
+	}()
+
+	err := h.copyFollowedLogs(stream, req, sidecar, sessionContext)
+	switch {
+	case r.Context().Err() != nil:
+		log.G(h.Ctx).Info(sessionContextMessage, "Log follow client disconnected")
+	case errors.Is(req.Context().Err(), context.DeadlineExceeded):
+		log.G(h.Ctx).Info(sessionContextMessage, "Log follow reached the maximum duration")
+		_ = stream.End("maximum follow duration reached")
+	case err != nil:
+		log.G(h.Ctx).Error(sessionContextMessage, err)
+		_ = stream.Error(err.Error())
+	default:
+		_ = stream.End("")
+	}
+}
+
+// copyFollowedLogs calls the sidecar and copies the logs it streams to stream.
+func (h *InterLinkHandler) copyFollowedLogs(stream *logstream.Writer, req *http.Request, sidecar *Sidecar, sessionContext string) error {
+	AddSessionContext(req, sessionContext)
+	if !isSafeURL(req.URL.String()) {
+		return fmt.Errorf("potential SSRF detected: %s", req.URL.String())
+	}
+	resp, err := sidecar.ClientHTTP.Do(req) // #nosec G704
+	if err != nil {
+		return fmt.Errorf("unable to get the logs from sidecar %s: %w", sidecar.Name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("sidecar %s returned HTTP %d: %s", sidecar.Name, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if _, err := io.Copy(stream, resp.Body); err != nil {
+		return fmt.Errorf("log stream from sidecar %s interrupted: %w", sidecar.Name, err)
+	}
+	return nil
+}
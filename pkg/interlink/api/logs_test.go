@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -16,6 +18,7 @@ import (
 	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 
 	types "github.com/interlink-hq/interlink/pkg/interlink"
+	"github.com/interlink-hq/interlink/pkg/interlink/logstream"
 )
 
 func setupLogsTestTracer() (*trace.TracerProvider, func()) {
@@ -351,3 +354,100 @@ func TestIsSafeURL(t *testing.T) {
 		})
 	}
 }
+
+// followSidecar streams a log line, then stays silent until the call is canceled, which it
+// reports on canceled.
+func followSidecar(t *testing.T) (*Sidecar, chan struct{}) {
+	t.Helper()
+	canceled := make(chan struct{})
+	server, endpoint, client := newUnixTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("line 1\n"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+		close(canceled)
+	}))
+	t.Cleanup(server.Close)
+	return &Sidecar{Name: "default", Endpoint: endpoint, ClientHTTP: client}, canceled
+}
+
+func followRequest(t *testing.T, url string) *http.Request {
+	t.Helper()
+	body, err := json.Marshal(types.LogStruct{
+		Namespace: "default",
+		PodUID:    "12345678-1234-1234-1234-123456789012",
+		Opts:      types.ContainerLogOpts{Follow: true},
+	})
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodGet, url, bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Accept", logstream.ContentType)
+	return req
+}
+
+func TestGetLogsHandler_Follow(t *testing.T) {
+	sidecar, canceled := followSidecar(t)
+	h := &InterLinkHandler{
+		Ctx:      context.Background(),
+		Config:   types.Config{Logs: types.LogsConfig{FollowHeartbeatSeconds: 1}},
+		Sidecars: []*Sidecar{sidecar},
+	}
+	server := httptest.NewServer(http.HandlerFunc(h.GetLogsHandler))
+	defer server.Close()
+
+	resp, err := http.DefaultClient.Do(followRequest(t, server.URL))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, logstream.ContentType, resp.Header.Get("Content-Type"))
+
+	var frames atomic.Int32
+	stream := logstream.NewReader(resp.Body, func() { frames.Add(1) })
+	line := make([]byte, len("line 1\n"))
+	_, err = io.ReadFull(stream, line)
+	require.NoError(t, err)
+	assert.Equal(t, "line 1\n", string(line))
+
+	// the sidecar is silent: only heartbeats keep coming
+	go func() { _, _ = stream.Read(make([]byte, 1)) }()
+	require.Eventually(t, func() bool { return frames.Load() >= 3 }, 3*time.Second, 50*time.Millisecond)
+
+	require.NoError(t, stream.Close())
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the sidecar call was not canceled when the client went away")
+	}
+}
+
+func TestGetLogsHandler_FollowEnds(t *testing.T) {
+	t.Run("maximum follow duration", func(t *testing.T) {
+		sidecar, canceled := followSidecar(t)
+		h := &InterLinkHandler{
+			Ctx:      context.Background(),
+			Config:   types.Config{Logs: types.LogsConfig{MaxFollowSeconds: 1}},
+			Sidecars: []*Sidecar{sidecar},
+		}
+		rec := httptest.NewRecorder()
+		h.GetLogsHandler(rec, followRequest(t, "/getLogs"))
+
+		out, err := io.ReadAll(logstream.NewReader(io.NopCloser(rec.Body), nil))
+		require.NoError(t, err, "the stream ends with an end frame")
+		assert.Equal(t, "line 1\n", string(out))
+		<-canceled
+	})
+
+	t.Run("sidecar error", func(t *testing.T) {
+		server, endpoint, client := newUnixTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			http.Error(w, "no such container", http.StatusNotFound)
+		}))
+		defer server.Close()
+		h := &InterLinkHandler{Ctx: context.Background(), Sidecars: []*Sidecar{{Name: "default", Endpoint: endpoint, ClientHTTP: client}}}
+		rec := httptest.NewRecorder()
+		h.GetLogsHandler(rec, followRequest(t, "/getLogs"))
+
+		assert.Equal(t, http.StatusOK, rec.Code, "the stream is started before the sidecar answers")
+		_, err := io.ReadAll(logstream.NewReader(io.NopCloser(rec.Body), nil))
+		var streamErr *logstream.StreamError
+		require.ErrorAs(t, err, &streamErr)
+		assert.Contains(t, streamErr.Message, "HTTP 404: no such container")
+	})
+}
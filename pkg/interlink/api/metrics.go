@@ -0,0 +1,141 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/interlink-hq/interlink/pkg/interlink/audit"
+)
+
+// instrumentedEndpoints are the API paths whose calls are measured. Other paths, such as
+// the long-lived /watch streams, are left out so that they do not skew the latencies.
+var instrumentedEndpoints = map[string]bool{
+	"/create":      true,
+	"/status":      true,
+	"/delete":      true,
+	"/getLogs":     true,
+	"/pinglink":    true,
+	"/updateCache": true,
+	"/validate":    true,
+	"/stats":       true,
+}
+
+var (
+	metricsRegistry = prometheus.NewRegistry()
+
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "interlink",
+		Name:      "http_requests_total",
+		Help:      "Number of calls to the interLink API, by endpoint and status code.",
+	}, []string{"endpoint", "code"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "interlink",
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of the calls to the interLink API, by endpoint.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint"})
+
+	inflightSessions = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "interlink",
+		Name:      "inflight_sessions",
+		Help:      "Number of calls to the interLink API being served.",
+	})
+
+	sidecarDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "interlink",
+		Name:      "sidecar_request_duration_seconds",
+		Help:      "Round-trip latency of the calls to the sidecar plugins, by sidecar, endpoint and status code (\"error\" when no response was received).",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"sidecar", "endpoint", "code"})
+
+	admissionQueued = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "interlink",
+		Name:      "admission_queued_pods",
+		Help:      "Number of pods waiting in the admission queue, by tenant.",
+	}, []string{"tenant"})
+
+	statusCacheSize = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "interlink",
+		Name:      "status_cache_pods",
+		Help:      "Number of pods held in the status cache.",
+	}, func() float64 {
+		PodStatuses.mu.Lock()
+		defer PodStatuses.mu.Unlock()
+		return float64(len(PodStatuses.Statuses))
+	})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		requestsTotal,
+		requestDuration,
+		inflightSessions,
+		sidecarDuration,
+		admissionQueued,
+		statusCacheSize,
+	)
+}
+
+// MetricsHandler serves the interLink metrics in the Prometheus exposition format.
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// MetricsMiddleware measures the calls to the instrumented API endpoints. Versioned paths
+// (/v1/create) are counted with their legacy one (/create).
+func MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		endpoint := unversionedPath(r.URL.Path)
+		if !instrumentedEndpoints[endpoint] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		inflightSessions.Inc()
+		defer inflightSessions.Dec()
+		start := time.Now()
+		recorder := &audit.StatusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(recorder, r)
+
+		requestDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+		requestsTotal.WithLabelValues(endpoint, strconv.Itoa(recorder.Code())).Inc()
+	})
+}
+
+// metricsTransport measures the round trips to a sidecar.
+type metricsTransport struct {
+	sidecar string
+	next    http.RoundTripper
+}
+
+// InstrumentTransport returns a transport recording the latency of the calls that next
+// (http.DefaultTransport when nil) sends to the named sidecar.
+func InstrumentTransport(sidecar string, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &metricsTransport{sidecar: sidecar, next: next}
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// sidecar endpoints may carry a prefix, e.g. "http+unix:///" turns /status into //status
+	endpoint := "/" + strings.TrimLeft(req.URL.Path, "/")
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	sidecarDuration.WithLabelValues(t.sidecar, endpoint, code).Observe(time.Since(start).Seconds())
+	return resp, err
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func histogramCount(t *testing.T, vec *prometheus.HistogramVec, labels ...string) uint64 {
+	t.Helper()
+	observer, err := vec.GetMetricWithLabelValues(labels...)
+	require.NoError(t, err)
+	var m dto.Metric
+	require.NoError(t, observer.(prometheus.Metric).Write(&m))
+	return m.GetHistogram().GetSampleCount()
+}
+
+func counterValue(t *testing.T, vec *prometheus.CounterVec, labels ...string) float64 {
+	t.Helper()
+	var m dto.Metric
+	require.NoError(t, vec.WithLabelValues(labels...).Write(&m))
+	return m.GetCounter().GetValue()
+}
+
+func TestMetricsMiddleware_CountsInstrumentedEndpoints(t *testing.T) {
+	handler := MetricsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/delete" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+
+	okBefore := counterValue(t, requestsTotal, "/status", "200")
+	failBefore := counterValue(t, requestsTotal, "/delete", "500")
+	latencyBefore := histogramCount(t, requestDuration, "/status")
+	watchBefore := histogramCount(t, requestDuration, "/watch")
+
+	for _, path := range []string{"/status", "/delete", "/watch"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, okBefore+1, counterValue(t, requestsTotal, "/status", "200"))
+	assert.Equal(t, failBefore+1, counterValue(t, requestsTotal, "/delete", "500"))
+	assert.Equal(t, latencyBefore+1, histogramCount(t, requestDuration, "/status"))
+	assert.Equal(t, watchBefore, histogramCount(t, requestDuration, "/watch"), "/watch must not be measured")
+}
+
+func TestMetricsMiddleware_KeepsFlusher(t *testing.T) {
+	flushed := false
+	handler := MetricsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		f, ok := w.(http.Flusher)
+		require.True(t, ok)
+		f.Flush()
+		flushed = true
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/getLogs", nil))
+	assert.True(t, flushed)
+	assert.True(t, rec.Flushed)
+}
+
+func TestInstrumentTransport_ObservesSidecarCalls(t *testing.T) {
+	server, endpoint, client := newUnixTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	client.Transport = InstrumentTransport("metrics-test", client.Transport)
+	before := histogramCount(t, sidecarDuration, "metrics-test", "/status", "202")
+
+	sidecar := &Sidecar{Name: "metrics-test", Endpoint: endpoint, ClientHTTP: client}
+	code, _, err := sidecar.do(context.Background(), http.MethodGet, "/status", nil, "test")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, code)
+	assert.Equal(t, before+1, histogramCount(t, sidecarDuration, "metrics-test", "/status", "202"))
+}
+
+func TestMetricsHandler_ExposesMetrics(t *testing.T) {
+	resetPodStatuses(testPodStatus("uid-a", "1"))
+	defer resetPodStatuses()
+
+	server := httptest.NewServer(MetricsHandler())
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	for _, name := range []string{
+		"interlink_http_requests_total",
+		"interlink_http_request_duration_seconds",
+		"interlink_inflight_sessions",
+		"interlink_sidecar_request_duration_seconds",
+		"interlink_status_cache_pods 1",
+		"go_goroutines",
+	} {
+		assert.Contains(t, string(body), name)
+	}
+}
@@ -2,14 +2,17 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/containerd/containerd/log"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 
 	types "github.com/interlink-hq/interlink/pkg/interlink"
 
@@ -18,7 +21,11 @@ import (
 	trace "go.opentelemetry.io/otel/trace"
 )
 
-// Ping is just a very basic Ping function
+// Ping is just a very basic Ping function.
+// With a single sidecar the plugin response is passed through unchanged, and the state of
+// its circuit breaker is reported in the CircuitStateHeader header. With several sidecars
+// every plugin is pinged and a PingResponse listing each plugin health and circuit state is
+// returned: the call fails only when no plugin is reachable.
 func (h *InterLinkHandler) Ping(w http.ResponseWriter, r *http.Request) {
 	start := time.Now().UnixMicro()
 	tracer := otel.Tracer("interlink-API")
@@ -31,6 +38,16 @@ func (h *InterLinkHandler) Ping(w http.ResponseWriter, r *http.Request) {
 
 	log.G(h.Ctx).Info("InterLink: received Ping call")
 
+	sidecars := h.sidecars()
+	if len(sidecars) > 1 {
+		h.pingSidecars(w, r, sidecars, start, span)
+		return
+	}
+	sidecar := sidecars[0]
+	if circuit := sidecar.circuitState(); circuit != "" {
+		w.Header().Set(CircuitStateHeader, circuit)
+	}
+
 	podsToBeChecked := []*v1.Pod{}
 	bodyBytes, err := json.Marshal(podsToBeChecked)
 	if err != nil {
@@ -38,7 +55,7 @@ func (h *InterLinkHandler) Ping(w http.ResponseWriter, r *http.Request) {
 	}
 
 	reader := bytes.NewReader(bodyBytes)
-	req, err := http.NewRequest(http.MethodGet, h.SidecarEndpoint+"/status", reader)
+	req, err := http.NewRequest(http.MethodGet, sidecar.Endpoint+"/status", reader)
 	if err != nil {
 		log.G(h.Ctx).Error(err)
 	}
@@ -52,7 +69,7 @@ func (h *InterLinkHandler) Ping(w http.ResponseWriter, r *http.Request) {
 	// respPlugin, err := http.DefaultClient.Do(req)
 	//  respPlugin, err := DoReq(req.WithContext(ctx))
 	sessionContext := GetSessionContext(req)
-	_, err = ReqWithError(h.Ctx, req, w, start, span, true, false, sessionContext, h.ClientHTTP)
+	_, err = ReqWithError(h.Ctx, req, w, start, span, true, false, sessionContext, sidecar.ClientHTTP)
 	if err != nil {
 		log.G(h.Ctx).Error(err)
 		w.WriteHeader(http.StatusServiceUnavailable)
@@ -83,3 +100,146 @@ func (h *InterLinkHandler) Ping(w http.ResponseWriter, r *http.Request) {
 	// 	log.G(h.Ctx).Error(errors.New("Failed to write to http buffer"))
 	// }
 }
+
+// pingSidecars pings every sidecar and aggregates their answers into a single PingResponse.
+func (h *InterLinkHandler) pingSidecars(w http.ResponseWriter, r *http.Request, sidecars []*Sidecar, start int64, span trace.Span) {
+	sessionContext := GetSessionContext(r)
+
+	aggregated := types.PingResponse{}
+	var resources []*types.ResourcesResponse
+	var taints []types.TaintResponse
+	taintsReported := false
+	healthy := 0
+
+	for _, sidecar := range sidecars {
+		pluginStatus := types.PluginPingStatus{Name: sidecar.Name, Status: "unavailable"}
+
+		code, body, err := pingSidecar(h.Ctx, sidecar, sessionContext)
+		pluginStatus.HTTPCode = code
+		pluginStatus.Circuit = sidecar.circuitState()
+		switch {
+		case err != nil:
+			pluginStatus.Error = err.Error()
+		case code != http.StatusOK:
+			pluginStatus.Error = strings.TrimSpace(string(body))
+		default:
+			pluginStatus.Status = "ok"
+			healthy++
+
+			var pluginResp types.PingResponse
+			if json.Unmarshal(body, &pluginResp) == nil {
+				if pluginResp.Resources != nil {
+					resources = append(resources, pluginResp.Resources)
+				}
+				if pluginResp.Taints != nil {
+					taintsReported = true
+					taints = append(taints, *pluginResp.Taints...)
+				}
+			}
+		}
+		if pluginStatus.Status != "ok" {
+			log.G(h.Ctx).Warningf("Sidecar %s is unavailable: %s", sidecar.Name, pluginStatus.Error)
+		}
+		aggregated.Plugins = append(aggregated.Plugins, pluginStatus)
+	}
+
+	statusCode := http.StatusOK
+	switch healthy {
+	case len(sidecars):
+		aggregated.Status = "ok"
+	case 0:
+		aggregated.Status = "unavailable"
+		statusCode = http.StatusServiceUnavailable
+	default:
+		aggregated.Status = "degraded"
+	}
+	aggregated.Resources = sumResources(h.Ctx, resources)
+	if taintsReported {
+		aggregated.Taints = &taints
+	}
+
+	types.SetDurationSpan(start, span, types.WithHTTPReturnCode(statusCode))
+
+	bodyBytes, err := json.Marshal(aggregated)
+	if err != nil {
+		log.G(h.Ctx).Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if _, err = w.Write(bodyBytes); err != nil {
+		log.G(h.Ctx).Error(errors.New("failed to write to http buffer"))
+	}
+}
+
+// pingSidecar sends an empty status request to a sidecar and returns its status code and body.
+func pingSidecar(ctx context.Context, sidecar *Sidecar, sessionContext string) (int, []byte, error) {
+	return sidecar.do(ctx, http.MethodGet, "/status", []byte("[]"), sessionContext)
+}
+
+// sumResources adds up the capacities reported by several plugins.
+// Quantities that cannot be parsed are skipped; nil is returned when nothing was reported.
+func sumResources(ctx context.Context, reported []*types.ResourcesResponse) *types.ResourcesResponse {
+	if len(reported) == 0 {
+		return nil
+	}
+
+	var cpu, memory, pods, cpuUsage, memoryUsage *resource.Quantity
+	add := func(total **resource.Quantity, value string) {
+		if value == "" {
+			return
+		}
+		q, err := resource.ParseQuantity(value)
+		if err != nil {
+			log.G(ctx).Warningf("Ignoring invalid resource quantity %q reported by a plugin: %v", value, err)
+			return
+		}
+		if *total == nil {
+			*total = &q
+			return
+		}
+		(*total).Add(q)
+	}
+
+	accelerators := map[string]*resource.Quantity{}
+	var acceleratorTypes []string
+	for _, res := range reported {
+		add(&cpu, res.CPU)
+		add(&memory, res.Memory)
+		add(&pods, res.Pods)
+		add(&cpuUsage, res.CPUUsage)
+		add(&memoryUsage, res.MemoryUsage)
+		for _, acc := range res.Accelerators {
+			total, ok := accelerators[acc.ResourceType]
+			if !ok {
+				acceleratorTypes = append(acceleratorTypes, acc.ResourceType)
+			}
+			add(&total, acc.Available)
+			accelerators[acc.ResourceType] = total
+		}
+	}
+
+	sum := &types.ResourcesResponse{}
+	if cpu != nil {
+		sum.CPU = cpu.String()
+	}
+	if memory != nil {
+		sum.Memory = memory.String()
+	}
+	if pods != nil {
+		sum.Pods = pods.String()
+	}
+	if cpuUsage != nil {
+		sum.CPUUsage = cpuUsage.String()
+	}
+	if memoryUsage != nil {
+		sum.MemoryUsage = memoryUsage.String()
+	}
+	for _, name := range acceleratorTypes {
+		if total := accelerators[name]; total != nil {
+			sum.Accelerators = append(sum.Accelerators, types.AcceleratorResponse{ResourceType: name, Available: total.String()})
+		}
+	}
+	return sum
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/containerd/containerd/log"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+	"github.com/interlink-hq/interlink/pkg/interlink/audit"
+	"github.com/interlink-hq/interlink/pkg/interlink/channelstream"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	trace "go.opentelemetry.io/otel/trace"
+)
+
+// validatePortForwardRequest checks the pod and the port of a port forward request.
+func validatePortForwardRequest(req types.PortForwardRequest) error {
+	if err := validateLogRequest(types.LogStruct{Namespace: req.Namespace, PodUID: req.PodUID}); err != nil {
+		return err
+	}
+	if req.Port < 1 || req.Port > 65535 {
+		return errors.New("invalid port: must be between 1 and 65535")
+	}
+	return nil
+}
+
+// PortForwardHandler handles HTTP POST requests forwarding a connection to a port of a pod, for
+// kubectl port-forward. The bodies are channel streams, as for ExecHandler: the request starts
+// with a JSON-encoded PortForwardRequest, then carries the bytes sent to the port on the stdin
+// channel; the response carries the bytes received on the stdout channel. The session ends
+// with a status frame once the connection is closed in both directions.
+//
+// HTTP Status Codes:
+//   - 200: Session opened, the outcome is in the status frame
+//   - 400: Bad request (the stream does not start with a valid PortForwardRequest)
+//   - 501: The plugin does not support port forwarding
+//   - 502: The plugin failed to open the session
+func (h *InterLinkHandler) PortForwardHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now().UnixMicro()
+	tracer := otel.Tracer("interlink-API")
+	_, span := tracer.Start(h.Ctx, "PortForwardAPI", trace.WithAttributes(
+		attribute.Int64("start.timestamp", start),
+	))
+	defer span.End()
+	defer types.SetDurationSpan(start, span)
+	defer types.SetInfoFromHeaders(span, &r.Header)
+
+	sessionContext := GetSessionContext(r)
+	sessionContextMessage := GetSessionContextMessage(sessionContext)
+	span.SetAttributes(attribute.String("session.id", sessionContext))
+	log.G(h.Ctx).Info(sessionContextMessage, "InterLink: received PortForward call")
+
+	enableFullDuplex(w)
+
+	body := channelstream.NewReader(r.Body)
+	channel, payload, err := body.Next()
+	if err != nil || channel != channelstream.ChannelRequest {
+		http.Error(w, "the stream must start with the port forward request", http.StatusBadRequest)
+		return
+	}
+	var portForwardRequest types.PortForwardRequest
+	if err := json.Unmarshal(payload, &portForwardRequest); err != nil {
+		http.Error(w, "invalid port forward request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validatePortForwardRequest(portForwardRequest); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	span.SetAttributes(
+		attribute.String("pod.name", portForwardRequest.PodName),
+		attribute.String("pod.namespace", portForwardRequest.Namespace),
+		attribute.String("pod.uid", portForwardRequest.PodUID),
+		attribute.Int("portforward.port", int(portForwardRequest.Port)),
+	)
+	audit.AddPod(r.Context(), audit.Pod{Namespace: portForwardRequest.Namespace, Name: portForwardRequest.PodName, UID: portForwardRequest.PodUID})
+	log.G(h.Ctx).Info(sessionContextMessage, "Forward port ", portForwardRequest.Port, " of pod ",
+		portForwardRequest.Namespace, "/", portForwardRequest.PodName)
+
+	sidecar := h.routeUID(portForwardRequest.PodUID, portForwardRequest.Namespace)
+	span.SetAttributes(attribute.String("sidecar.name", sidecar.Name))
+	h.relaySession(w, r, sidecar, "/portforward", payload, body, sessionContext)
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+	"github.com/interlink-hq/interlink/pkg/interlink/channelstream"
+)
+
+func TestPortForwardHandler(t *testing.T) {
+	sidecar, endpoint, client := newUnixTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		assert.NoError(t, rc.EnableFullDuplex())
+		in := channelstream.NewReader(r.Body)
+		_, payload, err := in.Next()
+		assert.NoError(t, err)
+		var req types.PortForwardRequest
+		assert.NoError(t, json.Unmarshal(payload, &req))
+		assert.Equal(t, int32(8888), req.Port)
+
+		w.Header().Set("Content-Type", channelstream.ContentType)
+		w.WriteHeader(http.StatusOK)
+		assert.NoError(t, rc.Flush())
+		out := channelstream.NewWriter(w)
+		channel, payload, err := in.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, channelstream.ChannelStdin, channel)
+		assert.NoError(t, out.WriteFrame(channelstream.ChannelStdout, bytes.ToUpper(payload)))
+		assert.NoError(t, out.WriteJSON(channelstream.ChannelStatus, channelstream.Status{}))
+	}))
+	defer sidecar.Close()
+	h := &InterLinkHandler{Ctx: context.Background(), SidecarEndpoint: endpoint, ClientHTTP: client}
+	server := httptest.NewServer(http.HandlerFunc(h.PortForwardHandler))
+	defer server.Close()
+
+	body, pipe := io.Pipe()
+	defer pipe.Close()
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, server.URL+"/portforward", body)
+	require.NoError(t, err)
+	in := channelstream.NewWriter(pipe)
+	go func() {
+		_ = in.WriteJSON(channelstream.ChannelRequest, types.PortForwardRequest{
+			Namespace: "default", PodUID: execPodUID, PodName: "pod", Port: 8888,
+		})
+		_ = in.WriteFrame(channelstream.ChannelStdin, []byte("ping"))
+	}()
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	out := channelstream.NewReader(resp.Body)
+	channel, payload, err := out.Next()
+	require.NoError(t, err)
+	assert.Equal(t, channelstream.ChannelStdout, channel)
+	assert.Equal(t, "PING", string(payload))
+	channel, _, err = out.Next()
+	require.NoError(t, err)
+	assert.Equal(t, channelstream.ChannelStatus, channel)
+}
+
+func TestPortForwardHandler_InvalidPort(t *testing.T) {
+	h := &InterLinkHandler{Ctx: context.Background()}
+	for _, port := range []int32{0, -1, 70000} {
+		var body bytes.Buffer
+		require.NoError(t, channelstream.NewWriter(&body).WriteJSON(channelstream.ChannelRequest,
+			types.PortForwardRequest{Namespace: "default", PodUID: execPodUID, Port: port}))
+		rec := httptest.NewRecorder()
+		h.PortForwardHandler(rec, httptest.NewRequest(http.MethodPost, "/portforward", &body))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "port %d", port)
+	}
+}
@@ -0,0 +1,331 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/log"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+)
+
+const (
+	defaultRetryMaxAttempts        = 3
+	defaultRetryInitialBackoff     = 200 * time.Millisecond
+	defaultRetryMaxBackoff         = 5 * time.Second
+	defaultCircuitFailureThreshold = 5
+	defaultCircuitOpenDuration     = 30 * time.Second
+)
+
+// Circuit breaker states, as reported by /pinglink.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// CircuitStateHeader carries the circuit breaker state of the only sidecar in the /pinglink
+// responses, whose body is the one of the plugin.
+const CircuitStateHeader = "Interlink-Circuit-State"
+
+// ErrCircuitOpen is returned for the calls to a sidecar whose circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// circuitBreaker counts the consecutive failures of a sidecar. Once the threshold is reached
+// the circuit opens and calls fail immediately. After openDuration a single probe call is let
+// through (half-open): its success closes the circuit, its failure opens it again.
+type circuitBreaker struct {
+	mu           sync.Mutex
+	name         string
+	threshold    int
+	openDuration time.Duration
+	now          func() time.Time
+
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newCircuitBreaker(name string, threshold int, openDuration time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		name:         name,
+		threshold:    threshold,
+		openDuration: openDuration,
+		now:          time.Now,
+		state:        CircuitClosed,
+	}
+}
+
+// allow returns ErrCircuitOpen when the call must not reach the sidecar.
+func (b *circuitBreaker) allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitOpen {
+		remaining := b.openDuration - b.now().Sub(b.openedAt)
+		if remaining > 0 {
+			return fmt.Errorf("%w: sidecar %s is unavailable, next attempt in %s", ErrCircuitOpen, b.name, remaining.Round(time.Second))
+		}
+		b.state = CircuitHalfOpen
+		b.probing = false
+	}
+	if b.state == CircuitHalfOpen {
+		if b.probing {
+			return fmt.Errorf("%w: sidecar %s is unavailable, a probe call is in progress", ErrCircuitOpen, b.name)
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// record updates the breaker with the outcome of a call let through by allow.
+func (b *circuitBreaker) record(success bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if success {
+		if b.state != CircuitClosed {
+			log.L.Info("Circuit breaker of sidecar ", b.name, " closed")
+		}
+		b.state = CircuitClosed
+		b.failures = 0
+		b.probing = false
+		return
+	}
+
+	b.failures++
+	if b.state == CircuitHalfOpen || b.failures >= b.threshold {
+		if b.state != CircuitOpen {
+			log.L.Warningf("Circuit breaker of sidecar %s opened after %d consecutive failures", b.name, b.failures)
+		}
+		b.state = CircuitOpen
+		b.openedAt = b.now()
+		b.probing = false
+	}
+}
+
+func (b *circuitBreaker) currentState() string {
+	if b == nil {
+		return CircuitClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == CircuitOpen && b.now().Sub(b.openedAt) >= b.openDuration {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
+
+// SidecarTransport wraps the transport of a sidecar client. Idempotent requests (GET and HEAD)
+// are retried with exponential backoff and jitter when the sidecar cannot be reached or answers
+// 502, 503 or 504, and a circuit breaker fails every request fast while the sidecar is down.
+type SidecarTransport struct {
+	next           http.RoundTripper
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	breaker        *circuitBreaker
+}
+
+// NewSidecarTransport returns a SidecarTransport for the named sidecar sending requests through next
+// (http.DefaultTransport when nil). Unset fields of config take their default value.
+func NewSidecarTransport(name string, next http.RoundTripper, config types.SidecarRetryConfig) *SidecarTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	t := &SidecarTransport{
+		next:           next,
+		maxAttempts:    defaultRetryMaxAttempts,
+		initialBackoff: defaultRetryInitialBackoff,
+		maxBackoff:     defaultRetryMaxBackoff,
+	}
+	if config.MaxAttempts > 0 {
+		t.maxAttempts = config.MaxAttempts
+	}
+	if config.InitialBackoffMilliseconds > 0 {
+		t.initialBackoff = time.Duration(config.InitialBackoffMilliseconds) * time.Millisecond
+	}
+	if config.MaxBackoffMilliseconds > 0 {
+		t.maxBackoff = time.Duration(config.MaxBackoffMilliseconds) * time.Millisecond
+	}
+
+	if config.CircuitFailureThreshold >= 0 {
+		threshold := defaultCircuitFailureThreshold
+		if config.CircuitFailureThreshold > 0 {
+			threshold = config.CircuitFailureThreshold
+		}
+		openDuration := defaultCircuitOpenDuration
+		if config.CircuitOpenSeconds > 0 {
+			openDuration = time.Duration(config.CircuitOpenSeconds) * time.Second
+		}
+		t.breaker = newCircuitBreaker(name, threshold, openDuration)
+	}
+	return t
+}
+
+// CircuitState returns the state of the circuit breaker: CircuitClosed, CircuitOpen or CircuitHalfOpen.
+func (t *SidecarTransport) CircuitState() string {
+	return t.breaker.currentState()
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *SidecarTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	attempts := 1
+	if (req.Method == http.MethodGet || req.Method == http.MethodHead) && (req.Body == nil || req.GetBody != nil) {
+		attempts = t.maxAttempts
+	}
+
+	backoff := t.initialBackoff
+	for attempt := 1; ; attempt++ {
+		if err := t.breaker.allow(); err != nil {
+			return nil, err
+		}
+
+		try := req
+		if attempt > 1 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				t.breaker.record(true)
+				return nil, err
+			}
+			try = req.Clone(req.Context())
+			try.Body = body
+		}
+
+		resp, err := t.next.RoundTrip(try)
+		if req.Context().Err() != nil {
+			// the caller gave up: this says nothing about the health of the sidecar
+			t.breaker.record(true)
+			return resp, err
+		}
+		failed := err != nil || isUnavailableStatus(resp.StatusCode)
+		t.breaker.record(!failed)
+		if !failed || attempt >= attempts {
+			return resp, err
+		}
+
+		if err != nil {
+			log.G(req.Context()).Warningf("%s %s failed (attempt %d/%d): %v", req.Method, req.URL.Path, attempt, attempts, err)
+		} else {
+			log.G(req.Context()).Warningf("%s %s returned %d (attempt %d/%d)", req.Method, req.URL.Path, resp.StatusCode, attempt, attempts)
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(jitter(backoff)):
+		}
+		backoff = min(2*backoff, t.maxBackoff)
+	}
+}
+
+func isUnavailableStatus(code int) bool {
+	return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+}
+
+// jitter returns a random duration between d/2 and d, so that callers retrying together spread out.
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1)) // #nosec G404 -- no security purpose
+}
+
+// circuitState returns the circuit breaker state of the sidecar, or "" when it has no breaker.
+func (sc *Sidecar) circuitState() string {
+	if sc.ClientHTTP == nil {
+		return ""
+	}
+	if t, ok := sc.ClientHTTP.Transport.(*SidecarTransport); ok && t.breaker != nil {
+		return t.CircuitState()
+	}
+	return ""
+}
+
+// errResponseHeaderTimeout is the cause of the calls canceled by HeaderTimeoutTransport.
+var errResponseHeaderTimeout = errors.New("timeout awaiting response headers")
+
+type noHeaderTimeoutKey struct{}
+
+// withoutHeaderTimeout marks the calls of a context as streams, which plugins may only
+// answer once they have something to send: HeaderTimeoutTransport does not limit them.
+func withoutHeaderTimeout(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noHeaderTimeoutKey{}, true)
+}
+
+// HeaderTimeoutTransport fails the calls whose response headers do not arrive within
+// timeout, like http.Transport.ResponseHeaderTimeout, except for the follow-mode streams.
+type HeaderTimeoutTransport struct {
+	next    http.RoundTripper
+	timeout time.Duration
+}
+
+// NewHeaderTimeoutTransport returns a HeaderTimeoutTransport sending requests through next.
+func NewHeaderTimeoutTransport(next http.RoundTripper, timeout time.Duration) *HeaderTimeoutTransport {
+	return &HeaderTimeoutTransport{next: next, timeout: timeout}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *HeaderTimeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.timeout <= 0 || req.Context().Value(noHeaderTimeoutKey{}) != nil {
+		return t.next.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithCancelCause(req.Context())
+	timer := time.AfterFunc(t.timeout, func() { cancel(errResponseHeaderTimeout) })
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if !timer.Stop() {
+		if err == nil {
+			resp.Body.Close()
+		}
+		return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL.Path, errResponseHeaderTimeout)
+	}
+	if err != nil {
+		cancel(nil)
+		return nil, err
+	}
+	// The context must live as long as the body is read.
+	if rwc, ok := resp.Body.(io.ReadWriteCloser); ok {
+		resp.Body = &cancelReadWriteCloser{ReadWriteCloser: rwc, cancel: func() { cancel(nil) }}
+	} else {
+		resp.Body = &cancelReadCloser{ReadCloser: resp.Body, cancel: func() { cancel(nil) }}
+	}
+	return resp, nil
+}
+
+// cancelReadCloser cancels the context of a call when its body is closed.
+type cancelReadCloser struct {
+	io.ReadCloser
+	cancel func()
+}
+
+func (c *cancelReadCloser) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+// cancelReadWriteCloser is cancelReadCloser for the bodies of upgraded connections.
+type cancelReadWriteCloser struct {
+	io.ReadWriteCloser
+	cancel func()
+}
+
+func (c *cancelReadWriteCloser) Close() error {
+	defer c.cancel()
+	return c.ReadWriteCloser.Close()
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+)
+
+// flakySidecar answers 503 to the first failures requests and 200 afterwards.
+func flakySidecar(t *testing.T, failures int32, config types.SidecarRetryConfig) (*Sidecar, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	server, endpoint, client := newUnixTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if calls.Add(1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	t.Cleanup(server.Close)
+	client.Transport = NewSidecarTransport("flaky", client.Transport, config)
+	return &Sidecar{Name: "flaky", Endpoint: endpoint, ClientHTTP: client}, &calls
+}
+
+func TestSidecarTransport_RetriesIdempotentCalls(t *testing.T) {
+	sidecar, calls := flakySidecar(t, 2, types.SidecarRetryConfig{InitialBackoffMilliseconds: 1})
+
+	code, body, err := sidecar.do(context.Background(), http.MethodGet, "/status", []byte("[]"), "test")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "[]", string(body))
+	assert.Equal(t, int32(3), calls.Load())
+	assert.Equal(t, CircuitClosed, sidecar.circuitState())
+}
+
+func TestSidecarTransport_DoesNotRetryCreate(t *testing.T) {
+	sidecar, calls := flakySidecar(t, 2, types.SidecarRetryConfig{InitialBackoffMilliseconds: 1})
+
+	code, _, err := sidecar.do(context.Background(), http.MethodPost, "/create", []byte("[]"), "test")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestSidecarTransport_CircuitBreaker(t *testing.T) {
+	sidecar, calls := flakySidecar(t, 3, types.SidecarRetryConfig{MaxAttempts: 1, CircuitFailureThreshold: 3})
+	breaker := sidecar.ClientHTTP.Transport.(*SidecarTransport).breaker
+	now := time.Now()
+	breaker.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		code, _, err := sidecar.do(context.Background(), http.MethodGet, "/status", nil, "test")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+	}
+	assert.Equal(t, CircuitOpen, sidecar.circuitState())
+
+	_, _, err := sidecar.do(context.Background(), http.MethodGet, "/status", nil, "test")
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, int32(3), calls.Load(), "an open circuit must not reach the sidecar")
+
+	now = now.Add(defaultCircuitOpenDuration)
+	assert.Equal(t, CircuitHalfOpen, sidecar.circuitState())
+	code, _, err := sidecar.do(context.Background(), http.MethodGet, "/status", nil, "test")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, CircuitClosed, sidecar.circuitState())
+}
+
+func TestCircuitBreaker_SingleProbeWhenHalfOpen(t *testing.T) {
+	breaker := newCircuitBreaker("test", 1, time.Minute)
+	now := time.Now()
+	breaker.now = func() time.Time { return now }
+
+	require.NoError(t, breaker.allow())
+	breaker.record(false)
+	require.ErrorIs(t, breaker.allow(), ErrCircuitOpen)
+
+	now = now.Add(time.Minute)
+	require.NoError(t, breaker.allow())
+	require.ErrorIs(t, breaker.allow(), ErrCircuitOpen, "only one probe may run while half-open")
+
+	breaker.record(false)
+	assert.Equal(t, CircuitOpen, breaker.currentState())
+}
+
+func TestReqWithError_CircuitOpenReturns503(t *testing.T) {
+	sidecar, _ := flakySidecar(t, 1, types.SidecarRetryConfig{MaxAttempts: 1, CircuitFailureThreshold: 1})
+	_, _, err := sidecar.do(context.Background(), http.MethodGet, "/status", nil, "test")
+	require.NoError(t, err)
+
+	tp, cleanup := setupTestTracer()
+	defer cleanup()
+	_, span := tp.Tracer("test").Start(context.Background(), "test")
+	defer span.End()
+
+	req, err := http.NewRequest(http.MethodGet, sidecar.Endpoint+"/status", strings.NewReader("[]"))
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	_, err = ReqWithError(context.Background(), req, rec, time.Now().UnixMicro(), span, true, false, "test", sidecar.ClientHTTP)
+
+	require.True(t, errors.Is(err, ErrCircuitOpen))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Contains(t, rec.Body.String(), "sidecar flaky is unavailable")
+}
+
+func TestPing_ReportsOpenCircuit(t *testing.T) {
+	sidecar, _ := flakySidecar(t, 1, types.SidecarRetryConfig{MaxAttempts: 1, CircuitFailureThreshold: 1})
+	_, _, err := sidecar.do(context.Background(), http.MethodGet, "/status", nil, "test")
+	require.NoError(t, err)
+
+	h := &InterLinkHandler{Ctx: context.Background(), SidecarEndpoint: sidecar.Endpoint, ClientHTTP: sidecar.ClientHTTP}
+	rec := httptest.NewRecorder()
+	h.Ping(rec, httptest.NewRequest(http.MethodPost, "/pinglink", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, CircuitOpen, rec.Header().Get(CircuitStateHeader))
+	assert.Contains(t, rec.Body.String(), ErrCircuitOpen.Error(), "the body is the one of a failed plugin ping")
+}
+
+func TestPing_ReportsClosedCircuit(t *testing.T) {
+	sidecar, _ := flakySidecar(t, 0, types.SidecarRetryConfig{MaxAttempts: 1})
+
+	h := &InterLinkHandler{Ctx: context.Background(), SidecarEndpoint: sidecar.Endpoint, ClientHTTP: sidecar.ClientHTTP}
+	rec := httptest.NewRecorder()
+	h.Ping(rec, httptest.NewRequest(http.MethodPost, "/pinglink", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, CircuitClosed, rec.Header().Get(CircuitStateHeader))
+}
+
+func TestHeaderTimeoutTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		_, _ = w.Write([]byte("late"))
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: NewHeaderTimeoutTransport(http.DefaultTransport, 50*time.Millisecond)}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	_, err = client.Do(req)
+	require.ErrorIs(t, err, errResponseHeaderTimeout)
+
+	req, err = http.NewRequestWithContext(withoutHeaderTimeout(context.Background()), http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err, "streams are not limited")
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, "late", string(body))
+}
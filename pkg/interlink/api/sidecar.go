@@ -0,0 +1,206 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+)
+
+// PluginAnnotation lets a pod choose its sidecar plugin by name, overriding the routing rules.
+const PluginAnnotation = "interlink.eu/plugin"
+
+// defaultSidecarName names the sidecar built from the legacy SidecarURL/SidecarPort settings.
+const defaultSidecarName = "default"
+
+// Sidecar is a sidecar plugin reachable by interLink.
+type Sidecar struct {
+	// Name identifies the plugin in routing rules and pod annotations
+	Name string
+	// Endpoint is the base URL of the plugin
+	Endpoint string
+	// ClientHTTP is the HTTP client for communicating with the plugin
+	ClientHTTP *http.Client
+	// SecretKey is the public key the Secret data sent to the plugin is encrypted with (optional)
+	SecretKey *ecdh.PublicKey
+}
+
+// do sends a request to the sidecar outside of any client request, e.g. for background
+// refreshes or aggregated calls, and returns the status code and body of the response.
+func (sc *Sidecar) do(ctx context.Context, method, path string, body []byte, sessionContext string) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, sc.Endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	AddSessionContext(req, sessionContext)
+
+	if !isSafeURL(req.URL.String()) {
+		return 0, nil, fmt.Errorf("potential SSRF detected: %s", req.URL.String())
+	}
+	resp, err := sc.ClientHTTP.Do(req) // #nosec G704
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, err
+	}
+	return resp.StatusCode, respBody, nil
+}
+
+// MutexOwners records which sidecar plugin a pod was created on, so that status,
+// logs and delete calls reach the same plugin even if the routing rules change.
+type MutexOwners struct {
+	mu     sync.RWMutex
+	owners map[string]string
+}
+
+// PodOwners maps pod UIDs to the name of the sidecar owning them.
+var PodOwners MutexOwners
+
+func (o *MutexOwners) get(uid string) (string, bool) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	name, ok := o.owners[uid]
+	return name, ok
+}
+
+func (o *MutexOwners) set(uid, name string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.owners == nil {
+		o.owners = make(map[string]string)
+	}
+	o.owners[uid] = name
+}
+
+func (o *MutexOwners) forget(uid string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.owners, uid)
+}
+
+// ValidateRouting checks that sidecar names are unique and that the routing rules
+// and the default sidecar only reference configured sidecars.
+func ValidateRouting(config types.Config) error {
+	if len(config.Sidecars) == 0 {
+		if len(config.Routing) > 0 || config.DefaultSidecar != "" {
+			return errors.New("Routing and DefaultSidecar require the Sidecars list to be set")
+		}
+		return nil
+	}
+
+	names := make(map[string]bool, len(config.Sidecars))
+	for _, sc := range config.Sidecars {
+		if sc.Name == "" {
+			return fmt.Errorf("sidecar with URL %q has no Name", sc.URL)
+		}
+		if names[sc.Name] {
+			return fmt.Errorf("sidecar name %q is used more than once", sc.Name)
+		}
+		names[sc.Name] = true
+	}
+
+	if config.DefaultSidecar != "" && !names[config.DefaultSidecar] {
+		return fmt.Errorf("DefaultSidecar %q is not a configured sidecar", config.DefaultSidecar)
+	}
+	for i, rule := range config.Routing {
+		if !names[rule.Sidecar] {
+			return fmt.Errorf("routing rule %d references unknown sidecar %q", i, rule.Sidecar)
+		}
+	}
+	return nil
+}
+
+// sidecars returns the plugins served by this handler. Without a Sidecars list the
+// handler falls back to the single plugin set through SidecarEndpoint and ClientHTTP.
+func (h *InterLinkHandler) sidecars() []*Sidecar {
+	if len(h.Sidecars) > 0 {
+		return h.Sidecars
+	}
+	return []*Sidecar{{Name: defaultSidecarName, Endpoint: h.SidecarEndpoint, ClientHTTP: h.ClientHTTP, SecretKey: h.SecretKey}}
+}
+
+func (h *InterLinkHandler) sidecarByName(name string) *Sidecar {
+	for _, sc := range h.sidecars() {
+		if sc.Name == name {
+			return sc
+		}
+	}
+	return nil
+}
+
+func (h *InterLinkHandler) defaultSidecar() *Sidecar {
+	if h.Config.DefaultSidecar != "" {
+		if sc := h.sidecarByName(h.Config.DefaultSidecar); sc != nil {
+			return sc
+		}
+	}
+	return h.sidecars()[0]
+}
+
+// routePod returns the sidecar a pod belongs to. In order of precedence:
+// the plugin that already owns the pod, the interlink.eu/plugin annotation,
+// the first matching routing rule and finally the default sidecar.
+func (h *InterLinkHandler) routePod(pod *v1.Pod) (*Sidecar, error) {
+	if name, ok := PodOwners.get(string(pod.UID)); ok {
+		if sc := h.sidecarByName(name); sc != nil {
+			return sc, nil
+		}
+	}
+
+	if name, ok := pod.Annotations[PluginAnnotation]; ok && name != "" {
+		sc := h.sidecarByName(name)
+		if sc == nil {
+			return nil, fmt.Errorf("pod %s/%s requests unknown plugin %q", pod.Namespace, pod.Name, name)
+		}
+		return sc, nil
+	}
+
+	for _, rule := range h.Config.Routing {
+		if ruleMatches(rule, pod) {
+			if sc := h.sidecarByName(rule.Sidecar); sc != nil {
+				return sc, nil
+			}
+		}
+	}
+
+	return h.defaultSidecar(), nil
+}
+
+// routeUID returns the sidecar of a pod known only by UID and namespace, as in log requests.
+func (h *InterLinkHandler) routeUID(uid, namespace string) *Sidecar {
+	pod := &v1.Pod{}
+	pod.UID = k8stypes.UID(uid)
+	pod.Namespace = namespace
+	sc, err := h.routePod(pod)
+	if err != nil {
+		return h.defaultSidecar()
+	}
+	return sc
+}
+
+func ruleMatches(rule types.RoutingRule, pod *v1.Pod) bool {
+	if len(rule.Namespaces) > 0 && !slices.Contains(rule.Namespaces, pod.Namespace) {
+		return false
+	}
+	for key, value := range rule.Labels {
+		if podValue, ok := pod.Labels[key]; !ok || podValue != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,273 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+)
+
+func testRoutingHandler() *InterLinkHandler {
+	return &InterLinkHandler{
+		Ctx: context.Background(),
+		Config: types.Config{
+			Sidecars: []types.SidecarConfig{{Name: "slurm"}, {Name: "htcondor"}, {Name: "docker"}},
+			Routing: []types.RoutingRule{
+				{Sidecar: "htcondor", Namespaces: []string{"grid"}},
+				{Sidecar: "docker", Namespaces: []string{"dev"}, Labels: map[string]string{"runtime": "docker"}},
+			},
+			DefaultSidecar: "slurm",
+		},
+		Sidecars: []*Sidecar{{Name: "slurm"}, {Name: "htcondor"}, {Name: "docker"}},
+	}
+}
+
+func testPod(uid, namespace string, labels, annotations map[string]string) *v1.Pod {
+	return &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:        "pod-" + uid,
+		UID:         k8stypes.UID(uid),
+		Namespace:   namespace,
+		Labels:      labels,
+		Annotations: annotations,
+	}}
+}
+
+func TestRoutePod(t *testing.T) {
+	h := testRoutingHandler()
+
+	tests := []struct {
+		name    string
+		pod     *v1.Pod
+		want    string
+		wantErr bool
+	}{
+		{name: "default sidecar", pod: testPod("1", "default", nil, nil), want: "slurm"},
+		{name: "namespace rule", pod: testPod("2", "grid", nil, nil), want: "htcondor"},
+		{name: "namespace and label rule", pod: testPod("3", "dev", map[string]string{"runtime": "docker"}, nil), want: "docker"},
+		{name: "label missing", pod: testPod("4", "dev", nil, nil), want: "slurm"},
+		{name: "annotation wins over rules", pod: testPod("5", "grid", nil, map[string]string{PluginAnnotation: "docker"}), want: "docker"},
+		{name: "unknown plugin annotation", pod: testPod("6", "default", nil, map[string]string{PluginAnnotation: "kueue"}), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sidecar, err := h.routePod(tt.pod)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, sidecar.Name)
+		})
+	}
+}
+
+func TestRoutePod_OwnerWinsOverRules(t *testing.T) {
+	h := testRoutingHandler()
+	PodOwners.set("owned", "docker")
+	defer PodOwners.forget("owned")
+
+	sidecar, err := h.routePod(testPod("owned", "grid", nil, nil))
+	require.NoError(t, err)
+	assert.Equal(t, "docker", sidecar.Name)
+	assert.Equal(t, "docker", h.routeUID("owned", "grid").Name)
+}
+
+func TestRoutePod_LegacySingleSidecar(t *testing.T) {
+	h := &InterLinkHandler{SidecarEndpoint: "http://localhost:4000"}
+
+	sidecar, err := h.routePod(testPod("1", "grid", nil, nil))
+	require.NoError(t, err)
+	assert.Equal(t, defaultSidecarName, sidecar.Name)
+	assert.Equal(t, "http://localhost:4000", sidecar.Endpoint)
+}
+
+func TestValidateRouting(t *testing.T) {
+	sidecars := []types.SidecarConfig{{Name: "a", URL: "http://a"}, {Name: "b", URL: "http://b"}}
+
+	tests := []struct {
+		name    string
+		config  types.Config
+		wantErr bool
+	}{
+		{name: "legacy single sidecar", config: types.Config{}},
+		{name: "valid", config: types.Config{Sidecars: sidecars, Routing: []types.RoutingRule{{Sidecar: "b"}}, DefaultSidecar: "a"}},
+		{name: "rules without sidecars", config: types.Config{Routing: []types.RoutingRule{{Sidecar: "a"}}}, wantErr: true},
+		{name: "duplicate name", config: types.Config{Sidecars: append(sidecars, types.SidecarConfig{Name: "a"})}, wantErr: true},
+		{name: "missing name", config: types.Config{Sidecars: []types.SidecarConfig{{URL: "http://a"}}}, wantErr: true},
+		{name: "unknown rule target", config: types.Config{Sidecars: sidecars, Routing: []types.RoutingRule{{Sidecar: "c"}}}, wantErr: true},
+		{name: "unknown default", config: types.Config{Sidecars: sidecars, DefaultSidecar: "c"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRouting(tt.config)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// newStatusSidecar starts a sidecar answering /status for every pod it receives, using its name as JobID.
+func newStatusSidecar(t *testing.T, name string, received *[]string) *Sidecar {
+	t.Helper()
+	server, endpoint, client := newUnixTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var pods []*v1.Pod
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &pods)
+
+		statuses := []types.PodStatus{}
+		for _, pod := range pods {
+			*received = append(*received, string(pod.UID))
+			statuses = append(statuses, types.PodStatus{PodName: pod.Name, PodUID: string(pod.UID), PodNamespace: pod.Namespace, JobID: name})
+		}
+		_ = json.NewEncoder(w).Encode(statuses)
+	}))
+	t.Cleanup(server.Close)
+	return &Sidecar{Name: name, Endpoint: endpoint, ClientHTTP: client}
+}
+
+func TestStatusHandler_RoutesPodsToOwningSidecar(t *testing.T) {
+	PodStatuses.mu.Lock()
+	PodStatuses.Statuses = make(map[string]types.PodStatus)
+	PodStatuses.mu.Unlock()
+
+	var slurmPods, condorPods []string
+	h := testRoutingHandler()
+	h.Sidecars = []*Sidecar{newStatusSidecar(t, "slurm", &slurmPods), newStatusSidecar(t, "htcondor", &condorPods)}
+	h.Config.Routing = h.Config.Routing[:1]
+	h.Config.Sidecars = h.Config.Sidecars[:2]
+
+	pods := []*v1.Pod{testPod("a", "default", nil, nil), testPod("b", "grid", nil, nil), testPod("c", "default", nil, nil)}
+	body, err := json.Marshal(pods)
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	h.StatusHandler(rec, httptest.NewRequest(http.MethodGet, "/status", strings.NewReader(string(body))))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	assert.ElementsMatch(t, []string{"a", "c"}, slurmPods)
+	assert.ElementsMatch(t, []string{"b"}, condorPods)
+
+	var statuses []types.PodStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &statuses))
+	require.Len(t, statuses, 3)
+	for _, status := range statuses {
+		owner, ok := PodOwners.get(status.PodUID)
+		assert.True(t, ok)
+		assert.Equal(t, owner, status.JobID)
+		PodOwners.forget(status.PodUID)
+	}
+}
+
+func TestStatusHandler_FailingSidecarKeepsCachedStatuses(t *testing.T) {
+	PodStatuses.mu.Lock()
+	PodStatuses.Statuses = map[string]types.PodStatus{"b": {PodName: "b", PodUID: "b", PodNamespace: "grid", JobID: "cached"}}
+	PodStatuses.mu.Unlock()
+
+	var slurmPods []string
+	failing, endpoint, client := newUnixTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "circuit breaker open", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	h := testRoutingHandler()
+	h.Sidecars = []*Sidecar{newStatusSidecar(t, "slurm", &slurmPods), {Name: "htcondor", Endpoint: endpoint, ClientHTTP: client}}
+	h.Config.Routing = h.Config.Routing[:1]
+	h.Config.Sidecars = h.Config.Sidecars[:2]
+
+	pods := []*v1.Pod{testPod("a", "default", nil, nil), testPod("b", "grid", nil, nil)}
+	body, err := json.Marshal(pods)
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	h.StatusHandler(rec, httptest.NewRequest(http.MethodGet, "/status", strings.NewReader(string(body))))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var statuses []types.PodStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &statuses))
+	jobIDs := make(map[string]string)
+	for _, status := range statuses {
+		jobIDs[status.PodUID] = status.JobID
+	}
+	assert.Equal(t, map[string]string{"a": "slurm", "b": "cached"}, jobIDs)
+	PodOwners.forget("a")
+}
+
+func TestPing_AggregatesSidecars(t *testing.T) {
+	healthyServer, healthyEndpoint, healthyClient := newUnixTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"status":"ok","resources":{"cpu":"4","memory":"8Gi","cpuUsage":"1500m","memoryUsage":"2Gi","accelerators":[{"resourceType":"nvidia.com/gpu","available":"2"}]}}`))
+	}))
+	defer healthyServer.Close()
+	otherServer, otherEndpoint, otherClient := newUnixTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"status":"ok","resources":{"cpu":"500m","memory":"8Gi","cpuUsage":"250m","accelerators":[{"resourceType":"nvidia.com/gpu","available":"1"}]}}`))
+	}))
+	defer otherServer.Close()
+	brokenServer, brokenEndpoint, brokenClient := newUnixTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "queue down", http.StatusInternalServerError)
+	}))
+	defer brokenServer.Close()
+
+	h := &InterLinkHandler{
+		Ctx: context.Background(),
+		Sidecars: []*Sidecar{
+			{Name: "a", Endpoint: healthyEndpoint, ClientHTTP: healthyClient},
+			{Name: "b", Endpoint: otherEndpoint, ClientHTTP: otherClient},
+			{Name: "c", Endpoint: brokenEndpoint, ClientHTTP: brokenClient},
+		},
+	}
+
+	rec := httptest.NewRecorder()
+	h.Ping(rec, httptest.NewRequest(http.MethodPost, "/pinglink", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp types.PingResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, "degraded", resp.Status)
+	require.Len(t, resp.Plugins, 3)
+	assert.Equal(t, "ok", resp.Plugins[0].Status)
+	assert.Equal(t, "unavailable", resp.Plugins[2].Status)
+	assert.Equal(t, http.StatusInternalServerError, resp.Plugins[2].HTTPCode)
+	assert.Contains(t, resp.Plugins[2].Error, "queue down")
+
+	require.NotNil(t, resp.Resources)
+	assert.Equal(t, "4500m", resp.Resources.CPU)
+	assert.Equal(t, "16Gi", resp.Resources.Memory)
+	assert.Equal(t, "1750m", resp.Resources.CPUUsage)
+	assert.Equal(t, "2Gi", resp.Resources.MemoryUsage)
+	require.Len(t, resp.Resources.Accelerators, 1)
+	assert.Equal(t, "3", resp.Resources.Accelerators[0].Available)
+	assert.Nil(t, resp.Taints)
+}
+
+func TestPing_AllSidecarsDown(t *testing.T) {
+	brokenServer, brokenEndpoint, brokenClient := newUnixTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer brokenServer.Close()
+
+	h := &InterLinkHandler{
+		Ctx: context.Background(),
+		Sidecars: []*Sidecar{
+			{Name: "a", Endpoint: brokenEndpoint, ClientHTTP: brokenClient},
+			{Name: "b", Endpoint: brokenEndpoint, ClientHTTP: brokenClient},
+		},
+	}
+
+	rec := httptest.NewRecorder()
+	h.Ping(rec, httptest.NewRequest(http.MethodPost, "/pinglink", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
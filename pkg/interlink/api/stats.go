@@ -0,0 +1,122 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/log"
+	v1 "k8s.io/api/core/v1"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	trace "go.opentelemetry.io/otel/trace"
+)
+
+// StatsHandler handles HTTP GET requests to retrieve the resource usage of pods, for the stats
+// summary of the Virtual Kubelet. Each sidecar plugin is sent the pods it owns on its /stats
+// endpoint, and the usage they report is merged. The plugins without /stats, or failing to
+// answer, report no usage: their pods are left out of the response rather than failing it.
+//
+// Request body: JSON-encoded array of v1.Pod objects
+// Response: JSON-encoded array of PodStats objects, for the pods some plugin reported on
+//
+// HTTP Status Codes:
+//   - 200: Stats query completed, possibly without any usage
+//   - 400: The request body is not an array of pods
+func (h *InterLinkHandler) StatsHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now().UnixMicro()
+	tracer := otel.Tracer("interlink-API")
+	_, span := tracer.Start(h.Ctx, "StatsAPI", trace.WithAttributes(
+		attribute.Int64("start.timestamp", start),
+	))
+	defer span.End()
+	defer types.SetDurationSpan(start, span)
+	defer types.SetInfoFromHeaders(span, &r.Header)
+
+	sessionContext := GetSessionContext(r)
+	sessionContextMessage := GetSessionContextMessage(sessionContext)
+	log.G(h.Ctx).Debug(sessionContextMessage, "InterLink: received GetStats call")
+
+	bodyBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "unable to read the request body", http.StatusBadRequest)
+		return
+	}
+	var pods []*v1.Pod
+	if err := json.Unmarshal(bodyBytes, &pods); err != nil {
+		http.Error(w, "invalid pod list: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	span.SetAttributes(attribute.Int("pods.count", len(pods)))
+
+	podStats := []types.PodStats{}
+	for _, group := range h.groupBySidecar(pods) {
+		reported, err := h.statsFromPlugin(r, group, sessionContext)
+		if err != nil {
+			log.G(h.Ctx).Warning(sessionContextMessage, "Unable to get the stats of plugin ", group.sidecar.Name, ": ", err)
+			continue
+		}
+		podStats = append(podStats, reported...)
+	}
+	span.SetAttributes(attribute.Int("stats.count", len(podStats)))
+
+	returnValue, err := json.Marshal(podStats)
+	if err != nil {
+		log.G(h.Ctx).Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	types.SetDurationSpan(start, span, types.WithHTTPReturnCode(http.StatusOK))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err = w.Write(returnValue); err != nil {
+		log.G(h.Ctx).Error(errors.New("failed to write to http buffer"))
+	}
+}
+
+// statsFromPlugin asks a sidecar for the usage of its pods. The stats of the pods the sidecar
+// was not asked about are dropped, and the ones without measurement time get the current time.
+func (h *InterLinkHandler) statsFromPlugin(r *http.Request, group sidecarPods, sessionContext string) ([]types.PodStats, error) {
+	body, err := json.Marshal(group.pods)
+	if err != nil {
+		return nil, err
+	}
+	code, respBody, err := group.sidecar.do(r.Context(), http.MethodGet, "/stats", body, sessionContext)
+	switch {
+	case err != nil:
+		return nil, err
+	case code == http.StatusNotFound || code == http.StatusMethodNotAllowed || code == http.StatusNotImplemented:
+		log.G(h.Ctx).Debug("Plugin ", group.sidecar.Name, " has no /stats endpoint")
+		return nil, nil
+	case code != http.StatusOK:
+		return nil, fmt.Errorf("HTTP %d: %s", code, strings.TrimSpace(string(respBody)))
+	}
+
+	var reported []types.PodStats
+	if err := json.Unmarshal(respBody, &reported); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	asked := make(map[string]bool, len(group.pods))
+	for _, pod := range group.pods {
+		asked[string(pod.UID)] = true
+	}
+	now := time.Now()
+	podStats := make([]types.PodStats, 0, len(reported))
+	for _, stats := range reported {
+		if !asked[stats.PodUID] {
+			continue
+		}
+		if stats.Time.IsZero() {
+			stats.Time = now
+		}
+		podStats = append(podStats, stats)
+	}
+	return podStats, nil
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+)
+
+func TestStatsHandler(t *testing.T) {
+	usage := uint64(250000000)
+	slurm, endpoint, client := newUnixTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var pods []*v1.Pod
+		body, _ := io.ReadAll(r.Body)
+		assert.NoError(t, json.Unmarshal(body, &pods))
+		podStats := []types.PodStats{{PodUID: "not-asked"}}
+		for _, pod := range pods {
+			podStats = append(podStats, types.PodStats{
+				PodName: pod.Name, PodUID: string(pod.UID), PodNamespace: pod.Namespace,
+				Containers: []types.ContainerStats{{Name: "main", CPU: &types.CPUStats{UsageNanoCores: &usage}}},
+			})
+		}
+		_ = json.NewEncoder(w).Encode(podStats)
+	}))
+	defer slurm.Close()
+	condor, condorEndpoint, condorClient := newUnixTestServer(t, http.NotFoundHandler())
+	defer condor.Close()
+
+	h := testRoutingHandler()
+	h.Sidecars = []*Sidecar{
+		{Name: "slurm", Endpoint: endpoint, ClientHTTP: client},
+		{Name: "htcondor", Endpoint: condorEndpoint, ClientHTTP: condorClient},
+	}
+	h.Config.Routing = h.Config.Routing[:1]
+	h.Config.Sidecars = h.Config.Sidecars[:2]
+
+	pods := []*v1.Pod{testPod("a", "default", nil, nil), testPod("b", "grid", nil, nil)}
+	body, err := json.Marshal(pods)
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	h.StatsHandler(rec, httptest.NewRequest(http.MethodGet, "/stats", strings.NewReader(string(body))))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// the htcondor pod is left out, and so are the stats of the pods slurm was not asked about
+	var podStats []types.PodStats
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &podStats))
+	require.Len(t, podStats, 1)
+	assert.Equal(t, "a", podStats[0].PodUID)
+	assert.False(t, podStats[0].Time.IsZero())
+	assert.Equal(t, usage, *podStats[0].Containers[0].CPU.UsageNanoCores)
+}
+
+func TestStatsHandler_InvalidBody(t *testing.T) {
+	h := testRoutingHandler()
+	rec := httptest.NewRecorder()
+	h.StatsHandler(rec, httptest.NewRequest(http.MethodGet, "/stats", strings.NewReader("{")))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h.StatsHandler(rec, httptest.NewRequest(http.MethodGet, "/stats", strings.NewReader("[]")))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, "[]", rec.Body.String())
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,6 +14,7 @@ import (
 	v1 "k8s.io/api/core/v1"
 
 	types "github.com/interlink-hq/interlink/pkg/interlink"
+	"github.com/interlink-hq/interlink/pkg/interlink/audit"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -20,8 +22,8 @@ import (
 )
 
 // StatusHandler handles HTTP GET requests to retrieve pod status information.
-// This endpoint queries the sidecar plugin for the current status of one or more pods
-// and implements intelligent caching to reduce unnecessary requests to the remote system.
+// This endpoint queries the sidecar plugins for the current status of one or more pods,
+// sending each plugin only the pods it owns, and implements intelligent caching to reduce unnecessary requests to the remote system.
 //
 // The handler maintains a local cache of pod statuses and only queries the sidecar for:
 //   - Pods currently in Running or Pending state
@@ -30,9 +32,12 @@ import (
 // Request body: JSON-encoded array of v1.Pod objects
 // Response: JSON-encoded array of PodStatus objects
 //
+// A plugin that cannot be reached, or answers with an error, only leaves its own pods with
+// their cached status: the pods of the other plugins are still refreshed.
+//
 // HTTP Status Codes:
 //   - 200: Status query completed successfully
-//   - 500: Internal server error (sidecar communication failures, JSON marshalling errors)
+//   - 500: Internal server error (JSON marshalling errors)
 func (h *InterLinkHandler) StatusHandler(w http.ResponseWriter, r *http.Request) {
 	start := time.Now().UnixMicro()
 	tracer := otel.Tracer("interlink-API")
@@ -61,9 +66,13 @@ func (h *InterLinkHandler) StatusHandler(w http.ResponseWriter, r *http.Request)
 		attribute.Int("pods.count", len(pods)),
 	)
 
+	KnownPods.remember(pods...)
+	for _, pod := range pods {
+		audit.AddPod(r.Context(), audit.Pod{Namespace: pod.Namespace, Name: pod.Name, UID: string(pod.UID), JobID: pod.Annotations["JobID"]})
+	}
+
 	var podsToBeChecked []*v1.Pod
-	var returnedStatuses []types.PodStatus // returned from the query to the sidecar
-	var returnPods []types.PodStatus       // returned to the vk
+	var returnPods []types.PodStatus // returned to the vk
 
 	PodStatuses.mu.Lock()
 	for _, pod := range pods {
@@ -80,41 +89,25 @@ func (h *InterLinkHandler) StatusHandler(w http.ResponseWriter, r *http.Request)
 	}
 	PodStatuses.mu.Unlock()
 
-	if len(podsToBeChecked) > 0 {
-
-		bodyBytes, err = json.Marshal(podsToBeChecked)
-		if err != nil {
-			log.G(h.Ctx).Fatal(err)
-		}
-
-		reader := bytes.NewReader(bodyBytes)
-		req, err := http.NewRequest(http.MethodGet, h.SidecarEndpoint+"/status", reader)
-		if err != nil {
-			log.G(h.Ctx).Fatal(err)
-		}
-
-		log.G(h.Ctx).Info("InterLink: forwarding GetStatus call to sidecar")
-		req.Header.Set("Content-Type", "application/json")
-
-		sessionContext := GetSessionContext(r)
-		bodyBytes, err = ReqWithError(h.Ctx, req, w, start, span, false, true, sessionContext, h.ClientHTTP)
+	sessionContext := GetSessionContext(r)
+	for _, group := range h.groupBySidecar(podsToBeChecked) {
+		// a failing plugin only leaves its own pods with their cached status
+		returnedStatuses, err := h.sidecarStatuses(r.Context(), group, sessionContext)
 		if err != nil {
-			log.L.Error(err)
-			return
+			log.G(h.Ctx).Error(GetSessionContextMessage(sessionContext), "unable to get the status of ", len(group.pods),
+				" pods from sidecar ", group.sidecar.Name, ", answering with the cached ones: ", err)
+			span.AddEvent("Status of sidecar "+group.sidecar.Name+" failed", trace.WithAttributes(
+				attribute.String("sidecar.name", group.sidecar.Name),
+				attribute.String("error", err.Error()),
+			))
+			continue
 		}
 
-		err = json.Unmarshal(bodyBytes, &returnedStatuses)
-		if err != nil {
-			statusCode = http.StatusInternalServerError
-			w.WriteHeader(statusCode)
-			errWithContext := fmt.Errorf("error doing Unmarshal() in StatusHandler() of req %s error detail: %s error: %w", fmt.Sprintf("%#v", req), fmt.Sprintf("%#v", err), err)
-			log.G(h.Ctx).Error(errWithContext)
-			return
+		for _, pod := range group.pods {
+			PodOwners.set(string(pod.UID), group.sidecar.Name)
 		}
-
 		updateStatuses(returnedStatuses)
 		types.SetDurationSpan(start, span, types.WithHTTPReturnCode(statusCode))
-
 	}
 
 	if len(pods) > 0 {
@@ -150,3 +143,58 @@ func (h *InterLinkHandler) StatusHandler(w http.ResponseWriter, r *http.Request)
 		log.G(h.Ctx).Error(errors.New("failed to write to http buffer"))
 	}
 }
+
+// sidecarStatuses asks the sidecar of a group for the status of its pods.
+func (h *InterLinkHandler) sidecarStatuses(ctx context.Context, group sidecarPods, sessionContext string) ([]types.PodStatus, error) {
+	bodyBytes, err := json.Marshal(group.pods)
+	if err != nil {
+		return nil, err
+	}
+
+	log.G(h.Ctx).Info("InterLink: forwarding GetStatus call to sidecar ", group.sidecar.Name)
+	code, respBody, err := group.sidecar.do(ctx, http.MethodGet, "/status", bodyBytes, sessionContext)
+	if err != nil {
+		return nil, err
+	}
+	if code != http.StatusOK {
+		return nil, fmt.Errorf("sidecar %s returned HTTP %d: %s", group.sidecar.Name, code, bytes.TrimSpace(respBody))
+	}
+
+	var statuses []types.PodStatus
+	if err := json.Unmarshal(respBody, &statuses); err != nil {
+		return nil, fmt.Errorf("error doing Unmarshal() of the status returned by sidecar %s: %w", group.sidecar.Name, err)
+	}
+	return statuses, nil
+}
+
+// sidecarPods is the subset of a status request routed to a single sidecar.
+type sidecarPods struct {
+	sidecar *Sidecar
+	pods    []*v1.Pod
+}
+
+// groupBySidecar splits pods by owning sidecar, preserving the order in which sidecars first appear.
+// Pods requesting an unknown plugin are dropped, since no sidecar can report on them, and so are
+// the pods held in the admission queue, which the sidecars do not know yet.
+func (h *InterLinkHandler) groupBySidecar(pods []*v1.Pod) []sidecarPods {
+	var groups []sidecarPods
+	index := make(map[string]int)
+	for _, pod := range pods {
+		if Admission.holds(string(pod.UID)) {
+			continue
+		}
+		sidecar, err := h.routePod(pod)
+		if err != nil {
+			log.G(h.Ctx).Error(err)
+			continue
+		}
+		i, ok := index[sidecar.Name]
+		if !ok {
+			i = len(groups)
+			index[sidecar.Name] = i
+			groups = append(groups, sidecarPods{sidecar: sidecar})
+		}
+		groups[i].pods = append(groups[i].pods, pod)
+	}
+	return groups
+}
@@ -0,0 +1,334 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/containerd/containerd/log"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+)
+
+const (
+	// StatusStoreMemory keeps the status cache in memory only (default)
+	StatusStoreMemory = "memory"
+	// StatusStoreFile keeps the status cache in a write-ahead log on disk
+	StatusStoreFile = "file"
+
+	defaultCompactionThreshold = 10000
+	statusStoreLogName         = "statuses.log"
+	statusStoreSnapshotName    = "statuses.snapshot"
+)
+
+// StoredStatus is a pod status held by a StatusStore, along with the sidecar owning the pod.
+type StoredStatus struct {
+	types.PodStatus
+	// Sidecar is the name of the sidecar the pod was created on, empty when not known yet
+	Sidecar string `json:"sidecar,omitempty"`
+}
+
+// StatusStore is the backing store of the PodStatuses cache.
+// The cache map is always the source of truth for reads; the store only
+// has to make writes durable and give them back at startup.
+type StatusStore interface {
+	// Load returns every status held by the store, keyed by pod UID
+	Load() (map[string]StoredStatus, error)
+	// Put records the given statuses, replacing any previous entry for the same pod UID
+	Put(statuses []StoredStatus) error
+	// Delete removes the status of the given pod UID
+	Delete(uid string) error
+	// Close flushes and releases the store
+	Close() error
+}
+
+// NewStatusStore returns the StatusStore selected by the StatusStore section of the config.
+func NewStatusStore(config types.Config) (StatusStore, error) {
+	switch config.StatusStore.Backend {
+	case "", StatusStoreMemory:
+		return memoryStatusStore{}, nil
+	case StatusStoreFile:
+		path := config.StatusStore.Path
+		if path == "" {
+			if config.DataRootFolder == "" {
+				return nil, errors.New("file status store requires either StatusStore.Path or DataRootFolder to be set")
+			}
+			path = filepath.Join(config.DataRootFolder, "status-store")
+		}
+		return openFileStatusStore(path, config.StatusStore.CompactionThreshold)
+	default:
+		return nil, fmt.Errorf("unknown status store backend %q, expected %q or %q", config.StatusStore.Backend, StatusStoreMemory, StatusStoreFile)
+	}
+}
+
+// memoryStatusStore is the default backend: the PodStatuses map alone holds the cache.
+type memoryStatusStore struct{}
+
+func (memoryStatusStore) Load() (map[string]StoredStatus, error) {
+	return map[string]StoredStatus{}, nil
+}
+
+func (memoryStatusStore) Put([]StoredStatus) error { return nil }
+
+func (memoryStatusStore) Delete(string) error { return nil }
+
+func (memoryStatusStore) Close() error { return nil }
+
+// walRecord is a single line of the write-ahead log.
+type walRecord struct {
+	Op     string        `json:"op"`
+	UID    string        `json:"uid"`
+	Status *StoredStatus `json:"status,omitempty"`
+}
+
+const (
+	walOpPut    = "put"
+	walOpDelete = "delete"
+)
+
+// fileStatusStore appends every change to a JSON-lines log and fsyncs it before returning.
+// Once the log holds more than threshold records it is folded into a snapshot file,
+// written next to it and swapped in with an atomic rename. At startup the snapshot is
+// read first and the log is replayed on top of it, so a crash at any point leaves a
+// consistent state. A torn last line (crash in the middle of an append) is discarded; any
+// other unreadable record fails the opening of the store.
+type fileStatusStore struct {
+	mu        sync.Mutex
+	dir       string
+	log       *os.File
+	records   int
+	threshold int
+	state     map[string]StoredStatus
+}
+
+func openFileStatusStore(dir string, threshold int) (*fileStatusStore, error) {
+	if threshold <= 0 {
+		threshold = defaultCompactionThreshold
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("unable to create status store directory %s: %w", dir, err)
+	}
+
+	s := &fileStatusStore{
+		dir:       dir,
+		threshold: threshold,
+		state:     make(map[string]StoredStatus),
+	}
+
+	if err := s.readSnapshot(); err != nil {
+		return nil, err
+	}
+
+	logFile, err := os.OpenFile(filepath.Join(dir, statusStoreLogName), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open status store log: %w", err)
+	}
+	s.log = logFile
+
+	if err := s.replay(); err != nil {
+		logFile.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *fileStatusStore) readSnapshot() error {
+	data, err := os.ReadFile(filepath.Join(s.dir, statusStoreSnapshotName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read status store snapshot: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.state); err != nil {
+		return fmt.Errorf("corrupted status store snapshot: %w", err)
+	}
+	return nil
+}
+
+// replay applies the log on top of the snapshot and truncates any torn trailing record.
+// Only the unterminated last line can come from an interrupted append: a record that does
+// not parse anywhere else means the log is corrupted, and replaying the records after it
+// would give a wrong state.
+func (s *fileStatusStore) replay() error {
+	if _, err := s.log.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(s.log)
+	var good int64
+	for line := 1; ; line++ {
+		record, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// an unterminated line is a partial append: drop it
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read status store log: %w", err)
+		}
+
+		var rec walRecord
+		if jsonErr := json.Unmarshal(bytes.TrimSpace(record), &rec); jsonErr != nil {
+			return fmt.Errorf("corrupted status store log at line %d: %w", line, jsonErr)
+		}
+		s.apply(rec)
+		s.records++
+		good += int64(len(record))
+	}
+
+	if err := s.log.Truncate(good); err != nil {
+		return fmt.Errorf("unable to truncate status store log: %w", err)
+	}
+	_, err := s.log.Seek(good, io.SeekStart)
+	return err
+}
+
+func (s *fileStatusStore) apply(rec walRecord) {
+	switch rec.Op {
+	case walOpPut:
+		if rec.Status != nil {
+			s.state[rec.UID] = *rec.Status
+		}
+	case walOpDelete:
+		delete(s.state, rec.UID)
+	}
+}
+
+func (s *fileStatusStore) Load() (map[string]StoredStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make(map[string]StoredStatus, len(s.state))
+	for uid, status := range s.state {
+		statuses[uid] = status
+	}
+	return statuses, nil
+}
+
+func (s *fileStatusStore) Put(statuses []StoredStatus) error {
+	if len(statuses) == 0 {
+		return nil
+	}
+	records := make([]walRecord, 0, len(statuses))
+	for i := range statuses {
+		records = append(records, walRecord{Op: walOpPut, UID: statuses[i].PodUID, Status: &statuses[i]})
+	}
+	return s.append(records)
+}
+
+func (s *fileStatusStore) Delete(uid string) error {
+	return s.append([]walRecord{{Op: walOpDelete, UID: uid}})
+}
+
+// append writes the records to the log and fsyncs it. The sync runs under mu, and its caller
+// updateStatuses holds PodStatuses.mu, so cache updates wait for the disk: the statuses are
+// durable once they are served, and the writes of a status poll are batched in a single sync.
+func (s *fileStatusStore) append(records []walRecord) error {
+	var buf bytes.Buffer
+	for _, rec := range records {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.log == nil {
+		return errors.New("status store is closed")
+	}
+	if _, err := s.log.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("unable to append to status store log: %w", err)
+	}
+	if err := s.log.Sync(); err != nil {
+		return fmt.Errorf("unable to sync status store log: %w", err)
+	}
+	for _, rec := range records {
+		s.apply(rec)
+	}
+	s.records += len(records)
+
+	// the records are durable: a failed compaction is only retried at the next append
+	if s.records >= s.threshold {
+		if err := s.compact(); err != nil {
+			log.L.Error("unable to compact the status store: ", err)
+		}
+	}
+	return nil
+}
+
+// compact writes the current state to a new snapshot and empties the log. Called with mu held.
+func (s *fileStatusStore) compact() error {
+	data, err := json.Marshal(s.state)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := filepath.Join(s.dir, statusStoreSnapshotName+".tmp")
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("unable to create status store snapshot: %w", err)
+	}
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write status store snapshot: %w", err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(s.dir, statusStoreSnapshotName)); err != nil {
+		return fmt.Errorf("unable to install status store snapshot: %w", err)
+	}
+	if dir, err := os.Open(s.dir); err == nil {
+		_ = dir.Sync()
+		dir.Close()
+	}
+
+	// The snapshot now covers every record in the log, so it can be emptied.
+	if err := s.log.Truncate(0); err != nil {
+		return fmt.Errorf("unable to truncate status store log: %w", err)
+	}
+	if _, err := s.log.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	s.records = 0
+	return nil
+}
+
+func (s *fileStatusStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.log == nil {
+		return nil
+	}
+	err := s.log.Close()
+	s.log = nil
+	return err
+}
+
+// ready fails when the log has been closed or its file is no longer usable.
+func (s *fileStatusStore) ready() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.log == nil {
+		return errors.New("status store is closed")
+	}
+	if _, err := s.log.Stat(); err != nil {
+		return fmt.Errorf("status store log is not usable: %w", err)
+	}
+	return nil
+}
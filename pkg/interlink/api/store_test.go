@@ -0,0 +1,255 @@
+package api
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+)
+
+func testPodStatus(uid, jobID string) types.PodStatus {
+	return types.PodStatus{
+		PodName:      "pod-" + uid,
+		PodUID:       uid,
+		PodNamespace: "default",
+		JobID:        jobID,
+		Containers: []v1.ContainerStatus{
+			{Name: "main", State: v1.ContainerState{Running: &v1.ContainerStateRunning{}}},
+		},
+	}
+}
+
+func testStoredStatus(uid, jobID string) StoredStatus {
+	return StoredStatus{PodStatus: testPodStatus(uid, jobID)}
+}
+
+func TestNewStatusStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  types.Config
+		wantErr bool
+	}{
+		{name: "default is memory", config: types.Config{}},
+		{name: "explicit memory", config: types.Config{StatusStore: types.StatusStoreConfig{Backend: "memory"}}},
+		{name: "file under data root", config: types.Config{DataRootFolder: t.TempDir(), StatusStore: types.StatusStoreConfig{Backend: "file"}}},
+		{name: "file without any path", config: types.Config{StatusStore: types.StatusStoreConfig{Backend: "file"}}, wantErr: true},
+		{name: "unknown backend", config: types.Config{StatusStore: types.StatusStoreConfig{Backend: "etcd"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := NewStatusStore(tt.config)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.NoError(t, store.Close())
+		})
+	}
+}
+
+func TestFileStatusStore_SurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := openFileStatusStore(dir, 0)
+	require.NoError(t, err)
+	require.NoError(t, store.Put([]StoredStatus{testStoredStatus("a", "1"), testStoredStatus("b", "2")}))
+	require.NoError(t, store.Put([]StoredStatus{testStoredStatus("a", "3")}))
+	require.NoError(t, store.Delete("b"))
+	require.NoError(t, store.Close())
+
+	reopened, err := openFileStatusStore(dir, 0)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	statuses, err := reopened.Load()
+	require.NoError(t, err)
+	require.Len(t, statuses, 1)
+	assert.Equal(t, "3", statuses["a"].JobID)
+	assert.NotNil(t, statuses["a"].Containers[0].State.Running)
+}
+
+func TestFileStatusStore_DiscardsTornRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := openFileStatusStore(dir, 0)
+	require.NoError(t, err)
+	require.NoError(t, store.Put([]StoredStatus{testStoredStatus("a", "1")}))
+	require.NoError(t, store.Close())
+
+	// Simulate a crash in the middle of an append.
+	f, err := os.OpenFile(filepath.Join(dir, statusStoreLogName), os.O_APPEND|os.O_WRONLY, 0o600)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"op":"put","uid":"b","status":{"na`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	reopened, err := openFileStatusStore(dir, 0)
+	require.NoError(t, err)
+	statuses, err := reopened.Load()
+	require.NoError(t, err)
+	assert.Len(t, statuses, 1)
+	assert.Contains(t, statuses, "a")
+
+	// New appends must land on a clean line.
+	require.NoError(t, reopened.Put([]StoredStatus{testStoredStatus("c", "2")}))
+	require.NoError(t, reopened.Close())
+
+	again, err := openFileStatusStore(dir, 0)
+	require.NoError(t, err)
+	defer again.Close()
+	statuses, err = again.Load()
+	require.NoError(t, err)
+	assert.Len(t, statuses, 2)
+	assert.Contains(t, statuses, "c")
+}
+
+func TestFileStatusStore_RejectsCorruptedRecord(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, statusStoreLogName)
+	corrupted := `{"op":"put","uid":"a","status":{"UID":"a"}}` + "\n" +
+		`{"op":"put","uid":"b","sta` + "\n" +
+		`{"op":"put","uid":"c","status":{"UID":"c"}}` + "\n"
+	require.NoError(t, os.WriteFile(logPath, []byte(corrupted), 0o600))
+
+	_, err := openFileStatusStore(dir, 0)
+	assert.ErrorContains(t, err, "corrupted status store log at line 2")
+
+	// the records after the corruption are kept
+	data, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	assert.Equal(t, corrupted, string(data))
+}
+
+func TestFileStatusStore_Compaction(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := openFileStatusStore(dir, 3)
+	require.NoError(t, err)
+	require.NoError(t, store.Put([]StoredStatus{testStoredStatus("a", "1"), testStoredStatus("b", "1")}))
+	require.NoError(t, store.Delete("a"))
+	require.NoError(t, store.Put([]StoredStatus{testStoredStatus("c", "1")}))
+	require.NoError(t, store.Close())
+
+	_, err = os.Stat(filepath.Join(dir, statusStoreSnapshotName))
+	require.NoError(t, err, "snapshot should have been written")
+
+	reopened, err := openFileStatusStore(dir, 3)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	statuses, err := reopened.Load()
+	require.NoError(t, err)
+	assert.Len(t, statuses, 2)
+	assert.Contains(t, statuses, "b")
+	assert.Contains(t, statuses, "c")
+}
+
+func TestFileStatusStore_FailedCompactionKeepsRecords(t *testing.T) {
+	dir := t.TempDir()
+	// a directory in place of the temporary snapshot makes the compaction fail
+	require.NoError(t, os.Mkdir(filepath.Join(dir, statusStoreSnapshotName+".tmp"), 0o700))
+
+	store, err := openFileStatusStore(dir, 1)
+	require.NoError(t, err)
+	require.NoError(t, store.Put([]StoredStatus{testStoredStatus("a", "1")}), "the records were written")
+	require.NoError(t, store.Close())
+
+	reopened, err := openFileStatusStore(dir, 1)
+	require.NoError(t, err)
+	defer reopened.Close()
+	statuses, err := reopened.Load()
+	require.NoError(t, err)
+	assert.Contains(t, statuses, "a")
+}
+
+func TestInitPodStatuses_PersistsCacheUpdates(t *testing.T) {
+	config := types.Config{
+		DataRootFolder: t.TempDir(),
+		StatusStore:    types.StatusStoreConfig{Backend: StatusStoreFile},
+	}
+
+	require.NoError(t, InitPodStatuses(context.Background(), config))
+	updateStatuses([]types.PodStatus{testPodStatus("a", "1"), testPodStatus("b", "2")})
+	deleteCachedStatus("a")
+	require.NoError(t, ClosePodStatuses())
+
+	PodStatuses.Statuses = nil
+	require.NoError(t, InitPodStatuses(context.Background(), config))
+	defer func() {
+		require.NoError(t, ClosePodStatuses())
+		PodStatuses.Statuses = make(map[string]types.PodStatus)
+	}()
+
+	assert.Len(t, PodStatuses.Statuses, 1)
+	assert.Equal(t, "2", PodStatuses.Statuses["b"].JobID)
+}
+
+func TestInitPodStatuses_RestoresOwners(t *testing.T) {
+	config := types.Config{
+		DataRootFolder: t.TempDir(),
+		StatusStore:    types.StatusStoreConfig{Backend: StatusStoreFile},
+	}
+
+	require.NoError(t, InitPodStatuses(context.Background(), config))
+	PodOwners.set("a", "slurm")
+	updateStatuses([]types.PodStatus{testPodStatus("a", "1"), testPodStatus("b", "2")})
+	require.NoError(t, ClosePodStatuses())
+
+	// a restart forgets the owners, and the routing rules may have changed since
+	PodOwners = MutexOwners{}
+	PodStatuses.Statuses = nil
+	require.NoError(t, InitPodStatuses(context.Background(), config))
+	defer func() {
+		require.NoError(t, ClosePodStatuses())
+		PodStatuses.Statuses = make(map[string]types.PodStatus)
+		PodOwners = MutexOwners{}
+	}()
+
+	owner, ok := PodOwners.get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "slurm", owner)
+	_, ok = PodOwners.get("b")
+	assert.False(t, ok, "a pod without a known owner is routed again")
+	assert.Equal(t, testPodStatus("a", "1"), PodStatuses.Statuses["a"])
+}
+
+func TestInitPodStatuses_FailsQueuedPods(t *testing.T) {
+	config := types.Config{
+		DataRootFolder: t.TempDir(),
+		StatusStore:    types.StatusStoreConfig{Backend: StatusStoreFile},
+	}
+	pod := testPod("uid-q", "default", nil, nil)
+	pod.Spec.Containers = []v1.Container{{Name: "main"}}
+
+	require.NoError(t, InitPodStatuses(context.Background(), config))
+	updateStatuses([]types.PodStatus{admissionStatus(pod, "default", nil), testPodStatus("b", "2")})
+	require.NoError(t, ClosePodStatuses())
+
+	// the queued create is lost with the restart
+	PodStatuses.Statuses = nil
+	require.NoError(t, InitPodStatuses(context.Background(), config))
+	defer func() {
+		require.NoError(t, ClosePodStatuses())
+		PodStatuses.Statuses = make(map[string]types.PodStatus)
+		Admission.cancel("uid-q")
+	}()
+
+	status := PodStatuses.Statuses["uid-q"]
+	require.NotNil(t, status.Containers[0].State.Terminated)
+	assert.Equal(t, CreateFailedReason, status.Containers[0].State.Terminated.Reason)
+	assert.True(t, Admission.holds("uid-q"), "the sidecars are not asked about the failed pod")
+	assert.Equal(t, testPodStatus("b", "2"), PodStatuses.Statuses["b"])
+
+	// the failure is persisted
+	loaded, err := PodStatuses.store.Load()
+	require.NoError(t, err)
+	assert.False(t, isQueuedStatus(loaded["uid-q"].PodStatus))
+}
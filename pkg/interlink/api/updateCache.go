@@ -6,6 +6,8 @@ import (
 	"net/http"
 
 	"github.com/containerd/containerd/log"
+
+	"github.com/interlink-hq/interlink/pkg/interlink/audit"
 )
 
 // UpdateCacheHandler is responsible for deleting not-available-anymore Pods on the Virtual Kubelet from the InterLink caching structure
@@ -19,7 +21,11 @@ func (h *InterLinkHandler) UpdateCacheHandler(w http.ResponseWriter, r *http.Req
 		log.G(h.Ctx).Fatal(err)
 	}
 
+	audit.AddPod(r.Context(), audit.Pod{UID: string(bodyBytes)})
 	deleteCachedStatus(string(bodyBytes))
+	PodOwners.forget(string(bodyBytes))
+	KnownPods.forget(string(bodyBytes))
+	PodCreates.forget(string(bodyBytes))
 
 	w.WriteHeader(statusCode)
 	_, err = w.Write([]byte("Updated cache"))
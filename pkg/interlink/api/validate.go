@@ -0,0 +1,191 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/log"
+	v1 "k8s.io/api/core/v1"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+	"github.com/interlink-hq/interlink/pkg/interlink/audit"
+	"github.com/interlink-hq/interlink/pkg/interlink/jobscript"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	trace "go.opentelemetry.io/otel/trace"
+)
+
+// ValidateHandler handles HTTP POST requests checking whether a pod can be offloaded, without
+// creating it. interLink checks what it handles itself (the volume types it forwards, the
+// plugin and the job script template the pod selects), then forwards the pod to the /validate
+// endpoint of its plugin, when the plugin has one.
+//
+// Request body: JSON-encoded v1.Pod object
+// Response: JSON-encoded ValidationResponse with the findings of interLink and of the plugin
+//
+// HTTP Status Codes:
+//   - 200: Validation completed, whether the pod is valid or not
+//   - 400: The request body is not a pod
+func (h *InterLinkHandler) ValidateHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now().UnixMicro()
+	tracer := otel.Tracer("interlink-API")
+	_, span := tracer.Start(h.Ctx, "ValidateAPI", trace.WithAttributes(
+		attribute.Int64("start.timestamp", start),
+	))
+	defer span.End()
+	defer types.SetDurationSpan(start, span)
+	defer types.SetInfoFromHeaders(span, &r.Header)
+
+	sessionContext := GetSessionContext(r)
+	sessionContextMessage := GetSessionContextMessage(sessionContext)
+	log.G(h.Ctx).Info(sessionContextMessage, "InterLink: received Validate call")
+
+	bodyBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "unable to read the request body", http.StatusBadRequest)
+		return
+	}
+	var pod v1.Pod
+	if err := json.Unmarshal(bodyBytes, &pod); err != nil {
+		http.Error(w, "invalid pod: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	span.SetAttributes(
+		attribute.String("pod.name", pod.Name),
+		attribute.String("pod.namespace", pod.Namespace),
+	)
+	audit.AddPod(r.Context(), audit.Pod{Namespace: pod.Namespace, Name: pod.Name, UID: string(pod.UID)})
+
+	findings := h.validatePod(&pod)
+	sidecar, err := h.routePod(&pod)
+	if err != nil {
+		findings = append(findings, types.ValidationFinding{
+			Severity: types.ValidationError,
+			Field:    "metadata.annotations[" + PluginAnnotation + "]",
+			Message:  err.Error(),
+			Source:   types.ValidationSourceInterLink,
+		})
+	} else {
+		span.SetAttributes(attribute.String("sidecar.name", sidecar.Name))
+		findings = append(findings, h.validateWithPlugin(r, sidecar, bodyBytes, sessionContext)...)
+	}
+
+	response := types.NewValidationResponse(findings)
+	span.SetAttributes(attribute.Bool("pod.valid", response.Valid), attribute.Int("findings.count", len(response.Findings)))
+	returnValue, err := json.Marshal(response)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.G(h.Ctx).Error(sessionContextMessage, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(returnValue); err != nil {
+		log.G(h.Ctx).Error(sessionContextMessage, "failed to write to http buffer: ", err)
+	}
+}
+
+// forwardedVolumeTypes are the volume types interLink sends to the plugins. The Virtual
+// Kubelet turns downwardAPI volumes into projected ones before the create.
+var forwardedVolumeTypes = []string{"configMap", "secret", "projected", "emptyDir", "downwardAPI"}
+
+// validatePod runs the checks of interLink on a pod.
+func (h *InterLinkHandler) validatePod(pod *v1.Pod) []types.ValidationFinding {
+	var findings []types.ValidationFinding
+	finding := func(severity, field, message string) {
+		findings = append(findings, types.ValidationFinding{
+			Severity: severity, Field: field, Message: message, Source: types.ValidationSourceInterLink,
+		})
+	}
+
+	mounted := mountedVolumes(pod)
+	for i, volume := range pod.Spec.Volumes {
+		kind := volumeType(volume)
+		if slices.Contains(forwardedVolumeTypes, kind) {
+			continue
+		}
+		field := fmt.Sprintf("spec.volumes[%d].%s", i, kind)
+		if mounted[volume.Name] {
+			finding(types.ValidationError, field, fmt.Sprintf("volume %q: %s volumes are not supported and would not be mounted", volume.Name, kind))
+		} else {
+			finding(types.ValidationIgnored, field, fmt.Sprintf("volume %q: %s volumes are not supported, and no container mounts it", volume.Name, kind))
+		}
+	}
+
+	if name, ok := pod.Annotations[jobscript.TemplateAnnotation]; ok && name != "" {
+		field := "metadata.annotations[" + jobscript.TemplateAnnotation + "]"
+		switch {
+		case h.JobScripts == nil:
+			finding(types.ValidationIgnored, field, "no job script templates are configured")
+		case !slices.Contains(h.JobScripts.Names(), name):
+			finding(types.ValidationError, field, fmt.Sprintf("%v %q, available: %s", jobscript.ErrUnknownTemplate, name, strings.Join(h.JobScripts.Names(), ", ")))
+		}
+	}
+	return findings
+}
+
+// mountedVolumes returns the names of the volumes mounted by the containers of a pod.
+func mountedVolumes(pod *v1.Pod) map[string]bool {
+	mounted := make(map[string]bool)
+	for _, containers := range [][]v1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for _, container := range containers {
+			for _, mount := range container.VolumeMounts {
+				mounted[mount.Name] = true
+			}
+		}
+	}
+	return mounted
+}
+
+// volumeType returns the type of a volume as named in the pod spec, e.g. "persistentVolumeClaim".
+func volumeType(volume v1.Volume) string {
+	source := reflect.ValueOf(volume.VolumeSource)
+	for i := 0; i < source.NumField(); i++ {
+		if field := source.Field(i); field.Kind() == reflect.Pointer && !field.IsNil() {
+			name, _, _ := strings.Cut(source.Type().Field(i).Tag.Get("json"), ",")
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// validateWithPlugin forwards the pod to the /validate endpoint of the plugin. Plugins without
+// one are skipped; a plugin that fails to answer yields a warning, since its checks are missing.
+func (h *InterLinkHandler) validateWithPlugin(r *http.Request, sidecar *Sidecar, body []byte, sessionContext string) []types.ValidationFinding {
+	warning := func(message string) []types.ValidationFinding {
+		return []types.ValidationFinding{{
+			Severity: types.ValidationWarning,
+			Message:  fmt.Sprintf("plugin %s could not validate the pod: %s", sidecar.Name, message),
+			Source:   types.ValidationSourceInterLink,
+		}}
+	}
+
+	code, respBody, err := sidecar.do(r.Context(), http.MethodPost, "/validate", body, sessionContext)
+	switch {
+	case err != nil:
+		return warning(err.Error())
+	case code == http.StatusNotFound || code == http.StatusMethodNotAllowed || code == http.StatusNotImplemented:
+		log.G(h.Ctx).Debug("Plugin ", sidecar.Name, " has no /validate endpoint")
+		return nil
+	case code != http.StatusOK:
+		return warning(fmt.Sprintf("HTTP %d: %s", code, strings.TrimSpace(string(respBody))))
+	}
+
+	var response types.ValidationResponse
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		return warning("invalid response: " + err.Error())
+	}
+	for i := range response.Findings {
+		if response.Findings[i].Source == "" {
+			response.Findings[i].Source = types.ValidationSourcePlugin
+		}
+	}
+	return response.Findings
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+	"github.com/interlink-hq/interlink/pkg/interlink/jobscript"
+)
+
+func validate(t *testing.T, h *InterLinkHandler, pod *v1.Pod) types.ValidationResponse {
+	t.Helper()
+	body, err := json.Marshal(pod)
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	h.ValidateHandler(rec, httptest.NewRequest(http.MethodPost, "/validate", bytes.NewReader(body)))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var response types.ValidationResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	return response
+}
+
+func TestValidateHandler_Volumes(t *testing.T) {
+	server, endpoint, client := newUnixTestServer(t, http.NotFoundHandler())
+	defer server.Close()
+	h := &InterLinkHandler{Ctx: context.Background(), SidecarEndpoint: endpoint, ClientHTTP: client}
+
+	pod := testPod("uid", "default", nil, nil)
+	pod.Spec.Volumes = []v1.Volume{
+		{Name: "config", VolumeSource: v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{}}},
+		{Name: "data", VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "data"}}},
+		{Name: "host", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/tmp"}}},
+	}
+	pod.Spec.Containers = []v1.Container{{
+		Name:         "main",
+		VolumeMounts: []v1.VolumeMount{{Name: "config"}, {Name: "data"}},
+	}}
+
+	response := validate(t, h, pod)
+	assert.False(t, response.Valid)
+	assert.Equal(t, []types.ValidationFinding{
+		{
+			Severity: types.ValidationError,
+			Field:    "spec.volumes[1].persistentVolumeClaim",
+			Message:  `volume "data": persistentVolumeClaim volumes are not supported and would not be mounted`,
+			Source:   types.ValidationSourceInterLink,
+		},
+		{
+			Severity: types.ValidationIgnored,
+			Field:    "spec.volumes[2].hostPath",
+			Message:  `volume "host": hostPath volumes are not supported, and no container mounts it`,
+			Source:   types.ValidationSourceInterLink,
+		},
+	}, response.Findings)
+
+	response = validate(t, h, testPod("uid", "default", nil, nil))
+	assert.True(t, response.Valid)
+	assert.NotNil(t, response.Findings, "findings are always a list")
+}
+
+func TestValidateHandler_Plugin(t *testing.T) {
+	server, endpoint, client := newUnixTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		var pod v1.Pod
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&pod))
+		_ = json.NewEncoder(w).Encode(types.ValidationResponse{Findings: []types.ValidationFinding{
+			{Severity: types.ValidationWarning, Field: "spec.containers[0].resources", Message: "no memory limit for " + pod.Name},
+		}})
+	}))
+	defer server.Close()
+	failing, failingEndpoint, failingClient := newUnixTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	h := &InterLinkHandler{
+		Ctx: context.Background(),
+		Config: types.Config{
+			Sidecars:       []types.SidecarConfig{{Name: "slurm"}, {Name: "broken"}},
+			DefaultSidecar: "slurm",
+		},
+		Sidecars: []*Sidecar{
+			{Name: "slurm", Endpoint: endpoint, ClientHTTP: client},
+			{Name: "broken", Endpoint: failingEndpoint, ClientHTTP: failingClient},
+		},
+	}
+
+	response := validate(t, h, testPod("uid", "default", nil, nil))
+	assert.True(t, response.Valid)
+	assert.Equal(t, []types.ValidationFinding{{
+		Severity: types.ValidationWarning,
+		Field:    "spec.containers[0].resources",
+		Message:  "no memory limit for pod-uid",
+		Source:   types.ValidationSourcePlugin,
+	}}, response.Findings)
+
+	response = validate(t, h, testPod("uid", "default", nil, map[string]string{PluginAnnotation: "broken"}))
+	assert.True(t, response.Valid, "the plugin failures are warnings")
+	require.Len(t, response.Findings, 1)
+	assert.Equal(t, types.ValidationWarning, response.Findings[0].Severity)
+	assert.Contains(t, response.Findings[0].Message, "HTTP 500")
+
+	response = validate(t, h, testPod("uid", "default", nil, map[string]string{PluginAnnotation: "kueue"}))
+	assert.False(t, response.Valid)
+	require.Len(t, response.Findings, 1)
+	assert.Equal(t, "metadata.annotations["+PluginAnnotation+"]", response.Findings[0].Field)
+}
+
+func TestValidateHandler_JobScriptTemplate(t *testing.T) {
+	server, endpoint, client := newUnixTestServer(t, http.NotFoundHandler())
+	defer server.Close()
+	h := &InterLinkHandler{Ctx: context.Background(), SidecarEndpoint: endpoint, ClientHTTP: client}
+	pod := testPod("uid", "default", nil, map[string]string{jobscript.TemplateAnnotation: "gpu"})
+
+	response := validate(t, h, pod)
+	assert.True(t, response.Valid)
+	require.Len(t, response.Findings, 1)
+	assert.Equal(t, types.ValidationIgnored, response.Findings[0].Severity)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "default.tmpl"), []byte(`default`), 0o600))
+	h.JobScripts, _ = jobscript.NewEngine(types.Config{JobScriptTemplateDir: dir})
+	require.NotNil(t, h.JobScripts)
+
+	response = validate(t, h, pod)
+	assert.False(t, response.Valid)
+	require.Len(t, response.Findings, 1)
+	assert.Equal(t, types.ValidationError, response.Findings[0].Severity)
+	assert.Contains(t, response.Findings[0].Message, "available: default")
+}
+
+func TestValidateHandler_InvalidBody(t *testing.T) {
+	h := &InterLinkHandler{Ctx: context.Background()}
+	rec := httptest.NewRecorder()
+	h.ValidateHandler(rec, httptest.NewRequest(http.MethodPost, "/validate", bytes.NewReader([]byte("not a pod"))))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+	"github.com/interlink-hq/interlink/pkg/interlink/channelstream"
+)
+
+// VersionAdapter converts the bodies of one API version to and from the internal
+// representation, which is the v1 wire format understood by the handlers and the plugins.
+// It lets a new version change PodCreateRequests or PodStatus on the wire while older
+// virtual kubelets and plugins keep speaking v1. The streams of the streaming routes are
+// not converted, since that would hold them until their end: a version changing them has
+// to do it in their handlers.
+type VersionAdapter interface {
+	// Request converts the body of a call to endpoint (e.g. "/create") to the internal representation
+	Request(endpoint string, body []byte) ([]byte, error)
+	// Response converts the internal response body of endpoint to the version wire format
+	Response(endpoint string, body []byte) ([]byte, error)
+}
+
+// APIVersion is a version of the interLink API served under the /<Name>/ prefix.
+type APIVersion struct {
+	// Name is the version name, e.g. "v1"
+	Name string
+	// Adapter converts the version bodies; nil when the version is the internal representation
+	Adapter VersionAdapter
+}
+
+// apiVersions lists the served versions, oldest first. The legacy unversioned endpoints
+// default to the first one.
+var apiVersions = []APIVersion{
+	{Name: types.APIVersionV1},
+}
+
+// APIVersions returns the names of the served API versions, oldest first.
+func APIVersions() []string {
+	names := make([]string, 0, len(apiVersions))
+	for _, version := range apiVersions {
+		names = append(names, version.Name)
+	}
+	return names
+}
+
+// Route is an endpoint of the interLink API.
+type Route struct {
+	// Path is the unversioned path, e.g. "/create"
+	Path string
+	// Handler serves the endpoint in the internal representation
+	Handler http.HandlerFunc
+	// Streaming marks the routes whose responses are streams (server-sent events, followed
+	// logs, interactive sessions). Their responses, and their channel-stream requests, are
+	// passed through as they come instead of being converted by the version adapter.
+	Streaming bool
+}
+
+// Routes returns the endpoints of the interLink API.
+func (h *InterLinkHandler) Routes() []Route {
+	return []Route{
+		{Path: "/status", Handler: h.StatusHandler},
+		{Path: "/create", Handler: h.CreateHandler},
+		{Path: "/delete", Handler: h.DeleteHandler},
+		{Path: "/pinglink", Handler: h.Ping},
+		{Path: "/getLogs", Handler: h.GetLogsHandler, Streaming: true},
+		{Path: "/updateCache", Handler: h.UpdateCacheHandler},
+		{Path: "/watch", Handler: h.WatchHandler, Streaming: true},
+		{Path: "/validate", Handler: h.ValidateHandler},
+		{Path: "/exec", Handler: h.ExecHandler, Streaming: true},
+		{Path: "/attach", Handler: h.AttachHandler, Streaming: true},
+		{Path: "/portforward", Handler: h.PortForwardHandler, Streaming: true},
+		{Path: "/stats", Handler: h.StatsHandler},
+	}
+}
+
+// HandleVersioned registers a route on mux under every version prefix (/v1/create, ...) and,
+// for the virtual kubelets predating versioning, under its legacy path. Legacy calls are
+// served in the version negotiated through the APIVersionHeader, v1 when it is absent.
+// Every response carries the version it was served in.
+func HandleVersioned(mux *http.ServeMux, route Route) {
+	for _, version := range apiVersions {
+		mux.Handle("/"+version.Name+route.Path, versioned(version, route))
+	}
+	mux.HandleFunc(route.Path, func(w http.ResponseWriter, r *http.Request) {
+		version, ok := negotiateVersion(r.Header.Get(types.APIVersionHeader))
+		if !ok {
+			w.Header().Set(types.APIVersionHeader, strings.Join(APIVersions(), ", "))
+			http.Error(w, fmt.Sprintf("unsupported API version %q, supported versions: %s",
+				r.Header.Get(types.APIVersionHeader), strings.Join(APIVersions(), ", ")), http.StatusNotAcceptable)
+			return
+		}
+		versioned(version, route).ServeHTTP(w, r)
+	})
+}
+
+// negotiateVersion picks the newest served version among the comma-separated list requested.
+// An empty list selects the oldest version, which is the one legacy clients speak.
+func negotiateVersion(requested string) (APIVersion, bool) {
+	if strings.TrimSpace(requested) == "" {
+		return apiVersions[0], true
+	}
+	wanted := map[string]bool{}
+	for _, name := range strings.Split(requested, ",") {
+		wanted[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+	for i := len(apiVersions) - 1; i >= 0; i-- {
+		if wanted[apiVersions[i].Name] {
+			return apiVersions[i], true
+		}
+	}
+	return APIVersion{}, false
+}
+
+// versioned serves route in the given version, converting the bodies when the version has an
+// adapter. The responses of the streaming routes are written through unconverted.
+func versioned(version APIVersion, route Route) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(types.APIVersionHeader, version.Name)
+		if version.Adapter == nil {
+			route.Handler(w, r)
+			return
+		}
+
+		// the channel streams of the sessions last as long as the session: they are not read whole
+		if !route.Streaming || !strings.HasPrefix(r.Header.Get("Content-Type"), channelstream.ContentType) {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, "unable to read the request body", http.StatusBadRequest)
+				return
+			}
+			internal, err := version.Adapter.Request(route.Path, body)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid %s request: %v", version.Name, err), http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(internal))
+			r.ContentLength = int64(len(internal))
+		}
+		if route.Streaming {
+			route.Handler(w, r)
+			return
+		}
+
+		recorder := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+		route.Handler(recorder, r)
+
+		out := recorder.body.Bytes()
+		var err error
+		if recorder.status < 300 {
+			out, err = version.Adapter.Response(route.Path, out)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("unable to convert the response to %s: %v", version.Name, err), http.StatusInternalServerError)
+				return
+			}
+		}
+		for key, values := range recorder.header {
+			w.Header()[key] = values
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(out)))
+		w.WriteHeader(recorder.status)
+		_, _ = w.Write(out)
+	})
+}
+
+// unversionedPath strips the version prefix from an API path: /v1/create becomes /create.
+func unversionedPath(path string) string {
+	for _, version := range apiVersions {
+		if rest, ok := strings.CutPrefix(path, "/"+version.Name+"/"); ok {
+			return "/" + rest
+		}
+	}
+	return path
+}
+
+// bufferedResponse holds a response until the version adapter has converted it.
+type bufferedResponse struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header { return b.header }
+
+func (b *bufferedResponse) WriteHeader(code int) {
+	if !b.wroteHeader {
+		b.status = code
+		b.wroteHeader = true
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.wroteHeader = true
+	return b.body.Write(p)
+}
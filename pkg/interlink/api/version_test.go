@@ -0,0 +1,154 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+	"github.com/interlink-hq/interlink/pkg/interlink/channelstream"
+)
+
+// upperAdapter is a test version whose wire format is the upper-cased internal one.
+type upperAdapter struct{}
+
+func (upperAdapter) Request(_ string, body []byte) ([]byte, error) {
+	if bytes.Contains(body, []byte("invalid")) {
+		return nil, errors.New("invalid body")
+	}
+	return bytes.ToLower(body), nil
+}
+
+func (upperAdapter) Response(_ string, body []byte) ([]byte, error) {
+	return bytes.ToUpper(body), nil
+}
+
+// withTestVersion serves an additional "v9" version for the duration of the test.
+func withTestVersion(t *testing.T) {
+	t.Helper()
+	saved := apiVersions
+	apiVersions = append(append([]APIVersion{}, saved...), APIVersion{Name: "v9", Adapter: upperAdapter{}})
+	t.Cleanup(func() { apiVersions = saved })
+}
+
+// echoMux serves an endpoint echoing the request body, failing with 400 on "fail".
+func echoMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	HandleVersioned(mux, Route{Path: "/echo", Handler: func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) == "fail" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("bad request"))
+			return
+		}
+		w.Header().Set("X-Echo", "yes")
+		_, _ = w.Write(body)
+	}})
+	return mux
+}
+
+func versionCall(mux http.Handler, path, version, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	if version != "" {
+		req.Header.Set(types.APIVersionHeader, version)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandleVersioned_ServesLegacyAndV1Paths(t *testing.T) {
+	mux := echoMux()
+
+	for _, path := range []string{"/echo", "/v1/echo"} {
+		rec := versionCall(mux, path, "", "hello")
+		assert.Equal(t, http.StatusOK, rec.Code, path)
+		assert.Equal(t, "hello", rec.Body.String(), path)
+		assert.Equal(t, types.APIVersionV1, rec.Header().Get(types.APIVersionHeader), path)
+	}
+}
+
+func TestHandleVersioned_Negotiation(t *testing.T) {
+	withTestVersion(t)
+	mux := echoMux()
+
+	rec := versionCall(mux, "/echo", "v2, v1", "hello")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, types.APIVersionV1, rec.Header().Get(types.APIVersionHeader))
+
+	rec = versionCall(mux, "/echo", "v1, V9", "hello")
+	assert.Equal(t, "v9", rec.Header().Get(types.APIVersionHeader), "the newest common version is picked")
+	assert.Equal(t, "HELLO", rec.Body.String())
+
+	rec = versionCall(mux, "/echo", "v3", "hello")
+	assert.Equal(t, http.StatusNotAcceptable, rec.Code)
+	assert.Equal(t, "v1, v9", rec.Header().Get(types.APIVersionHeader))
+
+	rec = versionCall(mux, "/v1/echo", "v9", "hello")
+	assert.Equal(t, types.APIVersionV1, rec.Header().Get(types.APIVersionHeader), "the path prefix wins over the header")
+}
+
+func TestHandleVersioned_Adapter(t *testing.T) {
+	withTestVersion(t)
+	mux := echoMux()
+
+	rec := versionCall(mux, "/v9/echo", "", "HeLLo")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "HELLO", rec.Body.String(), "the handler must get the internal body and the client the converted one")
+	assert.Equal(t, "yes", rec.Header().Get("X-Echo"))
+	assert.Equal(t, "5", rec.Header().Get("Content-Length"))
+
+	rec = versionCall(mux, "/v9/echo", "", "FAIL")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "bad request", rec.Body.String(), "error bodies are not converted")
+
+	rec = versionCall(mux, "/v9/echo", "", "invalid")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid v9 request")
+}
+
+func TestHandleVersioned_StreamingRoute(t *testing.T) {
+	withTestVersion(t)
+	mux := http.NewServeMux()
+	HandleVersioned(mux, Route{Path: "/stream", Streaming: true, Handler: func(w http.ResponseWriter, r *http.Request) {
+		// echo the first line of the request stream, which stays open
+		assert.NoError(t, http.NewResponseController(w).EnableFullDuplex())
+		line, err := bufio.NewReader(r.Body).ReadString('\n')
+		assert.NoError(t, err)
+		_, _ = w.Write([]byte(line))
+		w.(http.Flusher).Flush()
+		_, _ = io.Copy(io.Discard, r.Body)
+	}})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	body, pipe := io.Pipe()
+	defer pipe.Close()
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/v9/stream", body)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", channelstream.ContentType)
+	go func() { _, _ = pipe.Write([]byte("hello\n")) }()
+
+	// the response comes while both streams are open, unconverted
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "v9", resp.Header.Get(types.APIVersionHeader))
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "hello\n", line)
+}
+
+func TestUnversionedPath(t *testing.T) {
+	assert.Equal(t, "/create", unversionedPath("/v1/create"))
+	assert.Equal(t, "/create", unversionedPath("/create"))
+	assert.Equal(t, "/v1create", unversionedPath("/v1create"))
+}
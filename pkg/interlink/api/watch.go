@@ -0,0 +1,327 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/log"
+	"github.com/google/uuid"
+	v1 "k8s.io/api/core/v1"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	trace "go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultWatchRefreshInterval   = 5 * time.Second
+	defaultWatchHeartbeatInterval = 15 * time.Second
+	// watchBufferSize is the number of events a watcher may lag behind before it is disconnected
+	watchBufferSize = 1024
+)
+
+// statusBroadcaster fans the changes of the PodStatuses cache out to the /watch clients.
+// publish never blocks: a client whose buffer is full is disconnected, and is expected
+// to reconnect and start again from a fresh snapshot.
+type statusBroadcaster struct {
+	mu          sync.Mutex
+	next        int
+	subscribers map[int]chan types.PodStatusEvent
+	// closed is set once the server shuts down: new watchers get a closed channel
+	closed bool
+}
+
+var statusWatchers statusBroadcaster
+
+// publish is called with PodStatuses.mu held, so that events are delivered in cache order.
+func (b *statusBroadcaster) publish(events ...types.PodStatusEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for id, ch := range b.subscribers {
+		if !deliver(ch, events) {
+			log.L.Warning("Disconnecting slow status watcher ", id)
+			close(ch)
+			delete(b.subscribers, id)
+		}
+	}
+}
+
+func deliver(ch chan types.PodStatusEvent, events []types.PodStatusEvent) bool {
+	for _, event := range events {
+		select {
+		case ch <- event:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (b *statusBroadcaster) count() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers)
+}
+
+// CloseWatchers ends every /watch stream and refuses new ones. It is called when the server
+// shuts down, since the streams would otherwise keep their connections busy until the
+// shutdown deadline.
+func CloseWatchers() {
+	statusWatchers.mu.Lock()
+	defer statusWatchers.mu.Unlock()
+
+	statusWatchers.closed = true
+	for id, ch := range statusWatchers.subscribers {
+		close(ch)
+		delete(statusWatchers.subscribers, id)
+	}
+}
+
+// subscribeStatuses registers a new watcher and returns its event channel, a snapshot of
+// the cache taken atomically with the registration, and the function unregistering it.
+func subscribeStatuses() (<-chan types.PodStatusEvent, []types.PodStatus, func()) {
+	ch := make(chan types.PodStatusEvent, watchBufferSize)
+
+	PodStatuses.mu.Lock()
+	statusWatchers.mu.Lock()
+	if statusWatchers.subscribers == nil {
+		statusWatchers.subscribers = make(map[int]chan types.PodStatusEvent)
+	}
+	id := statusWatchers.next
+	statusWatchers.next++
+	if statusWatchers.closed {
+		close(ch)
+	} else {
+		statusWatchers.subscribers[id] = ch
+	}
+	statusWatchers.mu.Unlock()
+
+	snapshot := make([]types.PodStatus, 0, len(PodStatuses.Statuses))
+	for _, status := range PodStatuses.Statuses {
+		snapshot = append(snapshot, status)
+	}
+	PodStatuses.mu.Unlock()
+
+	unsubscribe := func() {
+		statusWatchers.mu.Lock()
+		defer statusWatchers.mu.Unlock()
+		if sub, ok := statusWatchers.subscribers[id]; ok && sub == ch {
+			close(ch)
+			delete(statusWatchers.subscribers, id)
+		}
+	}
+	return ch, snapshot, unsubscribe
+}
+
+// MutexPods remembers the pods interLink has been asked about, so that their status
+// can be refreshed from the sidecars without waiting for the next client request.
+type MutexPods struct {
+	mu   sync.Mutex
+	pods map[string]*v1.Pod
+}
+
+// KnownPods holds the pods whose status is refreshed while watchers are connected.
+var KnownPods MutexPods
+
+func (k *MutexPods) remember(pods ...*v1.Pod) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.pods == nil {
+		k.pods = make(map[string]*v1.Pod)
+	}
+	for _, pod := range pods {
+		k.pods[string(pod.UID)] = pod
+	}
+}
+
+func (k *MutexPods) forget(uid string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.pods, uid)
+}
+
+func (k *MutexPods) list() []*v1.Pod {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	pods := make([]*v1.Pod, 0, len(k.pods))
+	for _, pod := range k.pods {
+		pods = append(pods, pod)
+	}
+	return pods
+}
+
+// isTerminal reports whether every container of the pod has terminated.
+func isTerminal(status types.PodStatus) bool {
+	if len(status.Containers) == 0 {
+		return false
+	}
+	for _, container := range status.Containers {
+		if container.State.Terminated == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// WatchHandler streams the changes of the pod status cache as Server-Sent Events.
+// The stream starts with a MODIFIED event for every cached status, followed by an event
+// every time a status changes or is removed from the cache. Each event carries a
+// JSON-encoded PodStatusEvent in its data field. Comment lines are sent as heartbeats
+// on idle streams, so that clients and proxies can detect dead connections.
+//
+// HTTP Status Codes:
+//   - 200: Stream established
+//   - 500: The server cannot stream responses
+func (h *InterLinkHandler) WatchHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now().UnixMicro()
+	tracer := otel.Tracer("interlink-API")
+	_, span := tracer.Start(h.Ctx, "WatchAPI", trace.WithAttributes(
+		attribute.Int64("start.timestamp", start),
+	))
+	defer span.End()
+	defer types.SetDurationSpan(start, span)
+	defer types.SetInfoFromHeaders(span, &r.Header)
+
+	sessionContext := GetSessionContext(r)
+	sessionContextMessage := GetSessionContextMessage(sessionContext)
+	log.G(h.Ctx).Info(sessionContextMessage, "InterLink: received Watch call")
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		log.G(h.Ctx).Error(sessionContextMessage, "streaming is not supported by the response writer")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	events, snapshot, unsubscribe := subscribeStatuses()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	for _, status := range snapshot {
+		if err := writeStatusEvent(w, types.PodStatusEvent{Type: types.PodStatusEventModified, Status: status}); err != nil {
+			log.G(h.Ctx).Error(sessionContextMessage, err)
+			return
+		}
+	}
+	flusher.Flush()
+	span.AddEvent("Snapshot sent", trace.WithAttributes(attribute.Int("pods.count", len(snapshot))))
+
+	heartbeat := time.NewTicker(h.watchHeartbeatInterval())
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			log.G(h.Ctx).Info(sessionContextMessage, "Watch client disconnected")
+			return
+		case <-h.Ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				log.G(h.Ctx).Warning(sessionContextMessage, "Closing the watch stream: client too slow or server shutting down")
+				return
+			}
+			if err := writeStatusEvent(w, event); err != nil {
+				log.G(h.Ctx).Error(sessionContextMessage, err)
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				log.G(h.Ctx).Error(sessionContextMessage, err)
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeStatusEvent(w http.ResponseWriter, event types.PodStatusEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	return err
+}
+
+func (h *InterLinkHandler) watchHeartbeatInterval() time.Duration {
+	if h.Config.Watch.HeartbeatIntervalSeconds > 0 {
+		return time.Duration(h.Config.Watch.HeartbeatIntervalSeconds) * time.Second
+	}
+	return defaultWatchHeartbeatInterval
+}
+
+func (h *InterLinkHandler) watchRefreshInterval() time.Duration {
+	if h.Config.Watch.RefreshIntervalSeconds > 0 {
+		return time.Duration(h.Config.Watch.RefreshIntervalSeconds) * time.Second
+	}
+	return defaultWatchRefreshInterval
+}
+
+// RefreshStatuses periodically asks the sidecars for the status of the known pods that are
+// not terminated yet, for as long as at least one client is watching. The changes are then
+// pushed to the watchers by updateStatuses. It returns when ctx is done.
+func (h *InterLinkHandler) RefreshStatuses(ctx context.Context) {
+	ticker := time.NewTicker(h.watchRefreshInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if statusWatchers.count() == 0 {
+			continue
+		}
+		h.refreshKnownPods(ctx)
+	}
+}
+
+func (h *InterLinkHandler) refreshKnownPods(ctx context.Context) {
+	var pods []*v1.Pod
+	PodStatuses.mu.Lock()
+	for _, pod := range KnownPods.list() {
+		if status, ok := PodStatuses.Statuses[string(pod.UID)]; !ok || !isTerminal(status) {
+			pods = append(pods, pod)
+		}
+	}
+	PodStatuses.mu.Unlock()
+
+	sessionContext := "Refresh-" + uuid.New().String()
+	for _, group := range h.groupBySidecar(pods) {
+		bodyBytes, err := json.Marshal(group.pods)
+		if err != nil {
+			log.G(ctx).Error(err)
+			continue
+		}
+		code, body, err := group.sidecar.do(ctx, http.MethodGet, "/status", bodyBytes, sessionContext)
+		if err == nil && code != http.StatusOK {
+			err = fmt.Errorf("sidecar returned %d: %s", code, body)
+		}
+		if err != nil {
+			log.G(ctx).Warning("Unable to refresh pod statuses from sidecar ", group.sidecar.Name, ": ", err)
+			continue
+		}
+
+		var statuses []types.PodStatus
+		if err := json.Unmarshal(body, &statuses); err != nil {
+			log.G(ctx).Warning("Invalid status response from sidecar ", group.sidecar.Name, ": ", err)
+			continue
+		}
+		updateStatuses(statuses)
+	}
+}
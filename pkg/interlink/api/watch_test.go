@@ -0,0 +1,183 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+)
+
+func resetPodStatuses(statuses ...types.PodStatus) {
+	PodStatuses.mu.Lock()
+	defer PodStatuses.mu.Unlock()
+	PodStatuses.Statuses = make(map[string]types.PodStatus)
+	for _, status := range statuses {
+		PodStatuses.Statuses[status.PodUID] = status
+	}
+}
+
+func nextEvent(t *testing.T, events <-chan types.PodStatusEvent) types.PodStatusEvent {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		require.True(t, ok, "watcher unexpectedly closed")
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+	return types.PodStatusEvent{}
+}
+
+func TestSubscribeStatuses_PublishesChanges(t *testing.T) {
+	resetPodStatuses(testPodStatus("a", "1"))
+	defer resetPodStatuses()
+
+	events, snapshot, unsubscribe := subscribeStatuses()
+	defer unsubscribe()
+	require.Len(t, snapshot, 1)
+	assert.Equal(t, "a", snapshot[0].PodUID)
+
+	updateStatuses([]types.PodStatus{testPodStatus("a", "1"), testPodStatus("b", "2")})
+	event := nextEvent(t, events)
+	assert.Equal(t, types.PodStatusEventModified, event.Type)
+	assert.Equal(t, "b", event.Status.PodUID, "unchanged statuses must not be published")
+
+	deleteCachedStatus("b")
+	event = nextEvent(t, events)
+	assert.Equal(t, types.PodStatusEventDeleted, event.Type)
+	assert.Equal(t, "2", event.Status.JobID)
+
+	assert.Empty(t, events)
+}
+
+func TestSubscribeStatuses_DisconnectsSlowWatcher(t *testing.T) {
+	resetPodStatuses()
+	defer resetPodStatuses()
+
+	events, _, unsubscribe := subscribeStatuses()
+	defer unsubscribe()
+
+	for i := 0; i <= watchBufferSize; i++ {
+		statusWatchers.publish(types.PodStatusEvent{Type: types.PodStatusEventModified})
+	}
+	assert.Equal(t, 0, statusWatchers.count())
+
+	received := 0
+	for range events {
+		received++
+	}
+	assert.Equal(t, watchBufferSize, received)
+}
+
+func TestCloseWatchers_EndsStreams(t *testing.T) {
+	resetPodStatuses()
+	defer resetPodStatuses()
+	defer func() {
+		statusWatchers.mu.Lock()
+		statusWatchers.closed = false
+		statusWatchers.mu.Unlock()
+	}()
+
+	events, _, unsubscribe := subscribeStatuses()
+	defer unsubscribe()
+
+	CloseWatchers()
+	_, ok := <-events
+	assert.False(t, ok, "open streams must end")
+	assert.Equal(t, 0, statusWatchers.count())
+
+	late, _, unsubscribeLate := subscribeStatuses()
+	defer unsubscribeLate()
+	_, ok = <-late
+	assert.False(t, ok, "watchers subscribing after the shutdown must get a closed stream")
+}
+
+func TestWatchHandler_StreamsSnapshotAndChanges(t *testing.T) {
+	resetPodStatuses(testPodStatus("a", "1"))
+	defer resetPodStatuses()
+
+	h := &InterLinkHandler{
+		Ctx:    context.Background(),
+		Config: types.Config{Watch: types.WatchConfig{HeartbeatIntervalSeconds: 1}},
+	}
+	server := httptest.NewServer(http.HandlerFunc(h.WatchHandler))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	readEvent := func() types.PodStatusEvent {
+		t.Helper()
+		for {
+			line, err := reader.ReadString('\n')
+			require.NoError(t, err)
+			if data, ok := strings.CutPrefix(line, "data: "); ok {
+				var event types.PodStatusEvent
+				require.NoError(t, json.Unmarshal([]byte(data), &event))
+				return event
+			}
+		}
+	}
+
+	event := readEvent()
+	assert.Equal(t, types.PodStatusEventModified, event.Type)
+	assert.Equal(t, "a", event.Status.PodUID)
+
+	updateStatuses([]types.PodStatus{testPodStatus("a", "2")})
+	event = readEvent()
+	assert.Equal(t, "2", event.Status.JobID)
+
+	line, err := reader.ReadString('\n')
+	for err == nil && line == "\n" {
+		line, err = reader.ReadString('\n')
+	}
+	require.NoError(t, err)
+	assert.Equal(t, ": heartbeat\n", line)
+}
+
+func TestRefreshKnownPods_SkipsTerminatedPods(t *testing.T) {
+	terminated := testPodStatus("done", "old")
+	terminated.Containers = []v1.ContainerStatus{{
+		Name:  "main",
+		State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 0}},
+	}}
+	resetPodStatuses(terminated)
+	defer resetPodStatuses()
+
+	KnownPods.mu.Lock()
+	KnownPods.pods = nil
+	KnownPods.mu.Unlock()
+	KnownPods.remember(testPod("running", "default", nil, nil), testPod("done", "default", nil, nil))
+	defer func() {
+		KnownPods.forget("running")
+		KnownPods.forget("done")
+	}()
+
+	var received []string
+	h := &InterLinkHandler{Ctx: context.Background(), Sidecars: []*Sidecar{newStatusSidecar(t, "default", &received)}}
+	h.refreshKnownPods(context.Background())
+
+	assert.Equal(t, []string{"running"}, received)
+	PodStatuses.mu.Lock()
+	defer PodStatuses.mu.Unlock()
+	assert.Equal(t, "default", PodStatuses.Statuses["running"].JobID)
+	assert.Equal(t, "old", PodStatuses.Statuses["done"].JobID)
+}
@@ -0,0 +1,314 @@
+// Package audit writes a structured audit log of the calls to the interLink API: one JSON
+// line per request, telling who called which endpoint, for which pods, and with which result.
+//
+// The Middleware records the request metadata and the caller, and writes the line once the
+// request is served. Handlers add the pods the call was about with AddPod and SetJobID.
+// Only these fields are written: request and response bodies, and therefore Secret data,
+// never reach the audit log.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/log"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+	"github.com/interlink-hq/interlink/pkg/interlink/auth"
+)
+
+const (
+	// sessionHeader carries the session ID set by the Virtual Kubelet for end-to-end tracing
+	sessionHeader = "InterLink-Http-Session"
+
+	// MethodClientCert identifies callers by the common name of their TLS client certificate
+	MethodClientCert = "client-cert"
+
+	defaultMaxSizeMB  = 100
+	defaultMaxBackups = 5
+	auditLogName      = "audit.log"
+)
+
+// Pod identifies a pod concerned by an API call.
+type Pod struct {
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+	UID       string `json:"uid,omitempty"`
+	JobID     string `json:"jobID,omitempty"`
+}
+
+// Record is a line of the audit log.
+type Record struct {
+	// Time is when the request was received
+	Time time.Time `json:"time"`
+	// Method and Endpoint are the HTTP method and path of the request
+	Method   string `json:"method"`
+	Endpoint string `json:"endpoint"`
+	// SessionID is the InterLink-Http-Session header of the request
+	SessionID string `json:"sessionID,omitempty"`
+	// Caller is the token subject, or the common name of the client certificate
+	Caller string `json:"caller,omitempty"`
+	// CallerMethod tells how the caller was identified: static-token, jwt or client-cert
+	CallerMethod string `json:"callerMethod,omitempty"`
+	// RemoteAddr is the network address of the caller
+	RemoteAddr string `json:"remoteAddr,omitempty"`
+	// Pods are the pods the call was about
+	Pods []Pod `json:"pods,omitempty"`
+	// StatusCode is the HTTP status code of the response
+	StatusCode int `json:"statusCode"`
+	// DurationMilliseconds is the time taken to serve the request
+	DurationMilliseconds int64 `json:"durationMs"`
+}
+
+// entry is the record of a request being served, shared through the request context.
+type entry struct {
+	mu     sync.Mutex
+	record Record
+}
+
+type entryKey struct{}
+
+func entryFromContext(ctx context.Context) *entry {
+	e, _ := ctx.Value(entryKey{}).(*entry)
+	return e
+}
+
+// AddPod records a pod concerned by the request being audited. It does nothing when the
+// request is not audited.
+func AddPod(ctx context.Context, pod Pod) {
+	if e := entryFromContext(ctx); e != nil {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.record.Pods = append(e.record.Pods, pod)
+	}
+}
+
+// SetJobID sets the job ID of a pod recorded with AddPod.
+func SetJobID(ctx context.Context, uid, jobID string) {
+	if e := entryFromContext(ctx); e != nil {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		for i := range e.record.Pods {
+			if e.record.Pods[i].UID == uid {
+				e.record.Pods[i].JobID = jobID
+			}
+		}
+	}
+}
+
+// Logger appends the audit records to a file, rotated once it reaches its maximum size.
+type Logger struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// NewLogger opens the audit log configured by the Audit section of the config.
+func NewLogger(config types.Config) (*Logger, error) {
+	path := config.Audit.Path
+	if path == "" {
+		if config.DataRootFolder == "" {
+			return nil, errors.New("the audit log requires either Audit.Path or DataRootFolder to be set")
+		}
+		path = filepath.Join(config.DataRootFolder, "audit", auditLogName)
+	}
+	maxSizeMB := config.Audit.MaxSizeMB
+	if maxSizeMB <= 0 {
+		maxSizeMB = defaultMaxSizeMB
+	}
+	maxBackups := config.Audit.MaxBackups
+	if maxBackups <= 0 {
+		maxBackups = defaultMaxBackups
+	}
+	return OpenLogger(path, int64(maxSizeMB)<<20, maxBackups)
+}
+
+// OpenLogger opens the audit log at path, keeping up to maxBackups rotated files of maxSize bytes.
+func OpenLogger(path string, maxSize int64, maxBackups int) (*Logger, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("unable to create audit log directory: %w", err)
+	}
+	l := &Logger{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Logger) open() error {
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("unable to open audit log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("unable to open audit log: %w", err)
+	}
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+// Write appends a record to the log.
+func (l *Logger) Write(record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return errors.New("audit log is closed")
+	}
+	if l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	return err
+}
+
+// rotate shifts the backups (audit.log.1 becomes audit.log.2, ...), moves the current file
+// to audit.log.1 and starts a new one. The oldest backup is dropped. Called with mu held.
+func (l *Logger) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	l.file = nil
+	for i := l.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(l.backup(i), l.backup(i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.Rename(l.path, l.backup(1)); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+func (l *Logger) backup(i int) string {
+	return l.path + "." + strconv.Itoa(i)
+}
+
+// Close flushes and closes the log.
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Sync()
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	l.file = nil
+	return err
+}
+
+// Middleware writes a record to logger for every request served by next. It must wrap the
+// authentication middleware, so that rejected calls are audited too, and next should be
+// wrapped in turn by RecordIdentity, to learn the identity of the accepted callers.
+func Middleware(logger *Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		e := &entry{record: Record{
+			Time:       start.UTC(),
+			Method:     r.Method,
+			Endpoint:   r.URL.Path,
+			SessionID:  r.Header.Get(sessionHeader),
+			RemoteAddr: r.RemoteAddr,
+		}}
+		if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+			e.record.Caller = r.TLS.PeerCertificates[0].Subject.CommonName
+			e.record.CallerMethod = MethodClientCert
+		}
+
+		recorder := &StatusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), entryKey{}, e)))
+
+		e.mu.Lock()
+		record := e.record
+		record.Pods = append([]Pod(nil), e.record.Pods...)
+		e.mu.Unlock()
+		record.StatusCode = recorder.Code()
+		record.DurationMilliseconds = time.Since(start).Milliseconds()
+		if err := logger.Write(record); err != nil {
+			log.G(r.Context()).Error("Unable to write the audit record of ", r.Method, " ", r.URL.Path, ": ", err)
+		}
+	})
+}
+
+// RecordIdentity copies the caller identity set by the authentication middleware into the
+// audit record of the request. A token identity takes precedence over the client certificate.
+func RecordIdentity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, ok := auth.IdentityFromContext(r.Context()); ok {
+			if e := entryFromContext(r.Context()); e != nil {
+				e.mu.Lock()
+				e.record.Caller = id.Subject
+				e.record.CallerMethod = id.Method
+				e.mu.Unlock()
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// StatusRecorder keeps the first status code written to the response. It is shared by the
+// audit and the metrics middlewares.
+type StatusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code before writing it.
+func (sr *StatusRecorder) WriteHeader(code int) {
+	if sr.status == 0 {
+		sr.status = code
+	}
+	sr.ResponseWriter.WriteHeader(code)
+}
+
+// Write records an implicit 200 when the handler wrote no status code.
+func (sr *StatusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	return sr.ResponseWriter.Write(b)
+}
+
+// Flush lets the handlers streaming their response (logs, ping) flush through the recorder.
+func (sr *StatusRecorder) Flush() {
+	if f, ok := sr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer.
+func (sr *StatusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// Code returns the status code of the response, 200 when the handler wrote none.
+func (sr *StatusRecorder) Code() int {
+	if sr.status == 0 {
+		return http.StatusOK
+	}
+	return sr.status
+}
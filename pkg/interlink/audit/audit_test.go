@@ -0,0 +1,125 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+	"github.com/interlink-hq/interlink/pkg/interlink/auth"
+)
+
+func readRecords(t *testing.T, path string) []Record {
+	t.Helper()
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record Record
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record), scanner.Text())
+		records = append(records, record)
+	}
+	require.NoError(t, scanner.Err())
+	return records
+}
+
+func TestMiddleware(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	logger, err := OpenLogger(path, 1<<20, 2)
+	require.NoError(t, err)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		AddPod(r.Context(), Pod{Namespace: "default", Name: "pod-a", UID: "uid-a"})
+		SetJobID(r.Context(), "uid-a", "42")
+		w.WriteHeader(http.StatusCreated)
+	})
+	// authenticate stands for the authentication middleware, rejecting calls without token.
+	authenticate := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), auth.Identity{Subject: "vk-node-1", Method: auth.MethodJWT})))
+		})
+	}
+	server := Middleware(logger, authenticate(RecordIdentity(handler)))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/create", strings.NewReader(`{"secrets":[{"data":{"password":"czNjcjN0"}}]}`))
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set(sessionHeader, "CreatePod#123")
+	server.ServeHTTP(httptest.NewRecorder(), req)
+
+	rejected := httptest.NewRequest(http.MethodDelete, "/delete", nil)
+	rejected.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "intruder"}}}}
+	server.ServeHTTP(httptest.NewRecorder(), rejected)
+	require.NoError(t, logger.Close())
+
+	records := readRecords(t, path)
+	require.Len(t, records, 2)
+
+	assert.Equal(t, http.MethodPost, records[0].Method)
+	assert.Equal(t, "/v1/create", records[0].Endpoint)
+	assert.Equal(t, "CreatePod#123", records[0].SessionID)
+	assert.Equal(t, "vk-node-1", records[0].Caller)
+	assert.Equal(t, auth.MethodJWT, records[0].CallerMethod)
+	assert.Equal(t, []Pod{{Namespace: "default", Name: "pod-a", UID: "uid-a", JobID: "42"}}, records[0].Pods)
+	assert.Equal(t, http.StatusCreated, records[0].StatusCode)
+	assert.False(t, records[0].Time.IsZero())
+
+	assert.Equal(t, "intruder", records[1].Caller)
+	assert.Equal(t, MethodClientCert, records[1].CallerMethod)
+	assert.Equal(t, http.StatusUnauthorized, records[1].StatusCode)
+	assert.Empty(t, records[1].Pods)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "czNjcjN0", "request bodies are never audited")
+}
+
+func TestLoggerRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	logger, err := OpenLogger(path, 300, 2)
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, logger.Write(Record{Method: http.MethodGet, Endpoint: "/status", StatusCode: http.StatusOK}))
+	}
+	require.NoError(t, logger.Close())
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		require.NoError(t, err, name)
+		assert.LessOrEqual(t, info.Size(), int64(300), name)
+		assert.NotEmpty(t, readRecords(t, name), name)
+	}
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err), "only MaxBackups rotated files are kept")
+
+	require.Error(t, logger.Write(Record{}), "a closed log refuses writes")
+}
+
+func TestNewLogger(t *testing.T) {
+	dir := t.TempDir()
+	logger, err := NewLogger(types.Config{DataRootFolder: dir, Audit: types.AuditConfig{Enabled: true}})
+	require.NoError(t, err)
+	require.NoError(t, logger.Close())
+	assert.FileExists(t, filepath.Join(dir, "audit", auditLogName))
+
+	_, err = NewLogger(types.Config{Audit: types.AuditConfig{Enabled: true}})
+	require.Error(t, err)
+}
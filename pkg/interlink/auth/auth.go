@@ -0,0 +1,201 @@
+// Package auth authenticates the calls to the interLink API server.
+// Callers present a bearer token that is either one of a list of static tokens
+// or a JWT verified against a JSON Web Key Set, with issuer, audience and
+// group claims enforced.
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/log"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+)
+
+const (
+	// MethodStaticToken marks callers authenticated with a static token
+	MethodStaticToken = "static-token"
+	// MethodJWT marks callers authenticated with a JWT
+	MethodJWT = "jwt"
+
+	defaultGroupsClaim = "groups"
+	defaultClockSkew   = 60 * time.Second
+)
+
+var (
+	// ErrMissingToken is returned when the request carries no bearer token
+	ErrMissingToken = errors.New("missing bearer token")
+	// ErrInvalidToken is returned when the token is neither a known static token nor a valid JWT
+	ErrInvalidToken = errors.New("invalid bearer token")
+	// ErrForbidden is returned when a valid JWT carries none of the allowed groups
+	ErrForbidden = errors.New("caller is not member of any allowed group")
+)
+
+// Identity describes an authenticated caller.
+type Identity struct {
+	// Subject is the sub claim of the JWT, or the name given to the static token
+	Subject string
+	// Groups are the groups listed in the JWT
+	Groups []string
+	// Method is either MethodStaticToken or MethodJWT
+	Method string
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx carrying the given caller identity.
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFromContext returns the caller identity stored by the authentication middleware.
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+type staticToken struct {
+	token string
+	name  string
+}
+
+// Authenticator validates bearer tokens according to an AuthConfig.
+type Authenticator struct {
+	config    types.AuthConfig
+	tokens    []staticToken
+	keys      *keySet
+	clockSkew time.Duration
+	now       func() time.Time
+}
+
+// NewAuthenticator builds an Authenticator from the Auth section of the interLink config.
+// At least one of TokensFile or a JWKS source (JWKSFile, JWKSURL or Issuer) must be set.
+func NewAuthenticator(ctx context.Context, config types.AuthConfig) (*Authenticator, error) {
+	a := &Authenticator{
+		config:    config,
+		clockSkew: defaultClockSkew,
+		now:       time.Now,
+	}
+	if config.ClockSkewSeconds > 0 {
+		a.clockSkew = time.Duration(config.ClockSkewSeconds) * time.Second
+	}
+	if a.config.GroupsClaim == "" {
+		a.config.GroupsClaim = defaultGroupsClaim
+	}
+
+	if config.TokensFile != "" {
+		tokens, err := readTokensFile(config.TokensFile)
+		if err != nil {
+			return nil, err
+		}
+		a.tokens = tokens
+		log.G(ctx).Infof("Loaded %d static API tokens from %s", len(tokens), config.TokensFile)
+	}
+
+	if config.JWKSFile != "" || config.JWKSURL != "" || config.Issuer != "" {
+		if len(config.Audiences) == 0 {
+			return nil, errors.New("JWT authentication requires Auth.Audiences to be set")
+		}
+		keys, err := newKeySet(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+		a.keys = keys
+	}
+
+	if a.tokens == nil && a.keys == nil {
+		return nil, errors.New("authentication enabled but neither Auth.TokensFile nor a JWKS source is configured")
+	}
+	return a, nil
+}
+
+func readTokensFile(path string) ([]staticToken, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open tokens file: %w", err)
+	}
+	defer f.Close()
+
+	tokens := []staticToken{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		token := staticToken{token: fields[0], name: fmt.Sprintf("static-token-%d", len(tokens))}
+		if len(fields) > 1 {
+			token.name = fields[1]
+		}
+		tokens = append(tokens, token)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read tokens file: %w", err)
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("tokens file %s holds no token", path)
+	}
+	return tokens, nil
+}
+
+// Authenticate validates the bearer token of the request and returns the caller identity.
+func (a *Authenticator) Authenticate(r *http.Request) (Identity, error) {
+	header := r.Header.Get("Authorization")
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return Identity{}, ErrMissingToken
+	}
+	token = strings.TrimSpace(token)
+
+	for _, static := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(static.token), []byte(token)) == 1 {
+			return Identity{Subject: static.name, Method: MethodStaticToken}, nil
+		}
+	}
+
+	if a.keys == nil || strings.Count(token, ".") != 2 {
+		return Identity{}, ErrInvalidToken
+	}
+
+	claims, err := a.verifyJWT(r.Context(), token)
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	id := Identity{Subject: claims.subject(), Groups: claims.stringList(a.config.GroupsClaim), Method: MethodJWT}
+	if len(a.config.AllowedGroups) > 0 && !slices.ContainsFunc(id.Groups, func(g string) bool {
+		return slices.Contains(a.config.AllowedGroups, g)
+	}) {
+		return id, ErrForbidden
+	}
+	return id, nil
+}
+
+// Middleware rejects the requests that fail authentication and stores the identity
+// of the accepted callers in the request context.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := a.Authenticate(r)
+		if err != nil {
+			log.G(r.Context()).Warningf("Rejected %s %s from %s: %v", r.Method, r.URL.Path, r.RemoteAddr, err)
+			if errors.Is(err, ErrForbidden) {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="interlink", error="invalid_token"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), id)))
+	})
+}
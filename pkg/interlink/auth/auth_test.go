@@ -0,0 +1,330 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+)
+
+const (
+	testIssuer   = "https://issuer.example"
+	testAudience = "interlink"
+)
+
+type testKeys struct {
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return testKeys{rsa: rsaKey, ec: ecKey}
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// writeJWKS writes the public keys with ids "rsa<gen>" and "ec<gen>".
+func (k testKeys) writeJWKS(t *testing.T, gen string) string {
+	t.Helper()
+	ecPoint, err := k.ec.PublicKey.Bytes()
+	require.NoError(t, err)
+	jwks := map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa" + gen, "use": "sig", "n": b64(k.rsa.N.Bytes()), "e": b64(big.NewInt(int64(k.rsa.E)).Bytes())},
+		{"kty": "EC", "kid": "ec" + gen, "crv": "P-256", "x": b64(ecPoint[1:33]), "y": b64(ecPoint[33:])},
+		{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"},
+	}}
+	data, err := json.Marshal(jwks)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+func (k testKeys) sign(t *testing.T, alg, kid string, claims map[string]any) string {
+	t.Helper()
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signingInput := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+	switch alg {
+	case "RS256":
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k.rsa, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, k.ec, digest[:])
+		require.NoError(t, err)
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	default:
+		signature = []byte("unsigned")
+	}
+	return signingInput + "." + b64(signature)
+}
+
+func validClaims() map[string]any {
+	return map[string]any{
+		"iss":    testIssuer,
+		"aud":    []string{"other", testAudience},
+		"sub":    "vk-node-1",
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"groups": []string{"interlink-vk"},
+	}
+}
+
+func newTestAuthenticator(t *testing.T, keys testKeys) *Authenticator {
+	t.Helper()
+	tokensFile := filepath.Join(t.TempDir(), "tokens")
+	require.NoError(t, os.WriteFile(tokensFile, []byte("# comment\nstatic-secret ci-runner\n\nanother-secret\n"), 0o600))
+
+	config := types.AuthConfig{
+		Enabled:       true,
+		TokensFile:    tokensFile,
+		Issuer:        testIssuer,
+		JWKSFile:      keys.writeJWKS(t, "-1"),
+		Audiences:     []string{testAudience},
+		AllowedGroups: []string{"interlink-vk"},
+	}
+	a, err := NewAuthenticator(context.Background(), config)
+	require.NoError(t, err)
+	return a
+}
+
+func TestAuthenticate(t *testing.T) {
+	keys := newTestKeys(t)
+	a := newTestAuthenticator(t, keys)
+
+	expired := validClaims()
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	notYet := validClaims()
+	notYet["nbf"] = time.Now().Add(time.Hour).Unix()
+	wrongIssuer := validClaims()
+	wrongIssuer["iss"] = "https://evil.example"
+	wrongAudience := validClaims()
+	wrongAudience["aud"] = "someone-else"
+	noExp := validClaims()
+	delete(noExp, "exp")
+	wrongGroup := validClaims()
+	wrongGroup["groups"] = "users"
+
+	other := newTestKeys(t)
+
+	tests := []struct {
+		name        string
+		header      string
+		wantErr     error
+		wantSubject string
+		wantMethod  string
+	}{
+		{name: "no header", header: "", wantErr: ErrMissingToken},
+		{name: "basic auth", header: "Basic Zm9vOmJhcg==", wantErr: ErrMissingToken},
+		{name: "static token with name", header: "Bearer static-secret", wantSubject: "ci-runner", wantMethod: MethodStaticToken},
+		{name: "static token without name", header: "bearer another-secret", wantSubject: "static-token-1", wantMethod: MethodStaticToken},
+		{name: "unknown static token", header: "Bearer nope", wantErr: ErrInvalidToken},
+		{name: "RS256 JWT", header: "Bearer " + keys.sign(t, "RS256", "rsa-1", validClaims()), wantSubject: "vk-node-1", wantMethod: MethodJWT},
+		{name: "ES256 JWT", header: "Bearer " + keys.sign(t, "ES256", "ec-1", validClaims()), wantSubject: "vk-node-1", wantMethod: MethodJWT},
+		{name: "signed by another key", header: "Bearer " + other.sign(t, "RS256", "rsa-1", validClaims()), wantErr: ErrInvalidToken},
+		{name: "alg none", header: "Bearer " + keys.sign(t, "none", "rsa-1", validClaims()), wantErr: ErrInvalidToken},
+		{name: "HMAC", header: "Bearer " + keys.sign(t, "HS256", "hmac", validClaims()), wantErr: ErrInvalidToken},
+		{name: "unknown kid", header: "Bearer " + keys.sign(t, "RS256", "rsa-2", validClaims()), wantErr: ErrInvalidToken},
+		{name: "expired", header: "Bearer " + keys.sign(t, "RS256", "rsa-1", expired), wantErr: ErrInvalidToken},
+		{name: "not valid yet", header: "Bearer " + keys.sign(t, "RS256", "rsa-1", notYet), wantErr: ErrInvalidToken},
+		{name: "no exp", header: "Bearer " + keys.sign(t, "RS256", "rsa-1", noExp), wantErr: ErrInvalidToken},
+		{name: "wrong issuer", header: "Bearer " + keys.sign(t, "RS256", "rsa-1", wrongIssuer), wantErr: ErrInvalidToken},
+		{name: "wrong audience", header: "Bearer " + keys.sign(t, "RS256", "rsa-1", wrongAudience), wantErr: ErrInvalidToken},
+		{name: "group not allowed", header: "Bearer " + keys.sign(t, "RS256", "rsa-1", wrongGroup), wantErr: ErrForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/status", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			id, err := a.Authenticate(req)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantSubject, id.Subject)
+			assert.Equal(t, tt.wantMethod, id.Method)
+		})
+	}
+}
+
+func TestAuthenticate_ReloadsRotatedKeys(t *testing.T) {
+	keys := newTestKeys(t)
+	a := newTestAuthenticator(t, keys)
+
+	rotated := newTestKeys(t)
+	require.NoError(t, os.Rename(rotated.writeJWKS(t, "-2"), a.config.JWKSFile))
+
+	req := httptest.NewRequest(http.MethodGet, "/status", nil)
+	req.Header.Set("Authorization", "Bearer "+rotated.sign(t, "RS256", "rsa-2", validClaims()))
+
+	// Reloads are rate limited: right after startup the new key is not picked up yet.
+	_, err := a.Authenticate(req)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	a.keys.lastLoad = time.Time{}
+	id, err := a.Authenticate(req)
+	require.NoError(t, err)
+	assert.Equal(t, "vk-node-1", id.Subject)
+	assert.NotContains(t, a.keys.keys, "rsa-1")
+}
+
+func TestKeySet_SingleReload(t *testing.T) {
+	keys := newTestKeys(t)
+	data, err := os.ReadFile(keys.writeJWKS(t, "-1"))
+	require.NoError(t, err)
+
+	var loads atomic.Int32
+	release := make(chan struct{})
+	ks := &keySet{description: "test", source: func(context.Context) ([]byte, error) {
+		loads.Add(1)
+		<-release
+		return data, nil
+	}}
+
+	// lookups of a known key do not wait for the reload in progress
+	ks.keys = map[string]crypto.PublicKey{"known": &keys.ec.PublicKey}
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := ks.lookup(context.Background(), "rsa-1")
+			assert.NoError(t, err)
+		}()
+	}
+	require.Eventually(t, func() bool { return loads.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+	_, err = ks.lookup(context.Background(), "known")
+	require.NoError(t, err)
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), loads.Load())
+}
+
+func TestParseJWKS_RejectsSmallRSAKeys(t *testing.T) {
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	data, err := json.Marshal(map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "small", "n": b64(small.N.Bytes()), "e": b64(big.NewInt(int64(small.E)).Bytes())},
+	}})
+	require.NoError(t, err)
+	_, err = parseJWKS(data)
+	assert.ErrorContains(t, err, "1024 bits")
+}
+
+func TestMiddleware(t *testing.T) {
+	keys := newTestKeys(t)
+	a := newTestAuthenticator(t, keys)
+
+	var seen Identity
+	handler := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = IdentityFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Header().Get("WWW-Authenticate"), "Bearer")
+
+	wrongGroup := validClaims()
+	wrongGroup["groups"] = []string{"users"}
+	req := httptest.NewRequest(http.MethodGet, "/status", nil)
+	req.Header.Set("Authorization", "Bearer "+keys.sign(t, "RS256", "rsa-1", wrongGroup))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/status", nil)
+	req.Header.Set("Authorization", "Bearer "+keys.sign(t, "RS256", "rsa-1", validClaims()))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "vk-node-1", seen.Subject)
+	assert.Equal(t, []string{"interlink-vk"}, seen.Groups)
+}
+
+func TestNewAuthenticator_Errors(t *testing.T) {
+	keys := newTestKeys(t)
+	jwks := keys.writeJWKS(t, "-1")
+
+	tests := []struct {
+		name   string
+		config types.AuthConfig
+	}{
+		{name: "nothing configured", config: types.AuthConfig{Enabled: true}},
+		{name: "JWT without audience", config: types.AuthConfig{Enabled: true, JWKSFile: jwks}},
+		{name: "missing tokens file", config: types.AuthConfig{Enabled: true, TokensFile: filepath.Join(t.TempDir(), "missing")}},
+		{name: "missing JWKS file", config: types.AuthConfig{Enabled: true, JWKSFile: filepath.Join(t.TempDir(), "missing"), Audiences: []string{"a"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewAuthenticator(context.Background(), tt.config)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestNewAuthenticator_OIDCDiscovery(t *testing.T) {
+	keys := newTestKeys(t)
+	jwks, err := os.ReadFile(keys.writeJWKS(t, "-1"))
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"issuer": server.URL, "jwks_uri": server.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write(jwks)
+	})
+
+	a, err := NewAuthenticator(context.Background(), types.AuthConfig{Enabled: true, Issuer: server.URL, Audiences: []string{testAudience}})
+	require.NoError(t, err)
+
+	claims := validClaims()
+	claims["iss"] = server.URL
+	req := httptest.NewRequest(http.MethodGet, "/status", nil)
+	req.Header.Set("Authorization", "Bearer "+keys.sign(t, "ES256", "ec-1", claims))
+	id, err := a.Authenticate(req)
+	require.NoError(t, err)
+	assert.Equal(t, MethodJWT, id.Method)
+}
@@ -0,0 +1,290 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/log"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+)
+
+// minRefreshInterval bounds how often the key set is reloaded when a JWT names an unknown key.
+var minRefreshInterval = 30 * time.Second
+
+// minRSAKeyBits is the smallest RSA modulus accepted for signing keys.
+const minRSAKeyBits = 2048
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// keySet holds the public keys of a JWKS. Keys are reloaded from their source when a
+// token names a key id that is not known yet, so that key rotation needs no restart.
+type keySet struct {
+	mu          sync.RWMutex
+	keys        map[string]crypto.PublicKey
+	source      func(ctx context.Context) ([]byte, error)
+	description string
+	lastLoad    time.Time
+	// loading is closed when the reload in progress ends, and is nil when there is none.
+	loading chan struct{}
+}
+
+func newKeySet(ctx context.Context, config types.AuthConfig) (*keySet, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	ks := &keySet{}
+
+	switch {
+	case config.JWKSFile != "":
+		path := config.JWKSFile
+		ks.description = path
+		ks.source = func(context.Context) ([]byte, error) {
+			return os.ReadFile(path)
+		}
+	case config.JWKSURL != "":
+		url := config.JWKSURL
+		ks.description = url
+		ks.source = func(ctx context.Context) ([]byte, error) {
+			return fetch(ctx, client, url)
+		}
+	default:
+		url, err := discoverJWKSURL(ctx, client, config.Issuer)
+		if err != nil {
+			return nil, err
+		}
+		ks.description = url
+		ks.source = func(ctx context.Context) ([]byte, error) {
+			return fetch(ctx, client, url)
+		}
+	}
+
+	keys, err := ks.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ks.keys = keys
+	ks.lastLoad = time.Now()
+	log.G(ctx).Infof("Loaded %d JWT verification keys from %s", len(ks.keys), ks.description)
+	return ks, nil
+}
+
+func fetch(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned %d", url, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// discoverJWKSURL reads the jwks_uri of the issuer from its OIDC discovery document.
+func discoverJWKSURL(ctx context.Context, client *http.Client, issuer string) (string, error) {
+	body, err := fetch(ctx, client, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration")
+	if err != nil {
+		return "", fmt.Errorf("unable to fetch the OIDC discovery document of %s: %w", issuer, err)
+	}
+	var discovery struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.Unmarshal(body, &discovery); err != nil || discovery.JWKSURI == "" {
+		return "", fmt.Errorf("OIDC discovery document of %s has no jwks_uri", issuer)
+	}
+	return discovery.JWKSURI, nil
+}
+
+// load reads and parses the current content of the source.
+func (ks *keySet) load(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	data, err := ks.source(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load JWKS from %s: %w", ks.description, err)
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse JWKS from %s: %w", ks.description, err)
+	}
+	return keys, nil
+}
+
+// lookup returns the key with the given id. An empty id is accepted only when the set holds a single key.
+func (ks *keySet) lookup(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	ks.mu.RLock()
+	key, ok := ks.find(kid)
+	ks.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	ks.refresh(ctx)
+	ks.mu.RLock()
+	key, ok = ks.find(kid)
+	ks.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown JWT key id %q", kid)
+}
+
+// refresh reloads the keys from the source, at most once per minRefreshInterval. The source
+// is read without holding mu, and concurrent callers wait for the reload in progress instead
+// of starting their own.
+func (ks *keySet) refresh(ctx context.Context) {
+	ks.mu.Lock()
+	if loading := ks.loading; loading != nil {
+		ks.mu.Unlock()
+		select {
+		case <-loading:
+		case <-ctx.Done():
+		}
+		return
+	}
+	if time.Since(ks.lastLoad) < minRefreshInterval {
+		ks.mu.Unlock()
+		return
+	}
+	ks.lastLoad = time.Now()
+	loading := make(chan struct{})
+	ks.loading = loading
+	ks.mu.Unlock()
+
+	// the reload is shared with the other callers: it does not end with this request
+	keys, err := ks.load(context.WithoutCancel(ctx))
+
+	ks.mu.Lock()
+	if err == nil {
+		ks.keys = keys
+	}
+	ks.loading = nil
+	ks.mu.Unlock()
+	close(loading)
+	if err != nil {
+		log.G(ctx).Error(err)
+	}
+}
+
+// find returns the key with the given id. Called with mu held.
+func (ks *keySet) find(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(ks.keys) == 1 {
+		for _, key := range ks.keys {
+			return key, true
+		}
+	}
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", jwk.Kid, err)
+		}
+		if key != nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no usable signing key")
+	}
+	return keys, nil
+}
+
+// publicKey decodes RSA and EC keys. Other key types are skipped by returning a nil key.
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		if n.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA key of %d bits is smaller than %d bits", n.BitLen(), minRSAKeyBits)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) > size || len(y) > size {
+			return nil, errors.New("invalid EC coordinates")
+		}
+		// ParseUncompressedPublicKey also checks that the point lies on the curve.
+		point := make([]byte, 1+2*size)
+		point[0] = 4
+		copy(point[1+size-len(x):1+size], x)
+		copy(point[1+2*size-len(y):], y)
+		return ecdsa.ParseUncompressedPublicKey(curve, point)
+	}
+	return nil, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// claims holds the decoded payload of a JWT.
+type claims map[string]any
+
+func (c claims) subject() string {
+	sub, _ := c["sub"].(string)
+	return sub
+}
+
+// stringList returns a claim that may be either a single string or a list of strings.
+func (c claims) stringList(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// numericDate returns a NumericDate claim (seconds since the epoch).
+func (c claims) numericDate(name string) (time.Time, bool) {
+	v, ok := c[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := v.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	sec := int64(f)
+	return time.Unix(sec, int64((f-float64(sec))*1e9)), true
+}
+
+var hashes = map[string]crypto.Hash{
+	"256": crypto.SHA256,
+	"384": crypto.SHA384,
+	"512": crypto.SHA512,
+}
+
+// verifyJWT checks the signature of a compact JWS and the registered claims of its payload.
+// Only asymmetric algorithms (RS*, PS*, ES*) are accepted: "none" and HMAC are always rejected.
+func (a *Authenticator) verifyJWT(ctx context.Context, token string) (claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed JWT")
+	}
+
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed JWT header: %w", err)
+	}
+	var header jwtHeader
+	if err := json.Unmarshal(headerBytes, &header); err != nil {
+		return nil, fmt.Errorf("malformed JWT header: %w", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed JWT signature: %w", err)
+	}
+
+	if len(header.Alg) != 5 {
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", header.Alg)
+	}
+	hash, ok := hashes[header.Alg[2:]]
+	if !ok || !slices.Contains([]string{"RS", "PS", "ES"}, header.Alg[:2]) {
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", header.Alg)
+	}
+	key, err := a.keys.lookup(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	hasher := hash.New()
+	hasher.Write([]byte(parts[0] + "." + parts[1]))
+	digest := hasher.Sum(nil)
+
+	switch header.Alg[:2] {
+	case "RS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("key %q is not an RSA key", header.Kid)
+		}
+		err = rsa.VerifyPKCS1v15(pub, hash, digest, signature)
+	case "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("key %q is not an RSA key", header.Kid)
+		}
+		err = rsa.VerifyPSS(pub, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("key %q is not an EC key", header.Kid)
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return nil, errors.New("invalid ECDSA signature length")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			err = errors.New("ECDSA verification failed")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", header.Alg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT signature: %w", err)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed JWT payload: %w", err)
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(payload)))
+	decoder.UseNumber()
+	var c claims
+	if err := decoder.Decode(&c); err != nil {
+		return nil, fmt.Errorf("malformed JWT payload: %w", err)
+	}
+
+	return c, a.validateClaims(c)
+}
+
+func (a *Authenticator) validateClaims(c claims) error {
+	now := a.now()
+
+	exp, ok := c.numericDate("exp")
+	if !ok {
+		return errors.New("JWT has no exp claim")
+	}
+	if now.After(exp.Add(a.clockSkew)) {
+		return errors.New("JWT is expired")
+	}
+	if nbf, ok := c.numericDate("nbf"); ok && now.Add(a.clockSkew).Before(nbf) {
+		return errors.New("JWT is not valid yet")
+	}
+
+	if a.config.Issuer != "" {
+		if iss, _ := c["iss"].(string); iss != a.config.Issuer {
+			return fmt.Errorf("unexpected JWT issuer %q", iss)
+		}
+	}
+
+	audiences := c.stringList("aud")
+	if !slices.ContainsFunc(audiences, func(aud string) bool {
+		return slices.Contains(a.config.Audiences, aud)
+	}) {
+		return fmt.Errorf("JWT audience %v is not accepted", audiences)
+	}
+	return nil
+}
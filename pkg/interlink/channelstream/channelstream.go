@@ -0,0 +1,202 @@
+// Package channelstream multiplexes the streams of an interactive session, such as the stdin,
+// stdout and stderr of kubectl exec, over the body of a single full-duplex HTTP request.
+//
+// Both directions are a sequence of frames, each made of a channel byte, a 4-byte big-endian
+// payload length and the payload. The client starts with a ChannelRequest frame describing the
+// session, then sends ChannelStdin and ChannelResize frames; the server sends ChannelStdout and
+// ChannelStderr frames and ends the session with a ChannelStatus frame. A ChannelClose frame,
+// whose payload is a channel byte, tells that the sender will not write to that channel again,
+// e.g. when stdin reaches EOF.
+//
+// The frames go through interLink unchanged, from the Virtual Kubelet to the plugin and back.
+package channelstream
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// ContentType identifies the channel streams, in the Content-Type header of the requests and
+// of the responses.
+const ContentType = "application/vnd.interlink.channel-stream"
+
+// Channels.
+const (
+	ChannelStdin  byte = 0
+	ChannelStdout byte = 1
+	ChannelStderr byte = 2
+	// ChannelResize carries a JSON-encoded TermSize
+	ChannelResize byte = 4
+	// ChannelRequest carries the JSON-encoded request opening the session
+	ChannelRequest byte = 'R'
+	// ChannelStatus carries the JSON-encoded Status ending the session
+	ChannelStatus byte = 'S'
+	// ChannelClose carries the channel the sender closed
+	ChannelClose byte = 'C'
+)
+
+const (
+	headerSize = 5
+	// MaxFrameSize bounds the payload of a frame. Larger writes are split.
+	MaxFrameSize = 1 << 20
+)
+
+// TermSize is the size of the terminal of a session with a TTY.
+type TermSize struct {
+	Width  uint16 `json:"width"`
+	Height uint16 `json:"height"`
+}
+
+// Status ends a session. Error is set when the command could not run; otherwise ExitCode is
+// the exit code of the command.
+type Status struct {
+	ExitCode int    `json:"exitCode"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Writer writes frames, and flushes each of them when the underlying writer is an
+// http.Flusher. It is safe for concurrent use, e.g. by the stdin and resize goroutines.
+type Writer struct {
+	mu    sync.Mutex
+	w     io.Writer
+	flush func()
+}
+
+// NewWriter returns a Writer framing its output to w.
+func NewWriter(w io.Writer) *Writer {
+	cw := &Writer{w: w, flush: func() {}}
+	if f, ok := w.(http.Flusher); ok {
+		cw.flush = f.Flush
+	}
+	return cw
+}
+
+// WriteFrame sends p on a channel, in several frames when p exceeds MaxFrameSize.
+func (cw *Writer) WriteFrame(channel byte, p []byte) error {
+	for {
+		n := min(len(p), MaxFrameSize)
+		if err := cw.frame(channel, p[:n]); err != nil {
+			return err
+		}
+		p = p[n:]
+		if len(p) == 0 {
+			return nil
+		}
+	}
+}
+
+// WriteJSON sends v JSON-encoded on a channel.
+func (cw *Writer) WriteJSON(channel byte, v any) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if len(payload) > MaxFrameSize {
+		return fmt.Errorf("channel stream message of %d bytes exceeds the maximum of %d", len(payload), MaxFrameSize)
+	}
+	return cw.frame(channel, payload)
+}
+
+// CloseChannel tells the peer that nothing more will be sent on a channel.
+func (cw *Writer) CloseChannel(channel byte) error {
+	return cw.frame(ChannelClose, []byte{channel})
+}
+
+// Channel returns an io.WriteCloser writing to a channel; Close sends a ChannelClose frame.
+func (cw *Writer) Channel(channel byte) io.WriteCloser {
+	return &channelWriter{w: cw, channel: channel}
+}
+
+func (cw *Writer) frame(channel byte, payload []byte) error {
+	var header [headerSize]byte
+	header[0] = channel
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload))) // #nosec G115 -- bounded by MaxFrameSize
+
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	if _, err := cw.w.Write(header[:]); err != nil {
+		return err
+	}
+	if len(payload) > 0 {
+		if _, err := cw.w.Write(payload); err != nil {
+			return err
+		}
+	}
+	cw.flush()
+	return nil
+}
+
+type channelWriter struct {
+	w       *Writer
+	channel byte
+}
+
+func (c *channelWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := c.w.WriteFrame(c.channel, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *channelWriter) Close() error {
+	return c.w.CloseChannel(c.channel)
+}
+
+// Reader reads frames.
+type Reader struct {
+	r io.Reader
+}
+
+// NewReader returns a Reader decoding the frames read from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r}
+}
+
+// Next returns the channel and the payload of the next frame. It returns io.EOF when the
+// stream ends between two frames, and io.ErrUnexpectedEOF when it ends within a frame.
+func (cr *Reader) Next() (byte, []byte, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(cr.r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > MaxFrameSize {
+		return 0, nil, fmt.Errorf("channel stream frame of %d bytes exceeds the maximum of %d", size, MaxFrameSize)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(cr.r, payload); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+	return header[0], payload, nil
+}
+
+// Relay copies the frames read from src to dst, up to the ChannelStatus frame ending the
+// session or the end of src. A src ending between two frames is not an error.
+func Relay(dst *Writer, src *Reader) error {
+	for {
+		channel, payload, err := src.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := dst.frame(channel, payload); err != nil {
+			return err
+		}
+		if channel == ChannelStatus {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package channelstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	require.NoError(t, w.WriteJSON(ChannelRequest, map[string]string{"cmd": "sh"}))
+	stdout := w.Channel(ChannelStdout)
+	_, err := stdout.Write([]byte("hello\n"))
+	require.NoError(t, err)
+	large := strings.Repeat("x", MaxFrameSize+10)
+	_, err = stdout.Write([]byte(large))
+	require.NoError(t, err)
+	require.NoError(t, stdout.Close())
+	require.NoError(t, w.WriteJSON(ChannelStatus, Status{ExitCode: 3}))
+
+	r := NewReader(&buf)
+	channel, payload, err := r.Next()
+	require.NoError(t, err)
+	assert.Equal(t, ChannelRequest, channel)
+	assert.JSONEq(t, `{"cmd":"sh"}`, string(payload))
+
+	var out []byte
+	for {
+		channel, payload, err = r.Next()
+		require.NoError(t, err)
+		if channel != ChannelStdout {
+			break
+		}
+		out = append(out, payload...)
+	}
+	assert.Equal(t, "hello\n"+large, string(out), "large writes are split")
+	assert.Equal(t, ChannelClose, channel)
+	assert.Equal(t, []byte{ChannelStdout}, payload)
+
+	channel, payload, err = r.Next()
+	require.NoError(t, err)
+	assert.Equal(t, ChannelStatus, channel)
+	var status Status
+	require.NoError(t, json.Unmarshal(payload, &status))
+	assert.Equal(t, 3, status.ExitCode)
+
+	_, _, err = r.Next()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestReaderErrors(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, NewWriter(&buf).WriteFrame(ChannelStdout, []byte("cut")))
+	_, _, err := NewReader(bytes.NewReader(buf.Bytes()[:buf.Len()-1])).Next()
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	_, _, err = NewReader(strings.NewReader("\x01\xff\xff\xff\xff")).Next()
+	assert.ErrorContains(t, err, "exceeds the maximum")
+}
+
+func TestRelay(t *testing.T) {
+	var src bytes.Buffer
+	w := NewWriter(&src)
+	require.NoError(t, w.WriteFrame(ChannelStderr, []byte("oops")))
+	require.NoError(t, w.WriteJSON(ChannelStatus, Status{Error: "not found"}))
+	require.NoError(t, w.WriteFrame(ChannelStdout, []byte("after the end")))
+
+	var dst bytes.Buffer
+	require.NoError(t, Relay(NewWriter(&dst), NewReader(&src)))
+	_, payload, err := NewReader(&src).Next()
+	require.NoError(t, err)
+	assert.Equal(t, "after the end", string(payload), "the relay stops at the status")
+
+	r := NewReader(&dst)
+	channel, payload, err := r.Next()
+	require.NoError(t, err)
+	assert.Equal(t, ChannelStderr, channel)
+	assert.Equal(t, "oops", string(payload))
+	channel, _, err = r.Next()
+	require.NoError(t, err)
+	assert.Equal(t, ChannelStatus, channel)
+
+	var cut bytes.Buffer
+	require.NoError(t, NewWriter(&cut).WriteFrame(ChannelStdin, []byte("in")))
+	err = Relay(NewWriter(io.Discard), NewReader(bytes.NewReader(cut.Bytes()[:3])))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,159 @@
+// Package compression implements the gzip and zstd compression of the bodies exchanged
+// between the Virtual Kubelet, interLink and the sidecar plugins.
+//
+// Compression is negotiated with the standard headers: clients list the encodings they
+// decode in Accept-Encoding, and servers advertise the encodings they accept for request
+// bodies with an Accept-Encoding response header (RFC 7694). A request body is compressed
+// only once the server has advertised support for it, so that peers unaware of compression
+// keep getting plain bodies.
+package compression
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// Gzip is the gzip content encoding
+	Gzip = "gzip"
+	// Zstd is the Zstandard content encoding
+	Zstd = "zstd"
+	// DefaultMinSizeBytes is the size from which bodies are compressed, when not configured
+	DefaultMinSizeBytes = 1024
+)
+
+// acceptEncoding lists the supported encodings, in order of preference.
+const acceptEncoding = Zstd + ", " + Gzip
+
+// Config configures the compression of the bodies sent by a component.
+// Compressed bodies are always decoded, whatever the config.
+type Config struct {
+	// Enabled allows compressing request and response bodies
+	Enabled bool `yaml:"Enabled"`
+	// Encoding is the preferred encoding, "zstd" (default) or "gzip". The other one is used
+	// when the peer only accepts it.
+	Encoding string `yaml:"Encoding,omitempty"`
+	// MinSizeBytes is the size from which bodies are compressed (default: 1024)
+	MinSizeBytes int `yaml:"MinSizeBytes,omitempty"`
+}
+
+// Validate checks the configured encoding.
+func (c Config) Validate() error {
+	switch c.Encoding {
+	case "", Zstd, Gzip:
+		return nil
+	default:
+		return fmt.Errorf("unsupported compression encoding %q, expected %q or %q", c.Encoding, Zstd, Gzip)
+	}
+}
+
+func (c Config) minSize() int {
+	if c.MinSizeBytes > 0 {
+		return c.MinSizeBytes
+	}
+	return DefaultMinSizeBytes
+}
+
+// choose returns the encoding to use with a peer accepting the given encodings, or "" when
+// the peer accepts none of the supported ones.
+func (c Config) choose(accepted map[string]bool) string {
+	preferred := c.Encoding
+	if preferred == "" {
+		preferred = Zstd
+	}
+	if accepted[preferred] {
+		return preferred
+	}
+	for _, encoding := range []string{Zstd, Gzip} {
+		if accepted[encoding] {
+			return encoding
+		}
+	}
+	return ""
+}
+
+// parseAccept returns the supported encodings listed in an Accept-Encoding header,
+// leaving out the ones refused with q=0.
+func parseAccept(header string) map[string]bool {
+	accepted := map[string]bool{}
+	for _, item := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != Zstd && name != Gzip {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok && strings.Trim(q, "0.") == "" {
+			continue
+		}
+		accepted[name] = true
+	}
+	return accepted
+}
+
+// isEncoded tells whether a Content-Encoding header value requires decoding.
+func isEncoded(contentEncoding string) bool {
+	return contentEncoding != "" && !strings.EqualFold(contentEncoding, "identity")
+}
+
+// newWriter returns a writer compressing to w with the given encoding.
+func newWriter(encoding string, w io.Writer) (io.WriteCloser, error) {
+	switch encoding {
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Zstd:
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+}
+
+// NewReader returns a reader decompressing r, encoded with the given Content-Encoding.
+func NewReader(encoding string, r io.Reader) (io.ReadCloser, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case Gzip:
+		return gzip.NewReader(r)
+	case Zstd:
+		decoder, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+}
+
+// Encode compresses data with the given encoding.
+func Encode(encoding string, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := newWriter(encoding, &buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readCloser closes both the decompressor and the compressed body.
+type readCloser struct {
+	io.ReadCloser
+	body io.Closer
+}
+
+func (rc readCloser) Close() error {
+	err := rc.ReadCloser.Close()
+	if bodyErr := rc.body.Close(); err == nil {
+		err = bodyErr
+	}
+	return err
+}
@@ -0,0 +1,183 @@
+package compression
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var largeBody = strings.Repeat(`{"name":"interlink"}`, 200)
+
+func TestParseAcceptAndChoose(t *testing.T) {
+	assert.Equal(t, map[string]bool{Zstd: true, Gzip: true}, parseAccept("zstd, GZIP;q=0.5, br"))
+	assert.Equal(t, map[string]bool{Zstd: true}, parseAccept("zstd, gzip;q=0"))
+	assert.Empty(t, parseAccept(""))
+
+	config := Config{}
+	assert.Equal(t, Zstd, config.choose(map[string]bool{Zstd: true, Gzip: true}))
+	assert.Equal(t, Gzip, config.choose(map[string]bool{Gzip: true}))
+	assert.Equal(t, Gzip, Config{Encoding: Gzip}.choose(map[string]bool{Zstd: true, Gzip: true}))
+	assert.Equal(t, "", config.choose(nil))
+
+	require.NoError(t, Config{Encoding: Gzip}.Validate())
+	require.Error(t, Config{Encoding: "br"}.Validate())
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	for _, encoding := range []string{Gzip, Zstd} {
+		encoded, err := Encode(encoding, []byte(largeBody))
+		require.NoError(t, err)
+		assert.Less(t, len(encoded), len(largeBody), encoding)
+
+		r, err := NewReader(encoding, bytes.NewReader(encoded))
+		require.NoError(t, err)
+		decoded, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		assert.Equal(t, largeBody, string(decoded), encoding)
+	}
+}
+
+// echoHandler answers with the (decoded) request body, flushing first when asked.
+func echoHandler(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Has("flush") {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+		}
+		_, _ = w.Write(body)
+	})
+}
+
+func serve(handler http.Handler, target, body string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddleware(t *testing.T) {
+	handler := Middleware(Config{Enabled: true}, echoHandler(t))
+
+	t.Run("compresses large responses", func(t *testing.T) {
+		rec := serve(handler, "/status", largeBody, map[string]string{"Accept-Encoding": "gzip"})
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, Gzip, rec.Header().Get("Content-Encoding"))
+		assert.Equal(t, acceptEncoding, rec.Header().Get("Accept-Encoding"))
+		r, err := NewReader(Gzip, rec.Body)
+		require.NoError(t, err)
+		decoded, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, largeBody, string(decoded))
+	})
+
+	t.Run("keeps small responses plain", func(t *testing.T) {
+		rec := serve(handler, "/status", "[]", map[string]string{"Accept-Encoding": "zstd"})
+		assert.Empty(t, rec.Header().Get("Content-Encoding"))
+		assert.Equal(t, "[]", rec.Body.String())
+	})
+
+	t.Run("streams flushed responses plain", func(t *testing.T) {
+		rec := serve(handler, "/getLogs?flush", largeBody, map[string]string{"Accept-Encoding": "zstd"})
+		assert.Empty(t, rec.Header().Get("Content-Encoding"))
+		assert.Equal(t, largeBody, rec.Body.String())
+	})
+
+	t.Run("decodes request bodies", func(t *testing.T) {
+		encoded, err := Encode(Zstd, []byte(largeBody))
+		require.NoError(t, err)
+		rec := serve(handler, "/create", string(encoded), map[string]string{"Content-Encoding": Zstd})
+		assert.Equal(t, largeBody, rec.Body.String())
+	})
+
+	t.Run("rejects unknown encodings", func(t *testing.T) {
+		rec := serve(handler, "/create", largeBody, map[string]string{"Content-Encoding": "br"})
+		assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+		assert.Equal(t, acceptEncoding, rec.Header().Get("Accept-Encoding"))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		rec := serve(Middleware(Config{}, echoHandler(t)), "/status", largeBody, map[string]string{"Accept-Encoding": "zstd"})
+		assert.Empty(t, rec.Header().Get("Content-Encoding"))
+		assert.Empty(t, rec.Header().Get("Accept-Encoding"), "a disabled server must not ask for compressed bodies")
+		assert.Equal(t, largeBody, rec.Body.String())
+	})
+}
+
+func TestTransport(t *testing.T) {
+	var encodings []string
+	record := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encodings = append(encodings, r.Header.Get("Content-Encoding"))
+			next.ServeHTTP(w, r)
+		})
+	}
+	post := func(t *testing.T, client *http.Client, url, body string) string {
+		t.Helper()
+		resp, err := client.Post(url, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		out, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Empty(t, resp.Header.Get("Content-Encoding"))
+		return string(out)
+	}
+
+	t.Run("compresses once the server advertised support", func(t *testing.T) {
+		encodings = nil
+		server := httptest.NewServer(record(Middleware(Config{Enabled: true}, echoHandler(t))))
+		defer server.Close()
+		client := &http.Client{Transport: NewTransport(nil, Config{Enabled: true}, nil)}
+
+		assert.Equal(t, largeBody, post(t, client, server.URL, largeBody))
+		assert.Equal(t, largeBody, post(t, client, server.URL, largeBody))
+		assert.Equal(t, "[]", post(t, client, server.URL, "[]"))
+		assert.Equal(t, []string{"", Zstd, ""}, encodings)
+	})
+
+	t.Run("plugins without support get plain bodies", func(t *testing.T) {
+		encodings = nil
+		server := httptest.NewServer(record(echoHandler(t)))
+		defer server.Close()
+		client := &http.Client{Transport: NewTransport(nil, Config{Enabled: true}, nil)}
+
+		post(t, client, server.URL, largeBody)
+		post(t, client, server.URL, largeBody)
+		assert.Equal(t, []string{"", ""}, encodings)
+	})
+
+	t.Run("streamed bodies are sent as they come", func(t *testing.T) {
+		encodings = nil
+		server := httptest.NewServer(record(Middleware(Config{Enabled: true}, echoHandler(t))))
+		defer server.Close()
+		client := &http.Client{Transport: NewTransport(nil, Config{Enabled: true}, nil)}
+		post(t, client, server.URL, largeBody)
+
+		body, pipe := io.Pipe()
+		go func() {
+			_, _ = pipe.Write([]byte(largeBody))
+			pipe.Close()
+		}()
+		req, err := http.NewRequest(http.MethodPost, server.URL, body)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		out, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, largeBody, string(out))
+		assert.Equal(t, []string{"", ""}, encodings)
+	})
+}
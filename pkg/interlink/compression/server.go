@@ -0,0 +1,149 @@
+package compression
+
+import (
+	"io"
+	"net/http"
+)
+
+// Middleware decodes the compressed request bodies and, when compression is enabled,
+// advertises the accepted encodings and compresses the responses of at least
+// config.MinSizeBytes for the clients accepting it. Responses flushed before reaching
+// the threshold, such as streamed logs, are sent uncompressed.
+func Middleware(config Config, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contentEncoding := r.Header.Get("Content-Encoding"); isEncoded(contentEncoding) {
+			body, err := NewReader(contentEncoding, r.Body)
+			if err != nil {
+				w.Header().Set("Accept-Encoding", acceptEncoding)
+				http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+				return
+			}
+			r.Body = readCloser{ReadCloser: body, body: r.Body}
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+		}
+
+		if !config.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Accept-Encoding", acceptEncoding)
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := config.choose(parseAccept(r.Header.Get("Accept-Encoding")))
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: config.minSize()}
+		defer cw.finish()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressWriter holds the response until it reaches minSize, then compresses it.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding  string
+	minSize   int
+	status    int
+	buf       []byte
+	committed bool
+	encoder   io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.committed || cw.status != 0 {
+		return
+	}
+	cw.status = code
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.committed {
+		if cw.encoder != nil {
+			return cw.encoder.Write(p)
+		}
+		return cw.ResponseWriter.Write(p)
+	}
+
+	cw.buf = append(cw.buf, p...)
+	if len(cw.buf) >= cw.minSize {
+		if err := cw.commit(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// commit writes the status and the buffered body, compressed or not.
+func (cw *compressWriter) commit(compress bool) error {
+	cw.committed = true
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	header := cw.Header()
+	bodyAllowed := cw.status >= http.StatusOK && cw.status != http.StatusNoContent && cw.status != http.StatusNotModified
+	if compress && bodyAllowed && header.Get("Content-Encoding") == "" {
+		encoder, err := newWriter(cw.encoding, cw.ResponseWriter)
+		if err != nil {
+			return err
+		}
+		cw.encoder = encoder
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if cw.encoder != nil {
+		_, err := cw.encoder.Write(buf)
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+// Flush sends what was written so far. A response flushed before reaching the threshold
+// is streamed uncompressed.
+func (cw *compressWriter) Flush() {
+	if !cw.committed {
+		if err := cw.commit(false); err != nil {
+			return
+		}
+	}
+	if f, ok := cw.encoder.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return
+		}
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *compressWriter) finish() {
+	if !cw.committed {
+		if cw.status == 0 && len(cw.buf) == 0 {
+			return
+		}
+		if err := cw.commit(false); err != nil {
+			return
+		}
+	}
+	if cw.encoder != nil {
+		_ = cw.encoder.Close()
+	}
+}
@@ -0,0 +1,98 @@
+package compression
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Peer records the encodings a server accepts for request bodies, as advertised by the
+// Accept-Encoding header of its last response. It may be shared by the clients of a server.
+type Peer struct {
+	mu       sync.RWMutex
+	accepted map[string]bool
+}
+
+func (p *Peer) observe(header http.Header) {
+	accepted := parseAccept(header.Get("Accept-Encoding"))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.accepted = accepted
+}
+
+func (p *Peer) acceptedEncodings() map[string]bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.accepted
+}
+
+// Transport compresses the request bodies of at least config.MinSizeBytes sent to a
+// server that advertised support for it, and decodes the compressed responses. Streamed
+// bodies, which cannot be replayed (GetBody is nil), are sent as they are: compressing them
+// would wait for their end, which for an interactive session never comes before the response.
+type Transport struct {
+	next   http.RoundTripper
+	config Config
+	peer   *Peer
+}
+
+// NewTransport wraps next (http.DefaultTransport when nil). The encodings accepted by the
+// server are recorded in peer, or in a peer owned by the transport when nil.
+func NewTransport(next http.RoundTripper, config Config, peer *Peer) *Transport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if peer == nil {
+		peer = &Peer{}
+	}
+	return &Transport{next: next, config: config, peer: peer}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	out := req.Clone(req.Context())
+
+	decode := req.Header.Get("Accept-Encoding") == ""
+	if decode {
+		out.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+
+	if t.config.Enabled && req.Body != nil && req.Body != http.NoBody && req.GetBody != nil && !isEncoded(req.Header.Get("Content-Encoding")) {
+		if encoding := t.config.choose(t.peer.acceptedEncodings()); encoding != "" {
+			body, err := io.ReadAll(req.Body)
+			req.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			if len(body) >= t.config.minSize() {
+				if body, err = Encode(encoding, body); err != nil {
+					return nil, err
+				}
+				out.Header.Set("Content-Encoding", encoding)
+			}
+			out.Body = io.NopCloser(bytes.NewReader(body))
+			out.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+			out.ContentLength = int64(len(body))
+		}
+	}
+
+	resp, err := t.next.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	t.peer.observe(resp.Header)
+
+	if contentEncoding := resp.Header.Get("Content-Encoding"); decode && isEncoded(contentEncoding) {
+		body, err := NewReader(contentEncoding, resp.Body)
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		resp.Body = readCloser{ReadCloser: body, body: resp.Body}
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+	}
+	return resp, nil
+}
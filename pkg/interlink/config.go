@@ -26,6 +26,8 @@ import (
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"gopkg.in/yaml.v2"
+
+	"github.com/interlink-hq/interlink/pkg/interlink/compression"
 )
 
 // VolumesOptions configures volume management for container runtimes like Apptainer.
@@ -104,10 +106,22 @@ type Config struct {
 	Sidecarurl string `yaml:"SidecarURL"`
 	// Sidecarport is the port of the sidecar plugin (for http)
 	Sidecarport string `yaml:"SidecarPort"`
+	// Sidecars lists named sidecar plugins served by this interLink instance (optional).
+	// When empty, Sidecarurl and Sidecarport describe the only plugin.
+	Sidecars []SidecarConfig `yaml:"Sidecars,omitempty"`
+	// Routing holds the rules selecting the sidecar of each pod, evaluated in order (optional)
+	Routing []RoutingRule `yaml:"Routing,omitempty"`
+	// DefaultSidecar is the sidecar receiving pods matched by no rule (default: first of Sidecars)
+	DefaultSidecar string `yaml:"DefaultSidecar,omitempty"`
 	// JobScriptBuildConfig contains configuration for building job scripts (optional)
 	JobScriptBuildConfig *ScriptBuildConfig `yaml:"JobScriptBuildConfig,omitempty"`
+	// JobScriptBuilder configures the client of the external job script builder (optional)
+	JobScriptBuilder JobScriptBuilderConfig `yaml:"JobScriptBuilder,omitempty"`
 	// JobScriptTemplate is the path to a local job script template file (optional)
 	JobScriptTemplate string `yaml:"JobScriptTemplate,omitempty"`
+	// JobScriptTemplateDir is a directory of named job script templates (*.tmpl), selected
+	// by pods with the interlink.eu/job-script-template annotation (optional)
+	JobScriptTemplateDir string `yaml:"JobScriptTemplateDir,omitempty"`
 	// VerboseLogging enables debug-level logging
 	VerboseLogging bool `yaml:"VerboseLogging"`
 	// ErrorsOnlyLogging restricts logging to errors only
@@ -118,6 +132,227 @@ type Config struct {
 	TLS TLSConfig `yaml:"TLS,omitempty"`
 	// Pprof contains configuration for the pprof profiling server
 	Pprof PprofConfig `yaml:"Pprof,omitempty"`
+	// StatusStore selects where the pod status cache is kept across restarts
+	StatusStore StatusStoreConfig `yaml:"StatusStore,omitempty"`
+	// Auth configures authentication of the calls to the interLink API
+	Auth AuthConfig `yaml:"Auth,omitempty"`
+	// Watch configures the /watch pod status stream
+	Watch WatchConfig `yaml:"Watch,omitempty"`
+	// Logs configures the follow-mode log streams of /getLogs
+	Logs LogsConfig `yaml:"Logs,omitempty"`
+	// LogArchive keeps the logs of the completed pods once the sidecars cleaned them up
+	LogArchive LogArchiveConfig `yaml:"LogArchive,omitempty"`
+	// SidecarRetry configures retries and circuit breaking of the calls to the sidecars
+	SidecarRetry SidecarRetryConfig `yaml:"SidecarRetry,omitempty"`
+	// Metrics configures the Prometheus /metrics endpoint
+	Metrics MetricsConfig `yaml:"Metrics,omitempty"`
+	// Compression configures the gzip/zstd compression of the API and sidecar bodies
+	Compression compression.Config `yaml:"Compression,omitempty"`
+	// Audit configures the audit log of the API calls
+	Audit AuditConfig `yaml:"Audit,omitempty"`
+	// Admission configures the fair-share admission queue of the pod creations. It is reloaded on SIGHUP
+	Admission AdmissionConfig `yaml:"Admission,omitempty"`
+	// SecretEncryption configures the envelope encryption of the Secret data sent to the sidecars
+	SecretEncryption SecretEncryptionConfig `yaml:"SecretEncryption,omitempty"`
+	// ShutdownTimeoutSeconds is how long in-flight requests are drained on SIGTERM/SIGINT (default: 30)
+	ShutdownTimeoutSeconds int `yaml:"ShutdownTimeoutSeconds,omitempty"`
+	// ConfigPath is the file the configuration was loaded from
+	ConfigPath string `yaml:"-"`
+}
+
+// JobScriptBuilderConfig configures the client of the external job script builder, called
+// when the Virtual Kubelet asks for a JobScriptBuilderURL. Failed calls are retried with an
+// exponential backoff, building a job script having no side effect.
+type JobScriptBuilderConfig struct {
+	// CACertFile is the CA certificate verifying the builder (default: system roots)
+	CACertFile string `yaml:"CACertFile,omitempty"`
+	// CertFile and KeyFile are the client certificate presented to the builder (optional)
+	CertFile string `yaml:"CertFile,omitempty"`
+	KeyFile  string `yaml:"KeyFile,omitempty"`
+	// BearerTokenFile holds the token sent in the Authorization header. It is read at every
+	// call, so that the token can be rotated (optional)
+	BearerTokenFile string `yaml:"BearerTokenFile,omitempty"`
+	// TimeoutSeconds bounds each attempt (default: 30)
+	TimeoutSeconds int `yaml:"TimeoutSeconds,omitempty"`
+	// MaxAttempts is the number of attempts, the first one included (default: 3). Set it to 1 to disable retries.
+	MaxAttempts int `yaml:"MaxAttempts,omitempty"`
+	// InitialBackoffMilliseconds is the delay before the first retry, doubled at every retry (default: 200)
+	InitialBackoffMilliseconds int `yaml:"InitialBackoffMilliseconds,omitempty"`
+	// MaxBackoffMilliseconds caps the delay between two retries (default: 5000)
+	MaxBackoffMilliseconds int `yaml:"MaxBackoffMilliseconds,omitempty"`
+}
+
+// AuditConfig configures the audit log, a JSON line per call to the interLink API with the
+// caller, the pods concerned and the result. Files are rotated when they reach MaxSizeMB.
+type AuditConfig struct {
+	// Enabled writes an audit record for every API call
+	Enabled bool `yaml:"Enabled"`
+	// Path is the audit log file (default: <DataRootFolder>/audit/audit.log)
+	Path string `yaml:"Path,omitempty"`
+	// MaxSizeMB is the size from which the file is rotated (default: 100)
+	MaxSizeMB int `yaml:"MaxSizeMB,omitempty"`
+	// MaxBackups is the number of rotated files kept (default: 5)
+	MaxBackups int `yaml:"MaxBackups,omitempty"`
+}
+
+// AdmissionConfig configures the admission queue of the pod creations. The creates forwarded
+// to the sidecars at the same time are limited, in total and per tenant. Pods over the limits
+// wait in interLink, and the tenants are served in weighted fair order as slots free up.
+// A limit of 0 means no limit.
+type AdmissionConfig struct {
+	// Enabled queues the creates over the limits instead of forwarding them at once
+	Enabled bool `yaml:"Enabled"`
+	// MaxConcurrentCreates caps the creates in flight to the sidecars, all tenants included
+	MaxConcurrentCreates int `yaml:"MaxConcurrentCreates,omitempty"`
+	// TenantMaxConcurrentCreates caps the creates in flight of each tenant not listed in Tenants
+	TenantMaxConcurrentCreates int `yaml:"TenantMaxConcurrentCreates,omitempty"`
+	// TenantLabel is the pod label naming the tenant of a pod (default: the pod namespace is the tenant)
+	TenantLabel string `yaml:"TenantLabel,omitempty"`
+	// Tenants overrides the limit and the weight of some tenants
+	Tenants []TenantConfig `yaml:"Tenants,omitempty"`
+}
+
+// TenantConfig sets the share of the sidecar capacity of a tenant.
+type TenantConfig struct {
+	// Name is the tenant, i.e. the namespace or the value of the TenantLabel pod label
+	Name string `yaml:"Name"`
+	// MaxConcurrentCreates caps the creates in flight of the tenant (default: TenantMaxConcurrentCreates)
+	MaxConcurrentCreates int `yaml:"MaxConcurrentCreates,omitempty"`
+	// Weight is the share of the freed slots the tenant gets when several tenants wait (default: 1)
+	Weight int `yaml:"Weight,omitempty"`
+}
+
+// SecretEncryptionConfig configures the envelope encryption of the Secret data sent to the
+// sidecar plugins. Each plugin holds the X25519 private key matching the public key
+// configured for it, and is the only one able to read the values of the Secrets.
+type SecretEncryptionConfig struct {
+	// Enabled encrypts the Secret data of every /create call sent to the sidecars
+	Enabled bool `yaml:"Enabled"`
+	// PublicKeyFile is the PEM X25519 public key of the plugins without a SecretPublicKeyFile of their own
+	PublicKeyFile string `yaml:"PublicKeyFile,omitempty"`
+}
+
+// MetricsConfig holds configuration for the Prometheus /metrics endpoint.
+// Without Port the metrics are served by the API server itself.
+type MetricsConfig struct {
+	// Enabled indicates whether the /metrics endpoint is served
+	Enabled bool `yaml:"Enabled"`
+	// Address is the listen address of the separate metrics server (default: 127.0.0.1)
+	Address string `yaml:"Address,omitempty"`
+	// Port is the listen port of the separate metrics server (default: served on the API server)
+	Port string `yaml:"Port,omitempty"`
+}
+
+// SidecarRetryConfig configures how interLink copes with sidecar plugins that are temporarily
+// unreachable. Idempotent calls (status, logs, ping) are retried with exponential backoff and
+// jitter, and every sidecar has a circuit breaker that fails calls fast while the plugin is down.
+type SidecarRetryConfig struct {
+	// MaxAttempts is the number of attempts of an idempotent call, the first one included (default: 3).
+	// Set it to 1 to disable retries.
+	MaxAttempts int `yaml:"MaxAttempts,omitempty"`
+	// InitialBackoffMilliseconds is the delay before the first retry, doubled at every retry (default: 200)
+	InitialBackoffMilliseconds int `yaml:"InitialBackoffMilliseconds,omitempty"`
+	// MaxBackoffMilliseconds caps the delay between two retries (default: 5000)
+	MaxBackoffMilliseconds int `yaml:"MaxBackoffMilliseconds,omitempty"`
+	// CircuitFailureThreshold is the number of consecutive failures opening the circuit (default: 5).
+	// A negative value disables the circuit breaker.
+	CircuitFailureThreshold int `yaml:"CircuitFailureThreshold,omitempty"`
+	// CircuitOpenSeconds is how long an open circuit fails calls before letting a probe through (default: 30)
+	CircuitOpenSeconds int `yaml:"CircuitOpenSeconds,omitempty"`
+}
+
+// WatchConfig configures the /watch endpoint streaming pod status changes.
+// While at least one client is watching, interLink refreshes the status of
+// the pods it knows about from the sidecars on its own.
+type WatchConfig struct {
+	// RefreshIntervalSeconds is the interval between two status refreshes from the sidecars (default: 5)
+	RefreshIntervalSeconds int `yaml:"RefreshIntervalSeconds,omitempty"`
+	// HeartbeatIntervalSeconds is the interval between two keep-alive comments on idle streams (default: 15)
+	HeartbeatIntervalSeconds int `yaml:"HeartbeatIntervalSeconds,omitempty"`
+}
+
+// LogsConfig configures the follow-mode log streams (kubectl logs -f). Streams are framed
+// for the Virtual Kubelets that support it, so that heartbeats keep idle streams open.
+type LogsConfig struct {
+	// FollowHeartbeatSeconds is the interval between two heartbeat frames on idle streams (default: 15)
+	FollowHeartbeatSeconds int `yaml:"FollowHeartbeatSeconds,omitempty"`
+	// MaxFollowSeconds ends the streams followed for longer (default: 86400, one day).
+	// A negative value lets streams run until the client disconnects.
+	MaxFollowSeconds int `yaml:"MaxFollowSeconds,omitempty"`
+}
+
+// LogArchiveConfig configures the archive of the logs of the completed pods. When a pod
+// reaches a terminal state, the logs of its containers are fetched from the sidecar and kept
+// compressed, and /getLogs serves them once the sidecar no longer has them.
+type LogArchiveConfig struct {
+	// Enabled archives the logs of the pods reaching a terminal state
+	Enabled bool `yaml:"Enabled"`
+	// Path is the archive directory (default: <DataRootFolder>/log-archive)
+	Path string `yaml:"Path,omitempty"`
+	// RetentionHours is how long the logs of a pod are kept (default: 168, one week)
+	RetentionHours int `yaml:"RetentionHours,omitempty"`
+	// MaxSizeMB caps the size of the archive, the oldest pods being removed first (default: 1024)
+	MaxSizeMB int `yaml:"MaxSizeMB,omitempty"`
+}
+
+// AuthConfig configures bearer-token authentication of the interLink API.
+// Callers are accepted when they present one of the static tokens or a JWT
+// signed by a key of the configured JSON Web Key Set.
+type AuthConfig struct {
+	// Enabled requires every API call to carry a valid "Authorization: Bearer" header
+	Enabled bool `yaml:"Enabled"`
+	// TokensFile is a file of static bearer tokens, one per line, optionally followed by a caller name (optional)
+	TokensFile string `yaml:"TokensFile,omitempty"`
+	// Issuer is the expected iss claim of JWTs. Its OIDC discovery document is used
+	// to find the JWKS when neither JWKSFile nor JWKSURL is set
+	Issuer string `yaml:"Issuer,omitempty"`
+	// JWKSFile is a local JSON Web Key Set used to verify JWT signatures (optional)
+	JWKSFile string `yaml:"JWKSFile,omitempty"`
+	// JWKSURL is the URL of the JSON Web Key Set used to verify JWT signatures (optional)
+	JWKSURL string `yaml:"JWKSURL,omitempty"`
+	// Audiences lists the accepted aud claims: a JWT must carry at least one of them
+	Audiences []string `yaml:"Audiences,omitempty"`
+	// GroupsClaim is the JWT claim holding the caller groups (default: "groups")
+	GroupsClaim string `yaml:"GroupsClaim,omitempty"`
+	// AllowedGroups restricts access to JWTs carrying at least one of these groups (optional)
+	AllowedGroups []string `yaml:"AllowedGroups,omitempty"`
+	// ClockSkewSeconds is the tolerance applied to the exp and nbf claims (default: 60)
+	ClockSkewSeconds int `yaml:"ClockSkewSeconds,omitempty"`
+}
+
+// StatusStoreConfig selects the backend holding the pod status cache.
+// The in-memory backend is lost on restart; the file backend keeps a
+// write-ahead log under DataRootFolder that is replayed at startup.
+type StatusStoreConfig struct {
+	// Backend is either "memory" (default) or "file"
+	Backend string `yaml:"Backend,omitempty"`
+	// Path is the directory of the file backend (default: <DataRootFolder>/status-store)
+	Path string `yaml:"Path,omitempty"`
+	// CompactionThreshold is the number of log records after which the log is folded into a snapshot (default: 10000)
+	CompactionThreshold int `yaml:"CompactionThreshold,omitempty"`
+}
+
+// SidecarConfig describes a named sidecar plugin.
+type SidecarConfig struct {
+	// Name identifies the plugin in routing rules and in the interlink.eu/plugin pod annotation
+	Name string `yaml:"Name"`
+	// URL of the sidecar plugin. Supports unix:// and http:// schemes
+	URL string `yaml:"URL"`
+	// Port of the sidecar plugin (for http)
+	Port string `yaml:"Port,omitempty"`
+	// SecretPublicKeyFile is the PEM X25519 public key of this plugin, overriding SecretEncryption.PublicKeyFile
+	SecretPublicKeyFile string `yaml:"SecretPublicKeyFile,omitempty"`
+}
+
+// RoutingRule sends the pods it matches to the named sidecar.
+// A rule matches a pod when every criterion it sets is satisfied.
+type RoutingRule struct {
+	// Sidecar is the name of the target sidecar
+	Sidecar string `yaml:"Sidecar"`
+	// Namespaces matches pods in any of the listed namespaces
+	Namespaces []string `yaml:"Namespaces,omitempty"`
+	// Labels matches pods carrying all the listed labels
+	Labels map[string]string `yaml:"Labels,omitempty"`
 }
 
 // PprofConfig holds configuration for the pprof profiling server.
@@ -354,20 +589,12 @@ func NewInterLinkConfig() (Config, error) {
 	}
 
 	log.G(context.Background()).Info("Loading InterLink config from " + path)
-	// Path traversal protection
-	if !filepath.IsAbs(path) || strings.Contains(path, "..") {
-		return Config{}, fmt.Errorf("invalid config file path")
-	}
-	yfile, err := os.ReadFile(path) // #nosec G703
+	err := readConfigFile(path, &interLinkNewConfig)
 	if err != nil {
 		log.G(context.Background()).Error("Error opening config file, exiting...")
 		return Config{}, err
 	}
-
-	err = yaml.Unmarshal(yfile, &interLinkNewConfig)
-	if err != nil {
-		return Config{}, err
-	}
+	interLinkNewConfig.ConfigPath = path
 
 	if os.Getenv("INTERLINKURL") != "" {
 		interLinkNewConfig.InterlinkAddress = os.Getenv("INTERLINKURL")
@@ -399,3 +626,27 @@ func NewInterLinkConfig() (Config, error) {
 
 	return interLinkNewConfig, nil
 }
+
+// LoadConfigFile reads the interLink configuration from a YAML file, without the command
+// line flags and the environment variable overrides. It is used to reload the settings that
+// can change without a restart.
+func LoadConfigFile(path string) (Config, error) {
+	config := Config{}
+	if err := readConfigFile(path, &config); err != nil {
+		return Config{}, err
+	}
+	config.ConfigPath = path
+	return config, nil
+}
+
+func readConfigFile(path string, config *Config) error {
+	// Path traversal protection
+	if !filepath.IsAbs(path) || strings.Contains(path, "..") {
+		return fmt.Errorf("invalid config file path")
+	}
+	yfile, err := os.ReadFile(path) // #nosec G703
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(yfile, config)
+}
@@ -304,3 +304,32 @@ func TestTLSConfig_Validation(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "InterLinkConfig.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+InterlinkAddress: "http://0.0.0.0"
+Admission:
+  Enabled: true
+  MaxConcurrentCreates: 20
+  TenantMaxConcurrentCreates: 5
+  Tenants:
+    - Name: "batch"
+      Weight: 3
+`), 0o600))
+
+	config, err := LoadConfigFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, path, config.ConfigPath)
+	assert.Equal(t, AdmissionConfig{
+		Enabled:                    true,
+		MaxConcurrentCreates:       20,
+		TenantMaxConcurrentCreates: 5,
+		Tenants:                    []TenantConfig{{Name: "batch", Weight: 3}},
+	}, config.Admission)
+
+	_, err = LoadConfigFile("relative/InterLinkConfig.yaml")
+	require.Error(t, err)
+	_, err = LoadConfigFile(filepath.Join(t.TempDir(), "missing.yaml"))
+	require.Error(t, err)
+}
@@ -0,0 +1,490 @@
+// Package envelope implements the envelope encryption of the Secret data that interLink
+// sends to the sidecar plugins: the Secrets, and the projected volumes holding service
+// account tokens and Secret values.
+//
+// Every Secret is encrypted with a fresh AES-256-GCM data key. The data key is wrapped
+// for the plugin with an ephemeral X25519 key agreement: the shared secret is expanded
+// with HKDF-SHA256 into the AES-256-GCM key sealing the data key. The wrapped data key
+// travels in the annotations of the Secret, next to the values it protects, so that the
+// Secret keeps its shape on the wire and only the holder of the plugin private key can
+// read its values.
+//
+// Projected volumes travel as ConfigMaps, sealed the same way by SealConfigMap.
+//
+// Plugins written in Go decrypt the Secrets and projected volumes they receive with OpenPodData:
+//
+//	key, err := envelope.LoadPrivateKey("/etc/interlink/plugin-key.pem")
+//	...
+//	if err := envelope.OpenPodData(key, &data); err != nil { ... }
+//
+// Keys are X25519 keys in PEM form, as generated by "openssl genpkey -algorithm X25519".
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+)
+
+const (
+	// Algorithm identifies the encryption scheme of a sealed Secret
+	Algorithm = "X25519-HKDF-SHA256-A256GCM"
+	// AlgorithmAnnotation marks a sealed Secret and holds its encryption scheme
+	AlgorithmAnnotation = "interlink.eu/secret-encryption"
+	// DataKeyAnnotation holds the data key of a sealed Secret, wrapped for the plugin (base64)
+	DataKeyAnnotation = "interlink.eu/secret-data-key"
+	// KeyIDAnnotation identifies the plugin public key a Secret was sealed for
+	KeyIDAnnotation = "interlink.eu/secret-key-id"
+)
+
+// wrapInfo binds the key derived for wrapping data keys to this scheme.
+const wrapInfo = "interlink secret envelope v1"
+
+const dataKeySize = 32
+
+// GenerateKey returns a new X25519 private key for a plugin.
+func GenerateKey() (*ecdh.PrivateKey, error) {
+	return ecdh.X25519().GenerateKey(rand.Reader)
+}
+
+// MarshalPublicKey encodes a public key as a PEM "PUBLIC KEY" block.
+func MarshalPublicKey(key *ecdh.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// MarshalPrivateKey encodes a private key as a PEM "PRIVATE KEY" block.
+func MarshalPrivateKey(key *ecdh.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// ParsePublicKey decodes an X25519 public key from a PEM "PUBLIC KEY" block.
+func ParsePublicKey(data []byte) (*ecdh.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, errors.New("no PEM PUBLIC KEY block found")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := key.(*ecdh.PublicKey)
+	if !ok || pub.Curve() != ecdh.X25519() {
+		return nil, fmt.Errorf("unsupported public key type %T, expected an X25519 key", key)
+	}
+	return pub, nil
+}
+
+// ParsePrivateKey decodes an X25519 private key from a PEM "PRIVATE KEY" block.
+func ParsePrivateKey(data []byte) (*ecdh.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("no PEM PRIVATE KEY block found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(*ecdh.PrivateKey)
+	if !ok || priv.Curve() != ecdh.X25519() {
+		return nil, fmt.Errorf("unsupported private key type %T, expected an X25519 key", key)
+	}
+	return priv, nil
+}
+
+// LoadPublicKey reads an X25519 public key from a PEM file.
+func LoadPublicKey(path string) (*ecdh.PublicKey, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParsePublicKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// LoadPrivateKey reads an X25519 private key from a PEM file.
+func LoadPrivateKey(path string) (*ecdh.PrivateKey, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// KeyID returns a short fingerprint of a public key, recorded in the sealed Secrets.
+func KeyID(key *ecdh.PublicKey) string {
+	sum := sha256.Sum256(key.Bytes())
+	return hex.EncodeToString(sum[:8])
+}
+
+// IsSealed tells whether a Secret was sealed by SealSecret.
+func IsSealed(secret *v1.Secret) bool {
+	return isSealed(secret.Annotations)
+}
+
+// IsSealedConfigMap tells whether a ConfigMap was sealed by SealConfigMap.
+func IsSealedConfigMap(configMap *v1.ConfigMap) bool {
+	return isSealed(configMap.Annotations)
+}
+
+func isSealed(annotations map[string]string) bool {
+	_, ok := annotations[AlgorithmAnnotation]
+	return ok
+}
+
+// SealSecret encrypts the data of a Secret for the holder of the private key matching key.
+// StringData is merged into Data first, so that every value gets encrypted. The values are
+// bound to the namespace, name and key they belong to, and cannot be moved to another Secret.
+// The Secret is sealed whatever its annotations: the encryption annotations of a cluster
+// Secret are not trusted, and are replaced.
+func SealSecret(key *ecdh.PublicKey, secret *v1.Secret) error {
+	aead, annotations, err := newEnvelope(key, secret.Annotations)
+	if err != nil {
+		return err
+	}
+
+	data := make(map[string][]byte, len(secret.Data)+len(secret.StringData))
+	for k, v := range secret.Data {
+		data[k] = v
+	}
+	for k, v := range secret.StringData {
+		data[k] = []byte(v)
+	}
+	for k, v := range data {
+		if data[k], err = seal(aead, v, valueAAD(secret.ObjectMeta, k)); err != nil {
+			return err
+		}
+	}
+
+	secret.Annotations = annotations
+	secret.Data = data
+	secret.StringData = nil
+	return nil
+}
+
+// OpenSecret decrypts a Secret sealed by SealSecret in place and removes the encryption
+// annotations. Secrets that were not sealed are left untouched.
+func OpenSecret(key *ecdh.PrivateKey, secret *v1.Secret) error {
+	if !IsSealed(secret) {
+		return nil
+	}
+	name := "secret " + secret.Namespace + "/" + secret.Name
+	aead, err := openEnvelope(key, secret.Annotations, name)
+	if err != nil {
+		return err
+	}
+
+	data := make(map[string][]byte, len(secret.Data))
+	for k, v := range secret.Data {
+		if data[k], err = open(aead, v, valueAAD(secret.ObjectMeta, k)); err != nil {
+			return fmt.Errorf("%s: unable to decrypt key %s: %w", name, k, err)
+		}
+	}
+
+	secret.Annotations = envelopeRemoved(secret.Annotations)
+	secret.Data = data
+	return nil
+}
+
+// SealConfigMap encrypts the values of a ConfigMap as SealSecret does. It is meant for the
+// projected volumes, which carry service account tokens and the values of Secrets. The
+// sealed values of Data are base64-encoded, so that they stay valid strings. Like SealSecret,
+// it replaces the encryption annotations the ConfigMap may already carry.
+func SealConfigMap(key *ecdh.PublicKey, configMap *v1.ConfigMap) error {
+	aead, annotations, err := newEnvelope(key, configMap.Annotations)
+	if err != nil {
+		return err
+	}
+
+	var data map[string]string
+	if configMap.Data != nil {
+		data = make(map[string]string, len(configMap.Data))
+		for k, v := range configMap.Data {
+			sealed, err := seal(aead, []byte(v), valueAAD(configMap.ObjectMeta, k))
+			if err != nil {
+				return err
+			}
+			data[k] = base64.StdEncoding.EncodeToString(sealed)
+		}
+	}
+	var binaryData map[string][]byte
+	if configMap.BinaryData != nil {
+		binaryData = make(map[string][]byte, len(configMap.BinaryData))
+		for k, v := range configMap.BinaryData {
+			if binaryData[k], err = seal(aead, v, valueAAD(configMap.ObjectMeta, k)); err != nil {
+				return err
+			}
+		}
+	}
+
+	configMap.Annotations = annotations
+	configMap.Data = data
+	configMap.BinaryData = binaryData
+	return nil
+}
+
+// OpenConfigMap decrypts a ConfigMap sealed by SealConfigMap in place and removes the
+// encryption annotations. ConfigMaps that were not sealed are left untouched.
+func OpenConfigMap(key *ecdh.PrivateKey, configMap *v1.ConfigMap) error {
+	if !IsSealedConfigMap(configMap) {
+		return nil
+	}
+	name := "configmap " + configMap.Namespace + "/" + configMap.Name
+	aead, err := openEnvelope(key, configMap.Annotations, name)
+	if err != nil {
+		return err
+	}
+
+	var data map[string]string
+	if configMap.Data != nil {
+		data = make(map[string]string, len(configMap.Data))
+		for k, v := range configMap.Data {
+			sealed, err := base64.StdEncoding.DecodeString(v)
+			if err != nil {
+				return fmt.Errorf("%s: invalid value of key %s: %w", name, k, err)
+			}
+			value, err := open(aead, sealed, valueAAD(configMap.ObjectMeta, k))
+			if err != nil {
+				return fmt.Errorf("%s: unable to decrypt key %s: %w", name, k, err)
+			}
+			data[k] = string(value)
+		}
+	}
+	var binaryData map[string][]byte
+	if configMap.BinaryData != nil {
+		binaryData = make(map[string][]byte, len(configMap.BinaryData))
+		for k, v := range configMap.BinaryData {
+			if binaryData[k], err = open(aead, v, valueAAD(configMap.ObjectMeta, k)); err != nil {
+				return fmt.Errorf("%s: unable to decrypt key %s: %w", name, k, err)
+			}
+		}
+	}
+
+	configMap.Annotations = envelopeRemoved(configMap.Annotations)
+	configMap.Data = data
+	configMap.BinaryData = binaryData
+	return nil
+}
+
+// SealPodData seals every Secret and projected volume of the containers of a pod. They are
+// replaced by sealed copies, leaving the ones possibly shared with the caller untouched.
+// The ConfigMaps mounted as such are not sealed: they hold no secret data.
+func SealPodData(key *ecdh.PublicKey, data *types.RetrievedPodData) error {
+	containers := make([]types.RetrievedContainer, len(data.Containers))
+	for i, container := range data.Containers {
+		if container.Secrets != nil {
+			secrets := make([]v1.Secret, len(container.Secrets))
+			for j := range container.Secrets {
+				secrets[j] = *container.Secrets[j].DeepCopy()
+				if err := SealSecret(key, &secrets[j]); err != nil {
+					return err
+				}
+			}
+			container.Secrets = secrets
+		}
+		if container.ProjectedVolumeMaps != nil {
+			projected := make([]v1.ConfigMap, len(container.ProjectedVolumeMaps))
+			for j := range container.ProjectedVolumeMaps {
+				projected[j] = *container.ProjectedVolumeMaps[j].DeepCopy()
+				if err := SealConfigMap(key, &projected[j]); err != nil {
+					return err
+				}
+			}
+			container.ProjectedVolumeMaps = projected
+		}
+		containers[i] = container
+	}
+	data.Containers = containers
+	return nil
+}
+
+// OpenPodData decrypts in place every sealed Secret and projected volume of the containers
+// of a pod. It is meant for the plugins receiving the /create calls.
+func OpenPodData(key *ecdh.PrivateKey, data *types.RetrievedPodData) error {
+	for i := range data.Containers {
+		for j := range data.Containers[i].Secrets {
+			if err := OpenSecret(key, &data.Containers[i].Secrets[j]); err != nil {
+				return err
+			}
+		}
+		for j := range data.Containers[i].ProjectedVolumeMaps {
+			if err := OpenConfigMap(key, &data.Containers[i].ProjectedVolumeMaps[j]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// newEnvelope generates the data key sealing the values of an object, and returns it with
+// the annotations of the sealed object: the given ones plus the wrapped data key.
+func newEnvelope(key *ecdh.PublicKey, annotations map[string]string) (cipher.AEAD, map[string]string, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	wrapped, err := wrapKey(key, dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	annotations = maps.Clone(annotations)
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[AlgorithmAnnotation] = Algorithm
+	annotations[DataKeyAnnotation] = base64.StdEncoding.EncodeToString(wrapped)
+	annotations[KeyIDAnnotation] = KeyID(key)
+	return aead, annotations, nil
+}
+
+// openEnvelope unwraps the data key of a sealed object from its annotations. name
+// identifies the object in the errors.
+func openEnvelope(key *ecdh.PrivateKey, annotations map[string]string, name string) (cipher.AEAD, error) {
+	if algorithm := annotations[AlgorithmAnnotation]; algorithm != Algorithm {
+		return nil, fmt.Errorf("%s: unsupported encryption %q", name, algorithm)
+	}
+	if id := annotations[KeyIDAnnotation]; id != "" && id != KeyID(key.PublicKey()) {
+		return nil, fmt.Errorf("%s: sealed for key %s, not for this key (%s)", name, id, KeyID(key.PublicKey()))
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(annotations[DataKeyAnnotation])
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid data key: %w", name, err)
+	}
+	dataKey, err := unwrapKey(key, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to unwrap the data key: %w", name, err)
+	}
+	return newAEAD(dataKey)
+}
+
+// envelopeRemoved returns a copy of the annotations of a sealed object without the
+// encryption ones.
+func envelopeRemoved(annotations map[string]string) map[string]string {
+	annotations = maps.Clone(annotations)
+	delete(annotations, AlgorithmAnnotation)
+	delete(annotations, DataKeyAnnotation)
+	delete(annotations, KeyIDAnnotation)
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	return annotations
+}
+
+// valueAAD binds an encrypted value to its object and key.
+func valueAAD(object metav1.ObjectMeta, key string) []byte {
+	return []byte(object.Namespace + "/" + object.Name + "/" + key)
+}
+
+// wrapKey seals a data key with an ephemeral X25519 key agreement. The result is the
+// ephemeral public key followed by the nonce and the sealed data key.
+func wrapKey(key *ecdh.PublicKey, dataKey []byte) ([]byte, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := ephemeral.ECDH(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := wrapAEAD(shared, ephemeral.PublicKey(), key)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := seal(aead, dataKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	return append(ephemeral.PublicKey().Bytes(), sealed...), nil
+}
+
+func unwrapKey(key *ecdh.PrivateKey, wrapped []byte) ([]byte, error) {
+	size := len(key.PublicKey().Bytes())
+	if len(wrapped) < size {
+		return nil, errors.New("wrapped key too short")
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(wrapped[:size])
+	if err != nil {
+		return nil, err
+	}
+	shared, err := key.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := wrapAEAD(shared, ephemeral, key.PublicKey())
+	if err != nil {
+		return nil, err
+	}
+	return open(aead, wrapped[size:], nil)
+}
+
+// wrapAEAD derives the key wrapping a data key from an X25519 shared secret. The salt
+// binds it to both the ephemeral and the recipient public keys.
+func wrapAEAD(shared []byte, ephemeral, recipient *ecdh.PublicKey) (cipher.AEAD, error) {
+	salt := append(ephemeral.Bytes(), recipient.Bytes()...)
+	wrappingKey, err := hkdf.Key(sha256.New, shared, salt, wrapInfo, dataKeySize)
+	if err != nil {
+		return nil, err
+	}
+	return newAEAD(wrappingKey)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext under a random nonce, prepended to the result.
+func seal(aead cipher.AEAD, plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(aead cipher.AEAD, sealed, aad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], aad)
+}
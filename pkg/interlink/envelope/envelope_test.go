@@ -0,0 +1,184 @@
+package envelope
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+)
+
+func testSecret() v1.Secret {
+	return v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "creds", Namespace: "default", Annotations: map[string]string{"team": "hpc"}},
+		Data:       map[string][]byte{"password": []byte("s3cr3t")},
+		StringData: map[string]string{"token": "abc"},
+	}
+}
+
+func TestKeyFiles(t *testing.T) {
+	key, err := GenerateKey()
+	require.NoError(t, err)
+	dir := t.TempDir()
+
+	pubPEM, err := MarshalPublicKey(key.PublicKey())
+	require.NoError(t, err)
+	privPEM, err := MarshalPrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "key.pub"), pubPEM, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "key.pem"), privPEM, 0o600))
+
+	pub, err := LoadPublicKey(filepath.Join(dir, "key.pub"))
+	require.NoError(t, err)
+	assert.True(t, pub.Equal(key.PublicKey()))
+	priv, err := LoadPrivateKey(filepath.Join(dir, "key.pem"))
+	require.NoError(t, err)
+	assert.True(t, priv.Equal(key))
+
+	_, err = LoadPublicKey(filepath.Join(dir, "key.pem"))
+	require.Error(t, err)
+	_, err = ParsePrivateKey([]byte("not a key"))
+	require.Error(t, err)
+}
+
+func TestSealOpenSecret(t *testing.T) {
+	key, err := GenerateKey()
+	require.NoError(t, err)
+
+	secret := testSecret()
+	require.NoError(t, SealSecret(key.PublicKey(), &secret))
+	assert.True(t, IsSealed(&secret))
+	assert.Nil(t, secret.StringData)
+	assert.Len(t, secret.Data, 2)
+	assert.NotContains(t, string(secret.Data["password"]), "s3cr3t")
+	assert.Equal(t, KeyID(key.PublicKey()), secret.Annotations[KeyIDAnnotation])
+
+	require.NoError(t, OpenSecret(key, &secret))
+	assert.False(t, IsSealed(&secret))
+	assert.Equal(t, map[string][]byte{"password": []byte("s3cr3t"), "token": []byte("abc")}, secret.Data)
+	assert.Equal(t, map[string]string{"team": "hpc"}, secret.Annotations)
+
+	plain := testSecret()
+	require.NoError(t, OpenSecret(key, &plain), "plain Secrets are left untouched")
+	assert.Equal(t, testSecret(), plain)
+}
+
+func TestSealForgedEnvelope(t *testing.T) {
+	key, err := GenerateKey()
+	require.NoError(t, err)
+
+	// a cluster Secret or projected volume claiming to be sealed is sealed all the same
+	forged := map[string]string{AlgorithmAnnotation: Algorithm, DataKeyAnnotation: "Zm9yZ2Vk"}
+	secret := testSecret()
+	secret.Annotations = forged
+	require.NoError(t, SealSecret(key.PublicKey(), &secret))
+	assert.NotContains(t, string(secret.Data["password"]), "s3cr3t")
+	assert.NotEqual(t, "Zm9yZ2Vk", secret.Annotations[DataKeyAnnotation])
+	require.NoError(t, OpenSecret(key, &secret))
+	assert.Equal(t, []byte("s3cr3t"), secret.Data["password"])
+
+	configMap := v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "kube-api-access", Annotations: forged},
+		Data:       map[string]string{"token": "eyJhbGciOi"},
+	}
+	require.NoError(t, SealConfigMap(key.PublicKey(), &configMap))
+	assert.NotContains(t, configMap.Data["token"], "eyJhbGciOi")
+	require.NoError(t, OpenConfigMap(key, &configMap))
+	assert.Equal(t, "eyJhbGciOi", configMap.Data["token"])
+}
+
+func TestOpenSecretFailures(t *testing.T) {
+	key, err := GenerateKey()
+	require.NoError(t, err)
+	other, err := GenerateKey()
+	require.NoError(t, err)
+
+	sealed := testSecret()
+	require.NoError(t, SealSecret(key.PublicKey(), &sealed))
+
+	t.Run("wrong key", func(t *testing.T) {
+		secret := *sealed.DeepCopy()
+		require.ErrorContains(t, OpenSecret(other, &secret), "sealed for key")
+	})
+
+	t.Run("tampered value", func(t *testing.T) {
+		secret := *sealed.DeepCopy()
+		secret.Data["password"][len(secret.Data["password"])-1] ^= 1
+		require.ErrorContains(t, OpenSecret(key, &secret), "password")
+	})
+
+	t.Run("value moved to another Secret", func(t *testing.T) {
+		secret := *sealed.DeepCopy()
+		secret.Name = "other"
+		require.Error(t, OpenSecret(key, &secret))
+	})
+
+	t.Run("unknown algorithm", func(t *testing.T) {
+		secret := *sealed.DeepCopy()
+		secret.Annotations[AlgorithmAnnotation] = "rot13"
+		require.ErrorContains(t, OpenSecret(key, &secret), "unsupported encryption")
+	})
+}
+
+func TestSealOpenPodData(t *testing.T) {
+	key, err := GenerateKey()
+	require.NoError(t, err)
+
+	original := testSecret()
+	projected := v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "kube-api-access"},
+		Data:       map[string]string{"token": "eyJhbGciOi", "ca.crt": "-----BEGIN CERTIFICATE-----"},
+	}
+	data := types.RetrievedPodData{Containers: []types.RetrievedContainer{
+		{Name: "main", Secrets: []v1.Secret{original}, ProjectedVolumeMaps: []v1.ConfigMap{projected}},
+		{Name: "sidecar"},
+	}}
+	shared := data.Containers[0].Secrets
+	sharedProjected := data.Containers[0].ProjectedVolumeMaps
+
+	require.NoError(t, SealPodData(key.PublicKey(), &data))
+	assert.True(t, IsSealed(&data.Containers[0].Secrets[0]))
+	assert.True(t, IsSealedConfigMap(&data.Containers[0].ProjectedVolumeMaps[0]))
+	assert.NotContains(t, data.Containers[0].ProjectedVolumeMaps[0].Data["token"], "eyJhbGciOi")
+	assert.Nil(t, data.Containers[1].Secrets)
+	assert.Nil(t, data.Containers[1].ProjectedVolumeMaps)
+	assert.False(t, IsSealed(&shared[0]), "the caller's Secrets are not modified")
+	assert.Equal(t, projected, sharedProjected[0], "the caller's projected volumes are not modified")
+
+	require.NoError(t, OpenPodData(key, &data))
+	assert.Equal(t, []byte("abc"), data.Containers[0].Secrets[0].Data["token"])
+	assert.Equal(t, projected, data.Containers[0].ProjectedVolumeMaps[0])
+}
+
+func TestSealOpenConfigMap(t *testing.T) {
+	key, err := GenerateKey()
+	require.NoError(t, err)
+
+	original := v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "projected", Namespace: "default"},
+		Data:       map[string]string{"token": "abc"},
+		BinaryData: map[string][]byte{"keystore": {0, 1, 2}},
+	}
+	sealed := *original.DeepCopy()
+	require.NoError(t, SealConfigMap(key.PublicKey(), &sealed))
+	assert.NotEqual(t, original.BinaryData, sealed.BinaryData)
+
+	opened := *sealed.DeepCopy()
+	require.NoError(t, OpenConfigMap(key, &opened))
+	assert.Equal(t, original, opened)
+
+	// values cannot be moved to another key
+	moved := *sealed.DeepCopy()
+	moved.Data = map[string]string{"other": sealed.Data["token"]}
+	require.ErrorContains(t, OpenConfigMap(key, &moved), "unable to decrypt key other")
+
+	other, err := GenerateKey()
+	require.NoError(t, err)
+	wrongKey := *sealed.DeepCopy()
+	require.ErrorContains(t, OpenConfigMap(other, &wrongKey), "not for this key")
+}
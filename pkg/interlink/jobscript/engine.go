@@ -0,0 +1,217 @@
+// Package jobscript renders the job scripts sent to the sidecars from text/template files.
+//
+// Templates come from the JobScriptTemplate file and from the *.tmpl files of the
+// JobScriptTemplateDir directory, each named after its file without the extension. A pod
+// selects one with the interlink.eu/job-script-template annotation; the other pods get the
+// default template. Templates are parsed once, and parsed again when their files change.
+package jobscript
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/containerd/containerd/log"
+	v1 "k8s.io/api/core/v1"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+)
+
+const (
+	// TemplateAnnotation selects the job script template of a pod by name
+	TemplateAnnotation = "interlink.eu/job-script-template"
+	// DefaultTemplate is the template of the pods without annotation: the JobScriptTemplate
+	// file, or default.tmpl in the JobScriptTemplateDir
+	DefaultTemplate = "default"
+	// ReloadInterval is how often the template files are checked for changes
+	ReloadInterval = 10 * time.Second
+
+	templateExt = ".tmpl"
+)
+
+// ErrUnknownTemplate is returned when a pod selects a template that does not exist.
+var ErrUnknownTemplate = errors.New("unknown job script template")
+
+// Engine holds the parsed job script templates.
+type Engine struct {
+	file     string
+	dir      string
+	dataRoot string
+
+	mu          sync.RWMutex
+	templates   map[string]*template.Template
+	fingerprint string
+}
+
+// NewEngine parses the templates configured by JobScriptTemplate and JobScriptTemplateDir.
+// Syntax errors are reported here, and not at the first create.
+func NewEngine(config types.Config) (*Engine, error) {
+	e := &Engine{
+		file:     config.JobScriptTemplate,
+		dir:      config.JobScriptTemplateDir,
+		dataRoot: config.DataRootFolder,
+	}
+	fingerprint, err := e.stat()
+	if err != nil {
+		return nil, err
+	}
+	if err := e.load(fingerprint); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Names returns the names of the loaded templates, sorted.
+func (e *Engine) Names() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	names := make([]string, 0, len(e.templates))
+	for name := range e.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Render executes the template selected by the pod with data. It returns an empty script
+// when the pod selects no template and there is no default one.
+func (e *Engine) Render(pod *v1.Pod, data any) (string, error) {
+	name, selected := pod.Annotations[TemplateAnnotation]
+	if !selected || name == "" {
+		name = DefaultTemplate
+	}
+
+	e.mu.RLock()
+	tmpl, ok := e.templates[name]
+	e.mu.RUnlock()
+	if !ok {
+		if !selected {
+			return "", nil
+		}
+		return "", fmt.Errorf("%w %q", ErrUnknownTemplate, name)
+	}
+
+	var script bytes.Buffer
+	if err := tmpl.Execute(&script, data); err != nil {
+		return "", fmt.Errorf("unable to render job script template %q: %w", name, err)
+	}
+	return script.String(), nil
+}
+
+// Watch reloads the templates whenever their files change, checking every interval until ctx
+// is done. When the new files do not parse, the error is logged and the loaded templates stay.
+func (e *Engine) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.reload(); err != nil {
+				log.G(ctx).Error("Unable to reload the job script templates, keeping the previous ones: ", err)
+			}
+		}
+	}
+}
+
+// reload parses the templates again if their files changed since the last load.
+func (e *Engine) reload() error {
+	fingerprint, err := e.stat()
+	if err != nil {
+		return err
+	}
+	e.mu.RLock()
+	unchanged := fingerprint == e.fingerprint
+	e.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+	if err := e.load(fingerprint); err != nil {
+		return err
+	}
+	log.L.Info("Reloaded the job script templates: ", strings.Join(e.Names(), ", "))
+	return nil
+}
+
+// files returns the template files by template name.
+func (e *Engine) files() (map[string]string, error) {
+	files := make(map[string]string)
+	if e.dir != "" {
+		entries, err := os.ReadDir(e.dir)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the job script template directory: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || filepath.Ext(entry.Name()) != templateExt {
+				continue
+			}
+			files[strings.TrimSuffix(entry.Name(), templateExt)] = filepath.Join(e.dir, entry.Name())
+		}
+	}
+	if e.file != "" {
+		if _, ok := files[DefaultTemplate]; ok {
+			return nil, fmt.Errorf("both JobScriptTemplate and %s%s in JobScriptTemplateDir define the default job script template", DefaultTemplate, templateExt)
+		}
+		files[DefaultTemplate] = e.file
+	}
+	return files, nil
+}
+
+// stat returns a fingerprint of the template files, changing whenever one of them is added,
+// removed or modified.
+func (e *Engine) stat() (string, error) {
+	files, err := e.files()
+	if err != nil {
+		return "", err
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		info, err := os.Stat(files[name])
+		if err != nil {
+			return "", fmt.Errorf("job script template %q: %w", name, err)
+		}
+		fmt.Fprintf(&b, "%s:%s:%d:%d;", name, files[name], info.Size(), info.ModTime().UnixNano())
+	}
+	return b.String(), nil
+}
+
+// load parses all the template files, and replaces the loaded templates only if they all parse.
+func (e *Engine) load(fingerprint string) error {
+	files, err := e.files()
+	if err != nil {
+		return err
+	}
+	templates := make(map[string]*template.Template, len(files))
+	for name, path := range files {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("job script template %q: %w", name, err)
+		}
+		tmpl, err := template.New(name).Funcs(funcs(e.dataRoot)).Parse(string(content))
+		if err != nil {
+			return fmt.Errorf("job script template %q: %w", name, err)
+		}
+		templates[name] = tmpl
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.templates = templates
+	e.fingerprint = fingerprint
+	return nil
+}
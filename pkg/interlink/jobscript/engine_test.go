@@ -0,0 +1,104 @@
+package jobscript
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+)
+
+func writeTemplate(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+}
+
+func annotatedPod(template string) *v1.Pod {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "ns", UID: "uid"}}
+	if template != "" {
+		pod.Annotations = map[string]string{TemplateAnnotation: template}
+	}
+	return pod
+}
+
+func TestEngineRender(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, filepath.Join(dir, "gpu.tmpl"), `#SBATCH --gres=gpu:1 {{ .Name }}`)
+	writeTemplate(t, filepath.Join(dir, "notes.txt"), `{{ ignored`)
+	file := filepath.Join(t.TempDir(), "job.sh")
+	writeTemplate(t, file, `cd {{ podDir . }} && echo {{ shellQuote .Name }}`)
+
+	engine, err := NewEngine(types.Config{JobScriptTemplate: file, JobScriptTemplateDir: dir, DataRootFolder: "/data"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{DefaultTemplate, "gpu"}, engine.Names())
+
+	pod := annotatedPod("")
+	script, err := engine.Render(pod, pod)
+	require.NoError(t, err)
+	assert.Equal(t, "cd /data/ns-uid && echo 'pod'", script)
+
+	pod = annotatedPod("gpu")
+	script, err = engine.Render(pod, pod)
+	require.NoError(t, err)
+	assert.Equal(t, "#SBATCH --gres=gpu:1 pod", script)
+
+	pod = annotatedPod("missing")
+	_, err = engine.Render(pod, pod)
+	require.ErrorIs(t, err, ErrUnknownTemplate)
+}
+
+func TestEngineWithoutDefault(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, filepath.Join(dir, "gpu.tmpl"), `gpu`)
+	engine, err := NewEngine(types.Config{JobScriptTemplateDir: dir})
+	require.NoError(t, err)
+
+	script, err := engine.Render(annotatedPod(""), nil)
+	require.NoError(t, err)
+	assert.Empty(t, script, "pods without annotation get no job script when there is no default template")
+}
+
+func TestEngineReportsErrorsAtLoad(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, filepath.Join(dir, "broken.tmpl"), `{{ if }}`)
+	_, err := NewEngine(types.Config{JobScriptTemplateDir: dir})
+	require.ErrorContains(t, err, `"broken"`)
+
+	writeTemplate(t, filepath.Join(dir, "broken.tmpl"), `{{ unknownFunc }}`)
+	_, err = NewEngine(types.Config{JobScriptTemplateDir: dir})
+	require.Error(t, err)
+
+	dir = t.TempDir()
+	writeTemplate(t, filepath.Join(dir, "default.tmpl"), `dir`)
+	file := filepath.Join(t.TempDir(), "job.sh")
+	writeTemplate(t, file, `file`)
+	_, err = NewEngine(types.Config{JobScriptTemplate: file, JobScriptTemplateDir: dir})
+	require.Error(t, err, "the default template must be defined once")
+}
+
+func TestEngineReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "default.tmpl")
+	writeTemplate(t, path, `v1`)
+	engine, err := NewEngine(types.Config{JobScriptTemplateDir: dir})
+	require.NoError(t, err)
+
+	writeTemplate(t, path, `version 2`)
+	writeTemplate(t, filepath.Join(dir, "extra.tmpl"), `extra`)
+	require.NoError(t, engine.reload())
+	script, err := engine.Render(annotatedPod(""), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "version 2", script)
+	assert.Equal(t, []string{DefaultTemplate, "extra"}, engine.Names())
+
+	writeTemplate(t, path, `{{ if }} broken`)
+	require.Error(t, engine.reload())
+	script, err = engine.Render(annotatedPod(""), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "version 2", script, "a broken file keeps the loaded templates")
+}
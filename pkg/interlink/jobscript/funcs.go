@@ -0,0 +1,208 @@
+package jobscript
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// envName matches the variable names a POSIX shell can export.
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// funcs returns the functions available to the job script templates. dataRoot is the
+// DataRootFolder of the config, under which the pod directories are laid out.
+func funcs(dataRoot string) template.FuncMap {
+	return template.FuncMap{
+		"cpuMillis":     cpuMillis,
+		"cpuCores":      cpuCores,
+		"memoryBytes":   memoryBytes,
+		"memoryMiB":     memoryMiB,
+		"memoryGiB":     memoryGiB,
+		"cpuRequest":    resourceGetter(v1.ResourceCPU, true),
+		"cpuLimit":      resourceGetter(v1.ResourceCPU, false),
+		"memoryRequest": resourceGetter(v1.ResourceMemory, true),
+		"memoryLimit":   resourceGetter(v1.ResourceMemory, false),
+		"shellQuote":    shellQuote,
+		"envExports":    envExports,
+		"join":          filepath.Join,
+		"podDir": func(pod any) (string, error) {
+			return podDir(dataRoot, pod)
+		},
+		"emptyDirPath": func(pod any, volume string) (string, error) {
+			dir, err := podDir(dataRoot, pod)
+			if err != nil {
+				return "", err
+			}
+			return filepath.Join(dir, "emptyDirs", volume), nil
+		},
+		"volumeFor": volumeFor,
+	}
+}
+
+// toQuantity accepts the quantities of the pod spec, as well as strings ("500m", "2Gi") and
+// integers. Nil and empty values are zero.
+func toQuantity(value any) (resource.Quantity, error) {
+	switch q := value.(type) {
+	case nil:
+		return resource.Quantity{}, nil
+	case resource.Quantity:
+		return q, nil
+	case *resource.Quantity:
+		if q == nil {
+			return resource.Quantity{}, nil
+		}
+		return *q, nil
+	case string:
+		if q == "" {
+			return resource.Quantity{}, nil
+		}
+		return resource.ParseQuantity(q)
+	case int:
+		return *resource.NewQuantity(int64(q), resource.DecimalSI), nil
+	case int64:
+		return *resource.NewQuantity(q, resource.DecimalSI), nil
+	default:
+		return resource.Quantity{}, fmt.Errorf("%T is not a quantity", value)
+	}
+}
+
+// cpuMillis converts a CPU quantity to millicores.
+func cpuMillis(value any) (int64, error) {
+	q, err := toQuantity(value)
+	if err != nil {
+		return 0, err
+	}
+	return q.MilliValue(), nil
+}
+
+// cpuCores converts a CPU quantity to whole cores, rounding up: 1500m is 2.
+func cpuCores(value any) (int64, error) {
+	q, err := toQuantity(value)
+	if err != nil {
+		return 0, err
+	}
+	return q.Value(), nil
+}
+
+// memoryBytes converts a memory quantity to bytes.
+func memoryBytes(value any) (int64, error) {
+	q, err := toQuantity(value)
+	if err != nil {
+		return 0, err
+	}
+	return q.Value(), nil
+}
+
+// memoryMiB converts a memory quantity to MiB, rounding up.
+func memoryMiB(value any) (int64, error) {
+	return memoryUnits(value, 1<<20)
+}
+
+// memoryGiB converts a memory quantity to GiB, rounding up.
+func memoryGiB(value any) (int64, error) {
+	return memoryUnits(value, 1<<30)
+}
+
+func memoryUnits(value any, unit int64) (int64, error) {
+	bytes, err := memoryBytes(value)
+	if err != nil {
+		return 0, err
+	}
+	return (bytes + unit - 1) / unit, nil
+}
+
+// resourceGetter returns a function reading a resource of a container. The request falls back
+// to the limit, as Kubernetes does when only the limit is set, and the limit to the request.
+func resourceGetter(name v1.ResourceName, request bool) func(any) (resource.Quantity, error) {
+	return func(value any) (resource.Quantity, error) {
+		var resources v1.ResourceRequirements
+		switch c := value.(type) {
+		case v1.Container:
+			resources = c.Resources
+		case *v1.Container:
+			resources = c.Resources
+		default:
+			return resource.Quantity{}, fmt.Errorf("%T is not a container", value)
+		}
+		first, second := resources.Limits, resources.Requests
+		if request {
+			first, second = second, first
+		}
+		if q, ok := first[name]; ok {
+			return q, nil
+		}
+		return second[name], nil
+	}
+}
+
+// shellQuote quotes a string for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// envExports renders the environment of a container as shell export lines. Variables whose
+// value comes from a reference are skipped: the Virtual Kubelet resolves them before the create.
+func envExports(value any) (string, error) {
+	var env []v1.EnvVar
+	switch c := value.(type) {
+	case v1.Container:
+		env = c.Env
+	case *v1.Container:
+		env = c.Env
+	case []v1.EnvVar:
+		env = c
+	default:
+		return "", fmt.Errorf("%T is not a container", value)
+	}
+
+	var b strings.Builder
+	for _, e := range env {
+		if e.Value == "" && e.ValueFrom != nil {
+			continue
+		}
+		if !envName.MatchString(e.Name) {
+			return "", fmt.Errorf("environment variable %q cannot be exported by a shell", e.Name)
+		}
+		b.WriteString("export " + e.Name + "=" + shellQuote(e.Value) + "\n")
+	}
+	return b.String(), nil
+}
+
+func toPod(value any) (*v1.Pod, error) {
+	switch p := value.(type) {
+	case v1.Pod:
+		return &p, nil
+	case *v1.Pod:
+		return p, nil
+	default:
+		return nil, fmt.Errorf("%T is not a pod", value)
+	}
+}
+
+// podDir is the directory of a pod under the DataRootFolder: <DataRootFolder>/<namespace>-<uid>.
+func podDir(dataRoot string, value any) (string, error) {
+	pod, err := toPod(value)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataRoot, pod.Namespace+"-"+string(pod.UID)), nil
+}
+
+// volumeFor returns the volume of the pod a volume mount refers to, to tell its kind.
+func volumeFor(podValue any, mount v1.VolumeMount) (*v1.Volume, error) {
+	pod, err := toPod(podValue)
+	if err != nil {
+		return nil, err
+	}
+	for i := range pod.Spec.Volumes {
+		if pod.Spec.Volumes[i].Name == mount.Name {
+			return &pod.Spec.Volumes[i], nil
+		}
+	}
+	return nil, fmt.Errorf("pod %s/%s has no volume %q", pod.Namespace, pod.Name, mount.Name)
+}
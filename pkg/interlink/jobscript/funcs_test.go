@@ -0,0 +1,78 @@
+package jobscript
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestQuantityFuncs(t *testing.T) {
+	millis, err := cpuMillis("1500m")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1500), millis)
+	cores, err := cpuCores(resource.MustParse("1500m"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), cores)
+	mib, err := memoryMiB("1500Ki")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), mib)
+	gib, err := memoryGiB("2Gi")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), gib)
+	bytes, err := memoryBytes(nil)
+	require.NoError(t, err)
+	assert.Zero(t, bytes)
+	_, err = cpuMillis(1.5)
+	require.Error(t, err)
+
+	container := v1.Container{Resources: v1.ResourceRequirements{
+		Limits:   v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")},
+		Requests: v1.ResourceList{v1.ResourceMemory: resource.MustParse("1Gi")},
+	}}
+	cpuRequest, err := resourceGetter(v1.ResourceCPU, true)(container)
+	require.NoError(t, err)
+	assert.Equal(t, "2", cpuRequest.String(), "the request falls back to the limit")
+	memoryLimit, err := resourceGetter(v1.ResourceMemory, false)(&container)
+	require.NoError(t, err)
+	assert.Equal(t, "1Gi", memoryLimit.String(), "the limit falls back to the request")
+}
+
+func TestShellFuncs(t *testing.T) {
+	assert.Equal(t, `'it'\''s'`, shellQuote("it's"))
+
+	exports, err := envExports(v1.Container{Env: []v1.EnvVar{
+		{Name: "GREETING", Value: "hello $USER"},
+		{Name: "EMPTY"},
+		{Name: "FROM_REF", ValueFrom: &v1.EnvVarSource{FieldRef: &v1.ObjectFieldSelector{FieldPath: "metadata.name"}}},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, "export GREETING='hello $USER'\nexport EMPTY=''\n", exports)
+
+	_, err = envExports([]v1.EnvVar{{Name: "not.valid", Value: "x"}})
+	require.Error(t, err)
+}
+
+func TestVolumeFuncs(t *testing.T) {
+	pod := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "ns", UID: "uid"},
+		Spec:       v1.PodSpec{Volumes: []v1.Volume{{Name: "scratch", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}}}},
+	}
+	fm := funcs("/data")
+
+	dir, err := fm["podDir"].(func(any) (string, error))(pod)
+	require.NoError(t, err)
+	assert.Equal(t, "/data/ns-uid", dir)
+	path, err := fm["emptyDirPath"].(func(any, string) (string, error))(&pod, "scratch")
+	require.NoError(t, err)
+	assert.Equal(t, "/data/ns-uid/emptyDirs/scratch", path)
+
+	volume, err := volumeFor(pod, v1.VolumeMount{Name: "scratch"})
+	require.NoError(t, err)
+	assert.NotNil(t, volume.EmptyDir)
+	_, err = volumeFor(pod, v1.VolumeMount{Name: "missing"})
+	require.Error(t, err)
+}
@@ -0,0 +1,313 @@
+// Package logarchive keeps the final logs of the completed pods, once the plugins may have
+// cleaned up their jobs.
+//
+// The logs of a container are stored gzip-compressed in <dir>/<namespace>-<uid>/<container>.log.gz,
+// as returned by the plugin with timestamps: each line starts with its RFC 3339 time, so that
+// SinceTime and SinceSeconds can be applied to the archived copy. The pods are removed after
+// the retention period, and the oldest ones first when the archive grows over its maximum size.
+package logarchive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+)
+
+const (
+	defaultRetention = 7 * 24 * time.Hour
+	defaultMaxSizeMB = 1024
+	archiveDirName   = "log-archive"
+	logExt           = ".log.gz"
+)
+
+// ErrNotArchived is returned when the logs of a container are not in the archive.
+var ErrNotArchived = errors.New("logs not archived")
+
+// Archive stores the logs of the completed pods.
+type Archive struct {
+	// mu serializes the changes to the archive directory
+	mu        sync.Mutex
+	dir       string
+	retention time.Duration
+	maxSize   int64
+}
+
+// New opens the archive configured by the LogArchive section of the config.
+func New(config types.Config) (*Archive, error) {
+	dir := config.LogArchive.Path
+	if dir == "" {
+		if config.DataRootFolder == "" {
+			return nil, errors.New("the log archive requires either LogArchive.Path or DataRootFolder to be set")
+		}
+		dir = filepath.Join(config.DataRootFolder, archiveDirName)
+	}
+	retention := defaultRetention
+	if config.LogArchive.RetentionHours > 0 {
+		retention = time.Duration(config.LogArchive.RetentionHours) * time.Hour
+	}
+	maxSizeMB := config.LogArchive.MaxSizeMB
+	if maxSizeMB <= 0 {
+		maxSizeMB = defaultMaxSizeMB
+	}
+	return Open(dir, retention, int64(maxSizeMB)<<20)
+}
+
+// Open opens the archive in dir, keeping the pods for retention and at most maxSize bytes.
+func Open(dir string, retention time.Duration, maxSize int64) (*Archive, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("unable to create log archive directory: %w", err)
+	}
+	return &Archive{dir: dir, retention: retention, maxSize: maxSize}, nil
+}
+
+// validName rejects the names that would escape the archive directory.
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+func (a *Archive) podDir(namespace, uid string) (string, error) {
+	if !validName(namespace) || !validName(uid) {
+		return "", fmt.Errorf("invalid pod %s/%s", namespace, uid)
+	}
+	return filepath.Join(a.dir, namespace+"-"+uid), nil
+}
+
+func (a *Archive) path(namespace, uid, container string) (string, error) {
+	dir, err := a.podDir(namespace, uid)
+	if err != nil {
+		return "", err
+	}
+	if !validName(container) {
+		return "", fmt.Errorf("invalid container name %q", container)
+	}
+	return filepath.Join(dir, container+logExt), nil
+}
+
+// Store archives the logs of a container, read from logs. It replaces the logs archived
+// before, and leaves them untouched when logs fails. The logs are streamed to a temporary file
+// in the archive directory without holding the lock, taken only to move the file in place.
+func (a *Archive) Store(namespace, uid, container string, logs io.Reader) error {
+	path, err := a.path(namespace, uid, container)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(a.dir, "."+container+"-*")
+	if err != nil {
+		return fmt.Errorf("unable to archive logs: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	zw := gzip.NewWriter(tmp)
+	_, err = io.Copy(zw, logs)
+	if err == nil {
+		err = zw.Close()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("unable to archive logs of container %s of pod %s/%s: %w", container, namespace, uid, err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("unable to create log archive directory: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Has tells whether the logs of a container are archived.
+func (a *Archive) Has(namespace, uid, container string) bool {
+	path, err := a.path(namespace, uid, container)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// WriteLogs writes the archived logs of a container to w, filtered by opts as the plugins do:
+// SinceTime or SinceSeconds first, then Tail and LimitBytes. Timestamps are removed unless
+// opts.Timestamps is set. It returns ErrNotArchived when the container has no archived logs.
+func (a *Archive) WriteLogs(w io.Writer, namespace, uid, container string, opts types.ContainerLogOpts, now time.Time) error {
+	path, err := a.path(namespace, uid, container)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotArchived
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("corrupted log archive %s: %w", path, err)
+	}
+	defer zr.Close()
+	return Filter(w, zr, opts, now)
+}
+
+// Remove deletes the archived logs of a pod.
+func (a *Archive) Remove(namespace, uid string) error {
+	dir, err := a.podDir(namespace, uid)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return os.RemoveAll(dir)
+}
+
+// archivedPod is a pod directory of the archive.
+type archivedPod struct {
+	dir     string
+	modTime time.Time
+	size    int64
+}
+
+// Prune removes the pods archived for longer than the retention period, then the oldest
+// pods until the archive fits in its maximum size. It returns the number of pods removed.
+func (a *Archive) Prune(now time.Time) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	entries, err := os.ReadDir(a.dir)
+	if err != nil {
+		return 0, fmt.Errorf("unable to read the log archive: %w", err)
+	}
+	var pods []archivedPod
+	var total int64
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		pod := archivedPod{dir: filepath.Join(a.dir, entry.Name())}
+		files, err := os.ReadDir(pod.dir)
+		if err != nil {
+			return 0, fmt.Errorf("unable to read the log archive: %w", err)
+		}
+		for _, file := range files {
+			info, err := file.Info()
+			if err != nil {
+				continue
+			}
+			pod.size += info.Size()
+			if info.ModTime().After(pod.modTime) {
+				pod.modTime = info.ModTime()
+			}
+		}
+		pods = append(pods, pod)
+		total += pod.size
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].modTime.Before(pods[j].modTime) })
+
+	removed := 0
+	for _, pod := range pods {
+		if now.Sub(pod.modTime) <= a.retention && total <= a.maxSize {
+			break
+		}
+		if err := os.RemoveAll(pod.dir); err != nil {
+			return removed, fmt.Errorf("unable to prune the log archive: %w", err)
+		}
+		total -= pod.size
+		removed++
+	}
+	return removed, nil
+}
+
+// Filter copies the timestamped logs read from r to w, applying opts. Lines without a
+// leading timestamp are always kept, since their time is unknown.
+func Filter(w io.Writer, r io.Reader, opts types.ContainerLogOpts, now time.Time) error {
+	since := opts.SinceTime
+	if opts.SinceSeconds > 0 {
+		since = now.Add(-time.Duration(opts.SinceSeconds) * time.Second)
+	}
+
+	var lines []string
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			stamp, rest, stamped := splitTimestamp(line)
+			if !stamped || since.IsZero() || !stamp.Before(since) {
+				if stamped && !opts.Timestamps {
+					line = rest
+				}
+				lines = append(lines, line)
+				if opts.Tail > 0 && len(lines) > opts.Tail {
+					lines = lines[1:]
+				}
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	out := w
+	if opts.LimitBytes > 0 {
+		out = &limitWriter{w: w, n: opts.LimitBytes}
+	}
+	for _, line := range lines {
+		if _, err := io.WriteString(out, line); err != nil {
+			if errors.Is(err, errLimitReached) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// splitTimestamp splits a line into its leading RFC 3339 timestamp and the rest of the line.
+func splitTimestamp(line string) (time.Time, string, bool) {
+	stamp, rest, found := strings.Cut(line, " ")
+	if !found {
+		return time.Time{}, line, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, stamp)
+	if err != nil {
+		return time.Time{}, line, false
+	}
+	return t, rest, true
+}
+
+var errLimitReached = errors.New("log byte limit reached")
+
+// limitWriter writes at most n bytes to w.
+type limitWriter struct {
+	w io.Writer
+	n int
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if len(p) > l.n {
+		n, err := l.w.Write(p[:l.n])
+		l.n -= n
+		if err == nil {
+			err = errLimitReached
+		}
+		return n, err
+	}
+	n, err := l.w.Write(p)
+	l.n -= n
+	return n, err
+}
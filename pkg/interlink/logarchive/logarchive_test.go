@@ -0,0 +1,169 @@
+package logarchive
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+)
+
+const testLogs = "2026-01-02T10:00:00Z first\n" +
+	"2026-01-02T10:00:10.5Z second\n" +
+	"continued without timestamp\n" +
+	"2026-01-02T10:00:20Z third\n"
+
+func TestNew(t *testing.T) {
+	_, err := New(types.Config{LogArchive: types.LogArchiveConfig{Enabled: true}})
+	require.Error(t, err)
+
+	root := t.TempDir()
+	archive, err := New(types.Config{DataRootFolder: root})
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "log-archive"), archive.dir)
+	assert.Equal(t, 7*24*time.Hour, archive.retention)
+	assert.Equal(t, int64(1024)<<20, archive.maxSize)
+}
+
+func TestStoreAndWriteLogs(t *testing.T) {
+	archive, err := Open(t.TempDir(), time.Hour, 1<<20)
+	require.NoError(t, err)
+
+	assert.False(t, archive.Has("default", "uid", "main"))
+	require.NoError(t, archive.Store("default", "uid", "main", strings.NewReader(testLogs)))
+	assert.True(t, archive.Has("default", "uid", "main"))
+
+	var out bytes.Buffer
+	require.NoError(t, archive.WriteLogs(&out, "default", "uid", "main", types.ContainerLogOpts{Timestamps: true}, time.Now()))
+	assert.Equal(t, testLogs, out.String())
+
+	err = archive.WriteLogs(&out, "default", "uid", "sidecar", types.ContainerLogOpts{}, time.Now())
+	assert.ErrorIs(t, err, ErrNotArchived)
+
+	// a failed store keeps the logs archived before
+	require.Error(t, archive.Store("default", "uid", "main", &failingReader{}))
+	out.Reset()
+	require.NoError(t, archive.WriteLogs(&out, "default", "uid", "main", types.ContainerLogOpts{Tail: 1}, time.Now()))
+	assert.Equal(t, "third\n", out.String())
+
+	require.NoError(t, archive.Remove("default", "uid"))
+	assert.False(t, archive.Has("default", "uid", "main"))
+}
+
+func TestStoreDoesNotBlockRemove(t *testing.T) {
+	archive, err := Open(t.TempDir(), time.Hour, 1<<20)
+	require.NoError(t, err)
+	require.NoError(t, archive.Store("default", "other", "main", strings.NewReader(testLogs)))
+
+	logs, writer := io.Pipe()
+	stored := make(chan error, 1)
+	go func() { stored <- archive.Store("default", "uid", "main", logs) }()
+	_, err = writer.Write([]byte(testLogs))
+	require.NoError(t, err)
+
+	// the logs are still streaming: removing and pruning the archive does not wait for them
+	removed := make(chan error, 1)
+	go func() {
+		if err := archive.Remove("default", "other"); err != nil {
+			removed <- err
+			return
+		}
+		_, err := archive.Prune(time.Now())
+		removed <- err
+	}()
+	select {
+	case err := <-removed:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Remove blocked behind Store")
+	}
+
+	require.NoError(t, writer.Close())
+	require.NoError(t, <-stored)
+	assert.True(t, archive.Has("default", "uid", "main"))
+}
+
+func TestInvalidNames(t *testing.T) {
+	archive, err := Open(t.TempDir(), time.Hour, 1<<20)
+	require.NoError(t, err)
+
+	assert.Error(t, archive.Store("default", "uid", "../escape", strings.NewReader("x")))
+	assert.Error(t, archive.Store("..", "uid", "main", strings.NewReader("x")))
+	assert.Error(t, archive.Remove("default", "a/b"))
+	assert.False(t, archive.Has("default", "uid", ""))
+}
+
+func TestFilter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 10, 1, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		opts types.ContainerLogOpts
+		want string
+	}{
+		{"all without timestamps", types.ContainerLogOpts{}, "first\nsecond\ncontinued without timestamp\nthird\n"},
+		{"tail", types.ContainerLogOpts{Tail: 2}, "continued without timestamp\nthird\n"},
+		{"limit bytes", types.ContainerLogOpts{LimitBytes: 9}, "first\nsec"},
+		{"since time", types.ContainerLogOpts{SinceTime: time.Date(2026, 1, 2, 10, 0, 10, 0, time.UTC)}, "second\ncontinued without timestamp\nthird\n"},
+		{"since seconds", types.ContainerLogOpts{SinceSeconds: 45, Timestamps: true}, "continued without timestamp\n2026-01-02T10:00:20Z third\n"},
+		{"since time and tail", types.ContainerLogOpts{SinceTime: time.Date(2026, 1, 2, 10, 0, 5, 0, time.UTC), Tail: 1}, "third\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			require.NoError(t, Filter(&out, strings.NewReader(testLogs), tt.opts, now))
+			assert.Equal(t, tt.want, out.String())
+		})
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, Filter(&out, strings.NewReader("no trailing newline"), types.ContainerLogOpts{}, now))
+	assert.Equal(t, "no trailing newline", out.String())
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	archive, err := Open(dir, 24*time.Hour, 1<<20)
+	require.NoError(t, err)
+	now := time.Now()
+
+	for _, uid := range []string{"old", "recent", "newest"} {
+		require.NoError(t, archive.Store("default", uid, "main", strings.NewReader(testLogs)))
+	}
+	age := func(uid string, d time.Duration) {
+		path := filepath.Join(dir, "default-"+uid, "main.log.gz")
+		require.NoError(t, os.Chtimes(path, now.Add(-d), now.Add(-d)))
+	}
+	age("old", 48*time.Hour)
+	age("recent", 2*time.Hour)
+	age("newest", time.Hour)
+
+	removed, err := archive.Prune(now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed, "pods older than the retention are removed")
+	assert.False(t, archive.Has("default", "old", "main"))
+	assert.True(t, archive.Has("default", "recent", "main"))
+
+	// over the maximum size, the oldest pods go first
+	info, err := os.Stat(filepath.Join(dir, "default-newest", "main.log.gz"))
+	require.NoError(t, err)
+	archive.maxSize = info.Size()
+	removed, err = archive.Prune(now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assert.False(t, archive.Has("default", "recent", "main"))
+	assert.True(t, archive.Has("default", "newest", "main"))
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
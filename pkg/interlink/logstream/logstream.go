@@ -0,0 +1,196 @@
+// Package logstream frames the follow-mode log streams sent by interLink to the Virtual Kubelet.
+//
+// A raw log stream cannot carry keep-alives: any byte would end up in the logs. When the
+// Virtual Kubelet accepts ContentType, interLink sends the logs as a sequence of frames
+// instead, each made of a type byte, a 4-byte big-endian payload length and the payload:
+//
+//   - FrameData carries log bytes
+//   - FrameHeartbeat is empty, and keeps idle streams and the proxies on their way open
+//   - FrameError ends the stream with the error message in its payload
+//   - FrameEnd ends the stream normally, with an optional reason in its payload
+//
+// A stream that stops without FrameError or FrameEnd was interrupted.
+package logstream
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// ContentType identifies framed log streams, in the Accept header of the requests and in the
+// Content-Type header of the responses.
+const ContentType = "application/vnd.interlink.log-stream"
+
+// Frame types.
+const (
+	FrameData      byte = 'D'
+	FrameHeartbeat byte = 'H'
+	FrameError     byte = 'E'
+	FrameEnd       byte = 'Z'
+)
+
+const (
+	headerSize = 5
+	// MaxFrameSize bounds the payload of a frame. Larger writes are split.
+	MaxFrameSize = 1 << 20
+)
+
+// ErrInterrupted is returned by a Reader when the stream stops without an end frame.
+var ErrInterrupted = errors.New("log stream interrupted")
+
+// StreamError is the error sent by interLink in a FrameError.
+type StreamError struct {
+	Message string
+}
+
+func (e *StreamError) Error() string {
+	return e.Message
+}
+
+// Writer writes frames, and flushes each of them when the underlying writer is an
+// http.Flusher. It is safe for concurrent use, e.g. by a heartbeat goroutine.
+type Writer struct {
+	mu    sync.Mutex
+	w     io.Writer
+	flush func()
+}
+
+// NewWriter returns a Writer framing its output to w.
+func NewWriter(w io.Writer) *Writer {
+	sw := &Writer{w: w, flush: func() {}}
+	if f, ok := w.(http.Flusher); ok {
+		sw.flush = f.Flush
+	}
+	return sw
+}
+
+// Write sends p in data frames.
+func (sw *Writer) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), MaxFrameSize)
+		if err := sw.frame(FrameData, p[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Heartbeat sends a heartbeat frame.
+func (sw *Writer) Heartbeat() error {
+	return sw.frame(FrameHeartbeat, nil)
+}
+
+// Error ends the stream with an error.
+func (sw *Writer) Error(message string) error {
+	return sw.frame(FrameError, truncate(message))
+}
+
+// End ends the stream normally. reason may be empty.
+func (sw *Writer) End(reason string) error {
+	return sw.frame(FrameEnd, truncate(reason))
+}
+
+func truncate(s string) []byte {
+	if len(s) > MaxFrameSize {
+		s = s[:MaxFrameSize]
+	}
+	return []byte(s)
+}
+
+func (sw *Writer) frame(kind byte, payload []byte) error {
+	var header [headerSize]byte
+	header[0] = kind
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload))) // #nosec G115 -- bounded by MaxFrameSize
+
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if _, err := sw.w.Write(header[:]); err != nil {
+		return err
+	}
+	if len(payload) > 0 {
+		if _, err := sw.w.Write(payload); err != nil {
+			return err
+		}
+	}
+	sw.flush()
+	return nil
+}
+
+// Reader decodes a framed stream back into the raw logs.
+type Reader struct {
+	r       io.ReadCloser
+	alive   func()
+	pending []byte
+	err     error
+}
+
+// NewReader returns a Reader decoding the frames read from r. alive, when not nil, is called
+// for every frame received, heartbeats included. Closing the Reader closes r.
+func NewReader(r io.ReadCloser, alive func()) *Reader {
+	if alive == nil {
+		alive = func() {}
+	}
+	return &Reader{r: r, alive: alive}
+}
+
+// Read returns the log bytes of the data frames. It returns io.EOF at the end frame, the
+// *StreamError of an error frame, and ErrInterrupted when the stream stops unexpectedly.
+func (sr *Reader) Read(p []byte) (int, error) {
+	for len(sr.pending) == 0 {
+		if sr.err != nil {
+			return 0, sr.err
+		}
+		sr.err = sr.next()
+	}
+	n := copy(p, sr.pending)
+	sr.pending = sr.pending[n:]
+	return n, nil
+}
+
+// next reads a frame. It returns the error ending the stream, if any.
+func (sr *Reader) next() error {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(sr.r, header[:]); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return ErrInterrupted
+		}
+		return err
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > MaxFrameSize {
+		return fmt.Errorf("log stream frame of %d bytes exceeds the maximum of %d", size, MaxFrameSize)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(sr.r, payload); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return ErrInterrupted
+		}
+		return err
+	}
+	sr.alive()
+
+	switch header[0] {
+	case FrameData:
+		sr.pending = payload
+	case FrameHeartbeat:
+	case FrameError:
+		return &StreamError{Message: string(payload)}
+	case FrameEnd:
+		return io.EOF
+	default:
+		return fmt.Errorf("unknown log stream frame type %q", header[0])
+	}
+	return nil
+}
+
+// Close closes the underlying stream.
+func (sr *Reader) Close() error {
+	return sr.r.Close()
+}
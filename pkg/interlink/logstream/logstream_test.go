@@ -0,0 +1,55 @@
+package logstream
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	require.NoError(t, w.Heartbeat())
+	_, err := w.Write([]byte("line 1\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Heartbeat())
+	large := strings.Repeat("x", MaxFrameSize+10)
+	_, err = w.Write([]byte(large))
+	require.NoError(t, err)
+	require.NoError(t, w.End("done"))
+
+	frames := 0
+	r := NewReader(io.NopCloser(&buf), func() { frames++ })
+	out, err := io.ReadAll(r)
+	require.NoError(t, err, "the end frame is a clean EOF")
+	assert.Equal(t, "line 1\n"+large, string(out))
+	assert.Equal(t, 6, frames, "heartbeats count as activity, and large writes are split")
+}
+
+func TestReaderErrors(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	_, err := w.Write([]byte("partial"))
+	require.NoError(t, err)
+	require.NoError(t, w.Error("sidecar returned HTTP 500"))
+
+	out, err := io.ReadAll(NewReader(io.NopCloser(&buf), nil))
+	assert.Equal(t, "partial", string(out))
+	var streamErr *StreamError
+	require.ErrorAs(t, err, &streamErr)
+	assert.Equal(t, "sidecar returned HTTP 500", streamErr.Message)
+
+	buf.Reset()
+	_, err = w.Write([]byte("cut"))
+	require.NoError(t, err)
+	out, err = io.ReadAll(NewReader(io.NopCloser(bytes.NewReader(buf.Bytes()[:buf.Len()-1])), nil))
+	assert.Empty(t, out)
+	require.ErrorIs(t, err, ErrInterrupted)
+
+	_, err = io.ReadAll(NewReader(io.NopCloser(strings.NewReader("X\x00\x00\x00\x00")), nil))
+	require.ErrorContains(t, err, "unknown log stream frame type")
+}
@@ -9,6 +9,15 @@ import (
 	v1 "k8s.io/api/core/v1"
 )
 
+const (
+	// APIVersionHeader negotiates the version of the interLink API. Clients list the versions
+	// they speak (e.g. "v2, v1") and interLink answers with the one it picked.
+	APIVersionHeader = "InterLink-API-Version"
+	// APIVersionV1 is the first versioned API, whose wire format is the one of the legacy
+	// unversioned endpoints.
+	APIVersionV1 = "v1"
+)
+
 // PodCreateRequests represents a request to create one or more pods on the remote system.
 // It contains the pod specification along with all necessary supporting resources
 // such as ConfigMaps, Secrets, and projected volumes that the pod requires.
@@ -48,6 +57,76 @@ type PodStatus struct {
 	InitContainers []v1.ContainerStatus `json:"initContainers"`
 }
 
+// PodStats reports the resource usage of a pod measured by a plugin on the remote system. It
+// is the element of the response of the /stats endpoints. The values a plugin cannot measure
+// are left unset, and the containers it has no data for are left out.
+type PodStats struct {
+	// PodName is the name of the Kubernetes pod
+	PodName string `json:"name"`
+	// PodUID is the unique identifier of the Kubernetes pod
+	PodUID string `json:"UID"`
+	// PodNamespace is the namespace where the pod is deployed
+	PodNamespace string `json:"namespace"`
+	// Time is when the usage was measured; the time of the answer when unset
+	Time time.Time `json:"time"`
+	// Containers holds the usage of the containers of the pod
+	Containers []ContainerStats `json:"containers"`
+	// Network holds the network usage of the pod (optional)
+	Network *NetworkStats `json:"network,omitempty"`
+}
+
+// ContainerStats reports the resource usage of a container.
+type ContainerStats struct {
+	// Name is the container's name as specified in the pod
+	Name string `json:"name"`
+	// CPU holds the CPU usage (optional)
+	CPU *CPUStats `json:"cpu,omitempty"`
+	// Memory holds the memory usage (optional)
+	Memory *MemoryStats `json:"memory,omitempty"`
+	// Filesystem holds the usage of the writable layer or scratch space of the container (optional)
+	Filesystem *FilesystemStats `json:"filesystem,omitempty"`
+}
+
+// CPUStats reports the CPU usage of a container.
+type CPUStats struct {
+	// UsageNanoCores is the CPU usage averaged over the last sampling interval, in billionths of a core
+	UsageNanoCores *uint64 `json:"usageNanoCores,omitempty"`
+	// UsageCoreNanoSeconds is the cumulative CPU time consumed, in core-nanoseconds
+	UsageCoreNanoSeconds *uint64 `json:"usageCoreNanoSeconds,omitempty"`
+}
+
+// MemoryStats reports the memory usage of a container, in bytes.
+type MemoryStats struct {
+	// UsageBytes is the total memory in use, including caches
+	UsageBytes *uint64 `json:"usageBytes,omitempty"`
+	// WorkingSetBytes is the memory that cannot be reclaimed, which memory limits and kubectl top use
+	WorkingSetBytes *uint64 `json:"workingSetBytes,omitempty"`
+	// RSSBytes is the anonymous and swap cache memory
+	RSSBytes *uint64 `json:"rssBytes,omitempty"`
+}
+
+// FilesystemStats reports the usage of a filesystem, in bytes.
+type FilesystemStats struct {
+	// UsedBytes is the space used by the container
+	UsedBytes *uint64 `json:"usedBytes,omitempty"`
+	// CapacityBytes is the size of the filesystem
+	CapacityBytes *uint64 `json:"capacityBytes,omitempty"`
+	// AvailableBytes is the space left on the filesystem
+	AvailableBytes *uint64 `json:"availableBytes,omitempty"`
+}
+
+// NetworkStats reports the cumulative network usage of a pod.
+type NetworkStats struct {
+	// RxBytes is the number of bytes received
+	RxBytes *uint64 `json:"rxBytes,omitempty"`
+	// TxBytes is the number of bytes sent
+	TxBytes *uint64 `json:"txBytes,omitempty"`
+	// RxErrors is the number of errors while receiving
+	RxErrors *uint64 `json:"rxErrors,omitempty"`
+	// TxErrors is the number of errors while sending
+	TxErrors *uint64 `json:"txErrors,omitempty"`
+}
+
 // CreateStruct represents the response from the interLink API when a pod creation is requested.
 // It provides the mapping between the Kubernetes pod UUID and the remote system's job identifier,
 // enabling status tracking and management of the pod throughout its lifecycle.
@@ -129,6 +208,64 @@ type LogStruct struct {
 	Opts ContainerLogOpts `json:"Opts"`
 }
 
+// ExecRequest opens a kubectl exec session in a container. It is the first frame of the
+// channel stream sent to the /exec endpoints.
+type ExecRequest struct {
+	// Namespace is the Kubernetes namespace of the pod
+	Namespace string `json:"Namespace"`
+	// PodUID is the unique identifier of the pod
+	PodUID string `json:"PodUID"`
+	// PodName is the name of the pod
+	PodName string `json:"PodName"`
+	// ContainerName is the name of the container the command runs in
+	ContainerName string `json:"ContainerName"`
+	// Command is the command to run and its arguments
+	Command []string `json:"Command"`
+	// Stdin tells whether the client sends the standard input of the command
+	Stdin bool `json:"Stdin"`
+	// Stdout tells whether the client reads the standard output of the command
+	Stdout bool `json:"Stdout"`
+	// Stderr tells whether the client reads the standard error of the command
+	Stderr bool `json:"Stderr"`
+	// TTY tells whether the command runs in a terminal, resized through the resize channel
+	TTY bool `json:"TTY"`
+}
+
+// AttachRequest attaches a kubectl attach session to the main process of a container. It is
+// the first frame of the channel stream sent to the /attach endpoints.
+type AttachRequest struct {
+	// Namespace is the Kubernetes namespace of the pod
+	Namespace string `json:"Namespace"`
+	// PodUID is the unique identifier of the pod
+	PodUID string `json:"PodUID"`
+	// PodName is the name of the pod
+	PodName string `json:"PodName"`
+	// ContainerName is the name of the container to attach to
+	ContainerName string `json:"ContainerName"`
+	// Stdin tells whether the client writes to the standard input of the process
+	Stdin bool `json:"Stdin"`
+	// Stdout tells whether the client reads the standard output of the process
+	Stdout bool `json:"Stdout"`
+	// Stderr tells whether the client reads the standard error of the process
+	Stderr bool `json:"Stderr"`
+	// TTY tells whether the process runs in a terminal, resized through the resize channel
+	TTY bool `json:"TTY"`
+}
+
+// PortForwardRequest forwards a kubectl port-forward connection to a port of a pod. It is the
+// first frame of the channel stream sent to the /portforward endpoints; the bytes sent to the
+// port then travel on the stdin channel, and the bytes received on the stdout channel.
+type PortForwardRequest struct {
+	// Namespace is the Kubernetes namespace of the pod
+	Namespace string `json:"Namespace"`
+	// PodUID is the unique identifier of the pod
+	PodUID string `json:"PodUID"`
+	// PodName is the name of the pod
+	PodName string `json:"PodName"`
+	// Port is the port of the pod to connect to
+	Port int32 `json:"Port"`
+}
+
 // PingResponse represents the optional structured response from the InterLink plugin ping endpoint.
 // Plugins may return a JSON body with this structure to report their status and available resources.
 // If the response body cannot be parsed as this structure, it is treated as a plain text response
@@ -143,6 +280,113 @@ type PingResponse struct {
 	// When present (even as an empty list), the node's non-system taints are replaced with
 	// this list. When absent, existing taints are left unchanged.
 	Taints *[]TaintResponse `json:"taints,omitempty"`
+	// Plugins reports the health of every sidecar plugin when interLink routes pods to more than one.
+	// Resources and Taints then aggregate the values reported by the healthy plugins.
+	Plugins []PluginPingStatus `json:"plugins,omitempty"`
+}
+
+const (
+	// ReadinessOK marks a ready interLink, or a dependency that is available
+	ReadinessOK = "ok"
+	// ReadinessUnavailable marks an interLink that is not ready, or a dependency that is not available
+	ReadinessUnavailable = "unavailable"
+)
+
+// ReadinessResponse is the body returned by the interLink /readyz endpoint.
+type ReadinessResponse struct {
+	// Status is ReadinessOK when every check passed, ReadinessUnavailable otherwise
+	Status string `json:"status"`
+	// Checks lists the outcome of every dependency check
+	Checks []ReadinessCheck `json:"checks"`
+}
+
+// ReadinessCheck is the outcome of checking a single interLink dependency.
+type ReadinessCheck struct {
+	// Name identifies the dependency, e.g. "sidecar/default", "tls" or "statusStore"
+	Name string `json:"name"`
+	// Status is ReadinessOK or ReadinessUnavailable
+	Status string `json:"status"`
+	// Error describes why the dependency is unavailable
+	Error string `json:"error,omitempty"`
+}
+
+const (
+	// PodStatusEventModified is sent when the cached status of a pod is added or changes
+	PodStatusEventModified = "MODIFIED"
+	// PodStatusEventDeleted is sent when a pod is removed from the status cache
+	PodStatusEventDeleted = "DELETED"
+)
+
+// PodStatusEvent is a change of the interLink pod status cache, as streamed by the /watch endpoint.
+type PodStatusEvent struct {
+	// Type is either PodStatusEventModified or PodStatusEventDeleted
+	Type string `json:"type"`
+	// Status is the new status of the pod, or its last known status when deleted
+	Status PodStatus `json:"status"`
+}
+
+const (
+	// ValidationError marks a finding that prevents the pod from running as specified
+	ValidationError = "error"
+	// ValidationWarning marks a finding the pod may run with, though probably not as intended
+	ValidationWarning = "warning"
+	// ValidationIgnored marks a field of the pod that is not honored once offloaded
+	ValidationIgnored = "ignored"
+
+	// ValidationSourceVirtualKubelet, ValidationSourceInterLink and ValidationSourcePlugin
+	// tell which component reported a finding
+	ValidationSourceVirtualKubelet = "virtual-kubelet"
+	ValidationSourceInterLink      = "interlink"
+	ValidationSourcePlugin         = "plugin"
+)
+
+// ValidationFinding is an issue found in a pod by a /validate call.
+type ValidationFinding struct {
+	// Severity is ValidationError, ValidationWarning or ValidationIgnored
+	Severity string `json:"severity"`
+	// Field is the path of the pod field concerned, e.g. "spec.volumes[0].persistentVolumeClaim"
+	Field string `json:"field,omitempty"`
+	// Message describes the issue
+	Message string `json:"message"`
+	// Source is the component that reported the finding
+	Source string `json:"source,omitempty"`
+}
+
+// ValidationResponse is the body returned by the /validate endpoints of the Virtual Kubelet,
+// interLink and the plugins, which check whether a pod can be offloaded without creating it.
+type ValidationResponse struct {
+	// Valid is false when at least one finding is a ValidationError
+	Valid bool `json:"valid"`
+	// Findings lists the issues found, empty when there are none
+	Findings []ValidationFinding `json:"findings"`
+}
+
+// NewValidationResponse returns the response reporting findings.
+func NewValidationResponse(findings []ValidationFinding) ValidationResponse {
+	response := ValidationResponse{Valid: true, Findings: findings}
+	if response.Findings == nil {
+		response.Findings = []ValidationFinding{}
+	}
+	for _, finding := range findings {
+		if finding.Severity == ValidationError {
+			response.Valid = false
+		}
+	}
+	return response
+}
+
+// PluginPingStatus reports the outcome of pinging a single sidecar plugin.
+type PluginPingStatus struct {
+	// Name is the sidecar name as configured in interLink
+	Name string `json:"name"`
+	// Status is "ok" when the plugin answered successfully, "unavailable" otherwise
+	Status string `json:"status"`
+	// HTTPCode is the HTTP status code returned by the plugin, if any
+	HTTPCode int `json:"httpCode,omitempty"`
+	// Error describes why the plugin is unavailable
+	Error string `json:"error,omitempty"`
+	// Circuit is the state of the circuit breaker of the plugin: "closed", "open" or "half-open"
+	Circuit string `json:"circuit,omitempty"`
 }
 
 // TaintResponse represents a Kubernetes taint to be applied to the virtual node,
@@ -166,6 +410,11 @@ type ResourcesResponse struct {
 	Memory string `json:"memory,omitempty"`
 	// Pods specifies the maximum number of pods this node can handle
 	Pods string `json:"pods,omitempty"`
+	// CPUUsage optionally reports the CPU currently in use (e.g., "12", "3500m"), exposed as the
+	// node usage on the /metrics/resource endpoint of the Virtual Kubelet
+	CPUUsage string `json:"cpuUsage,omitempty"`
+	// MemoryUsage optionally reports the memory currently in use (e.g., "48Gi")
+	MemoryUsage string `json:"memoryUsage,omitempty"`
 	// Accelerators lists hardware accelerators available on this node (GPUs, FPGAs, etc.)
 	Accelerators []AcceleratorResponse `json:"accelerators,omitempty"`
 }
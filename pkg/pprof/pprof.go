@@ -14,10 +14,35 @@ import (
 // It listens on listenAddr, falling back to defaultAddr if listenAddr is empty.
 // The server stops when the provided context is canceled.
 func Start(ctx context.Context, enabled bool, listenAddr string, defaultAddr string) {
-	if !enabled {
+	server := NewServer(enabled, listenAddr, defaultAddr)
+	if server == nil {
 		return
 	}
 
+	go func() {
+		<-ctx.Done()
+		logrus.Infof("Shutting down pprof server on %s", server.Addr)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logrus.Errorf("pprof server on %s shutdown error: %v", server.Addr, err)
+		}
+	}()
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logrus.Errorf("pprof server on %s failed: %v", server.Addr, err)
+		}
+	}()
+}
+
+// NewServer returns the pprof HTTP server, not started yet, for the callers managing its
+// lifecycle themselves; nil when profiling is not enabled. The address is chosen as in Start.
+func NewServer(enabled bool, listenAddr string, defaultAddr string) *http.Server {
+	if !enabled {
+		return nil
+	}
+
 	addr := listenAddr
 	if addr == "" {
 		addr = defaultAddr
@@ -38,23 +63,7 @@ func Start(ctx context.Context, enabled bool, listenAddr string, defaultAddr str
 
 	logrus.Infof("Starting pprof server on http://%s/debug/pprof/", addr)
 
-	server := &http.Server{
+	return &http.Server{
 		Addr: addr,
 	}
-
-	go func() {
-		<-ctx.Done()
-		logrus.Infof("Shutting down pprof server on %s", addr)
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		if err := server.Shutdown(shutdownCtx); err != nil {
-			logrus.Errorf("pprof server on %s shutdown error: %v", addr, err)
-		}
-	}()
-
-	go func() {
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logrus.Errorf("pprof server on %s failed: %v", addr, err)
-		}
-	}()
 }
@@ -63,3 +63,15 @@ func TestPprofDisabled(t *testing.T) {
 		t.Error("expected connection failure for disabled pprof server, but dial succeeded")
 	}
 }
+
+func TestPprofNewServer(t *testing.T) {
+	if server := NewServer(false, "127.0.0.1:7000", "127.0.0.1:6060"); server != nil {
+		t.Errorf("expected no server when disabled, got one on %s", server.Addr)
+	}
+	if server := NewServer(true, "", "127.0.0.1:6060"); server == nil || server.Addr != "127.0.0.1:6060" {
+		t.Errorf("expected a server on the default address, got %v", server)
+	}
+	if server := NewServer(true, "7000", "127.0.0.1:6060"); server == nil || server.Addr != ":7000" {
+		t.Errorf("expected a server on port 7000, got %v", server)
+	}
+}
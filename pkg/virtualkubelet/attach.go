@@ -0,0 +1,60 @@
+package virtualkubelet
+
+import (
+	"context"
+	"fmt"
+	mathrand "math/rand"
+	"strconv"
+	"time"
+
+	"github.com/containerd/containerd/log"
+	"github.com/virtual-kubelet/virtual-kubelet/node/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	trace "go.opentelemetry.io/otel/trace"
+)
+
+// AttachToContainer attaches to the main process of a container of an offloaded pod, for
+// kubectl attach. The session goes through interLink to the /attach endpoint of the plugin,
+// tagged with its own InterLink-Http-Session header. Leaving the session detaches from the
+// process without stopping it.
+func (p *Provider) AttachToContainer(ctx context.Context, namespace, podName, containerName string, attach api.AttachIO) error {
+	start := time.Now().Unix()
+	tracer := otel.Tracer("interlink-service")
+	sessionContext := "Attach#" + strconv.Itoa(mathrand.Intn(100000))
+	ctx, span := tracer.Start(ctx, "AttachToContainerVK", trace.WithAttributes(
+		attribute.String("pod.name", podName),
+		attribute.String("pod.namespace", namespace),
+		attribute.String("container.name", containerName),
+		attribute.String("session.id", sessionContext),
+		attribute.Int64("start.timestamp", start),
+	))
+	defer span.End()
+	defer types.SetDurationSpan(start, span)
+
+	log.G(ctx).Infof(GetSessionContextMessage(sessionContext)+"receive AttachToContainer %s/%s/%s", namespace, podName, containerName)
+
+	pod, err := p.clientSet.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if parseDisableOffloadContainers(pod)[containerName] {
+		return fmt.Errorf("container %s of pod %s/%s is not offloaded", containerName, namespace, podName)
+	}
+
+	attachRequest := types.AttachRequest{
+		Namespace:     namespace,
+		PodUID:        string(pod.UID),
+		PodName:       podName,
+		ContainerName: containerName,
+		Stdin:         attach.Stdin() != nil,
+		Stdout:        attach.Stdout() != nil,
+		Stderr:        attach.Stderr() != nil,
+		TTY:           attach.TTY(),
+	}
+	return runSession(ctx, p.config, p.clientHTTPTransport, "/attach", attachRequest, attach, sessionContext)
+}
@@ -0,0 +1,70 @@
+package virtualkubelet
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+	"github.com/interlink-hq/interlink/pkg/interlink/channelstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/virtual-kubelet/virtual-kubelet/node/api"
+)
+
+func TestAttachToContainer(t *testing.T) {
+	p := testExecProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/attach", r.URL.Path)
+		assert.True(t, strings.HasPrefix(r.Header.Get("InterLink-Http-Session"), "Attach#"))
+		rc := http.NewResponseController(w)
+		assert.NoError(t, rc.EnableFullDuplex())
+		in := channelstream.NewReader(r.Body)
+		channel, payload, err := in.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, channelstream.ChannelRequest, channel)
+		var req types.AttachRequest
+		assert.NoError(t, json.Unmarshal(payload, &req))
+		assert.Equal(t, types.AttachRequest{
+			Namespace: "default", PodUID: "uid", PodName: "pod", ContainerName: "main", Stdout: true, TTY: true,
+		}, req)
+
+		w.Header().Set("Content-Type", channelstream.ContentType)
+		w.WriteHeader(http.StatusOK)
+		assert.NoError(t, rc.Flush())
+		out := channelstream.NewWriter(w)
+		channel, payload, err = in.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, channelstream.ChannelResize, channel)
+		assert.JSONEq(t, `{"width":100,"height":30}`, string(payload))
+		assert.NoError(t, out.WriteFrame(channelstream.ChannelStdout, []byte("$ ")))
+		assert.NoError(t, out.WriteJSON(channelstream.ChannelStatus, channelstream.Status{}))
+	})
+
+	resize := make(chan api.TermSize, 1)
+	resize <- api.TermSize{Width: 100, Height: 30}
+	var stdout bytes.Buffer
+	err := p.AttachToContainer(t.Context(), "default", "pod", "main", &testAttachIO{
+		stdout: nopWriteCloser{&stdout},
+		tty:    true,
+		resize: resize,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "$ ", stdout.String())
+}
+
+func TestAttachToContainer_Errors(t *testing.T) {
+	p := testExecProvider(t, func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "plugin docker does not support attach", http.StatusNotImplemented)
+	})
+	attach := &testAttachIO{stdout: nopWriteCloser{io.Discard}}
+
+	err := p.AttachToContainer(t.Context(), "default", "pod", "main", attach)
+	require.ErrorIs(t, err, ErrNotSupported)
+	assert.Contains(t, err.Error(), "plugin docker does not support attach")
+
+	err = p.AttachToContainer(t.Context(), "default", "pod", "local", attach)
+	assert.ErrorContains(t, err, "not offloaded")
+}
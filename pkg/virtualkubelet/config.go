@@ -1,5 +1,7 @@
 package virtualkubelet
 
+import "github.com/interlink-hq/interlink/pkg/interlink/compression"
+
 // Config holds the complete configuration for the Virtual Kubelet provider.
 // It defines how the virtual node connects to the Kubernetes cluster and interLink API.
 type Config struct {
@@ -60,8 +62,31 @@ type Config struct {
 	DisableCSR bool `yaml:"DisableCSR,omitempty"`
 	// Pprof configures the pprof profiling server
 	Pprof PprofConfig `yaml:"Pprof,omitempty"`
+	// StatusBatchSize is the maximum number of pods sent to interLink in a single status request (default: 100)
+	StatusBatchSize int `yaml:"StatusBatchSize,omitempty"`
+	// StatusLoopIntervalSeconds is the interval between two pod status updates (default: 5)
+	StatusLoopIntervalSeconds int `yaml:"StatusLoopIntervalSeconds,omitempty"`
+	// DisableStatusWatch disables the /watch status stream and relies on polling only
+	DisableStatusWatch bool `yaml:"DisableStatusWatch,omitempty"`
+	// StatusResyncIntervalSeconds is the polling interval used while the status stream is connected (default: 60)
+	StatusResyncIntervalSeconds int `yaml:"StatusResyncIntervalSeconds,omitempty"`
+	// StatsCacheSeconds is how long the resource usage reported by the plugins is reused for the stats summary (default: 10)
+	StatsCacheSeconds int `yaml:"StatsCacheSeconds,omitempty"`
+	// Compression configures the gzip/zstd compression of the bodies sent to interLink
+	Compression compression.Config `yaml:"Compression,omitempty"`
 }
 
+const (
+	// DefaultStatusBatchSize is the default maximum number of pods per status request
+	DefaultStatusBatchSize = 100
+	// DefaultStatusLoopIntervalSeconds is the default interval between two pod status updates
+	DefaultStatusLoopIntervalSeconds = 5
+	// DefaultStatusResyncIntervalSeconds is the default polling interval while the status stream is connected
+	DefaultStatusResyncIntervalSeconds = 60
+	// DefaultStatsCacheSeconds is the default time the resource usage reported by the plugins is reused
+	DefaultStatsCacheSeconds = 10
+)
+
 // TLSConfig holds TLS/mTLS configuration for secure communication with interLink API.
 type TLSConfig struct {
 	// Enabled indicates whether TLS is enabled
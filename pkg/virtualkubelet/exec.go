@@ -0,0 +1,204 @@
+package virtualkubelet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/log"
+	"github.com/virtual-kubelet/virtual-kubelet/node/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilexec "k8s.io/utils/exec"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+	"github.com/interlink-hq/interlink/pkg/interlink/channelstream"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	trace "go.opentelemetry.io/otel/trace"
+)
+
+// ErrNotSupported is returned for the interactive sessions the plugin of a pod does not support.
+var ErrNotSupported = errors.New("not supported by the interLink plugin")
+
+// RunInContainer runs a command in a container of an offloaded pod, for kubectl exec. The
+// session goes through interLink to the /exec endpoint of the plugin. A command exiting with
+// a non-zero code returns a utilexec.ExitError, which kubectl turns into its exit code.
+func (p *Provider) RunInContainer(ctx context.Context, namespace, podName, containerName string, cmd []string, attach api.AttachIO) error {
+	start := time.Now().Unix()
+	tracer := otel.Tracer("interlink-service")
+	ctx, span := tracer.Start(ctx, "RunInContainerVK", trace.WithAttributes(
+		attribute.String("pod.name", podName),
+		attribute.String("pod.namespace", namespace),
+		attribute.String("container.name", containerName),
+		attribute.Int64("start.timestamp", start),
+	))
+	defer span.End()
+	defer types.SetDurationSpan(start, span)
+
+	sessionContext := "Exec#" + strconv.Itoa(mathrand.Intn(100000))
+	log.G(ctx).Infof(GetSessionContextMessage(sessionContext)+"receive RunInContainer %s/%s/%s: %s", namespace, podName, containerName, strings.Join(cmd, " "))
+
+	pod, err := p.clientSet.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if parseDisableOffloadContainers(pod)[containerName] {
+		return fmt.Errorf("container %s of pod %s/%s is not offloaded", containerName, namespace, podName)
+	}
+
+	execRequest := types.ExecRequest{
+		Namespace:     namespace,
+		PodUID:        string(pod.UID),
+		PodName:       podName,
+		ContainerName: containerName,
+		Command:       cmd,
+		Stdin:         attach.Stdin() != nil,
+		Stdout:        attach.Stdout() != nil,
+		Stderr:        attach.Stderr() != nil,
+		TTY:           attach.TTY(),
+	}
+	return runSession(ctx, p.config, p.clientHTTPTransport, "/exec", execRequest, attach, sessionContext)
+}
+
+// runSession opens an interactive session on an interLink endpoint and runs it to its end: it
+// sends request, stdin and the terminal resizes, and writes the output to attach. It returns
+// the outcome of the status frame ending the session.
+func runSession(ctx context.Context, config Config, transport *http.Transport, path string, request any, attach api.AttachIO, sessionContext string) error {
+	sessionContextMessage := GetSessionContextMessage(sessionContext)
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	token := ""
+	if config.VKTokenFile != "" {
+		b, err := os.ReadFile(config.VKTokenFile)
+		if err != nil {
+			return err
+		}
+		token = string(b)
+	}
+
+	// the request lives as long as the session
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	body, pipe := io.Pipe()
+	defer body.Close()
+	interLinkEndpoint := getSidecarEndpoint(ctx, config.InterlinkURL, config.InterlinkPort)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, interLinkEndpoint+path, body)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Add("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("Content-Type", channelstream.ContentType)
+	req.Header.Set(types.APIVersionHeader, types.APIVersionV1)
+	// an interLink answering without reading the stream, e.g. with a 404, must not wait for its end
+	req.Header.Set("Expect", "100-continue")
+	AddSessionContext(req, sessionContext)
+	if !urlSafetyChecker(req.URL.String()) {
+		return fmt.Errorf("potential SSRF detected: %s", req.URL.String())
+	}
+
+	go sendSessionInput(ctx, pipe, payload, attach)
+
+	resp, err := (&http.Client{Transport: transport}).Do(req) // #nosec G704
+	if err != nil {
+		return fmt.Errorf("unable to open the %s session: %w", strings.TrimPrefix(path, "/"), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		switch resp.StatusCode {
+		case http.StatusNotImplemented:
+			return fmt.Errorf("%s %w: %s", strings.TrimPrefix(path, "/"), ErrNotSupported, strings.TrimSpace(string(message)))
+		case http.StatusNotFound:
+			return fmt.Errorf("%s %w: interLink has no %s endpoint", strings.TrimPrefix(path, "/"), ErrNotSupported, path)
+		}
+		return fmt.Errorf("interLink returned HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	output := channelstream.NewReader(resp.Body)
+	for {
+		channel, payload, err := output.Next()
+		if err != nil {
+			return fmt.Errorf("%s session interrupted: %w", strings.TrimPrefix(path, "/"), err)
+		}
+		var out io.Writer
+		switch channel {
+		case channelstream.ChannelStdout:
+			out = attach.Stdout()
+		case channelstream.ChannelStderr:
+			out = attach.Stderr()
+		case channelstream.ChannelStatus:
+			var status channelstream.Status
+			if err := json.Unmarshal(payload, &status); err != nil {
+				return fmt.Errorf("invalid session status: %w", err)
+			}
+			log.G(ctx).Debug(sessionContextMessage, "session ended with exit code ", status.ExitCode, " ", status.Error)
+			switch {
+			case status.Error != "":
+				return errors.New(status.Error)
+			case status.ExitCode != 0:
+				return utilexec.CodeExitError{Err: fmt.Errorf("exit status %d", status.ExitCode), Code: status.ExitCode}
+			}
+			return nil
+		}
+		if out == nil || len(payload) == 0 {
+			continue
+		}
+		if _, err := out.Write(payload); err != nil {
+			return fmt.Errorf("unable to write the output of the session: %w", err)
+		}
+	}
+}
+
+// sendSessionInput writes the request frame, then stdin and the terminal resizes, to the
+// request body of a session. The body stays open until the session ends, for the resizes.
+func sendSessionInput(ctx context.Context, pipe *io.PipeWriter, request []byte, attach api.AttachIO) {
+	input := channelstream.NewWriter(pipe)
+	if err := input.WriteFrame(channelstream.ChannelRequest, request); err != nil {
+		pipe.CloseWithError(err)
+		return
+	}
+
+	if resize := attach.Resize(); attach.TTY() && resize != nil {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case size, ok := <-resize:
+					if !ok {
+						return
+					}
+					if err := input.WriteJSON(channelstream.ChannelResize, channelstream.TermSize{Width: size.Width, Height: size.Height}); err != nil {
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	if stdin := attach.Stdin(); stdin != nil {
+		if _, err := io.Copy(input.Channel(channelstream.ChannelStdin), stdin); err != nil {
+			pipe.CloseWithError(err)
+			return
+		}
+		if err := input.CloseChannel(channelstream.ChannelStdin); err != nil {
+			pipe.CloseWithError(err)
+			return
+		}
+	}
+	<-ctx.Done()
+	pipe.Close()
+}
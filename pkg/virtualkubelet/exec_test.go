@@ -0,0 +1,151 @@
+package virtualkubelet
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+	"github.com/interlink-hq/interlink/pkg/interlink/channelstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/virtual-kubelet/virtual-kubelet/node/api"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sTypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	utilexec "k8s.io/utils/exec"
+)
+
+type testAttachIO struct {
+	stdin  io.Reader
+	stdout io.WriteCloser
+	stderr io.WriteCloser
+	tty    bool
+	resize chan api.TermSize
+}
+
+func (a *testAttachIO) Stdin() io.Reader            { return a.stdin }
+func (a *testAttachIO) Stdout() io.WriteCloser      { return a.stdout }
+func (a *testAttachIO) Stderr() io.WriteCloser      { return a.stderr }
+func (a *testAttachIO) TTY() bool                   { return a.tty }
+func (a *testAttachIO) Resize() <-chan api.TermSize { return a.resize }
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func testExecProvider(t *testing.T, handler http.HandlerFunc) *Provider {
+	t.Helper()
+	return &Provider{
+		config:              newTestInterLinkServer(t, handler),
+		clientHTTPTransport: &http.Transport{},
+		clientSet: fake.NewSimpleClientset(&v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:        "pod",
+			Namespace:   "default",
+			UID:         k8sTypes.UID("uid"),
+			Annotations: map[string]string{annDisableOffloadContainers: "local"},
+		}}),
+	}
+}
+
+// readExecRequest reads the request frame of an exec session, and answers the session.
+func readExecRequest(t *testing.T, w http.ResponseWriter, r *http.Request) (types.ExecRequest, *channelstream.Reader, *channelstream.Writer) {
+	rc := http.NewResponseController(w)
+	assert.NoError(t, rc.EnableFullDuplex())
+	in := channelstream.NewReader(r.Body)
+	channel, payload, err := in.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, channelstream.ChannelRequest, channel)
+	var req types.ExecRequest
+	assert.NoError(t, json.Unmarshal(payload, &req))
+
+	w.Header().Set("Content-Type", channelstream.ContentType)
+	w.WriteHeader(http.StatusOK)
+	assert.NoError(t, rc.Flush())
+	return req, in, channelstream.NewWriter(w)
+}
+
+func TestRunInContainer(t *testing.T) {
+	p := testExecProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/exec", r.URL.Path)
+		req, in, out := readExecRequest(t, w, r)
+		assert.Equal(t, types.ExecRequest{
+			Namespace: "default", PodUID: "uid", PodName: "pod", ContainerName: "main",
+			Command: []string{"cat"}, Stdin: true, Stdout: true, Stderr: true,
+		}, req)
+		for {
+			channel, payload, err := in.Next()
+			if !assert.NoError(t, err) || channel == channelstream.ChannelClose {
+				break
+			}
+			assert.NoError(t, out.WriteFrame(channelstream.ChannelStdout, bytes.ToUpper(payload)))
+		}
+		assert.NoError(t, out.WriteFrame(channelstream.ChannelStderr, []byte("done\n")))
+		assert.NoError(t, out.WriteJSON(channelstream.ChannelStatus, channelstream.Status{ExitCode: 3}))
+	})
+
+	var stdout, stderr bytes.Buffer
+	err := p.RunInContainer(t.Context(), "default", "pod", "main", []string{"cat"}, &testAttachIO{
+		stdin:  strings.NewReader("hello\n"),
+		stdout: nopWriteCloser{&stdout},
+		stderr: nopWriteCloser{&stderr},
+	})
+	var exitErr utilexec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 3, exitErr.ExitStatus())
+	assert.Equal(t, "HELLO\n", stdout.String())
+	assert.Equal(t, "done\n", stderr.String())
+}
+
+func TestRunInContainer_TTYResize(t *testing.T) {
+	p := testExecProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		req, in, out := readExecRequest(t, w, r)
+		assert.True(t, req.TTY)
+		assert.False(t, req.Stdin)
+		channel, payload, err := in.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, channelstream.ChannelResize, channel)
+		assert.JSONEq(t, `{"width":120,"height":40}`, string(payload))
+		assert.NoError(t, out.WriteJSON(channelstream.ChannelStatus, channelstream.Status{}))
+	})
+
+	resize := make(chan api.TermSize, 1)
+	resize <- api.TermSize{Width: 120, Height: 40}
+	var stdout bytes.Buffer
+	err := p.RunInContainer(t.Context(), "default", "pod", "main", []string{"sh"}, &testAttachIO{
+		stdout: nopWriteCloser{&stdout},
+		tty:    true,
+		resize: resize,
+	})
+	assert.NoError(t, err)
+}
+
+func TestRunInContainer_Errors(t *testing.T) {
+	p := testExecProvider(t, func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "plugin docker does not support exec", http.StatusNotImplemented)
+	})
+	attach := &testAttachIO{stdout: nopWriteCloser{io.Discard}}
+
+	err := p.RunInContainer(t.Context(), "default", "pod", "main", []string{"sh"}, attach)
+	require.ErrorIs(t, err, ErrNotSupported)
+	assert.Contains(t, err.Error(), "plugin docker does not support exec")
+
+	err = p.RunInContainer(t.Context(), "default", "pod", "local", []string{"sh"}, attach)
+	assert.ErrorContains(t, err, "not offloaded")
+
+	err = p.RunInContainer(t.Context(), "default", "missing", "main", []string{"sh"}, attach)
+	assert.Error(t, err)
+
+	p = testExecProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _, out := readExecRequest(t, w, r)
+		assert.NoError(t, out.WriteJSON(channelstream.ChannelStatus, channelstream.Status{Error: "container main is not running"}))
+	})
+	err = p.RunInContainer(t.Context(), "default", "pod", "main", []string{"sh"}, attach)
+	assert.EqualError(t, err, "container main is not running")
+}
@@ -20,6 +20,8 @@ import (
 	"time"
 
 	types "github.com/interlink-hq/interlink/pkg/interlink"
+	"github.com/interlink-hq/interlink/pkg/interlink/compression"
+	"github.com/interlink-hq/interlink/pkg/interlink/logstream"
 	authenticationv1 "k8s.io/api/authentication/v1"
 	k8sTypes "k8s.io/apimachinery/pkg/types"
 
@@ -261,11 +263,28 @@ func createTLSHTTPClient(ctx context.Context, tlsConfig TLSConfig) (*http.Client
 	return &http.Client{Transport: transport}, nil
 }
 
+// interLinkPeer records the encodings interLink accepts, shared by the clients of every call.
+var interLinkPeer compression.Peer
+
+// newInterLinkClient returns the HTTP client for the calls to the interLink API: TLS as
+// configured and, when enabled, compression of the request bodies.
+func newInterLinkClient(ctx context.Context, config Config) (*http.Client, error) {
+	httpClient, err := createTLSHTTPClient(ctx, config.TLS)
+	if err != nil || !config.Compression.Enabled {
+		return httpClient, err
+	}
+	return &http.Client{
+		Transport: compression.NewTransport(httpClient.Transport, config.Compression, &interLinkPeer),
+		Timeout:   httpClient.Timeout,
+	}, nil
+}
+
 func doRequestWithClient(req *http.Request, token string, httpClient *http.Client) (*http.Response, error) {
 	if token != "" {
 		req.Header.Add("Authorization", "Bearer "+token)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(types.APIVersionHeader, types.APIVersionV1)
 	if !urlSafetyChecker(req.URL.String()) {
 		return nil, fmt.Errorf("potential SSRF detected: %s", req.URL.String())
 	}
@@ -308,6 +327,7 @@ func PingInterLink(ctx context.Context, config Config) (bool, int, string, error
 		}
 		req.Header.Add("Authorization", "Bearer "+string(token))
 	}
+	req.Header.Set(types.APIVersionHeader, types.APIVersionV1)
 
 	startHTTPCall := time.Now().UnixMicro()
 	_, spanHTTP := tracer.Start(ctx, "PingHttpCall", trace.WithAttributes(
@@ -320,7 +340,7 @@ func PingInterLink(ctx context.Context, config Config) (bool, int, string, error
 	AddSessionContext(req, "PingInterLink#"+strconv.Itoa(rand.Intn(100000)))
 
 	// Create TLS-enabled HTTP client
-	httpClient, err := createTLSHTTPClient(ctx, config.TLS)
+	httpClient, err := newInterLinkClient(ctx, config)
 	if err != nil {
 		log.G(ctx).Error("Failed to create TLS HTTP client: ", err)
 		return false, retVal, "", err
@@ -368,6 +388,7 @@ func updateCacheRequest(ctx context.Context, config Config, pod v1.Pod, token st
 		req.Header.Add("Authorization", "Bearer "+token)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(types.APIVersionHeader, types.APIVersionV1)
 
 	startHTTPCall := time.Now().UnixMicro()
 	spanHTTP := traceExecute(ctx, &pod, "UpdateCacheHttpCall", startHTTPCall)
@@ -376,7 +397,7 @@ func updateCacheRequest(ctx context.Context, config Config, pod v1.Pod, token st
 	AddSessionContext(req, "UpdateCache#"+strconv.Itoa(rand.Intn(100000)))
 
 	// Create TLS-enabled HTTP client
-	httpClient, err := createTLSHTTPClient(ctx, config.TLS)
+	httpClient, err := newInterLinkClient(ctx, config)
 	if err != nil {
 		log.L.Error("Failed to create TLS HTTP client: ", err)
 		return err
@@ -433,7 +454,7 @@ func createRequest(ctx context.Context, config Config, pod types.PodCreateReques
 	AddSessionContext(req, "CreatePod#"+strconv.Itoa(rand.Intn(100000)))
 
 	// Create TLS-enabled HTTP client
-	httpClient, err := createTLSHTTPClient(ctx, config.TLS)
+	httpClient, err := newInterLinkClient(ctx, config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create TLS HTTP client: %w", err)
 	}
@@ -482,7 +503,7 @@ func deleteRequest(ctx context.Context, config Config, pod *v1.Pod, token string
 	AddSessionContext(req, "DeletePod#"+strconv.Itoa(rand.Intn(100000)))
 
 	// Create TLS-enabled HTTP client
-	httpClient, err := createTLSHTTPClient(ctx, config.TLS)
+	httpClient, err := newInterLinkClient(ctx, config)
 	if err != nil {
 		log.G(context.Background()).Error("Failed to create TLS HTTP client: ", err)
 		return nil, err
@@ -545,7 +566,7 @@ func statusRequest(ctx context.Context, config Config, podsList []*v1.Pod, token
 	AddSessionContext(req, "GetStatus#"+strconv.Itoa(rand.Intn(100000)))
 
 	// Create TLS-enabled HTTP client
-	httpClient, err := createTLSHTTPClient(ctx, config.TLS)
+	httpClient, err := newInterLinkClient(ctx, config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create TLS HTTP client: %w", err)
 	}
@@ -606,13 +627,20 @@ func LogRetrieval(
 		return nil, errWithContext
 	}
 
+	// The request lives as long as the stream: it is canceled when the kubelet closes the
+	// returned body, e.g. because kubectl logs -f went away.
+	streamCtx, cancel := context.WithCancel(ctx)
 	reader := bytes.NewReader(bodyBytes)
-	req, err := http.NewRequest(http.MethodGet, interLinkEndpoint+"/getLogs", reader)
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodGet, interLinkEndpoint+"/getLogs", reader)
 	if err != nil {
+		cancel()
 		errWithContext := fmt.Errorf(sessionContextMessage+"error during HTTP request: %s/getLogs %w", interLinkEndpoint, err)
 		log.G(ctx).Error(errWithContext)
 		return nil, errWithContext
 	}
+	if logsRequest.Opts.Follow {
+		req.Header.Set("Accept", logstream.ContentType)
+	}
 
 	// log.G(ctx).Println(string(bodyBytes))
 
@@ -636,6 +664,7 @@ func LogRetrieval(
 
 	resp, err := doRequestWithClient(req, token, logHTTPClient)
 	if err != nil {
+		cancel()
 		log.G(ctx).Error(err)
 		return nil, err
 	}
@@ -649,8 +678,30 @@ func LogRetrieval(
 		err = errors.New(sessionContextMessage + "Unexpected error occured while getting logs. Status code: " + strconv.Itoa(resp.StatusCode) + ". Check InterLink's logs for further informations")
 	}
 
+	if err == nil && strings.HasPrefix(resp.Header.Get("Content-Type"), logstream.ContentType) {
+		// interLink sends heartbeats on idle framed streams: a silent one is dead.
+		idle := time.AfterFunc(logStreamIdleTimeout, cancel)
+		stream := logstream.NewReader(resp.Body, func() { idle.Reset(logStreamIdleTimeout) })
+		return &logStream{ReadCloser: stream, stop: func() { idle.Stop(); cancel() }}, nil
+	}
+
 	// return io.NopCloser(bufio.NewReader(resp.Body)), err
-	return resp.Body, err
+	return &logStream{ReadCloser: resp.Body, stop: cancel}, err
+}
+
+// logStreamIdleTimeout closes a framed log stream that stayed silent for too long. interLink
+// sends a heartbeat every 15 seconds by default, so a healthy stream is never idle that long.
+const logStreamIdleTimeout = 60 * time.Second
+
+// logStream releases the request of a log stream when the stream is closed.
+type logStream struct {
+	io.ReadCloser
+	stop func()
+}
+
+func (s *logStream) Close() error {
+	defer s.stop()
+	return s.ReadCloser.Close()
 }
 
 // Adds to pod environment variables related to services. For now, it only concerns Kubernetes API variables, example below:
@@ -1486,168 +1537,177 @@ func (p *Provider) podTerminalPhase(podUID string) (v1.PodPhase, bool) {
 }
 
 // checkPodsStatus is regularly called by the VK itself at regular intervals of time to query InterLink for Pods' status.
-// It basically append all available pods registered to the VK to a slice and passes this slice to the statusRequest function.
-// After the statusRequest returns a response, this function uses that response to update every Pod and Container status.
-func checkPodsStatus(ctx context.Context, p *Provider, pod *v1.Pod, token string, config Config) ([]types.PodStatus, error) {
+// The whole batch of pods is sent to InterLink in a single statusRequest, and every returned status is then
+// applied to the matching Pod and Container statuses. A failure to apply one status does not prevent the others
+// from being applied. Returns the statuses received from InterLink.
+func checkPodsStatus(ctx context.Context, p *Provider, pods []*v1.Pod, token string, config Config) ([]types.PodStatus, error) {
 	var ret []types.PodStatus
 
 	// retrieve pod status from remote interlink
-	returnVal, err := statusRequest(ctx, config, []*v1.Pod{pod}, token)
+	returnVal, err := statusRequest(ctx, config, pods, token)
 	if err != nil {
 		return nil, err
 	}
 
-	if returnVal != nil {
+	if returnVal == nil {
+		return nil, nil
+	}
+
+	err = json.Unmarshal(returnVal, &ret)
+	if err != nil {
+		errWithContext := fmt.Errorf("error doing Unmarshal() in checkPodsStatus() error detail: %s error: %w", fmt.Sprintf("%#v", err), err)
+		return nil, errWithContext
+	}
 
-		err = json.Unmarshal(returnVal, &ret)
-		if err != nil {
-			errWithContext := fmt.Errorf("error doing Unmarshal() in checkPodsStatus() error detail: %s error: %w", fmt.Sprintf("%#v", err), err)
-			return nil, errWithContext
-		}
+	if len(ret) < len(pods) {
+		log.G(ctx).Warningf("InterLink returned %d statuses for a batch of %d pods", len(ret), len(pods))
+	}
 
-		if len(ret) == 0 {
-			log.G(ctx).Warning("No status available from InterLink for pod ", pod.Name, "and Pod uid ", pod.UID)
-			return nil, nil
+	for _, podRemoteStatus := range ret {
+		err = applyPodStatus(ctx, p, podRemoteStatus, token, config)
+		if err != nil {
+			log.G(ctx).Warning("Unable to apply the status of pod ", podRemoteStatus.PodNamespace, "/", podRemoteStatus.PodName, ": ", err)
 		}
+	}
 
-		// if there is a pod status available go ahead to match with the latest state available in etcd
-		podRemoteStatus := ret[0]
+	log.G(ctx).Info("No errors while getting statuses")
+	log.G(ctx).Debug(ret)
+	return ret, nil
+}
 
-		log.G(ctx).Debug(fmt.Sprintln("Get status from remote status len: ", len(podRemoteStatus.Containers)))
-		// avoid asking for status too early, when etcd as not been updated
+// applyPodStatus matches a status returned by InterLink with the latest state available in etcd
+// and updates the Pod and Container statuses held by the provider accordingly.
+func applyPodStatus(ctx context.Context, p *Provider, podRemoteStatus types.PodStatus, token string, config Config) error {
+	log.G(ctx).Debug(fmt.Sprintln("Get status from remote status len: ", len(podRemoteStatus.Containers)))
+	// avoid asking for status too early, when etcd as not been updated
 
-		if podRemoteStatus.PodName == "" {
-			log.G(ctx).Warning("PodName is empty, skipping")
-			return nil, err
-		}
+	if podRemoteStatus.PodName == "" {
+		log.G(ctx).Warning("PodName is empty, skipping")
+		return nil
+	}
 
-		// get pod reference from cluster etcd
-		podRefInCluster, err := p.GetPodByUID(ctx, podRemoteStatus.PodNamespace, podRemoteStatus.PodName, k8sTypes.UID(podRemoteStatus.PodUID))
-		if err != nil {
-			log.G(ctx).Warning(err)
-			return nil, err
-		}
-		log.G(ctx).Debug(fmt.Sprintln("Get pod from k8s cluster status: ", podRefInCluster.Status.ContainerStatuses))
+	// get pod reference from cluster etcd
+	podRefInCluster, err := p.GetPodByUID(ctx, podRemoteStatus.PodNamespace, podRemoteStatus.PodName, k8sTypes.UID(podRemoteStatus.PodUID))
+	if err != nil {
+		log.G(ctx).Warning(err)
+		return err
+	}
+	log.G(ctx).Debug(fmt.Sprintln("Get pod from k8s cluster status: ", podRefInCluster.Status.ContainerStatuses))
 
-		// if the PodUID match with the one in etcd we are talking of the same thing. GOOD
-		if podRemoteStatus.PodUID == string(podRefInCluster.UID) {
-			// check if the pod is already in a terminal state (Failed or Succeeded)
-			if currentPhase, terminal := p.podTerminalPhase(podRemoteStatus.PodUID); terminal {
-				if podRefInCluster.Status.Phase == currentPhase {
-					log.G(ctx).Debug("Pod " + podRemoteStatus.PodName + " is already in phase " + string(currentPhase))
-					return nil, err
-				}
+	// if the PodUID match with the one in etcd we are talking of the same thing. GOOD
+	if podRemoteStatus.PodUID == string(podRefInCluster.UID) {
+		// check if the pod is already in a terminal state (Failed or Succeeded)
+		if currentPhase, terminal := p.podTerminalPhase(podRemoteStatus.PodUID); terminal {
+			if podRefInCluster.Status.Phase == currentPhase {
+				log.G(ctx).Debug("Pod " + podRemoteStatus.PodName + " is already in phase " + string(currentPhase))
+				return nil
 			}
+		}
 
-			podInit := false    // if a init container is running, the other containers phase is PodInitializing
-			podRunning := false // if a normale container is running, the phase is PodRunning
-			podErrored := false
-			podInitErrored := false              // if a container is in error, the phase is PodFailed
-			podCompleted := false                // if all containers are terminated, the phase is PodSucceeded, but if one is in error, the phase is PodFailed
-			podWaitingForInitContainers := false // if init containers are waiting, the phase is PodPending
-			failedReason := ""
-			failedReasonInit := ""
-
-			nContainersInPod := 0
-			if podRemoteStatus.Containers != nil {
-				nContainersInPod = len(podRemoteStatus.Containers)
-			}
-			counterOfTerminatedContainers := 0
+		podInit := false    // if a init container is running, the other containers phase is PodInitializing
+		podRunning := false // if a normale container is running, the phase is PodRunning
+		podErrored := false
+		podInitErrored := false              // if a container is in error, the phase is PodFailed
+		podCompleted := false                // if all containers are terminated, the phase is PodSucceeded, but if one is in error, the phase is PodFailed
+		podWaitingForInitContainers := false // if init containers are waiting, the phase is PodPending
+		failedReason := ""
+		failedReasonInit := ""
+
+		nContainersInPod := 0
+		if podRemoteStatus.Containers != nil {
+			nContainersInPod = len(podRemoteStatus.Containers)
+		}
+		counterOfTerminatedContainers := 0
 
-			nInitContainersInPod := 0
-			if podRemoteStatus.InitContainers != nil {
-				nInitContainersInPod = len(podRemoteStatus.InitContainers)
-			}
-			counterOfTerminatedInitContainers := 0
+		nInitContainersInPod := 0
+		if podRemoteStatus.InitContainers != nil {
+			nInitContainersInPod = len(podRemoteStatus.InitContainers)
+		}
+		counterOfTerminatedInitContainers := 0
 
-			log.G(ctx).Debug("Number of containers in POD:      " + strconv.Itoa(nContainersInPod))
-			log.G(ctx).Debug("Number of init containers in POD: " + strconv.Itoa(nInitContainersInPod))
+		log.G(ctx).Debug("Number of containers in POD:      " + strconv.Itoa(nContainersInPod))
+		log.G(ctx).Debug("Number of init containers in POD: " + strconv.Itoa(nInitContainersInPod))
 
-			// Protect all writes to podRefInCluster.Status (= p.pods[uid]) with the
-			// write lock so that concurrent goroutines (e.g. CreatePod's async error
-			// path) do not observe a partially-updated pod status.
-			p.podsMu.Lock()
+		// Protect all writes to podRefInCluster.Status (= p.pods[uid]) with the
+		// write lock so that concurrent goroutines (e.g. CreatePod's async error
+		// path) do not observe a partially-updated pod status.
+		p.podsMu.Lock()
 
-			// if there are init containers, we need to check them first
-			if nInitContainersInPod > 0 {
-				podWaitingForInitContainers, podInit, podInitErrored, failedReasonInit, counterOfTerminatedInitContainers = handleInitContainersUpdate(ctx, podRemoteStatus, podRefInCluster, nInitContainersInPod)
-			}
+		// if there are init containers, we need to check them first
+		if nInitContainersInPod > 0 {
+			podWaitingForInitContainers, podInit, podInitErrored, failedReasonInit, counterOfTerminatedInitContainers = handleInitContainersUpdate(ctx, podRemoteStatus, podRefInCluster, nInitContainersInPod)
+		}
 
-			if podInitErrored {
-				log.G(ctx).Error("At least one init container is in error with reason: " + failedReasonInit)
-			}
+		if podInitErrored {
+			log.G(ctx).Error("At least one init container is in error with reason: " + failedReasonInit)
+		}
 
-			// call handleContainersUpdate to update the status of the containers
-			counterOfTerminatedContainers, podErrored, failedReason, podRunning = handleContainersUpdate(ctx, podRemoteStatus, podRefInCluster, podWaitingForInitContainers, podInit, nInitContainersInPod, counterOfTerminatedInitContainers)
+		// call handleContainersUpdate to update the status of the containers
+		counterOfTerminatedContainers, podErrored, failedReason, podRunning = handleContainersUpdate(ctx, podRemoteStatus, podRefInCluster, podWaitingForInitContainers, podInit, nInitContainersInPod, counterOfTerminatedInitContainers)
 
-			if counterOfTerminatedContainers == nContainersInPod {
-				podCompleted = true
-			}
+		if counterOfTerminatedContainers == nContainersInPod {
+			podCompleted = true
+		}
 
-			if podCompleted {
-				// it means that all containers are terminated, check if some of them are errored
-				if podErrored || podInitErrored {
-					podRefInCluster.Status.Phase = v1.PodFailed
+		if podCompleted {
+			// it means that all containers are terminated, check if some of them are errored
+			if podErrored || podInitErrored {
+				podRefInCluster.Status.Phase = v1.PodFailed
+				if podErrored {
+					podRefInCluster.Status.Reason = failedReason
+				} else {
+					podRefInCluster.Status.Reason = failedReasonInit
+				}
+				// override all the ContainerStatuses to set Reason to failedReason or failedReasonInit
+				for i := range podRefInCluster.Status.ContainerStatuses {
 					if podErrored {
-						podRefInCluster.Status.Reason = failedReason
+						podRefInCluster.Status.ContainerStatuses[i].State.Terminated.Reason = failedReason
 					} else {
-						podRefInCluster.Status.Reason = failedReasonInit
-					}
-					// override all the ContainerStatuses to set Reason to failedReason or failedReasonInit
-					for i := range podRefInCluster.Status.ContainerStatuses {
-						if podErrored {
-							podRefInCluster.Status.ContainerStatuses[i].State.Terminated.Reason = failedReason
-						} else {
-							podRefInCluster.Status.ContainerStatuses[i].State.Terminated.Reason = failedReasonInit
-						}
+						podRefInCluster.Status.ContainerStatuses[i].State.Terminated.Reason = failedReasonInit
 					}
-				} else {
-					podRefInCluster.Status.Conditions = append(podRefInCluster.Status.Conditions, v1.PodCondition{Type: v1.PodReady, Status: v1.ConditionFalse})
-					podRefInCluster.Status.Phase = v1.PodSucceeded
-					podRefInCluster.Status.Reason = PodPhaseCompleted
 				}
 			} else {
-				if podInit {
-					podRefInCluster.Status.Phase = v1.PodPending
-					podRefInCluster.Status.Reason = "Init"
-				}
-				if podWaitingForInitContainers {
-					podRefInCluster.Status.Phase = v1.PodPending
-					podRefInCluster.Status.Reason = "Waiting for init containers"
-				}
-				if podRunning && podRefInCluster.Status.Phase != v1.PodRunning { // do not update the status if it is already running
-					podRefInCluster.Status.Phase = v1.PodRunning
-					podRefInCluster.Status.Conditions = []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}
-					podRefInCluster.Status.Reason = "Running"
-				}
+				podRefInCluster.Status.Conditions = append(podRefInCluster.Status.Conditions, v1.PodCondition{Type: v1.PodReady, Status: v1.ConditionFalse})
+				podRefInCluster.Status.Phase = v1.PodSucceeded
+				podRefInCluster.Status.Reason = PodPhaseCompleted
 			}
-
-			p.podsMu.Unlock()
 		} else {
-			list, err := p.clientSet.CoreV1().Pods(podRemoteStatus.PodNamespace).List(ctx, metav1.ListOptions{})
-			if err != nil {
-				log.G(ctx).Error(err)
-				return nil, err
+			if podInit {
+				podRefInCluster.Status.Phase = v1.PodPending
+				podRefInCluster.Status.Reason = "Init"
+			}
+			if podWaitingForInitContainers {
+				podRefInCluster.Status.Phase = v1.PodPending
+				podRefInCluster.Status.Reason = "Waiting for init containers"
+			}
+			if podRunning && podRefInCluster.Status.Phase != v1.PodRunning { // do not update the status if it is already running
+				podRefInCluster.Status.Phase = v1.PodRunning
+				podRefInCluster.Status.Conditions = []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}
+				podRefInCluster.Status.Reason = "Running"
 			}
+		}
 
-			pods := list.Items
+		p.podsMu.Unlock()
+	} else {
+		list, err := p.clientSet.CoreV1().Pods(podRemoteStatus.PodNamespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			log.G(ctx).Error(err)
+			return err
+		}
 
-			for _, pod := range pods {
-				if string(pod.UID) == podRemoteStatus.PodUID {
-					err = updateCacheRequest(ctx, config, pod, token)
-					if err != nil {
-						log.G(ctx).Error(err)
-						continue
-					}
+		pods := list.Items
+
+		for _, pod := range pods {
+			if string(pod.UID) == podRemoteStatus.PodUID {
+				err = updateCacheRequest(ctx, config, pod, token)
+				if err != nil {
+					log.G(ctx).Error(err)
+					continue
 				}
 			}
-
 		}
 
-		log.G(ctx).Info("No errors while getting statuses")
-		log.G(ctx).Debug(ret)
-		return nil, nil
 	}
 
-	return nil, err
+	return nil
 }
@@ -2,18 +2,23 @@ package virtualkubelet
 
 import (
 	"context"
+	"encoding/json"
+	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	types "github.com/interlink-hq/interlink/pkg/interlink"
+	"github.com/interlink-hq/interlink/pkg/interlink/logstream"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sTypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/fake"
 )
 
@@ -33,6 +38,18 @@ func (rt *unixSocketRoundTripper) RoundTrip(req *http.Request) (*http.Response,
 	return rt.transport.RoundTrip(req)
 }
 
+// newTestInterLinkServer starts an interLink API served by handler for the duration of the
+// test, and returns the Virtual Kubelet config pointing at it.
+func newTestInterLinkServer(t *testing.T, handler http.Handler) Config {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	require.NoError(t, err)
+	return Config{InterlinkURL: "http://" + host, InterlinkPort: port}
+}
+
 // newUnixTestServer starts an httptest.Server backed by a unix socket and returns
 // the server, a base URL using the http+unix scheme (safe per isSafeURL), and an
 // HTTP client that routes requests to that socket.
@@ -662,3 +679,111 @@ func TestResolveEnvFromRefsOptionalMissingSecret(t *testing.T) {
 	assert.Empty(t, container.Env)
 	assert.Empty(t, container.EnvFrom)
 }
+
+func TestStatusBatches(t *testing.T) {
+	pods := make([]*v1.Pod, 7)
+	for i := range pods {
+		pods[i] = &v1.Pod{}
+	}
+
+	tests := []struct {
+		name      string
+		batchSize int
+		pods      []*v1.Pod
+		want      []int
+	}{
+		{name: "default size", pods: pods, want: []int{7}},
+		{name: "exact multiple", batchSize: 7, pods: pods, want: []int{7}},
+		{name: "remainder", batchSize: 3, pods: pods, want: []int{3, 3, 1}},
+		{name: "no pods", batchSize: 3, want: []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Provider{config: Config{StatusBatchSize: tt.batchSize}}
+			sizes := []int{}
+			for _, batch := range p.statusBatches(tt.pods) {
+				sizes = append(sizes, len(batch))
+			}
+			assert.Equal(t, tt.want, sizes)
+		})
+	}
+}
+
+func TestCheckPodsStatus_SingleRequestPerBatch(t *testing.T) {
+	requests := 0
+	config := newTestInterLinkServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		var pods []*v1.Pod
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&pods))
+
+		statuses := []types.PodStatus{}
+		for _, pod := range pods {
+			statuses = append(statuses, types.PodStatus{
+				PodName:      pod.Name,
+				PodUID:       string(pod.UID),
+				PodNamespace: pod.Namespace,
+				Containers: []v1.ContainerStatus{{
+					Name:  "main",
+					State: v1.ContainerState{Running: &v1.ContainerStateRunning{}},
+				}},
+			})
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(statuses))
+	}))
+
+	p := &Provider{
+		config: config,
+		pods:   map[string]*v1.Pod{},
+	}
+	var batch []*v1.Pod
+	for _, name := range []string{"a", "b", "c"} {
+		pod := &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace, UID: k8sTypes.UID("uid-" + name)},
+			Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "main"}}},
+			Status:     v1.PodStatus{Phase: v1.PodPending},
+		}
+		p.pods[string(pod.UID)] = pod
+		batch = append(batch, pod.DeepCopy())
+	}
+
+	statuses, err := checkPodsStatus(context.Background(), p, batch, "", p.config)
+	require.NoError(t, err)
+	assert.Equal(t, 1, requests)
+	assert.Len(t, statuses, 3)
+	for _, pod := range p.pods {
+		assert.Equal(t, v1.PodRunning, pod.Status.Phase, "pod %s", pod.Name)
+	}
+}
+
+func TestLogRetrieval_FramedFollow(t *testing.T) {
+	canceled := make(chan struct{})
+	config := newTestInterLinkServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, logstream.ContentType, r.Header.Get("Accept"))
+		var logsRequest types.LogStruct
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&logsRequest))
+		assert.True(t, logsRequest.Opts.Follow)
+		w.Header().Set("Content-Type", logstream.ContentType)
+		stream := logstream.NewWriter(w)
+		_, _ = stream.Write([]byte("line 1\n"))
+		_ = stream.Heartbeat()
+		_, _ = stream.Write([]byte("line 2\n"))
+		<-r.Context().Done()
+		close(canceled)
+	}))
+	logsRequest := types.LogStruct{Namespace: testNamespace, PodUID: "uid", Opts: types.ContainerLogOpts{Follow: true}}
+
+	logs, err := LogRetrieval(context.Background(), config, logsRequest, &http.Transport{}, "")
+	require.NoError(t, err)
+	out := make([]byte, len("line 1\nline 2\n"))
+	_, err = io.ReadFull(logs, out)
+	require.NoError(t, err)
+	assert.Equal(t, "line 1\nline 2\n", string(out), "the frames are decoded back to plain logs")
+
+	require.NoError(t, logs.Close())
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the interLink call was not canceled when the logs were closed")
+	}
+}
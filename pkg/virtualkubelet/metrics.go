@@ -0,0 +1,273 @@
+package virtualkubelet
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/apimachinery/pkg/api/resource"
+	stats "k8s.io/kubelet/pkg/apis/stats/v1alpha1"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	trace "go.opentelemetry.io/otel/trace"
+)
+
+// The metrics of the /metrics/resource endpoint, named and labeled as the kubelet ones so that
+// metrics-server can scrape the virtual node.
+var (
+	nodeCPUUsageDesc = prometheus.NewDesc("node_cpu_usage_seconds_total",
+		"Cumulative cpu time consumed by the node in core-seconds", nil, nil)
+	nodeMemoryWorkingSetDesc = prometheus.NewDesc("node_memory_working_set_bytes",
+		"Current working set of the node in bytes", nil, nil)
+	podCPUUsageDesc = prometheus.NewDesc("pod_cpu_usage_seconds_total",
+		"Cumulative cpu time consumed by the pod in core-seconds", []string{"pod", "namespace"}, nil)
+	podMemoryWorkingSetDesc = prometheus.NewDesc("pod_memory_working_set_bytes",
+		"Current working set of the pod in bytes", []string{"pod", "namespace"}, nil)
+	containerCPUUsageDesc = prometheus.NewDesc("container_cpu_usage_seconds_total",
+		"Cumulative cpu time consumed by the container in core-seconds", []string{"container", "pod", "namespace"}, nil)
+	containerMemoryWorkingSetDesc = prometheus.NewDesc("container_memory_working_set_bytes",
+		"Current working set of the container in bytes", []string{"container", "pod", "namespace"}, nil)
+	containerStartTimeDesc = prometheus.NewDesc("container_start_time_seconds",
+		"Start time of the container since unix epoch in seconds", []string{"container", "pod", "namespace"}, nil)
+	resourceScrapeErrorDesc = prometheus.NewDesc("resource_scrape_error",
+		"1 if there was an error while getting container metrics, 0 otherwise", nil, nil)
+)
+
+// resourceMetrics holds the node usage reported by the plugins in the ping responses, and the
+// state of the cumulative CPU counters: the ones integrated from the instantaneous usage, for
+// the plugins reporting usage in nano cores only, and the one of the node.
+type resourceMetrics struct {
+	mu           sync.Mutex
+	nodeCPU      *resource.Quantity
+	nodeMemory   *resource.Quantity
+	nodeMeasured time.Time
+	// node is the CPU counter of the node
+	node cpuCounter
+	// cpu holds the counters integrated for the containers, by pod UID and container name
+	cpu map[string]cpuCounter
+	// containerSeconds holds the last CPU time exposed for the containers
+	containerSeconds map[string]float64
+}
+
+// cpuCounter is a cumulative CPU time integrated from usage samples.
+type cpuCounter struct {
+	seconds  float64
+	measured time.Time
+}
+
+// advance adds the CPU time of a usage sample to the counter. The usage is assumed constant
+// since the previous sample; the first sample only starts the counter.
+func (c *cpuCounter) advance(nanoCores uint64, measured time.Time) {
+	if !c.measured.IsZero() && measured.After(c.measured) {
+		c.seconds += float64(nanoCores) / 1e9 * measured.Sub(c.measured).Seconds()
+	}
+	if measured.After(c.measured) {
+		c.measured = measured
+	}
+}
+
+// recordNodeUsage records the usage reported in a ping response; nil clears it, e.g. when the
+// ping failed. Invalid quantities are ignored.
+func (m *resourceMetrics) recordNodeUsage(ctx context.Context, resources *types.ResourcesResponse) {
+	parse := func(name, value string) *resource.Quantity {
+		if value == "" {
+			return nil
+		}
+		q, err := resource.ParseQuantity(value)
+		if err != nil || q.Sign() < 0 {
+			log.G(ctx).Warnf("Invalid %s usage %q in ping response", name, value)
+			return nil
+		}
+		return &q
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nodeCPU, m.nodeMemory = nil, nil
+	m.nodeMeasured = time.Now()
+	if resources == nil {
+		return
+	}
+	m.nodeCPU = parse("CPU", resources.CPUUsage)
+	m.nodeMemory = parse("memory", resources.MemoryUsage)
+}
+
+// integrateCPU adds a usage sample to the counter of key and returns the counter. Callers hold mu.
+func (m *resourceMetrics) integrateCPU(key string, nanoCores uint64, measured time.Time) float64 {
+	if m.cpu == nil {
+		m.cpu = make(map[string]cpuCounter)
+	}
+	counter := m.cpu[key]
+	counter.advance(nanoCores, measured)
+	m.cpu[key] = counter
+	return counter.seconds
+}
+
+// GetMetricsResource returns the metrics of the kubelet /metrics/resource endpoint, for
+// metrics-server and kubectl top. The container values come from the stats summary, and the
+// pod values add up the ones of their containers. The node values come from the usage the
+// plugins report in the ping responses or, when they do not, from the containers. The CPU
+// counters are integrated from the instantaneous usage for the plugins that do not report
+// the cumulative CPU time.
+func (p *Provider) GetMetricsResource(ctx context.Context) ([]*dto.MetricFamily, error) {
+	start := time.Now().Unix()
+	tracer := otel.Tracer("interlink-service")
+	ctx, span := tracer.Start(ctx, "GetMetricsResourceVK", trace.WithAttributes(
+		attribute.Int64("start.timestamp", start),
+	))
+	defer span.End()
+	defer types.SetDurationSpan(start, span)
+
+	summary, err := p.GetStatsSummary(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.stats.mu.Lock()
+	scrapeErr := p.stats.err
+	p.stats.mu.Unlock()
+
+	m := &p.resourceMetrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.containerSeconds == nil {
+		m.containerSeconds = make(map[string]float64)
+	}
+
+	var metrics []prometheus.Metric
+	add := func(desc *prometheus.Desc, valueType prometheus.ValueType, value float64, measured time.Time, labels ...string) {
+		metric := prometheus.MustNewConstMetric(desc, valueType, value, labels...)
+		if !measured.IsZero() {
+			metric = prometheus.NewMetricWithTimestamp(measured, metric)
+		}
+		metrics = append(metrics, metric)
+	}
+	latest := func(measured *time.Time, t time.Time) {
+		if t.After(*measured) {
+			*measured = t
+		}
+	}
+
+	seen := make(map[string]bool)
+	// the CPU time and memory of the containers, for the node when the plugins report no usage
+	var nodeCPUDelta, nodeMemory float64
+	var nodeCPUReported, nodeMemoryReported bool
+	var nodeMeasured time.Time
+	for _, pod := range summary.Pods {
+		ref := pod.PodRef
+		var podCPU, podMemory float64
+		var podCPUReported, podMemoryReported bool
+		var podCPUMeasured, podMemoryMeasured time.Time
+		for _, container := range pod.Containers {
+			key := ref.UID + "/" + container.Name
+			if seconds, ok := m.containerCPUSeconds(key, container.CPU); ok {
+				seen[key] = true
+				if last, ok := m.containerSeconds[key]; ok && seconds >= last {
+					nodeCPUDelta += seconds - last
+				}
+				m.containerSeconds[key] = seconds
+				add(containerCPUUsageDesc, prometheus.CounterValue, seconds, container.CPU.Time.Time, container.Name, ref.Name, ref.Namespace)
+				podCPU += seconds
+				podCPUReported = true
+				latest(&podCPUMeasured, container.CPU.Time.Time)
+			}
+			if bytes := workingSetBytes(container.Memory); bytes != nil {
+				add(containerMemoryWorkingSetDesc, prometheus.GaugeValue, float64(*bytes), container.Memory.Time.Time, container.Name, ref.Name, ref.Namespace)
+				podMemory += float64(*bytes)
+				podMemoryReported = true
+				latest(&podMemoryMeasured, container.Memory.Time.Time)
+			}
+			if !container.StartTime.IsZero() {
+				add(containerStartTimeDesc, prometheus.GaugeValue, float64(container.StartTime.Unix()), time.Time{}, container.Name, ref.Name, ref.Namespace)
+			}
+		}
+		if podCPUReported {
+			add(podCPUUsageDesc, prometheus.CounterValue, podCPU, podCPUMeasured, ref.Name, ref.Namespace)
+			nodeCPUReported = true
+			latest(&nodeMeasured, podCPUMeasured)
+		}
+		if podMemoryReported {
+			add(podMemoryWorkingSetDesc, prometheus.GaugeValue, podMemory, podMemoryMeasured, ref.Name, ref.Namespace)
+			nodeMemory += podMemory
+			nodeMemoryReported = true
+			latest(&nodeMeasured, podMemoryMeasured)
+		}
+	}
+
+	switch {
+	case m.nodeCPU != nil:
+		m.node.advance(uint64(m.nodeCPU.MilliValue())*1000000, m.nodeMeasured)
+		add(nodeCPUUsageDesc, prometheus.CounterValue, m.node.seconds, m.nodeMeasured)
+	case nodeCPUReported:
+		m.node.seconds += nodeCPUDelta
+		latest(&m.node.measured, nodeMeasured)
+		add(nodeCPUUsageDesc, prometheus.CounterValue, m.node.seconds, nodeMeasured)
+	}
+	switch {
+	case m.nodeMemory != nil:
+		add(nodeMemoryWorkingSetDesc, prometheus.GaugeValue, float64(m.nodeMemory.Value()), m.nodeMeasured)
+	case nodeMemoryReported:
+		add(nodeMemoryWorkingSetDesc, prometheus.GaugeValue, nodeMemory, nodeMeasured)
+	}
+	scrapeError := 0.0
+	if scrapeErr != nil {
+		scrapeError = 1
+	}
+	add(resourceScrapeErrorDesc, prometheus.GaugeValue, scrapeError, time.Time{})
+
+	// forget the counters of the containers gone
+	for key := range m.containerSeconds {
+		if !seen[key] {
+			delete(m.containerSeconds, key)
+			delete(m.cpu, key)
+		}
+	}
+
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(constCollector(metrics)); err != nil {
+		return nil, err
+	}
+	return registry.Gather()
+}
+
+// containerCPUSeconds returns the cumulative CPU time of a container: the one the plugin
+// reports, or the one integrated from its instantaneous usage. Callers hold mu.
+func (m *resourceMetrics) containerCPUSeconds(key string, cpu *stats.CPUStats) (float64, bool) {
+	switch {
+	case cpu == nil:
+		return 0, false
+	case cpu.UsageCoreNanoSeconds != nil:
+		return float64(*cpu.UsageCoreNanoSeconds) / 1e9, true
+	case cpu.UsageNanoCores != nil:
+		return m.integrateCPU(key, *cpu.UsageNanoCores, cpu.Time.Time), true
+	}
+	return 0, false
+}
+
+// workingSetBytes returns the working set of memory stats, or the usage when the plugin does
+// not report the working set.
+func workingSetBytes(memory *stats.MemoryStats) *uint64 {
+	switch {
+	case memory == nil:
+		return nil
+	case memory.WorkingSetBytes != nil:
+		return memory.WorkingSetBytes
+	}
+	return memory.UsageBytes
+}
+
+// constCollector collects a fixed set of metrics.
+type constCollector []prometheus.Metric
+
+func (c constCollector) Describe(chan<- *prometheus.Desc) {}
+
+func (c constCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, metric := range c {
+		ch <- metric
+	}
+}
@@ -0,0 +1,105 @@
+package virtualkubelet
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+)
+
+// metricsText encodes metric families in the Prometheus text format, without timestamps.
+func metricsText(t *testing.T, families []*dto.MetricFamily) string {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			metric.TimestampMs = nil
+		}
+		_, err := expfmt.MetricFamilyToText(&buf, family)
+		require.NoError(t, err)
+	}
+	return buf.String()
+}
+
+func TestGetMetricsResource(t *testing.T) {
+	p := testExecProvider(t, func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode([]types.PodStats{{
+			PodUID: "a",
+			Time:   time.Now(),
+			Containers: []types.ContainerStats{
+				{Name: "main", CPU: &types.CPUStats{UsageCoreNanoSeconds: uint64Ptr(3000000000)}, Memory: &types.MemoryStats{WorkingSetBytes: uint64Ptr(1024)}},
+				{Name: "sidecar", CPU: &types.CPUStats{UsageNanoCores: uint64Ptr(500000000)}, Memory: &types.MemoryStats{UsageBytes: uint64Ptr(512)}},
+			},
+		}})
+	})
+	p.pods = map[string]*v1.Pod{"a": testStatsPod("a", v1.PodRunning, "main", "sidecar")}
+
+	families, err := p.GetMetricsResource(t.Context())
+	require.NoError(t, err)
+	text := metricsText(t, families)
+	assert.Contains(t, text, `container_cpu_usage_seconds_total{container="main",namespace="default",pod="pod-a"} 3`)
+	assert.Contains(t, text, `container_cpu_usage_seconds_total{container="sidecar",namespace="default",pod="pod-a"} 0`)
+	assert.Contains(t, text, `container_memory_working_set_bytes{container="main",namespace="default",pod="pod-a"} 1024`)
+	assert.Contains(t, text, `container_memory_working_set_bytes{container="sidecar",namespace="default",pod="pod-a"} 512`)
+	assert.Contains(t, text, `pod_cpu_usage_seconds_total{namespace="default",pod="pod-a"} 3`)
+	assert.Contains(t, text, `pod_memory_working_set_bytes{namespace="default",pod="pod-a"} 1536`)
+	assert.Contains(t, text, `container_start_time_seconds{container="main",namespace="default",pod="pod-a"}`)
+	// without usage in the ping responses, the node sums its pods
+	assert.Contains(t, text, "node_cpu_usage_seconds_total 0\n")
+	assert.Contains(t, text, "node_memory_working_set_bytes 1536\n")
+	assert.Contains(t, text, "resource_scrape_error 0\n")
+}
+
+func TestGetMetricsResource_WithoutPluginStats(t *testing.T) {
+	p := testExecProvider(t, func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("[]"))
+	})
+	p.pods = map[string]*v1.Pod{"a": testStatsPod("a", v1.PodRunning, "main")}
+	p.resourceMetrics.recordNodeUsage(t.Context(), &types.ResourcesResponse{CPUUsage: "1500m", MemoryUsage: "2Gi"})
+
+	families, err := p.GetMetricsResource(t.Context())
+	require.NoError(t, err)
+	text := metricsText(t, families)
+	assert.NotContains(t, text, "container_")
+	assert.NotContains(t, text, "pod_")
+	assert.Contains(t, text, "node_cpu_usage_seconds_total 0\n")
+	assert.Contains(t, text, "node_memory_working_set_bytes 2.147483648e+09\n")
+	assert.Contains(t, text, "resource_scrape_error 0\n")
+
+	// a failed ping clears the node usage
+	p.resourceMetrics.recordNodeUsage(t.Context(), nil)
+	families, err = p.GetMetricsResource(t.Context())
+	require.NoError(t, err)
+	assert.False(t, strings.Contains(metricsText(t, families), "node_memory_working_set_bytes"))
+}
+
+func TestGetMetricsResource_ScrapeError(t *testing.T) {
+	p := testExecProvider(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	p.pods = map[string]*v1.Pod{"a": testStatsPod("a", v1.PodRunning, "main")}
+
+	families, err := p.GetMetricsResource(t.Context())
+	require.NoError(t, err)
+	assert.Contains(t, metricsText(t, families), "resource_scrape_error 1\n")
+}
+
+func TestIntegrateCPU(t *testing.T) {
+	var m resourceMetrics
+	start := time.Now()
+	assert.Zero(t, m.integrateCPU("a", 500000000, start))
+	assert.InDelta(t, 5, m.integrateCPU("a", 500000000, start.Add(10*time.Second)), 1e-9)
+	assert.InDelta(t, 25, m.integrateCPU("a", 2000000000, start.Add(20*time.Second)), 1e-9)
+	// samples that are not newer do not count twice
+	assert.InDelta(t, 25, m.integrateCPU("a", 2000000000, start.Add(20*time.Second)), 1e-9)
+	assert.Zero(t, m.integrateCPU("b", 1000000000, start))
+}
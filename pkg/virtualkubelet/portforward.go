@@ -0,0 +1,127 @@
+package virtualkubelet
+
+import (
+	"context"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/containerd/containerd/log"
+	"github.com/virtual-kubelet/virtual-kubelet/node/api"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	trace "go.opentelemetry.io/otel/trace"
+)
+
+// portForwardDialTimeout bounds the connection to a port reached through the mesh networking.
+const portForwardDialTimeout = 10 * time.Second
+
+// PortForward forwards a kubectl port-forward connection to a port of an offloaded pod. Pods
+// using the mesh networking are reached through their wstunnel or WireGuard pod IP, for the
+// ports it carries; the other connections go through interLink to the /portforward endpoint
+// of the plugin.
+func (p *Provider) PortForward(ctx context.Context, namespace, podName string, port int32, stream io.ReadWriteCloser) error {
+	start := time.Now().Unix()
+	tracer := otel.Tracer("interlink-service")
+	sessionContext := "PortForward#" + strconv.Itoa(mathrand.Intn(100000))
+	ctx, span := tracer.Start(ctx, "PortForwardVK", trace.WithAttributes(
+		attribute.String("pod.name", podName),
+		attribute.String("pod.namespace", namespace),
+		attribute.Int("portforward.port", int(port)),
+		attribute.String("session.id", sessionContext),
+		attribute.Int64("start.timestamp", start),
+	))
+	defer span.End()
+	defer types.SetDurationSpan(start, span)
+
+	log.G(ctx).Infof(GetSessionContextMessage(sessionContext)+"receive PortForward %s/%s:%d", namespace, podName, port)
+
+	pod, err := p.clientSet.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	if p.meshCarriesPort(pod, port) {
+		span.SetAttributes(attribute.String("portforward.path", "mesh"))
+		return forwardToAddress(ctx, net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(int(port))), stream)
+	}
+
+	span.SetAttributes(attribute.String("portforward.path", "interlink"))
+	portForwardRequest := types.PortForwardRequest{
+		Namespace: namespace,
+		PodUID:    string(pod.UID),
+		PodName:   podName,
+		Port:      port,
+	}
+	return runSession(ctx, p.config, p.clientHTTPTransport, "/portforward", portForwardRequest, portForwardIO{stream}, sessionContext)
+}
+
+// meshCarriesPort tells whether a port of a pod is reachable through the mesh networking set up
+// at its creation: WireGuard carries every port, wstunnel only the exposed TCP ports.
+func (p *Provider) meshCarriesPort(pod *v1.Pod, port int32) bool {
+	if pod.Status.PodIP == "" {
+		return false
+	}
+	if p.config.Network.FullMesh && !isMeshNetworkingDisabled(pod) {
+		return true
+	}
+	if !p.shouldCreateWstunnel(pod) {
+		return false
+	}
+	for _, mapping := range extractPortMappings(pod) {
+		if mapping.Port == port && mapping.Protocol == DefaultProtocol {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardToAddress connects to address and copies the stream to it in both directions, until
+// the remote end closes the connection.
+func forwardToAddress(ctx context.Context, address string, stream io.ReadWriteCloser) error {
+	conn, err := (&net.Dialer{Timeout: portForwardDialTimeout}).DialContext(ctx, "tcp", address)
+	if err != nil {
+		return fmt.Errorf("unable to connect to %s: %w", address, err)
+	}
+	defer conn.Close()
+
+	go func() {
+		if _, err := io.Copy(conn, stream); err != nil {
+			log.G(ctx).Debug("port forward to ", address, " interrupted: ", err)
+		}
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			_ = tcpConn.CloseWrite()
+		}
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(stream, conn)
+		done <- err
+	}()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-done:
+		return err
+	}
+}
+
+// portForwardIO presents a port forward stream as the stdin and stdout of a session.
+type portForwardIO struct {
+	stream io.ReadWriteCloser
+}
+
+func (s portForwardIO) Stdin() io.Reader            { return s.stream }
+func (s portForwardIO) Stdout() io.WriteCloser      { return s.stream }
+func (s portForwardIO) Stderr() io.WriteCloser      { return nil }
+func (s portForwardIO) TTY() bool                   { return false }
+func (s portForwardIO) Resize() <-chan api.TermSize { return nil }
@@ -0,0 +1,121 @@
+package virtualkubelet
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+	"github.com/interlink-hq/interlink/pkg/interlink/channelstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// testStream is a port forward stream sending in, and recording what it receives in out.
+type testStream struct {
+	io.Reader
+	out bytes.Buffer
+}
+
+func (s *testStream) Write(b []byte) (int, error) { return s.out.Write(b) }
+func (s *testStream) Close() error                { return nil }
+
+func TestPortForward(t *testing.T) {
+	p := testExecProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/portforward", r.URL.Path)
+		assert.True(t, strings.HasPrefix(r.Header.Get("InterLink-Http-Session"), "PortForward#"))
+		rc := http.NewResponseController(w)
+		assert.NoError(t, rc.EnableFullDuplex())
+		in := channelstream.NewReader(r.Body)
+		channel, payload, err := in.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, channelstream.ChannelRequest, channel)
+		var req types.PortForwardRequest
+		assert.NoError(t, json.Unmarshal(payload, &req))
+		assert.Equal(t, types.PortForwardRequest{Namespace: "default", PodUID: "uid", PodName: "pod", Port: 8888}, req)
+
+		w.Header().Set("Content-Type", channelstream.ContentType)
+		w.WriteHeader(http.StatusOK)
+		assert.NoError(t, rc.Flush())
+		out := channelstream.NewWriter(w)
+		for {
+			channel, payload, err := in.Next()
+			if !assert.NoError(t, err) || channel == channelstream.ChannelClose {
+				break
+			}
+			assert.NoError(t, out.WriteFrame(channelstream.ChannelStdout, bytes.ToUpper(payload)))
+		}
+		assert.NoError(t, out.WriteJSON(channelstream.ChannelStatus, channelstream.Status{}))
+	})
+
+	stream := &testStream{Reader: strings.NewReader("ping")}
+	require.NoError(t, p.PortForward(t.Context(), "default", "pod", 8888, stream))
+	assert.Equal(t, "PING", stream.out.String())
+}
+
+func TestPortForward_Mesh(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		_, _ = conn.Write(bytes.ToUpper(data))
+	}()
+	port, err := strconv.Atoi(strings.TrimPrefix(listener.Addr().String(), "127.0.0.1:"))
+	require.NoError(t, err)
+
+	p := &Provider{
+		config: Config{Network: Network{EnableTunnel: true}},
+		clientSet: fake.NewSimpleClientset(&v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default"},
+			Spec: v1.PodSpec{Containers: []v1.Container{{
+				Name:  "main",
+				Ports: []v1.ContainerPort{{ContainerPort: int32(port)}},
+			}}},
+			Status: v1.PodStatus{PodIP: "127.0.0.1"},
+		}),
+	}
+	stream := &testStream{Reader: strings.NewReader("ping")}
+	require.NoError(t, p.PortForward(t.Context(), "default", "pod", int32(port), stream))
+	assert.Equal(t, "PING", stream.out.String())
+}
+
+func TestMeshCarriesPort(t *testing.T) {
+	pod := func(annotations map[string]string) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Annotations: annotations},
+			Spec: v1.PodSpec{Containers: []v1.Container{{
+				Ports: []v1.ContainerPort{{ContainerPort: 8888}, {ContainerPort: 5353, Protocol: v1.ProtocolUDP}},
+			}}},
+			Status: v1.PodStatus{PodIP: "10.0.0.1"},
+		}
+	}
+	tunnel := &Provider{config: Config{Network: Network{EnableTunnel: true}}}
+	fullMesh := &Provider{config: Config{Network: Network{FullMesh: true}}}
+	none := &Provider{}
+
+	assert.True(t, tunnel.meshCarriesPort(pod(nil), 8888))
+	assert.False(t, tunnel.meshCarriesPort(pod(nil), 9999), "wstunnel only carries the exposed ports")
+	assert.False(t, tunnel.meshCarriesPort(pod(nil), 5353), "wstunnel only carries TCP")
+	assert.False(t, tunnel.meshCarriesPort(pod(map[string]string{"interlink.eu/pod-vpn": "true"}), 8888))
+	assert.True(t, fullMesh.meshCarriesPort(pod(nil), 9999))
+	assert.False(t, fullMesh.meshCarriesPort(pod(map[string]string{annMeshNetworkDisabled: "disabled"}), 9999))
+	assert.False(t, none.meshCarriesPort(pod(nil), 8888))
+
+	noIP := pod(nil)
+	noIP.Status.PodIP = ""
+	assert.False(t, fullMesh.meshCarriesPort(noIP, 8888))
+}
@@ -0,0 +1,217 @@
+package virtualkubelet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/log"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	stats "k8s.io/kubelet/pkg/apis/stats/v1alpha1"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+)
+
+// statsCache holds the resource usage last reported by the plugins, by pod UID.
+type statsCache struct {
+	mu      sync.Mutex
+	pods    map[string]types.PodStats
+	fetched time.Time
+	// err is the error of the last refresh, if it failed
+	err error
+}
+
+// podStats returns the resource usage of the running pods, asking interLink again once the
+// cache is older than StatsCacheSeconds. When interLink cannot be reached the cache is emptied,
+// so that no stale usage is reported, and the next call retries after StatsCacheSeconds.
+func (p *Provider) podStats(ctx context.Context, pods []*v1.Pod) map[string]types.PodStats {
+	ttl := DefaultStatsCacheSeconds * time.Second
+	if p.config.StatsCacheSeconds > 0 {
+		ttl = time.Duration(p.config.StatsCacheSeconds) * time.Second
+	}
+
+	p.stats.mu.Lock()
+	defer p.stats.mu.Unlock()
+	if time.Since(p.stats.fetched) < ttl {
+		return p.stats.pods
+	}
+
+	var running []*v1.Pod
+	for _, pod := range pods {
+		if pod.Status.Phase == v1.PodRunning {
+			running = append(running, pod)
+		}
+	}
+	p.stats.fetched = time.Now()
+	p.stats.pods = make(map[string]types.PodStats, len(running))
+	p.stats.err = nil
+	if len(running) == 0 {
+		return p.stats.pods
+	}
+
+	reported, err := statsRequest(ctx, p.config, running)
+	if err != nil {
+		log.G(ctx).Warning("Unable to get the resource usage of the pods: ", err)
+		p.stats.err = err
+		return p.stats.pods
+	}
+	for _, podStats := range reported {
+		p.stats.pods[podStats.PodUID] = podStats
+	}
+	return p.stats.pods
+}
+
+// statsRequest asks interLink for the resource usage of pods.
+func statsRequest(ctx context.Context, config Config, pods []*v1.Pod) ([]types.PodStats, error) {
+	token := ""
+	if config.VKTokenFile != "" {
+		b, err := os.ReadFile(config.VKTokenFile)
+		if err != nil {
+			return nil, err
+		}
+		token = string(b)
+	}
+
+	bodyBytes, err := json.Marshal(pods)
+	if err != nil {
+		return nil, err
+	}
+	interLinkEndpoint := getSidecarEndpoint(ctx, config.InterlinkURL, config.InterlinkPort)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, interLinkEndpoint+"/stats", bytes.NewReader(bodyBytes))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	AddSessionContext(req, "GetStats#"+strconv.Itoa(mathrand.Intn(100000)))
+
+	httpClient, err := newInterLinkClient(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := doRequestWithClient(req, token, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("interLink stats failed with status code %d: %s", resp.StatusCode, body)
+	}
+	var podStats []types.PodStats
+	if err := json.Unmarshal(body, &podStats); err != nil {
+		return nil, fmt.Errorf("invalid interLink stats response: %w", err)
+	}
+	return podStats, nil
+}
+
+// summaryPodStats converts the usage a plugin reported for a pod to its stats summary entry.
+// Only the containers of the pod with some usage are listed, and the pod totals only add up
+// the values reported. It returns false when nothing was reported for the pod.
+func summaryPodStats(pod *v1.Pod, remote types.PodStats) (stats.PodStats, bool) {
+	measured := metav1.NewTime(remote.Time)
+	podStats := stats.PodStats{
+		PodRef: stats.PodReference{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+			UID:       string(pod.UID),
+		},
+		StartTime: pod.CreationTimestamp,
+	}
+
+	inSpec := make(map[string]bool, len(pod.Spec.Containers))
+	for _, container := range pod.Spec.Containers {
+		inSpec[container.Name] = true
+	}
+	var cpu, memory, rootfs bool
+	podCPU := &stats.CPUStats{Time: measured}
+	podMemory := &stats.MemoryStats{Time: measured}
+	podStorage := &stats.FsStats{Time: measured}
+	for _, container := range remote.Containers {
+		if !inSpec[container.Name] || (container.CPU == nil && container.Memory == nil && container.Filesystem == nil) {
+			continue
+		}
+		containerStats := stats.ContainerStats{
+			Name:      container.Name,
+			StartTime: pod.CreationTimestamp,
+		}
+		if container.CPU != nil {
+			cpu = true
+			containerStats.CPU = &stats.CPUStats{
+				Time:                 measured,
+				UsageNanoCores:       container.CPU.UsageNanoCores,
+				UsageCoreNanoSeconds: container.CPU.UsageCoreNanoSeconds,
+			}
+			addUsage(&podCPU.UsageNanoCores, container.CPU.UsageNanoCores)
+			addUsage(&podCPU.UsageCoreNanoSeconds, container.CPU.UsageCoreNanoSeconds)
+		}
+		if container.Memory != nil {
+			memory = true
+			containerStats.Memory = &stats.MemoryStats{
+				Time:            measured,
+				UsageBytes:      container.Memory.UsageBytes,
+				WorkingSetBytes: container.Memory.WorkingSetBytes,
+				RSSBytes:        container.Memory.RSSBytes,
+			}
+			addUsage(&podMemory.UsageBytes, container.Memory.UsageBytes)
+			addUsage(&podMemory.WorkingSetBytes, container.Memory.WorkingSetBytes)
+			addUsage(&podMemory.RSSBytes, container.Memory.RSSBytes)
+		}
+		if container.Filesystem != nil {
+			rootfs = true
+			containerStats.Rootfs = &stats.FsStats{
+				Time:           measured,
+				UsedBytes:      container.Filesystem.UsedBytes,
+				CapacityBytes:  container.Filesystem.CapacityBytes,
+				AvailableBytes: container.Filesystem.AvailableBytes,
+			}
+			addUsage(&podStorage.UsedBytes, container.Filesystem.UsedBytes)
+		}
+		podStats.Containers = append(podStats.Containers, containerStats)
+	}
+	if cpu {
+		podStats.CPU = podCPU
+	}
+	if memory {
+		podStats.Memory = podMemory
+	}
+	if rootfs {
+		podStats.EphemeralStorage = podStorage
+	}
+	if network := remote.Network; network != nil {
+		podStats.Network = &stats.NetworkStats{
+			Time: measured,
+			InterfaceStats: stats.InterfaceStats{
+				Name:     "eth0",
+				RxBytes:  network.RxBytes,
+				TxBytes:  network.TxBytes,
+				RxErrors: network.RxErrors,
+				TxErrors: network.TxErrors,
+			},
+		}
+	}
+	return podStats, len(podStats.Containers) > 0 || podStats.Network != nil
+}
+
+// addUsage adds value, when reported, to the total it points to.
+func addUsage(total **uint64, value *uint64) {
+	if value == nil {
+		return
+	}
+	if *total == nil {
+		*total = new(uint64)
+	}
+	**total += *value
+}
@@ -0,0 +1,103 @@
+package virtualkubelet
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sTypes "k8s.io/apimachinery/pkg/types"
+)
+
+func uint64Ptr(v uint64) *uint64 { return &v }
+
+func testStatsPod(uid string, phase v1.PodPhase, containers ...string) *v1.Pod {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "pod-" + uid,
+			Namespace:         "default",
+			UID:               k8sTypes.UID(uid),
+			CreationTimestamp: metav1.NewTime(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)),
+		},
+		Status: v1.PodStatus{Phase: phase},
+	}
+	for _, name := range containers {
+		pod.Spec.Containers = append(pod.Spec.Containers, v1.Container{Name: name})
+	}
+	return pod
+}
+
+func TestGetStatsSummary(t *testing.T) {
+	var calls atomic.Int32
+	measured := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	p := testExecProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		assert.Equal(t, "/stats", r.URL.Path)
+		var pods []*v1.Pod
+		body, _ := io.ReadAll(r.Body)
+		assert.NoError(t, json.Unmarshal(body, &pods))
+		var uids []k8sTypes.UID
+		for _, pod := range pods {
+			uids = append(uids, pod.UID)
+		}
+		assert.ElementsMatch(t, []k8sTypes.UID{"a", "b"}, uids, "only the running pods are asked for")
+		_ = json.NewEncoder(w).Encode([]types.PodStats{{
+			PodUID: "a",
+			Time:   measured,
+			Containers: []types.ContainerStats{
+				{Name: "main", CPU: &types.CPUStats{UsageNanoCores: uint64Ptr(200)}, Memory: &types.MemoryStats{WorkingSetBytes: uint64Ptr(1024)}},
+				{Name: "sidecar", CPU: &types.CPUStats{UsageNanoCores: uint64Ptr(50)}, Filesystem: &types.FilesystemStats{UsedBytes: uint64Ptr(10)}},
+				{Name: "empty"},
+				{Name: "unknown", CPU: &types.CPUStats{UsageNanoCores: uint64Ptr(1)}},
+			},
+			Network: &types.NetworkStats{RxBytes: uint64Ptr(7)},
+		}})
+	})
+	p.pods = map[string]*v1.Pod{
+		"a": testStatsPod("a", v1.PodRunning, "main", "sidecar", "empty"),
+		"b": testStatsPod("b", v1.PodRunning, "main"),
+		"c": testStatsPod("c", v1.PodSucceeded, "main"),
+	}
+
+	summary, err := p.GetStatsSummary(t.Context())
+	require.NoError(t, err)
+	require.Len(t, summary.Pods, 1, "the pods without usage are left out")
+	pod := summary.Pods[0]
+	assert.Equal(t, "pod-a", pod.PodRef.Name)
+	require.Len(t, pod.Containers, 2, "the containers without usage are left out")
+	assert.Equal(t, "main", pod.Containers[0].Name)
+	assert.Equal(t, uint64(200), *pod.Containers[0].CPU.UsageNanoCores)
+	assert.Equal(t, uint64(1024), *pod.Containers[0].Memory.WorkingSetBytes)
+	assert.Nil(t, pod.Containers[1].Memory)
+	assert.Equal(t, uint64(10), *pod.Containers[1].Rootfs.UsedBytes)
+	assert.True(t, pod.CPU.Time.Time.Equal(measured))
+	assert.Equal(t, uint64(250), *pod.CPU.UsageNanoCores)
+	assert.Nil(t, pod.CPU.UsageCoreNanoSeconds)
+	assert.Equal(t, uint64(1024), *pod.Memory.WorkingSetBytes)
+	assert.Nil(t, pod.Memory.UsageBytes)
+	assert.Equal(t, uint64(10), *pod.EphemeralStorage.UsedBytes)
+	assert.Equal(t, uint64(7), *pod.Network.RxBytes)
+
+	// the usage is cached
+	_, err = p.GetStatsSummary(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestGetStatsSummary_InterLinkDown(t *testing.T) {
+	p := testExecProvider(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	p.pods = map[string]*v1.Pod{"a": testStatsPod("a", v1.PodRunning, "main")}
+
+	summary, err := p.GetStatsSummary(t.Context())
+	require.NoError(t, err)
+	assert.Empty(t, summary.Pods)
+}
@@ -0,0 +1,209 @@
+package virtualkubelet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/containerd/containerd/log"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+)
+
+// ValidatePod checks whether a pod can be offloaded, without creating it. The Virtual Kubelet
+// checks the volumes it resolves itself, as remoteExecutionHandleVolumes would, then asks
+// interLink, which runs its own checks and the ones of the plugin. Only the containers that
+// would be offloaded are considered.
+func (p *Provider) ValidatePod(ctx context.Context, pod *v1.Pod) (types.ValidationResponse, error) {
+	podToOffload := pod.DeepCopy()
+	podToOffload.Spec.Containers = getOffloadContainers(pod)
+	podToOffload.Spec.InitContainers = getOffloadInitContainers(pod)
+
+	findings := p.validateVolumes(ctx, podToOffload)
+	remote, err := validateRequest(ctx, p.config, podToOffload)
+	if err != nil {
+		return types.ValidationResponse{}, err
+	}
+	return types.NewValidationResponse(append(findings, remote.Findings...)), nil
+}
+
+// validateVolumes reports the volumes and the volume sources the Virtual Kubelet would skip,
+// and the ConfigMaps and Secrets the create would wait for.
+func (p *Provider) validateVolumes(ctx context.Context, pod *v1.Pod) []types.ValidationFinding {
+	var findings []types.ValidationFinding
+	finding := func(severity, field, message string) {
+		findings = append(findings, types.ValidationFinding{
+			Severity: severity, Field: field, Message: message, Source: types.ValidationSourceVirtualKubelet,
+		})
+	}
+
+	for i, volume := range pod.Spec.Volumes {
+		field := fmt.Sprintf("spec.volumes[%d]", i)
+		switch {
+		case volume.ConfigMap != nil:
+			if msg := p.missingObject(ctx, pod.Namespace, "ConfigMap", volume.ConfigMap.Name, volume.ConfigMap.Optional); msg != "" {
+				finding(types.ValidationWarning, field+".configMap", msg)
+			}
+		case volume.Secret != nil:
+			if msg := p.missingObject(ctx, pod.Namespace, "Secret", volume.Secret.SecretName, volume.Secret.Optional); msg != "" {
+				finding(types.ValidationWarning, field+".secret", msg)
+			}
+		case volume.Projected != nil && p.config.DisableProjectedVolumes,
+			volume.DownwardAPI != nil && p.config.DisableProjectedVolumes:
+			finding(types.ValidationIgnored, field, fmt.Sprintf("volume %q: projected and downwardAPI volumes are disabled (DisableProjectedVolumes)", volume.Name))
+		case volume.Projected != nil:
+			for j, source := range volume.Projected.Sources {
+				sourceField := fmt.Sprintf("%s.projected.sources[%d]", field, j)
+				switch {
+				case source.ServiceAccountToken != nil:
+				case source.ConfigMap != nil:
+					if source.ConfigMap.Name == "kube-root-ca.crt" {
+						continue
+					}
+					if msg := p.missingObject(ctx, pod.Namespace, "ConfigMap", source.ConfigMap.Name, source.ConfigMap.Optional); msg != "" {
+						finding(types.ValidationError, sourceField+".configMap", msg+": the create would fail")
+					}
+				case source.DownwardAPI != nil:
+					for _, item := range validateDownwardAPIItems(pod, source.DownwardAPI.Items) {
+						finding(types.ValidationIgnored, sourceField+".downwardAPI."+item.field, item.message)
+					}
+				default:
+					finding(types.ValidationIgnored, sourceField, fmt.Sprintf("volume %q: only serviceAccountToken, configMap and downwardAPI projected sources are supported", volume.Name))
+				}
+			}
+		case volume.DownwardAPI != nil:
+			for _, item := range validateDownwardAPIItems(pod, volume.DownwardAPI.Items) {
+				finding(types.ValidationIgnored, field+".downwardAPI."+item.field, item.message)
+			}
+		}
+	}
+	return findings
+}
+
+type downwardAPIFinding struct {
+	field   string
+	message string
+}
+
+// validateDownwardAPIItems reports the downward API items populateProjectedVolumeFromDownwardAPI skips.
+func validateDownwardAPIItems(pod *v1.Pod, items []v1.DownwardAPIVolumeFile) []downwardAPIFinding {
+	var findings []downwardAPIFinding
+	for i, item := range items {
+		field := fmt.Sprintf("items[%d]", i)
+		switch {
+		case item.FieldRef != nil:
+			if _, ok := resolveDownwardAPIFieldPath(pod, item.FieldRef.FieldPath); !ok {
+				findings = append(findings, downwardAPIFinding{field + ".fieldRef", fmt.Sprintf("unsupported fieldPath %s, %s would not be written", item.FieldRef.FieldPath, item.Path)})
+			}
+		case item.ResourceFieldRef != nil:
+			findings = append(findings, downwardAPIFinding{field + ".resourceFieldRef", fmt.Sprintf("resourceFieldRef is not supported, %s would not be written", item.Path)})
+		}
+	}
+	return findings
+}
+
+// missingObject tells why a ConfigMap or Secret referenced by a volume would not be found,
+// or returns an empty string when it exists or is optional.
+func (p *Provider) missingObject(ctx context.Context, namespace, kind, name string, optional *bool) string {
+	if optional != nil && *optional {
+		return ""
+	}
+	var err error
+	if kind == "Secret" {
+		_, err = p.clientSet.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	} else {
+		_, err = p.clientSet.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	}
+	switch {
+	case err == nil:
+		return ""
+	case apierrors.IsNotFound(err):
+		return fmt.Sprintf("%s %s/%s not found, the create waits for it for up to 5 minutes", kind, namespace, name)
+	default:
+		return fmt.Sprintf("unable to check %s %s/%s: %v", kind, namespace, name, err)
+	}
+}
+
+// validateRequest asks interLink to validate a pod.
+func validateRequest(ctx context.Context, config Config, pod *v1.Pod) (types.ValidationResponse, error) {
+	var response types.ValidationResponse
+	token := ""
+	if config.VKTokenFile != "" {
+		b, err := os.ReadFile(config.VKTokenFile)
+		if err != nil {
+			return response, err
+		}
+		token = string(b)
+	}
+
+	bodyBytes, err := json.Marshal(pod)
+	if err != nil {
+		return response, err
+	}
+	interLinkEndpoint := getSidecarEndpoint(ctx, config.InterlinkURL, config.InterlinkPort)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, interLinkEndpoint+"/validate", bytes.NewReader(bodyBytes))
+	if err != nil {
+		return response, err
+	}
+	AddSessionContext(req, "ValidatePod#"+string(pod.UID))
+
+	httpClient, err := newInterLinkClient(ctx, config)
+	if err != nil {
+		return response, err
+	}
+	resp, err := doRequestWithClient(req, token, httpClient)
+	if err != nil {
+		return response, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return response, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return response, fmt.Errorf("interLink validation failed with status code %d: %s", resp.StatusCode, body)
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return response, fmt.Errorf("invalid interLink validation response: %w", err)
+	}
+	return response, nil
+}
+
+// ValidateHandler serves ValidatePod on the /validate endpoint of the Virtual Kubelet, for CI
+// pipelines and admission tooling to reject the pods that cannot be offloaded before they are
+// scheduled. The request body is the pod; the response is a ValidationResponse. Pods without
+// namespace are checked in the default namespace.
+func (p *Provider) ValidateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var pod v1.Pod
+	if err := json.NewDecoder(r.Body).Decode(&pod); err != nil {
+		http.Error(w, "invalid pod: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if pod.Namespace == "" {
+		pod.Namespace = metav1.NamespaceDefault
+	}
+
+	response, err := p.ValidatePod(r.Context(), &pod)
+	if err != nil {
+		log.G(r.Context()).Error("Unable to validate pod ", pod.Namespace, "/", pod.Name, ": ", err)
+		http.Error(w, "unable to validate the pod: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.G(r.Context()).Error(err)
+	}
+}
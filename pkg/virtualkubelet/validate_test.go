@@ -0,0 +1,95 @@
+package virtualkubelet
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testValidateProvider(t *testing.T, handler http.HandlerFunc) *Provider {
+	t.Helper()
+	return &Provider{
+		config: newTestInterLinkServer(t, handler),
+		clientSet: fake.NewSimpleClientset(&v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "present", Namespace: metav1.NamespaceDefault},
+		}),
+	}
+}
+
+func TestValidateHandler_MergesFindings(t *testing.T) {
+	p := testValidateProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/validate", r.URL.Path)
+		var pod v1.Pod
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&pod))
+		assert.Equal(t, metav1.NamespaceDefault, pod.Namespace)
+		_ = json.NewEncoder(w).Encode(types.NewValidationResponse([]types.ValidationFinding{{
+			Severity: types.ValidationError,
+			Field:    "spec.volumes[3].persistentVolumeClaim",
+			Message:  "not supported",
+			Source:   types.ValidationSourceInterLink,
+		}}))
+	})
+
+	pod := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod"},
+		Spec: v1.PodSpec{Volumes: []v1.Volume{
+			{Name: "present", VolumeSource: v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{
+				LocalObjectReference: v1.LocalObjectReference{Name: "present"},
+			}}},
+			{Name: "missing", VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: "missing"}}},
+			{Name: "labels", VolumeSource: v1.VolumeSource{DownwardAPI: &v1.DownwardAPIVolumeSource{Items: []v1.DownwardAPIVolumeFile{
+				{Path: "labels", FieldRef: &v1.ObjectFieldSelector{FieldPath: "metadata.labels"}},
+				{Path: "cpu", ResourceFieldRef: &v1.ResourceFieldSelector{Resource: "limits.cpu"}},
+			}}}},
+			{Name: "data", VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "data"}}},
+		}},
+	}
+	body, err := json.Marshal(pod)
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	p.ValidateHandler(rec, httptest.NewRequest(http.MethodPost, "/validate", bytes.NewReader(body)))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var response types.ValidationResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.False(t, response.Valid)
+	require.Len(t, response.Findings, 3)
+	assert.Equal(t, types.ValidationFinding{
+		Severity: types.ValidationWarning,
+		Field:    "spec.volumes[1].secret",
+		Message:  "Secret default/missing not found, the create waits for it for up to 5 minutes",
+		Source:   types.ValidationSourceVirtualKubelet,
+	}, response.Findings[0])
+	assert.Equal(t, "spec.volumes[2].downwardAPI.items[1].resourceFieldRef", response.Findings[1].Field)
+	assert.Equal(t, types.ValidationIgnored, response.Findings[1].Severity)
+	assert.Equal(t, types.ValidationSourceInterLink, response.Findings[2].Source)
+}
+
+func TestValidateHandler_Errors(t *testing.T) {
+	p := testValidateProvider(t, func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+
+	rec := httptest.NewRecorder()
+	p.ValidateHandler(rec, httptest.NewRequest(http.MethodPost, "/validate", strings.NewReader("not a pod")))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	p.ValidateHandler(rec, httptest.NewRequest(http.MethodPost, "/validate", strings.NewReader(`{"metadata":{"name":"pod"}}`)))
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+
+	rec = httptest.NewRecorder()
+	p.ValidateHandler(rec, httptest.NewRequest(http.MethodGet, "/validate", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -17,6 +17,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"text/template"
 	"time"
 
@@ -140,6 +141,10 @@ type Provider struct {
 	clientSet            kubernetes.Interface
 	clientHTTPTransport  *http.Transport
 	podIPs               []string
+	watchConnected       atomic.Bool
+	watchLost            chan struct{}
+	stats                statsCache
+	resourceMetrics      resourceMetrics
 }
 
 // Increment the given IP address
@@ -512,6 +517,7 @@ func NewProviderConfig(
 		config:              config,
 		startTime:           time.Now(),
 		clientHTTPTransport: clientHTTPTransport,
+		watchLost:           make(chan struct{}, 1),
 	}
 
 	return &provider, nil
@@ -641,6 +647,7 @@ func (p *Provider) nodeUpdate(ctx context.Context) {
 				p.node.Annotations = make(map[string]string)
 			}
 			p.node.Annotations["interlink.virtual-kubelet.io/ping-response"] = ""
+			p.resourceMetrics.recordNodeUsage(ctx, nil)
 			p.onNodeChangeCallback(p.node)
 			log.G(ctx).Error("Ping Failed with exit code: ", code)
 			log.G(ctx).Error("Error: ", err)
@@ -662,6 +669,7 @@ func (p *Provider) nodeUpdate(ctx context.Context) {
 			if respBody != "" {
 				var pingResp types.PingResponse
 				if err := json.Unmarshal([]byte(respBody), &pingResp); err == nil {
+					p.resourceMetrics.recordNodeUsage(ctx, pingResp.Resources)
 					if pingResp.Resources != nil {
 						p.updateNodeResources(ctx, pingResp.Resources)
 					}
@@ -2066,6 +2074,9 @@ func (p *Provider) GetPods(ctx context.Context) ([]*v1.Pod, error) {
 	p.podsMu.RUnlock()
 
 	go p.statusLoop(ctx)
+	if !p.config.DisableStatusWatch {
+		go p.watchLoop(ctx)
+	}
 	return pods, nil
 }
 
@@ -2074,20 +2085,55 @@ func (p *Provider) NotifyPods(_ context.Context, f func(*v1.Pod)) {
 	p.notifier = f
 }
 
+// statusLoopInterval returns the configured interval between two pod status updates.
+// While the status stream is connected, polling only acts as a periodic resync.
+func (p *Provider) statusLoopInterval() time.Duration {
+	if p.watchConnected.Load() {
+		if p.config.StatusResyncIntervalSeconds > 0 {
+			return time.Duration(p.config.StatusResyncIntervalSeconds) * time.Second
+		}
+		return DefaultStatusResyncIntervalSeconds * time.Second
+	}
+	if p.config.StatusLoopIntervalSeconds > 0 {
+		return time.Duration(p.config.StatusLoopIntervalSeconds) * time.Second
+	}
+	return DefaultStatusLoopIntervalSeconds * time.Second
+}
+
+// statusBatches splits pods into slices of at most the configured StatusBatchSize pods.
+func (p *Provider) statusBatches(pods []*v1.Pod) [][]*v1.Pod {
+	size := p.config.StatusBatchSize
+	if size <= 0 {
+		size = DefaultStatusBatchSize
+	}
+
+	batches := make([][]*v1.Pod, 0, (len(pods)+size-1)/size)
+	for size < len(pods) {
+		pods, batches = pods[size:], append(batches, pods[:size])
+	}
+	if len(pods) > 0 {
+		batches = append(batches, pods)
+	}
+	return batches
+}
+
 // statusLoop preiodically monitoring the status of all the pods in p.pods
 func (p *Provider) statusLoop(ctx context.Context) {
-	t := time.NewTimer(5 * time.Second)
+	t := time.NewTimer(p.statusLoopInterval())
 	if !t.Stop() {
 		<-t.C
 	}
 
 	for {
 		log.G(ctx).Info("statusLoop")
-		t.Reset(5 * time.Second)
+		t.Reset(p.statusLoopInterval())
 		select {
 		case <-ctx.Done():
 			return
 		case <-t.C:
+		case <-p.watchLost:
+			// the status stream went down: poll right away, events may have been missed
+			t.Stop()
 		}
 
 		p.podIPs = []string{}
@@ -2125,19 +2171,24 @@ func (p *Provider) statusLoop(ctx context.Context) {
 		}
 		p.podsMu.RUnlock()
 
+		var podsToCheck []*v1.Pod
 		for _, pod := range podsCopy {
-			if pod.Status.Phase != "Initializing" {
-				// Skip re-querying remote for pods already in a terminal state.
-				if pod.Status.Phase == v1.PodFailed || pod.Status.Phase == v1.PodSucceeded {
-					continue
-				}
-				_, err := checkPodsStatus(ctx, p, pod, token, p.config)
-				if err != nil {
-					log.G(ctx).Error(err)
-				}
-				// Use a fresh snapshot of the canonical pod (updated by checkPodsStatus
-				// under podsMu.Lock) rather than the pre-snapshot deep copy, so the
-				// notifier sees the latest status.
+			// Skip pods still being created and pods already in a terminal state.
+			if pod.Status.Phase == "Initializing" || pod.Status.Phase == v1.PodFailed || pod.Status.Phase == v1.PodSucceeded {
+				continue
+			}
+			podsToCheck = append(podsToCheck, pod)
+		}
+
+		for _, batch := range p.statusBatches(podsToCheck) {
+			_, err := checkPodsStatus(ctx, p, batch, token, p.config)
+			if err != nil {
+				log.G(ctx).Error(err)
+			}
+			// Use a fresh snapshot of the canonical pods (updated by checkPodsStatus
+			// under podsMu.Lock) rather than the pre-snapshot deep copies, so the
+			// notifier sees the latest status.
+			for _, pod := range batch {
 				p.podsMu.RLock()
 				canonical, exists := p.pods[string(pod.UID)]
 				var notifyPod *v1.Pod
@@ -2203,19 +2254,17 @@ func (p *Provider) GetLogs(ctx context.Context, namespace, podName, containerNam
 	return LogRetrieval(ctx, p.config, logsRequest, p.clientHTTPTransport, sessionContext)
 }
 
-// GetStatsSummary returns dummy stats for all pods known by this provider.
+// GetStatsSummary returns the resource usage of the pods known by this provider, as reported by
+// their plugins. The pods and containers the plugins report nothing for are left out.
 func (p *Provider) GetStatsSummary(ctx context.Context) (*stats.Summary, error) {
 	start := time.Now().Unix()
 	tracer := otel.Tracer("interlink-service")
-	_, span := tracer.Start(ctx, "GetStatsSummaryVK", trace.WithAttributes(
+	ctx, span := tracer.Start(ctx, "GetStatsSummaryVK", trace.WithAttributes(
 		attribute.Int64("start.timestamp", start),
 	))
 	defer span.End()
 	defer types.SetDurationSpan(start, span)
 
-	// Grab the current timestamp so we can report it as the time the stats were generated.
-	time := metav1.NewTime(time.Now())
-
 	// Create the Summary object that will later be populated with node and pod stats.
 	res := &stats.Summary{}
 
@@ -2225,7 +2274,6 @@ func (p *Provider) GetStatsSummary(ctx context.Context) (*stats.Summary, error)
 		StartTime: metav1.NewTime(p.startTime),
 	}
 
-	// Populate the Summary object with dummy stats for each pod known by this provider.
 	p.podsMu.RLock()
 	podsCopy := make([]*v1.Pod, 0, len(p.pods))
 	for _, pod := range p.pods {
@@ -2233,62 +2281,18 @@ func (p *Provider) GetStatsSummary(ctx context.Context) (*stats.Summary, error)
 	}
 	p.podsMu.RUnlock()
 
+	remoteStats := p.podStats(ctx, podsCopy)
 	for _, pod := range podsCopy {
-		var (
-			// totalUsageNanoCores will be populated with the sum of the values of UsageNanoCores computes across all containers in the pod.
-			totalUsageNanoCores uint64
-			// totalUsageBytes will be populated with the sum of the values of UsageBytes computed across all containers in the pod.
-			totalUsageBytes uint64
-		)
-
-		// Create a PodStats object to populate with pod stats.
-		pss := stats.PodStats{
-			PodRef: stats.PodReference{
-				Name:      pod.Name,
-				Namespace: pod.Namespace,
-				UID:       string(pod.UID),
-			},
-			StartTime: pod.CreationTimestamp,
-		}
-
-		// Iterate over all containers in the current pod to compute dummy stats.
-		for _, container := range pod.Spec.Containers {
-			// Grab a dummy value to be used as the total CPU usage.
-			// The value should fit a uint32 in order to avoid overflows later on when computing pod stats.
-			dummyUsageNanoCores := uint64(9999)
-			totalUsageNanoCores += dummyUsageNanoCores
-			// Create a dummy value to be used as the total RAM usage.
-			// The value should fit a uint32 in order to avoid overflows later on when computing pod stats.
-			dummyUsageBytes := uint64(9999)
-			totalUsageBytes += dummyUsageBytes
-			// Append a ContainerStats object containing the dummy stats to the PodStats object.
-			pss.Containers = append(pss.Containers, stats.ContainerStats{
-				Name:      container.Name,
-				StartTime: pod.CreationTimestamp,
-				CPU: &stats.CPUStats{
-					Time:           time,
-					UsageNanoCores: &dummyUsageNanoCores,
-				},
-				Memory: &stats.MemoryStats{
-					Time:       time,
-					UsageBytes: &dummyUsageBytes,
-				},
-			})
-		}
-
-		// Populate the CPU and RAM stats for the pod and append the PodsStats object to the Summary object to be returned.
-		pss.CPU = &stats.CPUStats{
-			Time:           time,
-			UsageNanoCores: &totalUsageNanoCores,
+		remote, ok := remoteStats[string(pod.UID)]
+		if !ok {
+			continue
 		}
-		pss.Memory = &stats.MemoryStats{
-			Time:       time,
-			UsageBytes: &totalUsageBytes,
+		if pss, ok := summaryPodStats(pod, remote); ok {
+			res.Pods = append(res.Pods, pss)
 		}
-		res.Pods = append(res.Pods, pss)
 	}
+	span.SetAttributes(attribute.Int("pods.count", len(res.Pods)))
 
-	// Return the dummy stats.
 	return res, nil
 }
 
@@ -0,0 +1,189 @@
+package virtualkubelet
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/log"
+	v1 "k8s.io/api/core/v1"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+)
+
+const (
+	watchMinBackoff = 1 * time.Second
+	watchMaxBackoff = 60 * time.Second
+	// watchIdleTimeout closes a stream that stayed silent for too long. interLink sends
+	// a heartbeat every 15 seconds by default, so a healthy stream is never idle that long.
+	watchIdleTimeout = 60 * time.Second
+)
+
+// errWatchUnsupported is returned when the interLink API does not expose the /watch endpoint.
+var errWatchUnsupported = errors.New("the interLink API does not support status watch")
+
+// watchLoop keeps a /watch stream open towards interLink and applies the received pod statuses.
+// The stream is reopened with an exponential backoff when it breaks. While it is down, statusLoop
+// falls back to polling at the regular StatusLoopIntervalSeconds pace.
+func (p *Provider) watchLoop(ctx context.Context) {
+	backoff := watchMinBackoff
+	for {
+		connectedAt := time.Now()
+		err := p.watchStatuses(ctx)
+		if p.watchConnected.Swap(false) {
+			select {
+			case p.watchLost <- struct{}{}:
+			default:
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, errWatchUnsupported) {
+			log.G(ctx).Info("interLink does not support the status watch, falling back to polling only")
+			return
+		}
+		log.G(ctx).Warning("Status watch interrupted, polling until it is restored: ", err)
+
+		if time.Since(connectedAt) > watchMaxBackoff {
+			backoff = watchMinBackoff
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, watchMaxBackoff)
+	}
+}
+
+// watchStatuses opens a single /watch stream and consumes it until it breaks.
+func (p *Provider) watchStatuses(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	token := ""
+	if p.config.VKTokenFile != "" {
+		b, err := os.ReadFile(p.config.VKTokenFile) // just pass the file name
+		if err != nil {
+			return err
+		}
+		token = string(b)
+	}
+
+	interLinkEndpoint := getSidecarEndpoint(ctx, p.config.InterlinkURL, p.config.InterlinkPort)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, interLinkEndpoint+"/watch", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	AddSessionContext(req, "Watch#"+strconv.Itoa(rand.Intn(100000)))
+
+	httpClient, err := newInterLinkClient(ctx, p.config)
+	if err != nil {
+		return fmt.Errorf("failed to create TLS HTTP client: %w", err)
+	}
+
+	resp, err := doRequestWithClient(req, token, httpClient)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+		return errWatchUnsupported
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, body)
+	}
+
+	log.G(ctx).Info("Status watch connected to ", interLinkEndpoint)
+	p.watchConnected.Store(true)
+
+	// Cancelling the request context is the only way to unblock a read on a silent stream.
+	idle := time.AfterFunc(watchIdleTimeout, cancel)
+	defer idle.Stop()
+
+	return readStatusEvents(resp.Body, func() { idle.Reset(watchIdleTimeout) }, func(event types.PodStatusEvent) {
+		p.handleStatusEvent(ctx, event, token)
+	})
+}
+
+// readStatusEvents parses a Server-Sent Events stream of PodStatusEvents. alive is called
+// for every received line, heartbeats included, and handle for every complete event.
+func readStatusEvents(r io.Reader, alive func(), handle func(types.PodStatusEvent)) error {
+	reader := bufio.NewReader(r)
+	var data []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return errors.New("stream closed by interLink")
+			}
+			return err
+		}
+		alive()
+
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "":
+			if len(data) == 0 {
+				continue
+			}
+			var event types.PodStatusEvent
+			if err := json.Unmarshal([]byte(strings.Join(data, "\n")), &event); err != nil {
+				log.L.Warning("Ignoring malformed status event: ", err)
+			} else {
+				handle(event)
+			}
+			data = data[:0]
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+		// comments (heartbeats) and the other SSE fields carry nothing we need
+	}
+}
+
+// handleStatusEvent applies a status received from the stream to the matching pod, if the
+// provider still holds it, and notifies the virtual kubelet of the change.
+func (p *Provider) handleStatusEvent(ctx context.Context, event types.PodStatusEvent, token string) {
+	if event.Type != types.PodStatusEventModified {
+		// deletions are driven by the virtual kubelet itself
+		return
+	}
+
+	p.podsMu.RLock()
+	pod, exists := p.pods[event.Status.PodUID]
+	skip := !exists || pod.Status.Phase == "Initializing"
+	p.podsMu.RUnlock()
+	if skip {
+		return
+	}
+
+	if err := applyPodStatus(ctx, p, event.Status, token, p.config); err != nil {
+		log.G(ctx).Warning("Unable to apply the status of pod ", event.Status.PodNamespace, "/", event.Status.PodName, ": ", err)
+		return
+	}
+
+	p.podsMu.RLock()
+	canonical, exists := p.pods[event.Status.PodUID]
+	var notifyPod *v1.Pod
+	if exists {
+		notifyPod = canonical.DeepCopy()
+	}
+	p.podsMu.RUnlock()
+	if notifyPod != nil {
+		p.asyncUpdate(ctx, notifyPod)
+	}
+}
@@ -0,0 +1,114 @@
+package virtualkubelet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	types "github.com/interlink-hq/interlink/pkg/interlink"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sTypes "k8s.io/apimachinery/pkg/types"
+)
+
+func TestReadStatusEvents(t *testing.T) {
+	stream := ": heartbeat\n\n" +
+		"event: MODIFIED\ndata: {\"type\":\"MODIFIED\",\"status\":{\"UID\":\"a\"}}\n\n" +
+		"data: not json\n\n" +
+		"event: DELETED\r\ndata: {\"type\":\"DELETED\",\r\ndata: \"status\":{\"UID\":\"b\"}}\r\n\r\n"
+
+	var events []types.PodStatusEvent
+	lines := 0
+	err := readStatusEvents(strings.NewReader(stream), func() { lines++ }, func(event types.PodStatusEvent) {
+		events = append(events, event)
+	})
+	require.Error(t, err)
+	assert.Equal(t, 11, lines)
+	require.Len(t, events, 2)
+	assert.Equal(t, types.PodStatusEventModified, events[0].Type)
+	assert.Equal(t, "a", events[0].Status.PodUID)
+	assert.Equal(t, types.PodStatusEventDeleted, events[1].Type)
+	assert.Equal(t, "b", events[1].Status.PodUID)
+}
+
+func testWatchProvider(t *testing.T, handler http.HandlerFunc) *Provider {
+	t.Helper()
+	return &Provider{
+		config:    newTestInterLinkServer(t, handler),
+		pods:      map[string]*v1.Pod{},
+		notifier:  func(*v1.Pod) {},
+		watchLost: make(chan struct{}, 1),
+	}
+}
+
+func TestWatchStatuses_AppliesStreamedStatuses(t *testing.T) {
+	p := testWatchProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/watch", r.URL.Path)
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, uid := range []string{"uid-a", "uid-unknown"} {
+			data, _ := json.Marshal(types.PodStatusEvent{Type: types.PodStatusEventModified, Status: types.PodStatus{
+				PodName:      strings.TrimPrefix(uid, "uid-"),
+				PodUID:       uid,
+				PodNamespace: testNamespace,
+				Containers: []v1.ContainerStatus{{
+					Name:  "main",
+					State: v1.ContainerState{Running: &v1.ContainerStateRunning{}},
+				}},
+			}})
+			fmt.Fprintf(w, "event: MODIFIED\ndata: %s\n\n", data)
+		}
+	})
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: testNamespace, UID: k8sTypes.UID("uid-a")},
+		Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "main"}}},
+		Status:     v1.PodStatus{Phase: v1.PodPending},
+	}
+	p.pods[string(pod.UID)] = pod
+	var notified []string
+	p.notifier = func(pod *v1.Pod) { notified = append(notified, pod.Name) }
+
+	err := p.watchStatuses(context.Background())
+	require.Error(t, err, "the stream ends when the server closes it")
+	assert.True(t, p.watchConnected.Load())
+	assert.Equal(t, v1.PodRunning, p.pods["uid-a"].Status.Phase)
+	assert.Equal(t, []string{"a"}, notified)
+}
+
+func TestWatchLoop_StopsWhenUnsupported(t *testing.T) {
+	requests := 0
+	p := testWatchProvider(t, func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		p.watchLoop(context.Background())
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("watchLoop kept retrying on a server without /watch")
+	}
+	assert.Equal(t, 1, requests)
+	assert.False(t, p.watchConnected.Load())
+}
+
+func TestStatusLoopInterval_ResyncWhileWatching(t *testing.T) {
+	p := &Provider{config: Config{StatusLoopIntervalSeconds: 2}}
+	assert.Equal(t, 2*time.Second, p.statusLoopInterval())
+
+	p.watchConnected.Store(true)
+	assert.Equal(t, DefaultStatusResyncIntervalSeconds*time.Second, p.statusLoopInterval())
+
+	p.config.StatusResyncIntervalSeconds = 30
+	assert.Equal(t, 30*time.Second, p.statusLoopInterval())
+}